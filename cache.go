@@ -0,0 +1,211 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+	"github.com/spf13/cobra"
+)
+
+const defaultCacheMaxAge = 30 * 24 * time.Hour
+
+// metadataCache stores extracted metadata between runs, nil with --no-cache.
+var metadataCache *resultCache
+
+// resultCache is an on-disk cache of nombra.Metadata. Entries are keyed by
+// everything that influences the model's answer, so a --dry-run followed by a
+// real run costs a single API call.
+type resultCache struct {
+	dir string
+}
+
+type cacheEntry struct {
+	Key      string          `json:"key"`
+	Created  time.Time       `json:"created"`
+	Provider string          `json:"provider"`
+	Model    string          `json:"model"`
+	Metadata nombra.Metadata `json:"metadata"`
+	// Signature is the MinHash signature of the extracted text, kept so that
+	// cached files still take part in near-duplicate detection.
+	Signature []uint64 `json:"signature,omitempty"`
+	// Method and OCRConfidence describe how the text was extracted, so that
+	// the confidence of cached metadata can be scored again.
+	Method        string  `json:"method,omitempty"`
+	OCRConfidence float64 `json:"ocr_confidence,omitempty"`
+}
+
+func cacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "nombra"), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine cache directory: %w", err)
+	}
+	return filepath.Join(dir, "nombra"), nil
+}
+
+func newResultCache() (*resultCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &resultCache{dir: filepath.Join(dir, "metadata")}, nil
+}
+
+// cacheKey combines the PDF content hash with the settings that affect the
+// result: the model and its prompts and fields, and how the text is read.
+func cacheKey(contentHash string) string {
+	opts := namer.Options()
+	settings := []string{
+		contentHash, providerName, opts.BaseURL, model, namer.PromptVersion(), strconv.Itoa(maxContentLength),
+		opts.ReasoningEffort, strconv.FormatBool(opts.ForceOCR), strconv.Itoa(opts.MinContentLength),
+		fmt.Sprint(opts.VisionPages), opts.VisionModel, opts.VisionDetail, strconv.Itoa(opts.VisionMaxSize),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(settings, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *resultCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c *resultCache) get(key string) (cacheEntry, bool) {
+	raw, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil || entry.Key != key {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put writes the entry through a temporary file so concurrent workers never
+// observe a partially written entry.
+func (c *resultCache) put(key string, metadata nombra.Metadata, content nombra.Content, signature []uint64) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	raw, err := json.Marshal(cacheEntry{
+		Key:           key,
+		Created:       time.Now().UTC(),
+		Provider:      providerName,
+		Model:         model,
+		Metadata:      metadata,
+		Signature:     signature,
+		Method:        content.Method,
+		OCRConfidence: content.OCRConfidence,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// prune removes entries last written before the cutoff and returns how many
+// were deleted.
+func (c *resultCache) prune(cutoff time.Time) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the metadata cache",
+	}
+
+	var olderThan time.Duration
+	var all bool
+	prune := &cobra.Command{
+		Use:     "prune",
+		Short:   "Delete old cache entries",
+		Example: "nombra cache prune\n  nombra cache prune --older-than 168h\n  nombra cache prune --all",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cache, err := newResultCache()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			cutoff := time.Now().Add(-olderThan)
+			if all {
+				cutoff = time.Now().Add(time.Minute)
+			}
+			removed, err := cache.prune(cutoff)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Removed %d cache entries from %s\n", removed, cache.dir)
+		},
+	}
+	prune.Flags().DurationVar(&olderThan, "older-than", defaultCacheMaxAge, "Remove entries older than this")
+	prune.Flags().BoolVar(&all, "all", false, "Remove every entry")
+
+	cmd.AddCommand(prune)
+	return cmd
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+func TestResultCacheRoundTrip(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	useTestNamer(t, nombra.Options{})
+	cache, err := newResultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := cacheKey("content-hash")
+	if _, ok := cache.get(key); ok {
+		t.Fatalf("empty cache returned an entry")
+	}
+
+	want := nombra.Metadata{Date: "2024.01.15", DocumentType: "Invoice", Organization: "ACME"}
+	if err := cache.put(key, want, nombra.Content{}, []uint64{1, 2, 3}); err != nil {
+		t.Fatalf("put returned error: %v", err)
+	}
+	got, ok := cache.get(key)
+	if !ok || !reflect.DeepEqual(got.Metadata, want) || len(got.Signature) != 3 {
+		t.Fatalf("get() = %+v, %v; want %+v", got, ok, want)
+	}
+
+	removed, err := cache.prune(time.Now().Add(-time.Hour))
+	if err != nil || removed != 0 {
+		t.Fatalf("prune of fresh entries = %d, %v; want 0", removed, err)
+	}
+	removed, err = cache.prune(time.Now().Add(time.Hour))
+	if err != nil || removed != 1 {
+		t.Fatalf("prune of all entries = %d, %v; want 1", removed, err)
+	}
+	if _, ok := cache.get(key); ok {
+		t.Fatalf("pruned entry still returned")
+	}
+}
+
+func TestCacheKeyDependsOnSettings(t *testing.T) {
+	savedModel, savedLength := model, maxContentLength
+	defer func() { model, maxContentLength = savedModel, savedLength }()
+	useTestNamer(t, nombra.Options{})
+
+	model, maxContentLength = "gpt-5.4", 3000
+	base := cacheKey("content-hash")
+
+	model = "gpt-5-mini"
+	if cacheKey("content-hash") == base {
+		t.Errorf("cache key ignores the model")
+	}
+
+	model, maxContentLength = "gpt-5.4", 5000
+	if cacheKey("content-hash") == base {
+		t.Errorf("cache key ignores the max content length")
+	}
+
+	maxContentLength = 3000
+	if cacheKey("other-hash") == base {
+		t.Errorf("cache key ignores the content hash")
+	}
+
+	useTestNamer(t, nombra.Options{Fields: []nombra.Field{{Name: "invoice_number", Description: "Invoice number"}}})
+	if cacheKey("content-hash") == base {
+		t.Errorf("cache key ignores custom fields")
+	}
+
+	for name, opts := range map[string]nombra.Options{
+		"base URL":         {Client: metadataProvider{}, BaseURL: "http://localhost:11434/v1"},
+		"OCR":              {ForceOCR: true},
+		"vision pages":     {VisionPages: []int{1, -1}},
+		"vision model":     {VisionModel: "gpt-4o"},
+		"vision detail":    {VisionDetail: nombra.VisionDetailLow},
+		"reasoning effort": {ReasoningEffort: "high"},
+	} {
+		useTestNamer(t, opts)
+		if cacheKey("content-hash") == base {
+			t.Errorf("cache key ignores the %s", name)
+		}
+	}
+}
+
+// useTestNamer sets the global namer to one answering with a fake model,
+// unless opts point at a fake server or recordings.
+func useTestNamer(t *testing.T, opts nombra.Options) {
+	t.Helper()
+	if opts.Client == nil && opts.BaseURL == "" && opts.Replay == "" {
+		opts.Client = metadataProvider{}
+	}
+	n, err := nombra.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := namer
+	t.Cleanup(func() { namer = previous })
+	namer = n
+}
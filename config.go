@@ -0,0 +1,347 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rtyx/nombra/nombra"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the environment variable of every flag, e.g.
+// NOMBRA_MAX_CONTENT_LENGTH for --max-content-length.
+const envPrefix = "NOMBRA_"
+
+var (
+	configPath  string
+	profileName string
+)
+
+// Flags that cannot be set from the config file or the environment.
+var unconfigurableFlags = map[string]bool{
+	"config":  true,
+	"profile": true,
+	"help":    true,
+	"version": true,
+}
+
+// configFile holds the settings of a config file. Keys are flag names; values
+// are kept as strings and parsed by the flags themselves.
+type configFile struct {
+	path     string
+	settings map[string]string
+	profile  string // profile used when neither --profile nor NOMBRA_PROFILE is set
+	profiles map[string]map[string]string
+}
+
+// defaultConfigPath returns config.toml in the XDG config directory.
+func defaultConfigPath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "nombra", "config.toml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine config directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "nombra", "config.toml"), nil
+}
+
+// loadConfig reads the config file at path, or the default one when path is
+// empty. A missing default file is an empty config.
+func loadConfig(path string) (*configFile, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = defaultConfigPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return &configFile{settings: map[string]string{}, profiles: map[string]map[string]string{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	cfg, err := parseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.path = path
+	return cfg, nil
+}
+
+// parseConfig reads the subset of TOML nombra needs: top-level keys, one
+// [profiles.<name>] table per profile, and strings, numbers, booleans and
+// single-line arrays of strings as values.
+func parseConfig(data string) (*configFile, error) {
+	cfg := &configFile{settings: map[string]string{}, profiles: map[string]map[string]string{}}
+	section, sectionName := cfg.settings, ""
+	for i, line := range strings.Split(data, "\n") {
+		lineErr := func(format string, args ...any) error {
+			return fmt.Errorf("line %d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimSpace(stripConfigComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, lineErr("unterminated table header")
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			profile, ok := strings.CutPrefix(name, "profiles.")
+			profile = strings.Trim(profile, `"'`)
+			if !ok || profile == "" {
+				return nil, lineErr("unknown table [%s], profiles are declared as [profiles.<name>]", name)
+			}
+			if _, dup := cfg.profiles[profile]; dup {
+				return nil, lineErr("profile %q declared twice", profile)
+			}
+			section, sectionName = map[string]string{}, profile
+			cfg.profiles[profile] = section
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, lineErr("expected key = value")
+		}
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		value, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, lineErr("%s: %v", key, err)
+		}
+		if key == "profile" {
+			if sectionName != "" {
+				return nil, lineErr("profile can only be set at the top level")
+			}
+			cfg.profile = value
+			continue
+		}
+		if _, dup := section[key]; dup {
+			return nil, lineErr("%s set twice", key)
+		}
+		section[key] = value
+	}
+	return cfg, nil
+}
+
+// stripConfigComment removes a # comment that is not inside a string.
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++ // an escaped quote does not end the string
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigValue turns a TOML value into the string a flag would be given
+// on the command line. Arrays become comma separated lists.
+func parseConfigValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", fmt.Errorf("missing value")
+	case strings.HasPrefix(raw, `"`):
+		return strconv.Unquote(raw)
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") || strings.Contains(raw[1:len(raw)-1], "'") {
+			return "", fmt.Errorf("invalid literal string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return "", fmt.Errorf("arrays must be written on one line")
+		}
+		items, err := splitConfigArray(raw[1 : len(raw)-1])
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		w := csv.NewWriter(&b)
+		w.Write(items)
+		w.Flush()
+		return strings.TrimSuffix(b.String(), "\n"), nil
+	case raw == "true" || raw == "false":
+		return raw, nil
+	default:
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err != nil {
+			return "", fmt.Errorf("strings must be quoted: %s", raw)
+		}
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+}
+
+func splitConfigArray(raw string) ([]string, error) {
+	var items []string
+	for rest := strings.TrimSpace(raw); rest != ""; {
+		end := 0
+		if rest[0] == '"' || rest[0] == '\'' {
+			end = 1
+			for end < len(rest) && rest[end] != rest[0] {
+				if rest[0] == '"' && rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+		} else {
+			end = strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+		}
+		item, err := parseConfigValue(strings.TrimSpace(rest[:min(end, len(rest))]))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		rest = strings.TrimSpace(rest[min(end, len(rest)):])
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+	return items, nil
+}
+
+// applyConfig fills every flag of cmd that was not given on the command line,
+// from NOMBRA_* environment variables first, then the selected profile, then
+// the top-level settings of the config file.
+func applyConfig(cmd *cobra.Command) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.checkKeys(cmd.Root()); err != nil {
+		return err
+	}
+
+	name := cmp.Or(profileName, os.Getenv(envPrefix+"PROFILE"), cfg.profile)
+	var profile map[string]string
+	if name != "" {
+		var ok bool
+		if profile, ok = cfg.profiles[name]; !ok {
+			return fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(cfg.profileNames(), ", "))
+		}
+		if verbose {
+			log.Printf("Using profile %s from %s", name, cfg.path)
+		}
+	}
+
+	var setErr error
+	keyFromFile := false
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if setErr != nil || f.Changed || unconfigurableFlags[f.Name] {
+			return
+		}
+		value, source := "", ""
+		if v := os.Getenv(flagEnvName(f.Name)); v != "" {
+			value, source = v, flagEnvName(f.Name)
+		} else if v, ok := profile[f.Name]; ok {
+			value, source = v, "profile "+name
+		} else if v, ok := cfg.settings[f.Name]; ok {
+			value, source = v, cfg.path
+		} else {
+			return
+		}
+		if err := cmd.Flags().Set(f.Name, value); err != nil {
+			setErr = fmt.Errorf("invalid %s from %s: %w", f.Name, source, err)
+		}
+		keyFromFile = keyFromFile || (f.Name == "key" && !strings.HasPrefix(source, envPrefix))
+	})
+
+	// A key in the config file yields to the provider's own variable, such as
+	// OPENAI_API_KEY, like every other setting yields to the environment.
+	if keyFromFile && providerKeySet() {
+		apiKey = ""
+	}
+	return setErr
+}
+
+func providerKeySet() bool {
+	if providerName == nombra.ProviderAnthropic {
+		return os.Getenv("ANTHROPIC_API_KEY") != ""
+	}
+	return os.Getenv("OPENAI_API_KEY") != ""
+}
+
+// flagEnvName returns the environment variable for a flag.
+func flagEnvName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// checkKeys rejects settings that are no flag of any command, which are most
+// likely typos.
+func (c *configFile) checkKeys(root *cobra.Command) error {
+	known := map[string]bool{}
+	var collect func(cmd *cobra.Command)
+	collect = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { known[f.Name] = true })
+		cmd.PersistentFlags().VisitAll(func(f *pflag.Flag) { known[f.Name] = true })
+		for _, sub := range cmd.Commands() {
+			collect(sub)
+		}
+	}
+	collect(root)
+
+	check := func(settings map[string]string, where string) error {
+		for key := range settings {
+			if !known[key] || unconfigurableFlags[key] {
+				return fmt.Errorf("%s: unknown setting %q in %s", c.path, key, where)
+			}
+		}
+		return nil
+	}
+	if err := check(c.settings, "top level"); err != nil {
+		return err
+	}
+	for _, name := range c.profileNames() {
+		if err := check(c.profiles[name], "profile "+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *configFile) profileNames() []string {
+	names := make([]string, 0, len(c.profiles))
+	for name := range c.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testConfig = `# nombra settings
+model = "gpt-5-mini"
+workers = 2
+profile = "personal"
+
+[profiles.invoices]
+provider = "anthropic"
+template = "{date:2006-01-02}_{organization} # not a comment"
+max_content_length = 5_000
+include = ["*.pdf", 'scans/**']
+
+[profiles.personal]
+dest = '~/Archive/{date:2006}'
+`
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(testConfig)
+	if err != nil {
+		t.Fatalf("parseConfig returned error: %v", err)
+	}
+	if cfg.profile != "personal" || !reflect.DeepEqual(cfg.settings, map[string]string{"model": "gpt-5-mini", "workers": "2"}) {
+		t.Errorf("top level = %q, %v", cfg.profile, cfg.settings)
+	}
+	want := map[string]string{
+		"provider":           "anthropic",
+		"template":           "{date:2006-01-02}_{organization} # not a comment",
+		"max-content-length": "5000",
+		"include":            "*.pdf,scans/**",
+	}
+	if got := cfg.profiles["invoices"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("invoices = %v; want %v", got, want)
+	}
+
+	for _, bad := range []string{
+		"model = gpt-5",
+		"[invoices]\nmodel = \"x\"",
+		"model = \"a\"\nmodel = \"b\"",
+		"[profiles.a]\nprofile = \"b\"",
+		"include = [\"a\",\n",
+	} {
+		if _, err := parseConfig(bad); err == nil {
+			t.Errorf("parseConfig(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+// configCommand returns a command with a few flags, parsed from args.
+func configCommand(t *testing.T, args ...string) (*cobra.Command, *string, *int, *[]string) {
+	t.Helper()
+	var model string
+	var length int
+	var include []string
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().StringVar(&model, "model", "default-model", "")
+	cmd.Flags().IntVar(&length, "max-content-length", 3000, "")
+	cmd.Flags().StringSliceVar(&include, "include", nil, "")
+	cmd.Flags().IntVar(new(int), "workers", 1, "")
+	cmd.Flags().StringVar(new(string), "provider", "", "")
+	cmd.Flags().StringVar(new(string), "template", "", "")
+	cmd.Flags().StringVar(new(string), "dest", "", "")
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return cmd, &model, &length, &include
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { configPath, profileName = "", "" }()
+	configPath, profileName = path, "invoices"
+
+	// Profile beats the top level, the top level beats defaults.
+	cmd, model, length, include := configCommand(t)
+	if err := applyConfig(cmd); err != nil {
+		t.Fatalf("applyConfig returned error: %v", err)
+	}
+	if *model != "gpt-5-mini" || *length != 5000 || !reflect.DeepEqual(*include, []string{"*.pdf", "scans/**"}) {
+		t.Errorf("from config: model %q, length %d, include %v", *model, *length, *include)
+	}
+
+	// The environment beats the profile, flags beat everything.
+	t.Setenv("NOMBRA_MAX_CONTENT_LENGTH", "4000")
+	t.Setenv("NOMBRA_MODEL", "gpt-4o")
+	cmd, model, length, _ = configCommand(t, "--model", "gpt-5.4")
+	if err := applyConfig(cmd); err != nil {
+		t.Fatalf("applyConfig returned error: %v", err)
+	}
+	if *model != "gpt-5.4" || *length != 4000 {
+		t.Errorf("with env and flag: model %q, length %d", *model, *length)
+	}
+
+	t.Setenv("NOMBRA_MAX_CONTENT_LENGTH", "lots")
+	cmd, _, _, _ = configCommand(t)
+	if err := applyConfig(cmd); err == nil || !strings.Contains(err.Error(), "NOMBRA_MAX_CONTENT_LENGTH") {
+		t.Errorf("invalid env value: error %v", err)
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	defer func() { configPath, profileName = "", "" }()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	// Without a config file nothing changes.
+	cmd, model, _, _ := configCommand(t)
+	if err := applyConfig(cmd); err != nil || *model != "default-model" {
+		t.Errorf("missing default config: %v, model %q", err, *model)
+	}
+
+	configPath = filepath.Join(dir, "missing.toml")
+	if err := applyConfig(cmd); err == nil {
+		t.Error("expected error for missing --config file")
+	}
+
+	configPath = filepath.Join(dir, "config.toml")
+	os.WriteFile(configPath, []byte(testConfig), 0o644)
+	profileName = "work"
+	if err := applyConfig(cmd); err == nil || !strings.Contains(err.Error(), "invoices, personal") {
+		t.Errorf("unknown profile: error %v", err)
+	}
+
+	profileName = ""
+	os.WriteFile(configPath, []byte("modle = \"gpt-5.4\"\n"), 0o644)
+	if err := applyConfig(cmd); err == nil || !strings.Contains(err.Error(), "modle") {
+		t.Errorf("unknown key: error %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+var (
+	prices    []string
+	maxCost   float64
+	maxTokens int
+)
+
+// spend is the budget of the run, nil without --max-cost and --max-tokens.
+var spend *budget
+
+// parsePrices reads --price values of the form model=input/output, in USD
+// per million tokens.
+func parsePrices(values []string) (map[string]nombra.Price, error) {
+	table := map[string]nombra.Price{}
+	for _, value := range values {
+		model, rates, ok := strings.Cut(value, "=")
+		input, output, ok2 := strings.Cut(rates, "/")
+		model = strings.ToLower(strings.TrimSpace(model))
+		if !ok || !ok2 || model == "" {
+			return nil, fmt.Errorf("invalid price %q, expected model=input/output in USD per million tokens", value)
+		}
+		in, err := strconv.ParseFloat(strings.TrimSpace(input), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input price in %q: %w", value, err)
+		}
+		out, err := strconv.ParseFloat(strings.TrimSpace(output), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output price in %q: %w", value, err)
+		}
+		table[model] = nombra.Price{Input: in, Output: out}
+	}
+	return table, nil
+}
+
+// budget stops new files from being processed once the tokens or cost of
+// the finished ones reach a limit. Files already being processed finish.
+type budget struct {
+	maxCost   float64
+	maxTokens int
+
+	mu        sync.Mutex
+	spent     nombra.Usage
+	exhausted bool
+}
+
+func newBudget(maxCost float64, maxTokens int) *budget {
+	if maxCost <= 0 && maxTokens <= 0 {
+		return nil
+	}
+	return &budget{maxCost: maxCost, maxTokens: maxTokens}
+}
+
+// add records the usage of a finished file.
+func (b *budget) add(usage nombra.Usage) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent = b.spent.Add(usage)
+	if b.exhausted {
+		return
+	}
+	if (b.maxCost > 0 && b.spent.Cost >= b.maxCost) || (b.maxTokens > 0 && b.spent.TotalTokens >= b.maxTokens) {
+		b.exhausted = true
+		log.Printf("Budget reached after %s; remaining files are skipped", formatUsage(b.spent))
+	}
+}
+
+// reason returns why no new file may start, or "" while the budget lasts.
+func (b *budget) reason() string {
+	if b == nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.exhausted {
+		return ""
+	}
+	if b.maxCost > 0 && b.spent.Cost >= b.maxCost {
+		return fmt.Sprintf("budget of $%.2f reached", b.maxCost)
+	}
+	return fmt.Sprintf("budget of %d tokens reached", b.maxTokens)
+}
+
+// formatUsage describes tokens and, when known, cost.
+func formatUsage(usage nombra.Usage) string {
+	s := fmt.Sprintf("%d tokens", usage.TotalTokens)
+	if usage.ReasoningTokens > 0 {
+		s += fmt.Sprintf(" (%d reasoning)", usage.ReasoningTokens)
+	}
+	if usage.Cost > 0 {
+		s += fmt.Sprintf(", $%.4f", usage.Cost)
+	}
+	return s
+}
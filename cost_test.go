@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+// pricedProvider answers like metadataProvider and reports token usage.
+type pricedProvider struct{ metadataProvider }
+
+func (p pricedProvider) Complete(ctx context.Context, req nombra.CompletionRequest) (nombra.Completion, error) {
+	reply, err := p.metadataProvider.Complete(ctx, req)
+	reply.Usage = nombra.Usage{PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100}
+	return reply, err
+}
+
+func TestParsePrices(t *testing.T) {
+	got, err := parsePrices([]string{"llama3=0/0", "GPT-5.4 = 2.5 / 15"})
+	if err != nil {
+		t.Fatalf("parsePrices returned error: %v", err)
+	}
+	if got["llama3"] != (nombra.Price{}) || got["gpt-5.4"] != (nombra.Price{Input: 2.5, Output: 15}) {
+		t.Errorf("parsePrices() = %v", got)
+	}
+	for _, bad := range []string{"gpt-5.4", "gpt-5.4=2.5", "=1/2", "gpt-5.4=cheap/15"} {
+		if _, err := parsePrices([]string{bad}); err == nil {
+			t.Errorf("parsePrices(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestBudgetStopsNewFiles(t *testing.T) {
+	useTestNamer(t, nombra.Options{Client: pricedProvider{}, Prices: map[string]nombra.Price{"gpt-5.4": {Input: 2, Output: 10}}})
+	previousDryRun := dryRun
+	t.Cleanup(func() { spend, dryRun = nil, previousDryRun })
+	spend, dryRun = newBudget(0, 1500), true
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("Invoice for the consulting services of January"), 0o644)
+		files = append(files, path)
+	}
+
+	results := processFiles(files, 1)
+	var summary runSummary
+	for _, result := range results {
+		summary.add(result)
+	}
+	if summary.succeeded != 2 || summary.skipped != 1 || results[2].skipReason != "budget of 1500 tokens reached" {
+		t.Errorf("summary = %+v, last result %+v", summary, results[2])
+	}
+	// 2 x (1000 x $2 + 100 x $10) per million tokens.
+	if summary.usage.TotalTokens != 2200 || summary.usage.Cost < 0.00599 || summary.usage.Cost > 0.00601 {
+		t.Errorf("usage = %+v", summary.usage)
+	}
+}
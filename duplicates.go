@@ -0,0 +1,358 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	duplicateSkip       = "skip"
+	duplicateDelete     = "delete"
+	duplicateDeleteNear = "delete-near"
+	duplicateLink       = "link"
+	duplicateReport     = "report"
+
+	defaultDuplicateThreshold = 0.8
+
+	// MinHash parameters: signatures of minhashSize values, compared in
+	// minhashBands bands for locality sensitive hashing. Shingles are runs of
+	// shingleWords words, short enough to survive the odd OCR error.
+	minhashSize     = 128
+	minhashBands    = 32
+	shingleWords    = 3
+	minShingleCount = 20
+)
+
+var validDuplicateActions = []string{duplicateSkip, duplicateDelete, duplicateDeleteNear, duplicateLink, duplicateReport}
+
+// duplicates finds duplicates among the files of a run, nil unless
+// --on-duplicate is set.
+var duplicates *duplicateIndex
+
+// duplicateMatch is the earlier file a result duplicates. Similarity is 1 for
+// identical content.
+type duplicateMatch struct {
+	path       string // the kept file when the duplicate was found
+	exact      bool   // same content hash, not just similar text
+	similarity float64
+	action     string // the --on-duplicate action taken
+	entry      *duplicateEntry
+}
+
+// duplicateEntry is a file claimed by the index. Once the file is renamed,
+// path follows it so links point at the final name.
+type duplicateEntry struct {
+	path      string
+	signature []uint64
+	original  *duplicateEntry
+}
+
+// duplicateIndex remembers content hashes and MinHash signatures of the files
+// processed so far. The first file to be claimed is kept; later ones are its
+// duplicates.
+type duplicateIndex struct {
+	mu        sync.Mutex
+	threshold float64
+	byHash    map[string]*duplicateEntry
+	buckets   map[string][]*duplicateEntry
+}
+
+func validateDuplicateAction(action string) error {
+	if action == "" || containsFold(validDuplicateActions, action) {
+		return nil
+	}
+	return fmt.Errorf("invalid --on-duplicate %q (valid: %s)", action, strings.Join(validDuplicateActions, ", "))
+}
+
+func newDuplicateIndex(threshold float64) *duplicateIndex {
+	return &duplicateIndex{
+		threshold: threshold,
+		byHash:    map[string]*duplicateEntry{},
+		buckets:   map[string][]*duplicateEntry{},
+	}
+}
+
+// claim registers a file by content hash. When the content was seen before
+// it returns the file that holds it instead.
+func (d *duplicateIndex) claim(hash, path string) (*duplicateEntry, *duplicateMatch) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if existing, ok := d.byHash[hash]; ok {
+		root := existing.root()
+		return nil, &duplicateMatch{path: root.path, exact: true, similarity: 1, entry: root}
+	}
+	entry := &duplicateEntry{path: path}
+	d.byHash[hash] = entry
+	return entry, nil
+}
+
+// match compares the signature of a claimed file with the files seen so far
+// and returns the most similar one above the threshold. Otherwise the file is
+// added to the index.
+func (d *duplicateIndex) match(entry *duplicateEntry, signature []uint64) *duplicateMatch {
+	if d == nil || entry == nil || len(signature) != minhashSize {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := bandKeys(signature)
+	var best *duplicateEntry
+	bestSimilarity := 0.0
+	seen := map[*duplicateEntry]bool{}
+	for _, key := range keys {
+		for _, candidate := range d.buckets[key] {
+			if seen[candidate] {
+				continue
+			}
+			seen[candidate] = true
+			if s := signatureSimilarity(signature, candidate.signature); s >= d.threshold && s > bestSimilarity {
+				best, bestSimilarity = candidate, s
+			}
+		}
+	}
+	if best != nil {
+		entry.original = best
+		root := best.root()
+		return &duplicateMatch{path: root.path, similarity: bestSimilarity, entry: root}
+	}
+
+	entry.signature = signature
+	for _, key := range keys {
+		d.buckets[key] = append(d.buckets[key], entry)
+	}
+	return nil
+}
+
+// moved records the new name of a kept file.
+func (d *duplicateIndex) moved(entry *duplicateEntry, path string) {
+	if d == nil || entry == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry.path = path
+}
+
+// currentPath returns where the kept file for match lives now.
+func (d *duplicateIndex) currentPath(match *duplicateMatch) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return match.entry.root().path
+}
+
+func (e *duplicateEntry) root() *duplicateEntry {
+	for e.original != nil {
+		e = e.original
+	}
+	return e
+}
+
+// shingles splits text into lowercase words and returns the hashes of all
+// runs of shingleWords consecutive words.
+func shingles(text string) map[uint64]struct{} {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	set := map[uint64]struct{}{}
+	for i := 0; i+shingleWords <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleWords], " ")))
+		set[h.Sum64()] = struct{}{}
+	}
+	return set
+}
+
+// minhashSignature returns the MinHash signature of text, or nil when the
+// text is too short to compare reliably.
+func minhashSignature(text string) []uint64 {
+	set := shingles(text)
+	if len(set) < minShingleCount {
+		return nil
+	}
+	signature := make([]uint64, minhashSize)
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+	for shingle := range set {
+		for i := range signature {
+			if v := mix64(shingle ^ (uint64(i+1) * 0x9e3779b97f4a7c15)); v < signature[i] {
+				signature[i] = v
+			}
+		}
+	}
+	return signature
+}
+
+// mix64 is the splitmix64 finalizer, used to derive independent hash
+// functions from one shingle hash.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// signatureSimilarity estimates the Jaccard similarity of two shingle sets.
+func signatureSimilarity(a, b []uint64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+func bandKeys(signature []uint64) []string {
+	rows := len(signature) / minhashBands
+	keys := make([]string, minhashBands)
+	for band := range keys {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%d", band)
+		for _, v := range signature[band*rows : (band+1)*rows] {
+			fmt.Fprintf(&b, ":%x", v)
+		}
+		keys[band] = b.String()
+	}
+	return keys
+}
+
+// duplicateAction is what --on-duplicate does with match. Similar text may
+// still be a different document sharing boilerplate, such as two invoices of
+// one sender, so delete and link only act on identical content and report
+// near-duplicates; delete-near deletes those too.
+func duplicateAction(match *duplicateMatch) string {
+	switch onDuplicate {
+	case duplicateDelete, duplicateLink:
+		if !match.exact {
+			return duplicateReport
+		}
+	case duplicateDeleteNear:
+		return duplicateDelete
+	}
+	return onDuplicate
+}
+
+// handleDuplicate applies --on-duplicate to a file whose content duplicates an
+// earlier one. report leaves the file to be renamed as usual.
+func handleDuplicate(result fileResult, filePath, hash string) fileResult {
+	result.duplicate.action = duplicateAction(result.duplicate)
+	if dryRun || printOnly {
+		return result
+	}
+
+	switch result.duplicate.action {
+	case duplicateSkip:
+		result.skipped = true
+	case duplicateDelete:
+		if err := deleteDuplicate(filePath, hash, result.duplicate); err != nil {
+			result.err = fmt.Errorf("could not delete duplicate: %w", err)
+		}
+	case duplicateLink:
+		target, err := linkDuplicate(filePath, result.duplicate)
+		if err != nil {
+			result.err = fmt.Errorf("could not link duplicate: %w", err)
+		} else {
+			result.newPath = target
+		}
+	}
+	return result
+}
+
+// deleteDuplicate deletes a duplicate once the journal can bring it back. An
+// identical copy is restored from the kept file; a near-duplicate, or a copy
+// whose kept file gets its metadata rewritten, is put away instead.
+func deleteDuplicate(filePath, hash string, match *duplicateMatch) error {
+	if journal == nil {
+		return fmt.Errorf("duplicates are only deleted with an undo journal")
+	}
+	if !match.exact || writeMetadata {
+		return journal.remove(filePath, hash)
+	}
+	if err := journal.recordDelete(filePath, duplicates.currentPath(match), hash); err != nil {
+		return err
+	}
+	return os.Remove(filePath)
+}
+
+// linkDuplicate replaces filePath with a hard link to the kept file, or a
+// symbolic link when the two are on different file systems. The kept file
+// may be renamed by another worker meanwhile, so its path is looked up again
+// when linking fails.
+func linkDuplicate(filePath string, match *duplicateMatch) (string, error) {
+	tmp := filepath.Join(filepath.Dir(filePath), ".nombra-link-"+filepath.Base(filePath))
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		target := duplicates.currentPath(match)
+		os.Remove(tmp)
+		if err = os.Link(target, tmp); err != nil {
+			if _, statErr := os.Stat(target); statErr == nil {
+				abs, absErr := filepath.Abs(target)
+				if absErr != nil {
+					return "", absErr
+				}
+				if err = os.Symlink(abs, tmp); err != nil {
+					return "", err
+				}
+			} else {
+				continue
+			}
+		}
+		if err = os.Rename(tmp, filePath); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		return target, nil
+	}
+	return "", err
+}
+
+// describeDuplicate says which file a duplicate matches and how closely.
+func describeDuplicate(match *duplicateMatch) string {
+	if match.exact {
+		return fmt.Sprintf("duplicate of %s", filepath.Base(match.path))
+	}
+	return fmt.Sprintf("near-duplicate of %s (%.0f%% similar)", filepath.Base(match.path), match.similarity*100)
+}
+
+// printDuplicate prints the outcome of a skipped, deleted or linked duplicate.
+func printDuplicate(w io.Writer, result fileResult) {
+	name := filepath.Base(result.path)
+	what := describeDuplicate(result.duplicate)
+	switch {
+	case dryRun || printOnly:
+		fmt.Fprintf(w, "[DUPLICATE] %s: %s, would %s\n", name, what, result.duplicate.action)
+	case result.duplicate.action == duplicateSkip:
+		fmt.Fprintf(w, "[SKIP] %s: %s\n", name, what)
+	case result.duplicate.action == duplicateDelete:
+		fmt.Fprintf(w, "[DELETED] %s: %s\n", name, what)
+	case result.duplicate.action == duplicateLink:
+		fmt.Fprintf(w, "[LINKED] %s: %s, now a link to %s\n", name, what, result.newPath)
+	}
+}
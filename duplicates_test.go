@@ -0,0 +1,220 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+const duplicateText = `This agreement is made between ACME Corporation and Rafael Toledano for the
+rental of the apartment located at Calle Mayor 12, Madrid. The monthly rent is
+nine hundred euros, payable on the first day of each month by bank transfer.
+The tenant shall keep the property in good condition and notify the landlord of
+any damage. Either party may terminate this agreement with two months notice.`
+
+func TestMinhashSimilarity(t *testing.T) {
+	original := minhashSignature(duplicateText)
+	if len(original) != minhashSize {
+		t.Fatalf("signature has %d values; want %d", len(original), minhashSize)
+	}
+
+	// A rescan with a couple of OCR errors is still close.
+	rescan := strings.NewReplacer("nine hundred", "nlne hundred", "Madrid", "Madr1d").Replace(duplicateText)
+	if s := signatureSimilarity(original, minhashSignature(rescan)); s < defaultDuplicateThreshold {
+		t.Errorf("similarity of rescan = %.2f; want at least %.2f", s, defaultDuplicateThreshold)
+	}
+
+	other := minhashSignature(`Invoice number 2025-0042 issued by Iberdrola to Rafael Toledano for the
+electricity supply between January and February. Total amount due is eighty four
+euros and twenty cents, to be charged to the account ending in 1234 on the tenth
+of March. Contact customer service for any questions about this invoice or tariff.`)
+	if s := signatureSimilarity(original, other); s > 0.2 {
+		t.Errorf("similarity of unrelated text = %.2f; want close to 0", s)
+	}
+
+	if minhashSignature("too short to compare") != nil {
+		t.Error("expected no signature for short text")
+	}
+}
+
+func TestDuplicateIndex(t *testing.T) {
+	index := newDuplicateIndex(defaultDuplicateThreshold)
+
+	first, match := index.claim("hash-a", "/docs/a.pdf")
+	if first == nil || match != nil {
+		t.Fatalf("claim of new content = %v, %v", first, match)
+	}
+	if _, match := index.claim("hash-a", "/docs/a-copy.pdf"); match == nil || match.path != "/docs/a.pdf" || match.similarity != 1 {
+		t.Fatalf("claim of identical content = %+v; want exact duplicate of a.pdf", match)
+	}
+
+	if match := index.match(first, minhashSignature(duplicateText)); match != nil {
+		t.Fatalf("first signature matched %+v", match)
+	}
+	index.moved(first, "/docs/2025.01.15 Rental agreement.pdf")
+
+	second, _ := index.claim("hash-b", "/docs/b.pdf")
+	match = index.match(second, minhashSignature(strings.Replace(duplicateText, "Madrid", "Madr1d", 1)))
+	if match == nil || match.path != "/docs/2025.01.15 Rental agreement.pdf" || match.similarity >= 1 {
+		t.Fatalf("near-duplicate match = %+v", match)
+	}
+
+	var disabled *duplicateIndex
+	if disabled.match(second, minhashSignature(duplicateText)) != nil {
+		t.Error("nil index reported a duplicate")
+	}
+}
+
+// useTestJournal records the test's deletions in a journal of its own.
+func useTestJournal(t *testing.T) *renameJournal {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	j, err := newRenameJournal(newRunID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := journal
+	journal = j
+	t.Cleanup(func() { j.close(); journal = previous })
+	return j
+}
+
+func TestHandleDuplicate(t *testing.T) {
+	defer func(action string, index *duplicateIndex) { onDuplicate, duplicates = action, index }(onDuplicate, duplicates)
+	useTestJournal(t)
+
+	for _, action := range []string{duplicateSkip, duplicateDelete, duplicateLink} {
+		t.Run(action, func(t *testing.T) {
+			dir := t.TempDir()
+			kept := filepath.Join(dir, "kept.pdf")
+			copyPath := filepath.Join(dir, "copy.pdf")
+			for _, path := range []string{kept, copyPath} {
+				if err := os.WriteFile(path, []byte("%PDF-1.4 same"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			onDuplicate, duplicates = action, newDuplicateIndex(defaultDuplicateThreshold)
+			duplicates.claim("hash", kept)
+			_, match := duplicates.claim("hash", copyPath)
+
+			result := handleDuplicate(fileResult{path: copyPath, duplicate: match}, copyPath, "hash")
+			if result.err != nil {
+				t.Fatalf("handleDuplicate returned error: %v", result.err)
+			}
+			_, statErr := os.Stat(copyPath)
+			switch action {
+			case duplicateSkip:
+				if !result.skipped || statErr != nil {
+					t.Errorf("skip: skipped=%v, stat error %v", result.skipped, statErr)
+				}
+			case duplicateDelete:
+				if !os.IsNotExist(statErr) || resultStatus(result) != statusDeleted {
+					t.Errorf("delete: stat error %v, status %s", statErr, resultStatus(result))
+				}
+			case duplicateLink:
+				keptInfo, _ := os.Stat(kept)
+				copyInfo, err := os.Stat(copyPath)
+				if err != nil || !os.SameFile(keptInfo, copyInfo) || resultStatus(result) != statusLinked {
+					t.Errorf("link: copy is not a link to the kept file (err %v, status %s)", err, resultStatus(result))
+				}
+			}
+		})
+	}
+}
+
+func TestNearDuplicatesAreOnlyDeletedOnRequest(t *testing.T) {
+	defer func(action string, index *duplicateIndex) { onDuplicate, duplicates = action, index }(onDuplicate, duplicates)
+	j := useTestJournal(t)
+	base := t.TempDir()
+
+	for _, action := range []string{duplicateDelete, duplicateLink, duplicateDeleteNear} {
+		t.Run(action, func(t *testing.T) {
+			dir := filepath.Join(base, action)
+			os.Mkdir(dir, 0o755)
+			kept := filepath.Join(dir, "kept.txt")
+			near := filepath.Join(dir, "near.txt")
+			text := strings.Replace(duplicateText, "nine hundred", "nine hundred and fifty", 1)
+			os.WriteFile(kept, []byte(duplicateText), 0o644)
+			os.WriteFile(near, []byte(text), 0o644)
+			hash, _ := fileSHA256(near)
+
+			onDuplicate, duplicates = action, newDuplicateIndex(defaultDuplicateThreshold)
+			first, _ := duplicates.claim("hash-kept", kept)
+			duplicates.match(first, minhashSignature(duplicateText))
+			second, _ := duplicates.claim(hash, near)
+			match := duplicates.match(second, minhashSignature(text))
+			if match == nil || match.exact {
+				t.Fatalf("match = %+v; want a near-duplicate", match)
+			}
+
+			result := handleDuplicate(fileResult{path: near, duplicate: match}, near, hash)
+			data, err := os.ReadFile(near)
+			if action != duplicateDeleteNear {
+				if result.duplicate.action != duplicateReport || err != nil || string(data) != text {
+					t.Errorf("near-duplicate was touched: action %s, content %q, %v", result.duplicate.action, data, err)
+				}
+				return
+			}
+			if result.err != nil || !os.IsNotExist(err) {
+				t.Fatalf("delete-near: error %v, stat %v", result.err, err)
+			}
+		})
+	}
+
+	// Deleted near-duplicates were put away, so undo brings them back.
+	j.close()
+	results, err := undoRun(j.runID)
+	if err != nil || len(results) != 1 || results[0].err != nil {
+		t.Fatalf("undoRun() = %+v, %v", results, err)
+	}
+	if data, err := os.ReadFile(results[0].entry.OriginalPath); err != nil || !strings.Contains(string(data), "nine hundred and fifty") {
+		t.Errorf("restored near-duplicate: %q, %v", data, err)
+	}
+}
+
+func TestUndoRestoresDeletedDuplicate(t *testing.T) {
+	defer func(action string, index *duplicateIndex) { onDuplicate, duplicates = action, index }(onDuplicate, duplicates)
+	j := useTestJournal(t)
+
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "scan1.pdf")
+	copyPath := filepath.Join(dir, "scan2.pdf")
+	for _, path := range []string{kept, copyPath} {
+		os.WriteFile(path, []byte("%PDF-1.4 same"), 0o644)
+	}
+	hash, _ := fileSHA256(kept)
+
+	onDuplicate, duplicates = duplicateDelete, newDuplicateIndex(defaultDuplicateThreshold)
+	entry, _ := duplicates.claim(hash, kept)
+	_, match := duplicates.claim(hash, copyPath)
+	if result := handleDuplicate(fileResult{path: copyPath, duplicate: match}, copyPath, hash); result.err != nil {
+		t.Fatal(result.err)
+	}
+
+	// The kept file is renamed after the copy was deleted.
+	renamed := filepath.Join(dir, "Invoice.pdf")
+	os.Rename(kept, renamed)
+	duplicates.moved(entry, renamed)
+	if err := j.recordRename(kept, renamed, hash, nombra.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	j.close()
+
+	results, err := undoRun(j.runID)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("undoRun() = %+v, %v", results, err)
+	}
+	for _, result := range results {
+		if result.err != nil {
+			t.Errorf("%s: %v", result.entry.Action, result.err)
+		}
+	}
+	for _, path := range []string{kept, copyPath} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != "%PDF-1.4 same" {
+			t.Errorf("%s: %q, %v", filepath.Base(path), data, err)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/rtyx/nombra/nombra"
+	"github.com/spf13/cobra"
+)
+
+// offlineModel names the offline heuristics in --models.
+const offlineModel = "offline"
+
+// evalCase is one labelled document of the ground truth: the file, relative
+// to the evaluated directory, and the filename and metadata expected for it.
+// Fields left empty are not scored.
+type evalCase struct {
+	File     string          `json:"file"`
+	Filename string          `json:"filename,omitempty"`
+	Metadata nombra.Metadata `json:"metadata"`
+}
+
+// evalPrediction is what a run proposed for a case.
+type evalPrediction struct {
+	title    string
+	metadata nombra.Metadata
+	usage    nombra.Usage
+	err      error
+}
+
+// evalRun holds the predictions of one model or recorded run, by case.
+type evalRun struct {
+	name        string
+	predictions []evalPrediction
+}
+
+// fieldScore counts correct answers among the cases that label a field.
+type fieldScore struct {
+	Correct int `json:"correct"`
+	Total   int `json:"total"`
+}
+
+func (s *fieldScore) add(correct bool) {
+	s.Total++
+	if correct {
+		s.Correct++
+	}
+}
+
+func (s fieldScore) accuracy() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Correct) / float64(s.Total)
+}
+
+// evalReport scores a run against the ground truth.
+type evalReport struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Failed    int    `json:"failed"`
+	// Fields is the accuracy of every labelled field; dates must match
+	// exactly, other values ignoring case and punctuation.
+	Fields        map[string]*fieldScore `json:"fields"`
+	FilenameExact fieldScore             `json:"filename_exact"`
+	// FilenameSimilarity is the mean edit-distance similarity (0-1) of the
+	// proposed and expected filenames.
+	FilenameSimilarity float64      `json:"filename_similarity"`
+	Usage              nombra.Usage `json:"usage"`
+	CostPerDocument    float64      `json:"cost_per_document_usd"`
+}
+
+func newEvalCmd() *cobra.Command {
+	var truthPath string
+	var models, recorded []string
+
+	cmd := &cobra.Command{
+		Use:   "eval <dir> --truth <file>",
+		Short: "Score models against a labelled set of documents",
+		Long: "Names every document listed in a ground-truth file with each model and reports per-field accuracy, " +
+			"exact date matches, filename similarity and cost, so that prompts and models can be compared with data. " +
+			"Files are never renamed. Results recorded earlier with --output json or jsonl can be scored with --recorded.",
+		Example: "nombra eval ./corpus --truth truth.jsonl\n  nombra eval ./corpus --truth truth.jsonl --models gpt-5.4,gpt-5-mini,offline\n" +
+			"  nombra eval ./corpus --truth truth.jsonl --recorded last-run.jsonl --output json",
+		Args: cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			prepareRun(cmd)
+			if truthPath == "" {
+				fmt.Println("Error: --truth is required")
+				os.Exit(1)
+			}
+			if outputFormat != outputText && outputFormat != outputJSON {
+				fmt.Println("Error: eval supports --output text or json")
+				os.Exit(1)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(models) == 0 && len(recorded) == 0 {
+				models = []string{namer.Options().Model}
+				if offline {
+					models = []string{offlineModel}
+				}
+			}
+			reports, err := runEval(args[0], truthPath, models, recorded)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if outputFormat == outputJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				err = enc.Encode(struct {
+					Runs []evalReport `json:"runs"`
+				}{reports})
+			} else {
+				err = writeEvalTable(os.Stdout, reports)
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&truthPath, "truth", "", "Ground truth: JSON lines of {\"file\", \"filename\", \"metadata\"} per document")
+	cmd.Flags().StringSliceVar(&models, "models", nil, "Models to compare with the configured provider; \"offline\" runs the heuristics (default: --model)")
+	cmd.Flags().StringSliceVar(&recorded, "recorded", nil, "Score results of an earlier run written with --output json or jsonl instead of calling a model")
+	return cmd
+}
+
+// runEval scores every model and recorded run against the ground truth of
+// the documents in dir.
+func runEval(dir, truthPath string, models, recorded []string) ([]evalReport, error) {
+	cases, err := loadGroundTruth(truthPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cases {
+		if _, err := os.Stat(filepath.Join(dir, c.File)); err != nil {
+			return nil, fmt.Errorf("ground truth lists %s, which cannot be read: %w", c.File, err)
+		}
+	}
+
+	var runs []evalRun
+	for _, path := range recorded {
+		run, err := loadRecordedRun(path, dir, cases)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if len(models) > 0 {
+		modelRuns, err := runEvalModels(dir, cases, models)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, modelRuns...)
+	}
+
+	reports := make([]evalReport, len(runs))
+	for i, run := range runs {
+		reports[i] = scoreRun(run, cases)
+	}
+	return reports, nil
+}
+
+// loadGroundTruth reads one evalCase per line. Blank lines are skipped.
+func loadGroundTruth(path string) ([]evalCase, error) {
+	f, err := os.Open(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ground truth: %w", err)
+	}
+	defer f.Close()
+
+	var cases []evalCase
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		var c evalCase
+		if err := dec.Decode(&c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		c.File = filepath.Clean(c.File)
+		if c.File == "." || filepath.IsAbs(c.File) {
+			return nil, fmt.Errorf("%s:%d: file must be a path relative to the evaluated directory", path, line)
+		}
+		if seen[c.File] {
+			return nil, fmt.Errorf("%s:%d: %s is listed twice", path, line, c.File)
+		}
+		seen[c.File] = true
+		c.Filename = strings.TrimSuffix(c.Filename, filepath.Ext(c.File))
+		if c.Filename == "" && c.Metadata.IsZero() {
+			return nil, fmt.Errorf("%s:%d: %s has neither a filename nor metadata to compare", path, line, c.File)
+		}
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read ground truth: %w", err)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("ground truth %s lists no documents", path)
+	}
+	return cases, nil
+}
+
+// loadRecordedRun reads the results of an earlier run in the json or jsonl
+// output format and matches them to the cases by path.
+func loadRecordedRun(path, dir string, cases []evalCase) (evalRun, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return evalRun{}, fmt.Errorf("cannot read recorded run: %w", err)
+	}
+	// The json format holds all files in one object, jsonl one per line.
+	var records []fileRecord
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value struct {
+			fileRecord
+			Files []fileRecord `json:"files"`
+		}
+		if err := dec.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return evalRun{}, fmt.Errorf("invalid recorded run %s: %w", path, err)
+		}
+		records = append(records, value.Files...)
+		if value.Type == "file" {
+			records = append(records, value.fileRecord)
+		}
+	}
+
+	byPath := map[string]fileRecord{}
+	byName := map[string]fileRecord{}
+	for _, record := range records {
+		byPath[relativeTo(dir, record.OriginalPath)] = record
+		byName[filepath.Base(record.OriginalPath)] = record
+	}
+	run := evalRun{name: filepath.Base(path), predictions: make([]evalPrediction, len(cases))}
+	for i, c := range cases {
+		record, ok := byPath[c.File]
+		if !ok {
+			record, ok = byName[filepath.Base(c.File)]
+		}
+		switch {
+		case !ok:
+			run.predictions[i].err = fmt.Errorf("not in recorded run")
+		case record.Status == statusFailed || record.Status == statusSkipped:
+			run.predictions[i].err = errors.New(cmp.Or(record.Error, record.SkipReason, record.Status))
+		default:
+			run.predictions[i].title = record.Title
+			if record.Metadata != nil {
+				run.predictions[i].metadata = *record.Metadata
+			}
+		}
+		run.predictions[i].usage = record.Usage
+	}
+	return run, nil
+}
+
+// relativeTo returns path relative to dir, or path itself outside dir.
+func relativeTo(dir, path string) string {
+	absDir, err1 := filepath.Abs(dir)
+	absPath, err2 := filepath.Abs(path)
+	if err1 != nil || err2 != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// runEvalModels extracts the text of every case once and asks each model for
+// its metadata. Extraction usage, such as vision requests, is added to every
+// model since each would pay it on its own.
+func runEvalModels(dir string, cases []evalCase, models []string) ([]evalRun, error) {
+	namers := make([]*nombra.Namer, len(models))
+	for i, model := range models {
+		opts := namer.Options()
+		if model == offlineModel {
+			opts.Offline = true
+		} else {
+			opts.Model, opts.Offline = model, false
+		}
+		n, err := nombra.New(opts)
+		if err != nil {
+			return nil, fmt.Errorf("model %s: %w", model, err)
+		}
+		namers[i] = n
+	}
+
+	runs := make([]evalRun, len(models))
+	for i, model := range models {
+		runs[i] = evalRun{name: model, predictions: make([]evalPrediction, len(cases))}
+	}
+	forEachParallel(len(cases), workers, func(i int) {
+		path := filepath.Join(dir, cases[i].File)
+		content, err := namer.ExtractContent(context.Background(), path)
+		if err != nil {
+			log.Printf("Error processing %s: %v", cases[i].File, err)
+		}
+		for m, n := range namers {
+			prediction := evalPrediction{usage: content.Usage, err: err}
+			if err == nil {
+				var usage nombra.Usage
+				prediction.metadata, usage, prediction.err = n.ContentMetadata(context.Background(), content)
+				prediction.usage = prediction.usage.Add(usage)
+				prediction.title, _ = n.BuildTitle(prediction.metadata)
+			}
+			if verbose {
+				log.Printf("%s [%s]: %q", cases[i].File, models[m], prediction.title)
+			}
+			runs[m].predictions[i] = prediction
+		}
+	})
+	return runs, nil
+}
+
+// forEachParallel calls fn for 0..n-1 on up to limit goroutines.
+func forEachParallel(n, limit int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, min(limit, n)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// scoreRun compares the predictions of run with the ground truth.
+func scoreRun(run evalRun, cases []evalCase) evalReport {
+	report := evalReport{Name: run.name, Documents: len(cases), Fields: map[string]*fieldScore{}}
+	similarity, compared := 0.0, 0
+	for i, c := range cases {
+		prediction := run.predictions[i]
+		report.Usage = report.Usage.Add(prediction.usage)
+		if prediction.err != nil {
+			report.Failed++
+		}
+
+		want, got := evalFieldValues(c.Metadata), evalFieldValues(prediction.metadata)
+		for name, expected := range want {
+			score := report.Fields[name]
+			if score == nil {
+				score = &fieldScore{}
+				report.Fields[name] = score
+			}
+			correct := sameFieldValue(name, got[name], expected)
+			score.add(correct)
+			if !correct && verbose {
+				log.Printf("%s [%s]: %s = %q, want %q", c.File, run.name, name, got[name], expected)
+			}
+		}
+
+		if c.Filename != "" {
+			report.FilenameExact.add(strings.EqualFold(prediction.title, c.Filename))
+			similarity += stringSimilarity(strings.ToLower(prediction.title), strings.ToLower(c.Filename))
+			compared++
+		}
+	}
+	if compared > 0 {
+		report.FilenameSimilarity = similarity / float64(compared)
+	}
+	if report.Documents > 0 {
+		report.CostPerDocument = report.Usage.Cost / float64(report.Documents)
+	}
+	return report
+}
+
+// evalFieldValues returns the non-empty fields of metadata by JSON name,
+// with custom fields under their own names.
+func evalFieldValues(metadata nombra.Metadata) map[string]string {
+	values := map[string]string{
+		"date":          metadata.Date,
+		"language":      metadata.Language,
+		"title":         metadata.Title,
+		"document_type": metadata.DocumentType,
+		"organization":  metadata.Organization,
+		"author":        metadata.Author,
+		"recipient":     metadata.Recipient,
+		"topic":         metadata.Topic,
+	}
+	for name, value := range metadata.Extra {
+		values[name] = value
+	}
+	for name, value := range values {
+		if strings.TrimSpace(value) == "" {
+			delete(values, name)
+		}
+	}
+	return values
+}
+
+// sameFieldValue compares dates exactly, whatever their separators, and
+// other values ignoring case and punctuation.
+func sameFieldValue(field, got, want string) bool {
+	if field == "date" {
+		normalize := strings.NewReplacer("-", ".", "/", ".").Replace
+		return normalize(strings.TrimSpace(got)) == normalize(strings.TrimSpace(want))
+	}
+	return comparableValue(got) == comparableValue(want)
+}
+
+func comparableValue(value string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// stringSimilarity is 1 minus the edit distance of a and b relative to the
+// longer one, so identical strings score 1.
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longest)
+}
+
+// editDistance is the Levenshtein distance of a and b.
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// evalFieldOrder lists the built-in fields in the order they are reported.
+var evalFieldOrder = []string{"date", "title", "document_type", "organization", "recipient", "author", "topic", "language"}
+
+// writeEvalTable prints one column per run.
+func writeEvalTable(w io.Writer, reports []evalReport) error {
+	var fields []string
+	var custom []string
+	for _, report := range reports {
+		for name := range report.Fields {
+			if !slices.Contains(evalFieldOrder, name) && !slices.Contains(custom, name) {
+				custom = append(custom, name)
+			}
+		}
+	}
+	sort.Strings(custom)
+	for _, name := range append(slices.Clone(evalFieldOrder), custom...) {
+		for _, report := range reports {
+			if report.Fields[name] != nil {
+				fields = append(fields, name)
+				break
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	row := func(label string, cell func(evalReport) string) {
+		fmt.Fprintf(tw, "%s\t", label)
+		for _, report := range reports {
+			fmt.Fprintf(tw, "%s\t", cell(report))
+		}
+		fmt.Fprintln(tw)
+	}
+	percent := func(s *fieldScore) string {
+		if s == nil || s.Total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%% (%d/%d)", 100*s.accuracy(), s.Correct, s.Total)
+	}
+
+	row("", func(r evalReport) string { return r.Name })
+	row("documents", func(r evalReport) string { return fmt.Sprint(r.Documents) })
+	row("failed", func(r evalReport) string { return fmt.Sprint(r.Failed) })
+	for _, name := range fields {
+		label := name
+		if name == "date" {
+			label = "date (exact)"
+		}
+		row(label, func(r evalReport) string { return percent(r.Fields[name]) })
+	}
+	row("filename (exact)", func(r evalReport) string { return percent(&r.FilenameExact) })
+	row("filename similarity", func(r evalReport) string {
+		if r.FilenameExact.Total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.3f", r.FilenameSimilarity)
+	})
+	row("tokens", func(r evalReport) string { return fmt.Sprint(r.Usage.TotalTokens) })
+	row("cost", func(r evalReport) string { return fmt.Sprintf("$%.4f", r.Usage.Cost) })
+	row("cost per document", func(r evalReport) string { return fmt.Sprintf("$%.5f", r.CostPerDocument) })
+	return tw.Flush()
+}
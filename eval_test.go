@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+func writeEvalCorpus(t *testing.T) (dir, truth string) {
+	t.Helper()
+	dir = t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("Invoice for the consulting services of January"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("Contract between ACME and Rafa about the lease"), 0o644)
+	truth = filepath.Join(t.TempDir(), "truth.jsonl")
+	os.WriteFile(truth, []byte(`{"file": "a.txt", "filename": "2025.01.15 - Invoice - ACME.txt", "metadata": {"date": "2025-01-15", "document_type": "invoice", "organization": "Acme"}}
+
+{"file": "b.txt", "filename": "2025.02.01 - Contract - ACME", "metadata": {"date": "2025.02.01", "document_type": "Contract"}}
+`), 0o644)
+	return dir, truth
+}
+
+func TestLoadGroundTruth(t *testing.T) {
+	_, truth := writeEvalCorpus(t)
+	cases, err := loadGroundTruth(truth)
+	if err != nil {
+		t.Fatalf("loadGroundTruth returned error: %v", err)
+	}
+	if len(cases) != 2 || cases[0].Filename != "2025.01.15 - Invoice - ACME" || cases[1].Metadata.DocumentType != "Contract" {
+		t.Errorf("cases = %+v", cases)
+	}
+
+	for _, bad := range []string{
+		`{"file": "a.txt", "filname": "x"}`,
+		`{"file": "a.txt"}`,
+		`{"file": "/abs/a.txt", "filename": "x"}`,
+		"{\"file\": \"a.txt\", \"filename\": \"x\"}\n{\"file\": \"a.txt\", \"filename\": \"y\"}",
+		"",
+	} {
+		os.WriteFile(truth, []byte(bad), 0o644)
+		if _, err := loadGroundTruth(truth); err == nil {
+			t.Errorf("loadGroundTruth(%s) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestStringSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"invoice", "invoice", 1},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"abc", "", 0},
+	}
+	for _, tt := range tests {
+		if got := stringSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("stringSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRunEvalModels(t *testing.T) {
+	useTestNamer(t, nombra.Options{Client: pricedProvider{}, MinContentLength: 10})
+	dir, truth := writeEvalCorpus(t)
+
+	reports, err := runEval(dir, truth, []string{"gpt-5.4", "gpt-5-mini"}, nil)
+	if err != nil {
+		t.Fatalf("runEval returned error: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Name != "gpt-5.4" || reports[1].Name != "gpt-5-mini" {
+		t.Fatalf("reports = %+v", reports)
+	}
+	for _, report := range reports {
+		if report.Documents != 2 || report.Failed != 0 {
+			t.Errorf("%s: documents = %d, failed = %d", report.Name, report.Documents, report.Failed)
+		}
+		if got := *report.Fields["date"]; got != (fieldScore{Correct: 1, Total: 2}) {
+			t.Errorf("%s: date = %+v", report.Name, got)
+		}
+		if got := *report.Fields["document_type"]; got != (fieldScore{Correct: 2, Total: 2}) {
+			t.Errorf("%s: document_type = %+v", report.Name, got)
+		}
+		if got := *report.Fields["organization"]; got != (fieldScore{Correct: 1, Total: 1}) {
+			t.Errorf("%s: organization = %+v", report.Name, got)
+		}
+		if report.FilenameExact != (fieldScore{Correct: 1, Total: 2}) || report.FilenameSimilarity <= 0.9 || report.FilenameSimilarity >= 1 {
+			t.Errorf("%s: filename exact = %+v, similarity = %v", report.Name, report.FilenameExact, report.FilenameSimilarity)
+		}
+		if report.Usage.TotalTokens != 2200 {
+			t.Errorf("%s: tokens = %d", report.Name, report.Usage.TotalTokens)
+		}
+	}
+	// 2 x (1000 x $0.25 + 100 x $2) per million tokens.
+	if cost := reports[1].Usage.Cost; math.Abs(cost-0.0009) > 1e-9 {
+		t.Errorf("gpt-5-mini cost = %v", cost)
+	}
+
+	var buf bytes.Buffer
+	if err := writeEvalTable(&buf, reports); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"gpt-5-mini", "date (exact)", "50.0% (1/2)", "filename similarity", "$0.0009"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("table lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRunEvalRecorded(t *testing.T) {
+	dir, truth := writeEvalCorpus(t)
+	recorded := filepath.Join(t.TempDir(), "run.jsonl")
+	os.WriteFile(recorded, []byte(`{"type":"file","original_path":"`+filepath.Join(dir, "a.txt")+`","title":"2025.01.15 - Invoice - ACME","status":"dry-run","metadata":{"date":"2025.01.15","document_type":"Invoice","organization":"ACME"},"usage":{"total_tokens":1100}}
+{"type":"summary","total":1,"succeeded":1}
+`), 0o644)
+
+	reports, err := runEval(dir, truth, nil, []string{recorded})
+	if err != nil {
+		t.Fatalf("runEval returned error: %v", err)
+	}
+	report := reports[0]
+	if report.Name != "run.jsonl" || report.Failed != 1 || report.FilenameExact != (fieldScore{Correct: 1, Total: 2}) || report.Usage.TotalTokens != 1100 {
+		t.Errorf("report = %+v", report)
+	}
+	if got := *report.Fields["date"]; got != (fieldScore{Correct: 1, Total: 2}) {
+		t.Errorf("date = %+v", got)
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+// Decisions on the review screen.
+const (
+	decisionPending  = ""
+	decisionAccepted = "accepted"
+	decisionRejected = "rejected"
+)
+
+// metadataFieldNames are the built-in fields that can be edited on the
+// review screen, in the order they are shown.
+var metadataFieldNames = []string{"date", "title", "document_type", "organization", "recipient", "author", "topic", "language"}
+
+const reviewHelp = `Commands (N is a number, a list such as 1,3-5, or "all"):
+  a N                accept
+  r N                reject
+  t N [title]        edit the title and accept
+  e N field=value    edit a metadata field, rebuild the title and accept
+  g N                ask the model again
+  s N                show the metadata
+  l                  list the proposals again
+  w                  rename the accepted files and exit
+  q                  exit without renaming anything
+`
+
+// reviewItem is a proposed rename on the review screen.
+type reviewItem struct {
+	result   fileResult
+	decision string
+	// edited is set once the title or metadata were changed by hand, which
+	// makes the confidence score meaningless.
+	edited bool
+}
+
+// reviewSession is the batch review screen of --interactive. Items are numbered
+// from 1.
+type reviewSession struct {
+	items []*reviewItem
+	in    *bufio.Reader
+	out   io.Writer
+}
+
+// reviewBatch names all files without renaming them, lets the user accept,
+// reject, edit or regenerate each proposal and then renames only the
+// accepted files. Proposals below --min-confidence start out rejected and
+// are held back as --review says unless the user accepts them.
+func reviewBatch(files []string, workerCount int, in io.Reader, out io.Writer) []fileResult {
+	fmt.Fprintf(out, "Analyzing %d files...\n", len(files))
+	results := processJobs(files, workerCount, true)
+
+	session := &reviewSession{in: bufio.NewReader(in), out: out}
+	for _, result := range results {
+		if result.err == nil && !result.skipped && result.title != "" {
+			session.items = append(session.items, &reviewItem{result: result, decision: initialDecision(result)})
+		}
+	}
+	if len(session.items) == 0 {
+		return results
+	}
+
+	apply := session.run()
+	for _, item := range session.items {
+		result := item.result
+		proposed := result.newPath
+		result.newPath = ""
+		switch {
+		case !apply:
+			result.skipped, result.skipReason = true, "review cancelled"
+		case item.decision == decisionAccepted:
+			start := time.Now()
+			result.review = false
+			result = renameFile(result, result.path, result.hash, result.claimed)
+			result.duration += time.Since(start)
+			if result.err != nil {
+				result.newPath = proposed
+			}
+		case result.review:
+			result = reviewFile(result, result.path, result.hash, result.claimed)
+		case item.decision == decisionRejected:
+			result.skipped, result.skipReason = true, "rejected in review"
+		default:
+			result.skipped, result.skipReason = true, "not accepted in review"
+		}
+		results[result.index] = result
+	}
+	return results
+}
+
+// initialDecision rejects proposals below --min-confidence until the user
+// accepts them.
+func initialDecision(result fileResult) string {
+	if result.review {
+		return decisionRejected
+	}
+	return decisionPending
+}
+
+// run reads commands until the user applies or abandons the review. It
+// reports whether the accepted renames should be applied; closed input
+// abandons the review.
+func (s *reviewSession) run() bool {
+	s.list()
+	fmt.Fprint(s.out, reviewHelp)
+	for {
+		fmt.Fprintf(s.out, "review (%s)> ", s.counts())
+		line, err := s.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(s.out, "\nNo files renamed.")
+			return false
+		}
+		command, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		args = strings.TrimSpace(args)
+		switch command {
+		case "":
+		case "a", "r":
+			decision := decisionAccepted
+			if command == "r" {
+				decision = decisionRejected
+			}
+			s.forEach(args, func(item *reviewItem) { item.decision = decision })
+			s.list()
+		case "t":
+			s.editTitle(args)
+		case "e":
+			s.editField(args)
+		case "g":
+			s.forEach(args, s.regenerate)
+			s.list()
+		case "s":
+			s.forEach(args, s.show)
+		case "l":
+			s.list()
+		case "w":
+			accepted := s.count(decisionAccepted)
+			fmt.Fprintf(s.out, "Renaming %d of %d files.\n\n", accepted, len(s.items))
+			return true
+		case "q":
+			fmt.Fprintln(s.out, "No files renamed.")
+			return false
+		case "?", "h", "help":
+			fmt.Fprint(s.out, reviewHelp)
+		default:
+			fmt.Fprintf(s.out, "Unknown command %q. Type ? for help.\n", command)
+		}
+	}
+}
+
+func (s *reviewSession) list() {
+	fmt.Fprintln(s.out)
+	for i, item := range s.items {
+		mark := " "
+		switch item.decision {
+		case decisionAccepted:
+			mark = "+"
+		case decisionRejected:
+			mark = "-"
+		}
+		from, to := displayPaths(item.result.path, item.result.newPath)
+		note := ""
+		switch {
+		case item.edited:
+			note = "edited"
+		case item.result.review:
+			note = fmt.Sprintf("confidence %.0f%%, below --min-confidence", 100*item.result.confidence.Score)
+		case item.result.confidence.Score < 1:
+			note = fmt.Sprintf("confidence %.0f%%", 100*item.result.confidence.Score)
+		}
+		if item.result.duplicate != nil {
+			note = strings.TrimPrefix(note+"; "+describeDuplicate(item.result.duplicate), "; ")
+		}
+		fmt.Fprintf(s.out, "%3d [%s] %s\n        -> %s\n", i+1, mark, from, to)
+		if note != "" {
+			fmt.Fprintf(s.out, "        (%s)\n", note)
+		}
+	}
+	fmt.Fprintln(s.out)
+}
+
+func (s *reviewSession) count(decision string) int {
+	n := 0
+	for _, item := range s.items {
+		if item.decision == decision {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *reviewSession) counts() string {
+	return fmt.Sprintf("%d accepted, %d rejected, %d pending", s.count(decisionAccepted), s.count(decisionRejected), s.count(decisionPending))
+}
+
+// forEach calls fn for the items numbered in args.
+func (s *reviewSession) forEach(args string, fn func(item *reviewItem)) {
+	numbers, err := parseItemNumbers(args, len(s.items))
+	if err != nil {
+		fmt.Fprintf(s.out, "Error: %v\n", err)
+		return
+	}
+	for _, n := range numbers {
+		fn(s.items[n-1])
+	}
+}
+
+// item returns the single item numbered at the start of args and the rest
+// of args.
+func (s *reviewSession) item(args string) (*reviewItem, string, bool) {
+	number, rest, _ := strings.Cut(args, " ")
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > len(s.items) {
+		fmt.Fprintf(s.out, "Error: give a file number from 1 to %d\n", len(s.items))
+		return nil, "", false
+	}
+	return s.items[n-1], strings.TrimSpace(rest), true
+}
+
+// prompt asks for a value, keeping current when the answer is empty.
+func (s *reviewSession) prompt(label, current string) string {
+	if current == "" {
+		fmt.Fprintf(s.out, "%s: ", label)
+	} else {
+		fmt.Fprintf(s.out, "%s [%s]: ", label, current)
+	}
+	answer, _ := s.in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return current
+	}
+	return answer
+}
+
+func (s *reviewSession) editTitle(args string) {
+	item, title, ok := s.item(args)
+	if !ok {
+		return
+	}
+	if title == "" {
+		title = s.prompt("Title", item.result.title)
+	}
+	if title == "" {
+		fmt.Fprintln(s.out, "Error: the title cannot be empty")
+		return
+	}
+	item.result.title = title
+	item.result.newPath = namer.ProposedPath(item.result.path, title, item.result.metadata)
+	item.decision, item.edited = decisionAccepted, true
+	s.list()
+}
+
+func (s *reviewSession) editField(args string) {
+	item, assignment, ok := s.item(args)
+	if !ok {
+		return
+	}
+	name, value, hasValue := strings.Cut(assignment, "=")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = s.prompt("Field", "")
+	}
+	metadata := item.result.metadata
+	metadata.Extra = maps.Clone(metadata.Extra)
+	current, _ := metadataField(metadata, name)
+	if !hasValue {
+		value = s.prompt(name, current)
+	}
+	if err := setMetadataField(&metadata, name, strings.TrimSpace(value)); err != nil {
+		fmt.Fprintf(s.out, "Error: %v\n", err)
+		return
+	}
+	title, ok := namer.BuildTitle(metadata)
+	if !ok {
+		fmt.Fprintln(s.out, "Error: no filename can be built from the edited metadata; change not applied")
+		return
+	}
+	item.result.metadata, item.result.title = metadata, title
+	item.result.newPath = namer.ProposedPath(item.result.path, title, metadata)
+	item.decision, item.edited = decisionAccepted, true
+	s.list()
+}
+
+// regenerate asks the model again, bypassing the cache, and puts the new
+// proposal up for review. Nothing is asked once --max-cost or --max-tokens
+// is used up.
+func (s *reviewSession) regenerate(item *reviewItem) {
+	if reason := spend.reason(); reason != "" {
+		fmt.Fprintf(s.out, "Not regenerating %s: %s\n", filepath.Base(item.result.path), reason)
+		return
+	}
+	fmt.Fprintf(s.out, "Regenerating %s...\n", filepath.Base(item.result.path))
+	result, err := regenerateTitle(item.result)
+	if err != nil {
+		fmt.Fprintf(s.out, "Error: %v\n", err)
+	}
+	item.result = result
+	if err == nil {
+		item.result.review = needsReview(result)
+		item.decision, item.edited = initialDecision(item.result), false
+	}
+}
+
+func (s *reviewSession) show(item *reviewItem) {
+	fmt.Fprintf(s.out, "%s\n", filepath.Base(item.result.path))
+	for _, name := range append(slices.Clone(metadataFieldNames), customFieldNames()...) {
+		if value, _ := metadataField(item.result.metadata, name); value != "" {
+			fmt.Fprintf(s.out, "  %-14s %s\n", name+":", value)
+		}
+	}
+	if !item.edited {
+		fmt.Fprintf(s.out, "  %-14s %s\n", "confidence:", formatConfidence(item.result.confidence))
+	}
+	if item.result.usage.TotalTokens > 0 {
+		fmt.Fprintf(s.out, "  %-14s %s\n", "usage:", formatUsage(item.result.usage))
+	}
+}
+
+// regenerateTitle extracts the metadata of a file again without the cache
+// and replaces the cached entry with the new answer. Usage adds up.
+func regenerateTitle(result fileResult) (fileResult, error) {
+	ctx := context.Background()
+	content, err := namer.ExtractContent(ctx, result.path)
+	result.usage = result.usage.Add(content.Usage)
+	spend.add(content.Usage)
+	if err != nil {
+		return result, err
+	}
+	metadata, usage, err := namer.ContentMetadata(ctx, content)
+	result.usage = result.usage.Add(usage)
+	spend.add(usage)
+	if err != nil {
+		return result, fmt.Errorf("title generation failed: %w", err)
+	}
+	result.title, _ = namer.BuildTitle(metadata)
+	result.metadata, result.method = metadata, content.Method
+	result.confidence = namer.Confidence(content, metadata)
+	result.newPath = namer.ProposedPath(result.path, result.title, metadata)
+
+	if metadataCache != nil {
+		var signature []uint64
+		if content.Method != nombra.MethodVision {
+			signature = minhashSignature(content.Text)
+		}
+		if err := metadataCache.put(cacheKey(result.hash), metadata, content, signature); err != nil {
+			log.Printf("Warning: could not write cache entry for %s: %v", filepath.Base(result.path), err)
+		}
+	}
+	return result, nil
+}
+
+// parseItemNumbers parses "all" or a comma separated list of numbers and
+// ranges such as 1,3-5 between 1 and count.
+func parseItemNumbers(args string, count int) ([]int, error) {
+	args = strings.TrimSpace(args)
+	if args == "all" || args == "*" {
+		numbers := make([]int, count)
+		for i := range numbers {
+			numbers[i] = i + 1
+		}
+		return numbers, nil
+	}
+	if args == "" {
+		return nil, fmt.Errorf("give file numbers, e.g. 1,3-5 or all")
+	}
+	var numbers []int
+	for _, part := range strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' }) {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(last)
+		}
+		if err != nil || from < 1 || to > count || from > to {
+			return nil, fmt.Errorf("invalid file number %q: use numbers from 1 to %d", part, count)
+		}
+		for n := from; n <= to; n++ {
+			if !slices.Contains(numbers, n) {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	return numbers, nil
+}
+
+// metadataField returns a built-in or custom field by name.
+func metadataField(metadata nombra.Metadata, name string) (string, bool) {
+	switch name {
+	case "date":
+		return metadata.Date, true
+	case "language":
+		return metadata.Language, true
+	case "title":
+		return metadata.Title, true
+	case "document_type":
+		return metadata.DocumentType, true
+	case "organization":
+		return metadata.Organization, true
+	case "author":
+		return metadata.Author, true
+	case "recipient":
+		return metadata.Recipient, true
+	case "topic":
+		return metadata.Topic, true
+	}
+	if slices.Contains(customFieldNames(), name) {
+		return metadata.Extra[name], true
+	}
+	return "", false
+}
+
+// setMetadataField sets a built-in or custom field by name. An empty value
+// clears it.
+func setMetadataField(metadata *nombra.Metadata, name, value string) error {
+	switch name {
+	case "date":
+		metadata.Date = value
+	case "language":
+		metadata.Language = value
+	case "title":
+		metadata.Title = value
+	case "document_type":
+		metadata.DocumentType = value
+	case "organization":
+		metadata.Organization = value
+	case "author":
+		metadata.Author = value
+	case "recipient":
+		metadata.Recipient = value
+	case "topic":
+		metadata.Topic = value
+	default:
+		if !slices.Contains(customFieldNames(), name) {
+			return fmt.Errorf("unknown field %q. fields: %s", name, strings.Join(append(slices.Clone(metadataFieldNames), customFieldNames()...), ", "))
+		}
+		if metadata.Extra == nil {
+			metadata.Extra = map[string]string{}
+		}
+		if value == "" {
+			delete(metadata.Extra, name)
+		} else {
+			metadata.Extra[name] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+// versionedProvider answers like metadataProvider with the organization
+// numbered by call, so that regenerated answers differ. Each answer costs ten
+// tokens.
+type versionedProvider struct{ calls *atomic.Int32 }
+
+func (p versionedProvider) Complete(ctx context.Context, req nombra.CompletionRequest) (nombra.Completion, error) {
+	kind := strings.Fields(req.User)[0]
+	n := p.calls.Add(1)
+	usage := nombra.Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10}
+	return nombra.Completion{Content: fmt.Sprintf(`{"date":"2025.01.15","document_type":%q,"organization":"ACME %d"}`, kind, n), Usage: usage}, nil
+}
+
+func (versionedProvider) DescribeImage(ctx context.Context, req nombra.ImageRequest) (nombra.Completion, error) {
+	return nombra.Completion{}, fmt.Errorf("no vision")
+}
+
+func writeReviewFiles(t *testing.T) (string, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	var files []string
+	for i, text := range []string{"Invoice for consulting services", "Contract between ACME and Rafa", "Letter about the lease renewal"} {
+		path := filepath.Join(dir, fmt.Sprintf("scan%d.txt", i+1))
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	return dir, files
+}
+
+func TestParseItemNumbers(t *testing.T) {
+	tests := []struct {
+		args string
+		want []int
+	}{
+		{"all", []int{1, 2, 3, 4}},
+		{"2", []int{2}},
+		{"1,3-4", []int{1, 3, 4}},
+		{"4 2 2", []int{4, 2}},
+	}
+	for _, tt := range tests {
+		got, err := parseItemNumbers(tt.args, 4)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseItemNumbers(%q) = %v, %v; want %v", tt.args, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "0", "5", "3-2", "x", "1-"} {
+		if _, err := parseItemNumbers(bad, 4); err == nil {
+			t.Errorf("parseItemNumbers(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestReviewBatch(t *testing.T) {
+	var calls atomic.Int32
+	useTestNamer(t, nombra.Options{Client: versionedProvider{&calls}, MinContentLength: 10})
+	dir, files := writeReviewFiles(t)
+
+	input := strings.Join([]string{
+		"r 2",
+		"t 3 Lease Letter",
+		"e 1 organization=Initech",
+		"e 1 bogus=1",
+		"e 1 document_type=",
+		"s 1",
+		"frobnicate",
+		"w",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	results := reviewBatch(files, 2, strings.NewReader(input), &out)
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if want := filepath.Join(dir, "2025.01.15 - Invoice - Initech.txt"); results[0].err != nil || results[0].newPath != want {
+		t.Errorf("first result = %+v; want renamed to %s", results[0], want)
+	}
+	if !results[1].skipped || results[1].skipReason != "rejected in review" {
+		t.Errorf("second result = %+v; want rejected", results[1])
+	}
+	if want := filepath.Join(dir, "Lease Letter.txt"); results[2].newPath != want {
+		t.Errorf("third result = %+v; want renamed to %s", results[2], want)
+	}
+	for _, name := range []string{"2025.01.15 - Invoice - Initech.txt", "scan2.txt", "Lease Letter.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %v\n%s", name, err, out.String())
+		}
+	}
+	for _, want := range []string{`unknown field "bogus"`, "no filename can be built", "organization:  Initech", `Unknown command "frobnicate"`, "Renaming 2 of 3 files."} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestReviewBatchRegenerate(t *testing.T) {
+	var calls atomic.Int32
+	useTestNamer(t, nombra.Options{Client: versionedProvider{&calls}, MinContentLength: 10})
+	dir, files := writeReviewFiles(t)
+
+	var out bytes.Buffer
+	results := reviewBatch(files, 1, strings.NewReader("g 1\na 1\nw\n"), &out)
+	if want := filepath.Join(dir, "2025.01.15 - Invoice - ACME 4.txt"); results[0].newPath != want {
+		t.Errorf("regenerated result = %+v; want renamed to %s\n%s", results[0], want, out.String())
+	}
+	if !results[1].skipped || results[1].skipReason != "not accepted in review" {
+		t.Errorf("pending result = %+v", results[1])
+	}
+}
+
+func TestReviewBatchRegenerateStopsAtBudget(t *testing.T) {
+	var calls atomic.Int32
+	useTestNamer(t, nombra.Options{Client: versionedProvider{&calls}, MinContentLength: 10})
+	t.Cleanup(func() { spend = nil })
+	spend = newBudget(0, 25)
+	_, files := writeReviewFiles(t)
+
+	// Naming the three files uses up the budget.
+	var out bytes.Buffer
+	results := reviewBatch(files, 1, strings.NewReader("g 1\nq\n"), &out)
+	if calls.Load() != 3 {
+		t.Errorf("model was asked %d times; want 3", calls.Load())
+	}
+	if !strings.Contains(out.String(), "Not regenerating scan1.txt: budget of 25 tokens reached") {
+		t.Errorf("output = %s", out.String())
+	}
+	if !results[0].skipped || results[0].skipReason != "review cancelled" {
+		t.Errorf("result = %+v", results[0])
+	}
+}
+
+func TestReviewBatchMinConfidence(t *testing.T) {
+	var calls atomic.Int32
+	useTestNamer(t, nombra.Options{Client: versionedProvider{&calls}, MinContentLength: 10})
+	// Date, document type and organization without a topic score 0.9.
+	useReview(t, 0.95, reviewFolder)
+	dir, files := writeReviewFiles(t)
+
+	var out bytes.Buffer
+	results := reviewBatch(files, 1, strings.NewReader("l\na 2\nw\n"), &out)
+	if !strings.Contains(out.String(), "review (0 accepted, 3 rejected, 0 pending)") || !strings.Contains(out.String(), "(confidence 90%, below --min-confidence)") {
+		t.Errorf("output = %s", out.String())
+	}
+	if results[1].err != nil || results[1].review || filepath.Dir(results[1].newPath) != dir {
+		t.Errorf("accepted result = %+v; want renamed", results[1])
+	}
+	for _, i := range []int{0, 2} {
+		want := filepath.Join(dir, reviewDirName, filepath.Base(files[i]))
+		if results[i].skipped || !results[i].review || results[i].newPath != want {
+			t.Errorf("result %d = %+v; want moved to %s", i, results[i], want)
+		}
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("result %d: %v", i, err)
+		}
+	}
+}
+
+func TestReviewBatchCancelled(t *testing.T) {
+	useTestNamer(t, nombra.Options{MinContentLength: 10})
+	for _, input := range []string{"a all\nq\n", "a all\n"} {
+		_, files := writeReviewFiles(t)
+		var out bytes.Buffer
+		results := reviewBatch(files, 2, strings.NewReader(input), &out)
+		for i, result := range results {
+			if !result.skipped || result.skipReason != "review cancelled" || result.newPath != "" {
+				t.Errorf("%q: result %d = %+v", input, i, result)
+			}
+			if _, err := os.Stat(files[i]); err != nil {
+				t.Errorf("%q: %v", input, err)
+			}
+		}
+		if !strings.Contains(out.String(), "No files renamed.") {
+			t.Errorf("%q: output = %s", input, out.String())
+		}
+	}
+}
@@ -0,0 +1,557 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+	"github.com/spf13/cobra"
+)
+
+const (
+	journalActionRename = "rename"
+	journalActionCopy   = "copy"
+	journalActionDelete = "delete"
+	journalActionRemove = "remove"
+	journalActionSplit  = "split"
+	journalActionUndo   = "undo"
+)
+
+// journal records the renames of the current run, nil when nothing is renamed.
+var journal *renameJournal
+
+// journalEntry is one line of a run journal. Rename entries are written as
+// files are renamed; undo entries are appended when `nombra undo` restores them.
+// A delete entry names a deleted file in OriginalPath and a file with the same
+// content in NewPath; a remove entry names where a removed file was put away;
+// a split entry names a part written from the batch in OriginalPath.
+type journalEntry struct {
+	RunID        string           `json:"run_id"`
+	Action       string           `json:"action"`
+	Timestamp    time.Time        `json:"timestamp"`
+	OriginalPath string           `json:"original_path"`
+	NewPath      string           `json:"new_path"`
+	SHA256       string           `json:"sha256"`
+	Provider     string           `json:"provider,omitempty"`
+	Model        string           `json:"model,omitempty"`
+	Metadata     *nombra.Metadata `json:"metadata,omitempty"`
+}
+
+// renameJournal is an append-only JSON Lines file per run. The file is created
+// on the first write so runs that rename nothing leave no journal behind.
+type renameJournal struct {
+	mu      sync.Mutex
+	runID   string
+	path    string
+	file    *os.File
+	renames int // entries that undo can revert
+	removed int
+	listed  int // files on the review list
+}
+
+type undoResult struct {
+	entry   journalEntry
+	skipped bool
+	err     error
+}
+
+// stateDir returns the directory for nombra's persistent state, following the
+// XDG base directory specification.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "nombra"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine state directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "nombra"), nil
+}
+
+func journalDir() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runs"), nil
+}
+
+// newRunID returns an identifier that sorts chronologically.
+func newRunID() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return time.Now().Format("20060102-150405.000000")
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+func newRenameJournal(runID string) (*renameJournal, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	return &renameJournal{runID: runID, path: filepath.Join(dir, runID+".jsonl")}, nil
+}
+
+func (j *renameJournal) recordRename(originalPath, newPath, hash string, metadata nombra.Metadata) error {
+	return j.recordFile(journalActionRename, originalPath, newPath, hash, metadata)
+}
+
+// recordCopy records a named copy made with --dest-mode copy. Undoing it
+// deletes the copy.
+func (j *renameJournal) recordCopy(originalPath, newPath, hash string, metadata nombra.Metadata) error {
+	return j.recordFile(journalActionCopy, originalPath, newPath, hash, metadata)
+}
+
+func (j *renameJournal) recordFile(action, originalPath, newPath, hash string, metadata nombra.Metadata) error {
+	return j.record(journalEntry{
+		Action:       action,
+		OriginalPath: originalPath,
+		NewPath:      newPath,
+		SHA256:       hash,
+		Provider:     providerName,
+		Model:        model,
+		Metadata:     &metadata,
+	})
+}
+
+// recordSplit records a part written by split. Undoing it deletes the part.
+func (j *renameJournal) recordSplit(batchPath, partPath, hash string) error {
+	return j.record(journalEntry{Action: journalActionSplit, OriginalPath: batchPath, NewPath: partPath, SHA256: hash})
+}
+
+// recordDelete records a deleted file whose content is still held by
+// keptPath. Undo copies it back from there, or from wherever the run moved
+// the kept file.
+func (j *renameJournal) recordDelete(path, keptPath, hash string) error {
+	return j.record(journalEntry{Action: journalActionDelete, OriginalPath: path, NewPath: keptPath, SHA256: hash})
+}
+
+// remove moves a file the run would delete into the run's folder in the
+// state directory, from where undo moves it back.
+func (j *renameJournal) remove(path, hash string) error {
+	j.mu.Lock()
+	j.removed++
+	stored := filepath.Join(strings.TrimSuffix(j.path, ".jsonl"), "removed", fmt.Sprintf("%d-%s", j.removed, filepath.Base(path)))
+	j.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(stored), 0o700); err != nil {
+		return fmt.Errorf("failed to create folder for removed files: %w", err)
+	}
+	if err := nombra.MoveFile(path, stored); err != nil {
+		return err
+	}
+	if err := j.record(journalEntry{Action: journalActionRemove, OriginalPath: path, NewPath: stored, SHA256: hash}); err != nil {
+		// Without its entry the file could not be found again.
+		if restoreErr := nombra.MoveFile(stored, path); restoreErr != nil {
+			return fmt.Errorf("%w; the file was left at %s", err, stored)
+		}
+		return err
+	}
+	return nil
+}
+
+// listForReview adds a file held back by --review list to the run's review
+// list, a tab separated file of path, confidence score and proposed name.
+func (j *renameJournal) listForReview(path string, score float64, proposedName string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	listPath := j.reviewListPath()
+	if err := os.MkdirAll(filepath.Dir(listPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create folder for the review list: %w", err)
+	}
+	file, err := os.OpenFile(listPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open review list: %w", err)
+	}
+	if _, err := fmt.Fprintf(file, "%s\t%.2f\t%s\n", path, score, proposedName); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write review list: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write review list: %w", err)
+	}
+	j.listed++
+	return nil
+}
+
+// reviewListPath is where listForReview writes, in the run's folder in the
+// state directory.
+func (j *renameJournal) reviewListPath() string {
+	return filepath.Join(strings.TrimSuffix(j.path, ".jsonl"), "review.tsv")
+}
+
+// record appends an entry that undo can revert.
+func (j *renameJournal) record(entry journalEntry) error {
+	err := j.append(entry)
+	if err == nil {
+		j.mu.Lock()
+		j.renames++
+		j.mu.Unlock()
+	}
+	return err
+}
+
+func (j *renameJournal) append(entry journalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+			return fmt.Errorf("failed to create journal directory: %w", err)
+		}
+		file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open journal: %w", err)
+		}
+		j.file = file
+	}
+
+	entry.RunID = j.runID
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return j.file.Sync()
+}
+
+func (j *renameJournal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// listRuns returns the run IDs that have a journal, oldest first.
+func listRuns() ([]string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+
+	var runs []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".jsonl" {
+			continue
+		}
+		runs = append(runs, strings.TrimSuffix(entry.Name(), ".jsonl"))
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+func readJournal(path string) ([]journalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("journal %s line %d: %w", filepath.Base(path), line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return entries, nil
+}
+
+// undoRun restores the names recorded in the journal of runID, newest rename
+// first. Files that changed since the rename, or whose original name is taken
+// again, are left untouched and reported as failures.
+func undoRun(runID string) ([]undoResult, error) {
+	j, err := newRenameJournal(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer j.close()
+
+	entries, err := readJournal(j.path)
+	if err != nil {
+		return nil, err
+	}
+
+	undone := map[string]struct{}{}
+	for _, entry := range entries {
+		if entry.Action == journalActionUndo {
+			undone[entry.OriginalPath+"\x00"+entry.NewPath] = struct{}{}
+		}
+	}
+
+	// A split part may have changed after it was written, when metadata was
+	// written on renaming it, so the hash of its rename applies once that is
+	// undone.
+	renamedHashes := map[string]string{}
+
+	var results []undoResult
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		switch entry.Action {
+		case journalActionUndo:
+			continue
+		case journalActionRename:
+			renamedHashes[entry.OriginalPath] = entry.SHA256
+		case journalActionSplit:
+			if hash, ok := renamedHashes[entry.NewPath]; ok {
+				entry.SHA256 = hash
+			}
+		}
+		if _, ok := undone[entry.OriginalPath+"\x00"+entry.NewPath]; ok {
+			results = append(results, undoResult{entry: entry, skipped: true})
+			continue
+		}
+
+		restore := restoreRename
+		switch entry.Action {
+		case journalActionCopy, journalActionSplit:
+			restore = removeCopy
+		case journalActionDelete:
+			restore = func(entry journalEntry) error { return restoreDeleted(entry, entries) }
+		}
+		if err := restore(entry); err != nil {
+			results = append(results, undoResult{entry: entry, err: err})
+			continue
+		}
+		if err := j.append(journalEntry{
+			Action:       journalActionUndo,
+			OriginalPath: entry.OriginalPath,
+			NewPath:      entry.NewPath,
+			SHA256:       entry.SHA256,
+		}); err != nil {
+			results = append(results, undoResult{entry: entry, err: fmt.Errorf("restored but could not update journal: %w", err)})
+			continue
+		}
+		results = append(results, undoResult{entry: entry})
+	}
+
+	// Report in the order the files were originally processed.
+	for i, k := 0, len(results)-1; i < k; i, k = i+1, k-1 {
+		results[i], results[k] = results[k], results[i]
+	}
+	return results, nil
+}
+
+func restoreRename(entry journalEntry) error {
+	info, err := os.Stat(entry.NewPath)
+	if err != nil {
+		return fmt.Errorf("renamed file is no longer accessible: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("renamed path is now a directory")
+	}
+
+	hash, err := fileSHA256(entry.NewPath)
+	if err != nil {
+		return err
+	}
+	if hash != entry.SHA256 {
+		return fmt.Errorf("file has changed since it was renamed")
+	}
+
+	if _, err := os.Lstat(entry.OriginalPath); err == nil {
+		return fmt.Errorf("original name is now occupied")
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("cannot check original name: %w", err)
+	}
+
+	if err := nombra.MoveFile(entry.NewPath, entry.OriginalPath); err != nil {
+		return fmt.Errorf("could not rename file: %w", err)
+	}
+	return nil
+}
+
+// restoreDeleted brings back a deleted duplicate by copying a file of the run
+// with the same content: the kept file, under any name the run gave it.
+func restoreDeleted(entry journalEntry, entries []journalEntry) error {
+	if _, err := os.Lstat(entry.OriginalPath); err == nil {
+		return fmt.Errorf("original name is now occupied")
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("cannot check original name: %w", err)
+	}
+
+	candidates := []string{entry.NewPath}
+	for _, other := range entries {
+		if other.SHA256 == entry.SHA256 && (other.Action == journalActionRename || other.Action == journalActionCopy) {
+			candidates = append(candidates, other.NewPath, other.OriginalPath)
+		}
+	}
+	for _, candidate := range candidates {
+		if hash, err := fileSHA256(candidate); err != nil || hash != entry.SHA256 {
+			continue
+		}
+		if err := nombra.CopyFile(candidate, entry.OriginalPath); err != nil {
+			return fmt.Errorf("could not restore deleted file: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no unchanged copy of the deleted file is left")
+}
+
+// removeCopy deletes a copy made with --dest-mode copy, or a part written by
+// split, unless it changed.
+func removeCopy(entry journalEntry) error {
+	hash, err := fileSHA256(entry.NewPath)
+	if err != nil {
+		return fmt.Errorf("file is no longer accessible: %w", err)
+	}
+	if hash != entry.SHA256 {
+		return fmt.Errorf("file has changed since it was written")
+	}
+	if err := os.Remove(entry.NewPath); err != nil {
+		return fmt.Errorf("could not remove file: %w", err)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of the file content.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for hashing: %w", err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func newUndoCmd() *cobra.Command {
+	var list bool
+
+	cmd := &cobra.Command{
+		Use:   "undo [run-id]",
+		Short: "Restore the original names of a previous run",
+		Long: "Restores the filenames recorded in a run journal. Without a run ID the most recent run is undone. " +
+			"Files that changed since the rename, or whose original name is taken again, are left untouched.",
+		Example: "nombra undo\n  nombra undo --list\n  nombra undo 20250102-150405-a1b2c3",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runs, err := listRuns()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if list {
+				if len(runs) == 0 {
+					fmt.Println("No runs recorded")
+				}
+				for _, run := range runs {
+					fmt.Println(run)
+				}
+				return
+			}
+
+			var runID string
+			switch {
+			case len(args) == 1:
+				runID = args[0]
+				if !slices.Contains(runs, runID) {
+					fmt.Printf("Error: no journal found for run %q\n", runID)
+					os.Exit(1)
+				}
+			case len(runs) > 0:
+				runID = runs[len(runs)-1]
+			default:
+				fmt.Println("Error: no runs recorded")
+				os.Exit(1)
+			}
+
+			results, err := undoRun(runID)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			var restoredCount, failedCount, skippedCount int
+			for _, result := range results {
+				switch {
+				case result.err != nil:
+					failedCount++
+					fmt.Printf("[FAIL] %s: %v\n", filepath.Base(result.entry.NewPath), result.err)
+				case result.skipped:
+					skippedCount++
+					fmt.Printf("[SKIP] %s: already restored\n", filepath.Base(result.entry.OriginalPath))
+				case result.entry.Action == journalActionCopy:
+					restoredCount++
+					fmt.Printf("Removed copy:\n  %s\n\n", result.entry.NewPath)
+				case result.entry.Action == journalActionSplit:
+					restoredCount++
+					fmt.Printf("Removed split part:\n  %s\n\n", result.entry.NewPath)
+				case result.entry.Action == journalActionDelete || result.entry.Action == journalActionRemove:
+					restoredCount++
+					fmt.Printf("Restored deleted file:\n  %s\n\n", result.entry.OriginalPath)
+				default:
+					restoredCount++
+					from, to := displayPaths(result.entry.NewPath, result.entry.OriginalPath)
+					fmt.Printf("Restored:\n  %s\n  -> %s\n\n", from, to)
+				}
+			}
+
+			fmt.Printf("Undo %s: %d restored, %d skipped, %d failed\n", runID, restoredCount, skippedCount, failedCount)
+			if failedCount > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&list, "list", false, "List recorded runs")
+	return cmd
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+func TestUndoRun(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	rename := func(j *renameJournal, from, to, content string) {
+		t.Helper()
+		original := filepath.Join(dir, from)
+		if err := os.WriteFile(original, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := fileSHA256(original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renamed := filepath.Join(dir, to)
+		if err := os.Rename(original, renamed); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.recordRename(original, renamed, hash, nombra.Metadata{Title: to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j, err := newRenameJournal("20240115-120000-abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rename(j, "scan1.pdf", "Invoice.pdf", "one")
+	rename(j, "scan2.pdf", "Letter.pdf", "two")
+	rename(j, "scan3.pdf", "Contract.pdf", "three")
+	if err := j.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modify one renamed file and occupy the original name of another.
+	if err := os.WriteFile(filepath.Join(dir, "Letter.pdf"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scan3.pdf"), []byte("new scan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := listRuns()
+	if err != nil || len(runs) != 1 || runs[0] != j.runID {
+		t.Fatalf("listRuns() = %v, %v", runs, err)
+	}
+
+	results, err := undoRun(j.runID)
+	if err != nil {
+		t.Fatalf("undoRun returned error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("undoRun returned %d results; want 3", len(results))
+	}
+	if results[0].err != nil {
+		t.Errorf("expected Invoice.pdf to be restored: %v", results[0].err)
+	}
+	if results[1].err == nil {
+		t.Errorf("expected changed Letter.pdf to be refused")
+	}
+	if results[2].err == nil {
+		t.Errorf("expected Contract.pdf to be refused because scan3.pdf exists")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "scan1.pdf")); err != nil {
+		t.Errorf("scan1.pdf was not restored: %v", err)
+	}
+
+	// A second undo skips what was already restored.
+	results, err = undoRun(j.runID)
+	if err != nil {
+		t.Fatalf("second undoRun returned error: %v", err)
+	}
+	if !results[0].skipped {
+		t.Errorf("expected already restored entry to be skipped")
+	}
+}
+
+func TestUndoRemovesCopies(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	original := filepath.Join(dir, "scan.pdf")
+	copied := filepath.Join(dir, "archive", "Invoice.pdf")
+	if err := os.WriteFile(original, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(copied), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(copied, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := fileSHA256(copied)
+
+	j, err := newRenameJournal("20240115-120000-c0ffee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.recordCopy(original, copied, hash, nombra.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	j.close()
+
+	results, err := undoRun(j.runID)
+	if err != nil || len(results) != 1 || results[0].err != nil {
+		t.Fatalf("undoRun() = %+v, %v", results, err)
+	}
+	if _, err := os.Stat(copied); !os.IsNotExist(err) {
+		t.Errorf("copy was not removed")
+	}
+	if _, err := os.Stat(original); err != nil {
+		t.Errorf("original was touched: %v", err)
+	}
+}
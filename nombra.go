@@ -16,160 +16,117 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"cmp"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/ledongthuc/pdf"
-	openai "github.com/sashabaranov/go-openai"
+	"github.com/rtyx/nombra/nombra"
 	"github.com/spf13/cobra"
 )
 
-const (
-	maxFilenameLength     = 120
-	truncationSuffix      = "... [content truncated]"
-	sanitizeRegex         = `[<>:"\/\\|?*]`
-	defaultModel          = "gpt-5.4"
-	visionModel           = openai.GPT4oMini
-	extractionPrompt      = "You extract structured metadata from PDF documents for filename generation.\n\nRead the document and return exactly one JSON object with these keys:\n- date: most relevant date in YYYY.MM.DD format, or empty string\n- language: main language of the document, or empty string\n- title: explicit document title or heading, or empty string\n- document_type: what the document actually is, or empty string\n- organization: the institution, company, authority, or organization speaking or issuing the document, or empty string\n- author: the specific person who signed or authored it, or empty string\n- recipient: who it is addressed to, or empty string\n- topic: the main subject or purpose, or empty string\n\nQuestions to answer internally before filling the JSON:\n- What is the most relevant date in this document?\n- What is the main language of this document?\n- What is this document?\n- What does it look like it is for?\n- Is there a visible title or heading?\n- Which institution, company, authority, or organization is issuing or speaking in this document?\n- Which specific person signed or authored it?\n- Who is it addressed to?\n- What is the main topic?\n\nRules:\n- Use the main language of the document for title, document_type, organization, recipient, and topic\n- Do not translate field values into another language\n- Do not include bilingual duplicates like 'Bundesamt ... (Federal Office ...)' in one field\n- Prefer specific document kinds like permit, questionnaire, application, certificate, invoice, letter, report, contract, or form\n- Distinguish the organization from the individual signer when both are present\n- If there is no useful title, leave title empty instead of inventing one\n- Do not use placeholders like Untitled, Document, File, Unknown, Misc, or N A\n- Do not invent facts that are not supported by the text\n- Return JSON only, with no markdown and no explanation."
-	retryExtractionPrompt = "You previously extracted weak metadata for filename generation. Re-read the document and return a better JSON object.\n\nReturn exactly one JSON object with these keys:\n- date\n- language\n- title\n- document_type\n- organization\n- author\n- recipient\n- topic\n\nRules:\n- Find the most relevant date and format it as YYYY.MM.DD when possible\n- Keep all textual fields in the main language of the document\n- Do not translate values or mix languages in the same field\n- Do not include bilingual duplicates in parentheses or after dashes\n- Focus first on what the document actually is, not just which names appear in it\n- Distinguish the institution or company from the individual signer when both are present\n- If there is no title, identify the document kind or concrete subject\n- Only include person names after the document itself has been identified\n- Do not use placeholders like Untitled, Document, File, Unknown, Misc, or N A\n- Do not return markdown, prose, or explanations\n- Return JSON only."
-)
-
 var (
-	verbose          bool
-	version          = "dev"
-	maxContentLength = 3000
-	minContentLength = 10
-	ocr              bool
-	model            string
-	dryRun           bool
-	printOnly        bool
-	interactive      bool
-	workers          int
-	inputDir         string
-	reasoningEffort  string
+	verbose            bool
+	version            = "dev"
+	maxContentLength   = 3000
+	minContentLength   = 10
+	ocr                bool
+	visionPages        string
+	visionModel        string
+	visionDetail       string
+	visionMaxSize      int
+	model              string
+	dryRun             bool
+	printOnly          bool
+	interactive        bool
+	workers            int
+	inputDir           string
+	reasoningEffort    string
+	templateSource     string
+	providerName       string
+	baseURL            string
+	scan               scanOptions
+	apiKey             string
+	noCache            bool
+	outputFormat       string
+	writeMetadata      bool
+	destSource         string
+	destMode           string
+	maxRetries         int
+	requestTimeout     time.Duration
+	requestsPerMinute  int
+	tokensPerMinute    int
+	onDuplicate        string
+	duplicateThreshold float64
+	structuredOutput   string
+	recordDir          string
+	replayDir          string
 )
 
+// namer holds the nombra library configured from the flags. prepareRun sets it.
+var namer *nombra.Namer
+
 type fileJob struct {
 	index int
 	path  string
+	// deferRename stops at the proposed path, so that the batch review can
+	// rename the accepted files afterwards.
+	deferRename bool
 }
 
 type fileResult struct {
-	index   int
-	path    string
-	title   string
-	newPath string
-	skipped bool
+	index    int
+	path     string
+	title    string
+	newPath  string
+	hash     string
+	metadata nombra.Metadata
+	method   string
+	usage    nombra.Usage
+	duration time.Duration
+	skipped  bool
+	// skipReason explains a skip other than a declined confirmation.
+	skipReason string
+	duplicate  *duplicateMatch
+	confidence nombra.Confidence
+	// review is set when the file was held back for --min-confidence.
+	review bool
+	// claimed is the duplicate index entry of a file whose rename was
+	// deferred to the batch review.
+	claimed *duplicateEntry
 	err     error
 }
 
-type extractedMetadata struct {
-	Date         string `json:"date"`
-	Language     string `json:"language"`
-	Title        string `json:"title"`
-	DocumentType string `json:"document_type"`
-	Organization string `json:"organization"`
-	Author       string `json:"author"`
-	Recipient    string `json:"recipient"`
-	Topic        string `json:"topic"`
-}
-
-// validModels lists the OpenAI models that can be used with the --model flag.
-// The slice is used for validating user input and constructing helpful error
-// messages when an unsupported model is supplied.
-var validModels = []string{
-	"gpt-5.4",
-	"gpt-5.4-pro",
-	"gpt-5-mini",
-	"gpt-5-nano",
-	"gpt-5-chat-latest",
-	openai.GPT3Dot5Turbo,
-	openai.GPT3Dot5Turbo0125,
-	openai.GPT3Dot5Turbo1106,
-	openai.GPT3Dot5Turbo16K,
-	openai.GPT4Turbo,
-	openai.GPT4Turbo0125,
-	openai.GPT4Turbo1106,
-	openai.GPT4TurboPreview,
-	openai.GPT4Turbo20240409,
-	openai.GPT4,
-	openai.GPT4o,
-	openai.GPT4oMini,
-	openai.GPT4VisionPreview,
-}
-
-var validReasoningEfforts = map[string]struct{}{
-	"none":   {},
-	"low":    {},
-	"medium": {},
-	"high":   {},
-	"xhigh":  {},
-}
-
-// validateModel ensures the provided model is one of the supported values.
-// It returns an error listing the allowed models when validation fails.
-func validateModel(m string) error {
-	for _, v := range validModels {
-		if m == v {
-			return nil
-		}
-	}
-	return fmt.Errorf("invalid model %q. valid models: %s", m, strings.Join(validModels, ", "))
-}
-
-func validateReasoningEffort(effort string) error {
-	e := strings.TrimSpace(strings.ToLower(effort))
-	if _, ok := validReasoningEfforts[e]; ok {
-		return nil
-	}
-
-	allowed := []string{"none", "low", "medium", "high", "xhigh"}
-	return fmt.Errorf("invalid reasoning effort %q. valid values: %s", effort, strings.Join(allowed, ", "))
-}
-
-func isGPT5Model(name string) bool {
-	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(name)), "gpt-5")
-}
+// methodCache is reported in fileResult.method when the metadata came from
+// the cache instead of the extraction methods of the nombra package.
+const methodCache = "cache"
 
 // main initializes and executes the CLI command for generating a title for a PDF file.
 // It sets up the command line flags, validates the API key, extracts content from the PDF,
-// generates a title using OpenAI's API, and finally renames the file based on the title.
+// generates a title with the configured model, and finally renames the file based on the title.
 func main() {
-	var apiKey string
-
 	rootCmd := &cobra.Command{
-		Use:     "nombra [PDF file ...]",
-		Short:   "Generate titles for PDF documents using AI",
-		Long:    "A CLI tool that analyzes PDF content and generates appropriate titles using OpenAI's API",
+		Use:     "nombra [file ...]",
+		Short:   "Generate titles for documents using AI",
+		Long:    "A CLI tool that analyzes PDF, image, office, email and text documents and generates appropriate titles using OpenAI, Anthropic, an OpenAI-compatible server or, offline, local heuristics",
 		Example: "nombra myfile.pdf\n  nombra myfile1.pdf myfile2.pdf --workers 4\n  nombra --dir ./docs --workers 6\n  nombra myfile.pdf --model gpt-5.4",
 		Version: version,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 && strings.TrimSpace(inputDir) == "" {
-				return fmt.Errorf("provide at least one PDF file or use --dir")
+				return fmt.Errorf("provide at least one file or use --dir")
 			}
 			return nil
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
-			if apiKey == "" {
-				apiKey = os.Getenv("OPENAI_API_KEY")
-			}
-			if apiKey == "" {
-				fmt.Println("Error: API key required. Use --key or set OPENAI_API_KEY")
-				os.Exit(1)
-			}
+			prepareRun(cmd)
 			if printOnly && dryRun {
 				fmt.Println("Error: --print-only cannot be combined with --dry-run")
 				os.Exit(1)
@@ -182,16 +139,33 @@ func main() {
 				fmt.Println("Error: --dry-run cannot be combined with --interactive")
 				os.Exit(1)
 			}
-			if err := validateModel(model); err != nil {
-				fmt.Println(err)
+			if interactive && outputFormat != outputText {
+				fmt.Println("Error: --interactive requires --output text")
+				os.Exit(1)
+			}
+			if scan.maxDepth < 0 {
+				fmt.Println("Error: --max-depth cannot be negative")
+				os.Exit(1)
+			}
+			if scan.maxDepth > 0 && !scan.recursive {
+				fmt.Println("Error: --max-depth requires --recursive")
 				os.Exit(1)
 			}
-			if err := validateReasoningEffort(reasoningEffort); err != nil {
-				fmt.Println(err)
+			if err := validateGlobs(append(append([]string{}, scan.include...), scan.exclude...)); err != nil {
+				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
-			if workers < 1 {
-				fmt.Println("Error: --workers must be at least 1")
+			if maxCost < 0 || maxTokens < 0 {
+				fmt.Println("Error: --max-cost and --max-tokens cannot be negative")
+				os.Exit(1)
+			}
+			spend = newBudget(maxCost, maxTokens)
+			if err := validateReview(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if cmd.Flags().Changed("review") && minConfidence == 0 {
+				fmt.Println("Error: --review requires --min-confidence")
 				os.Exit(1)
 			}
 		},
@@ -200,14 +174,16 @@ func main() {
 				log.Println("Verbose mode enabled")
 			}
 
-			files, err := collectInputPDFs(args, inputDir)
+			files, err := collectInputFiles(args, inputDir, scan)
 			if err != nil {
 				fmt.Printf("Input error: %v\n", err)
 				os.Exit(1)
 			}
 
-			if interactive && len(files) > 1 {
-				fmt.Println("Error: --interactive supports only one file at a time")
+			// The batch review defers renames, which duplicates cannot wait for.
+			batchReview := interactive && len(files) > 1
+			if batchReview && (onDuplicate == duplicateDelete || onDuplicate == duplicateDeleteNear || onDuplicate == duplicateLink) {
+				fmt.Println("Error: --interactive with several files cannot be combined with --on-duplicate delete or link")
 				os.Exit(1)
 			}
 
@@ -215,39 +191,47 @@ func main() {
 				workers = len(files)
 			}
 
-			client := openai.NewClient(apiKey)
-			results := processFiles(files, client, workers)
-
-			var successCount, failedCount, skippedCount int
-			for _, result := range results {
-				if result.err != nil {
-					failedCount++
-					fmt.Printf("[FAIL] %s: %v\n", filepath.Base(result.path), result.err)
-					continue
+			if !dryRun && !printOnly {
+				journal, err = newRenameJournal(newRunID())
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
 				}
+			}
 
-				if result.skipped {
-					skippedCount++
-					fmt.Printf("[SKIP] %s: rename cancelled\n", filepath.Base(result.path))
-					continue
+			start := time.Now()
+			var results []fileResult
+			if batchReview {
+				results = reviewBatch(files, workers, os.Stdin, os.Stdout)
+			} else {
+				results = processFiles(files, workers)
+			}
+			if journal != nil {
+				if err := journal.close(); err != nil {
+					log.Printf("Warning: could not close undo journal: %v", err)
 				}
+			}
 
-				successCount++
-				switch {
-				case printOnly:
-					fmt.Printf("%s: %s\n", filepath.Base(result.path), result.title)
-				case dryRun:
-					fmt.Printf("Dry run (no changes made):\n  %s\n  -> %s\n\n", filepath.Base(result.path), filepath.Base(result.newPath))
-				default:
-					fmt.Printf("Successfully renamed:\n  %s\n  -> %s\n\n", filepath.Base(result.path), filepath.Base(result.newPath))
+			out := newResultWriter(outputFormat, os.Stdout)
+			var summary runSummary
+			for _, result := range results {
+				summary.add(result)
+				if err := out.writeResult(result); err != nil {
+					log.Printf("Warning: could not write result: %v", err)
 				}
 			}
-
-			if len(files) > 1 {
-				fmt.Printf("Summary: %d succeeded, %d skipped, %d failed (total: %d)\n", successCount, skippedCount, failedCount, len(files))
+			summary.duration = time.Since(start)
+			if journal != nil && journal.renames > 0 {
+				summary.runID = journal.runID
+			}
+			if journal != nil && journal.listed > 0 {
+				summary.reviewList = journal.reviewListPath()
+			}
+			if err := out.finish(summary); err != nil {
+				log.Printf("Warning: could not write summary: %v", err)
 			}
 
-			if failedCount > 0 {
+			if summary.failed > 0 {
 				os.Exit(1)
 			}
 		},
@@ -256,16 +240,62 @@ func main() {
 	// Configure flags
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
 	rootCmd.PersistentFlags().BoolVarP(&ocr, "ocr", "o", false, "Force OCR text extraction")
-	rootCmd.PersistentFlags().StringVarP(&model, "model", "m", defaultModel, "OpenAI model to use")
+	rootCmd.PersistentFlags().StringVar(&visionPages, "vision-pages", "1", "PDF pages shown to the vision model when no text can be extracted, e.g. 1,2,-1 or first,last (-1 is the last page)")
+	rootCmd.PersistentFlags().StringVar(&visionModel, "vision-model", "", "Model reading scans without text (default: gpt-4o-mini with OpenAI, else --model)")
+	rootCmd.PersistentFlags().StringVar(&visionDetail, "vision-detail", nombra.VisionDetailHigh, "Image detail for the vision model: low, high or auto")
+	rootCmd.PersistentFlags().IntVar(&visionMaxSize, "vision-max-size", nombra.DefaultVisionMaxSize, "Scale images for the vision model down to at most this many pixels on the longer side")
+	rootCmd.PersistentFlags().StringVarP(&model, "model", "m", nombra.DefaultModel, "Model to use for metadata extraction")
+	rootCmd.PersistentFlags().StringVar(&providerName, "provider", nombra.ProviderOpenAI, "LLM provider: openai, openai-compatible, anthropic")
+	rootCmd.PersistentFlags().StringVar(&baseURL, "base-url", "", "API base URL, e.g. http://localhost:11434/v1 for Ollama")
 	rootCmd.PersistentFlags().StringVar(&reasoningEffort, "reasoning-effort", "none", "Reasoning effort for GPT-5 models: none, low, medium, high, xhigh")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview the new filename without renaming")
 	rootCmd.Flags().BoolVar(&printOnly, "print-only", false, "Print only the generated title")
-	rootCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Ask for confirmation before renaming")
-	rootCmd.Flags().StringVar(&inputDir, "dir", "", "Directory containing PDF files to process")
-	rootCmd.Flags().IntVarP(&workers, "workers", "w", runtime.NumCPU(), "Number of files to process concurrently")
-	rootCmd.Flags().IntVarP(&maxContentLength, "max-content-length", "l", 3000, "Maximum content length for processing")
-	rootCmd.Flags().IntVarP(&minContentLength, "min-content-length", "n", 10, "Minimum content length required for processing")
-	rootCmd.Flags().StringVarP(&apiKey, "key", "k", "", "OpenAI API key (default: $OPENAI_API_KEY)")
+	rootCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Confirm the rename, or review all proposed renames when given several files")
+	rootCmd.Flags().StringVar(&inputDir, "dir", "", "Directory containing documents to process")
+	rootCmd.Flags().BoolVarP(&scan.recursive, "recursive", "r", false, "Process documents in subdirectories of --dir")
+	rootCmd.Flags().StringSliceVar(&scan.include, "include", nil, "Only process files matching these glob patterns (relative to --dir, ** matches directories)")
+	rootCmd.Flags().StringSliceVar(&scan.exclude, "exclude", nil, "Skip files and directories matching these glob patterns")
+	rootCmd.Flags().IntVar(&scan.maxDepth, "max-depth", 0, "Maximum subdirectory depth with --recursive (0 = unlimited)")
+	rootCmd.Flags().BoolVar(&scan.followSymlinks, "follow-symlinks", false, "Descend into symlinked directories with --recursive")
+	rootCmd.PersistentFlags().IntVarP(&workers, "workers", "w", runtime.NumCPU(), "Number of files to process concurrently")
+	rootCmd.PersistentFlags().IntVarP(&maxContentLength, "max-content-length", "l", 3000, "Maximum content length for processing")
+	rootCmd.PersistentFlags().IntVarP(&minContentLength, "min-content-length", "n", 10, "Minimum content length required for processing")
+	rootCmd.PersistentFlags().StringVarP(&apiKey, "key", "k", "", "API key (default: $OPENAI_API_KEY or $ANTHROPIC_API_KEY)")
+	rootCmd.PersistentFlags().StringVar(&templateSource, "template", "", "Filename template, e.g. {date:2006-01-02}_{organization}_{document_type|title}")
+
+	rootCmd.PersistentFlags().StringVar(&promptFile, "prompt-file", "", "Replace the built-in metadata extraction instructions with the prompt in this file")
+	rootCmd.PersistentFlags().StringVar(&schemaPath, "schema", "", "JSON file with custom fields to extract, e.g. invoice numbers, for templates and output")
+	rootCmd.PersistentFlags().StringVar(&structuredOutput, "structured-output", nombra.StructuredOutputAuto, "Hold the model to a strict JSON schema: auto (supported OpenAI models), on or off")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Guess metadata with local heuristics instead of a model; no API key needed")
+	rootCmd.PersistentFlags().StringVar(&sendersPath, "known-senders", "", "File listing organizations to recognize in offline mode, one per line")
+	rootCmd.PersistentFlags().BoolVar(&selfRate, "self-rate", false, "Ask the model to rate its own answer, which weighs into the confidence score")
+	rootCmd.Flags().Float64Var(&minConfidence, "min-confidence", 0, "Hold back files whose name is less confident than this (0-1) for review instead of renaming them")
+	rootCmd.Flags().StringVar(&reviewMode, "review", reviewList, "How to hold back files below --min-confidence: list (leave in place) or folder (move into _review/)")
+	rootCmd.PersistentFlags().StringSliceVar(&prices, "price", nil, "Model price in USD per million input/output tokens, e.g. gpt-5.4=2.5/15 (adds to the built-in table)")
+	rootCmd.Flags().Float64Var(&maxCost, "max-cost", 0, "Stop starting new files once the run has cost this many USD (0 = unlimited)")
+	rootCmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Stop starting new files once the run has used this many tokens (0 = unlimited)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default: $XDG_CONFIG_HOME/nombra/config.toml)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Named profile from the config file (default: $NOMBRA_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Save every model request and reply in this directory for --replay")
+	rootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Answer model requests from a --record directory instead of calling the provider")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Do not read or write the metadata cache")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", outputText, "Result format: text, json, jsonl, csv")
+	rootCmd.PersistentFlags().BoolVar(&writeMetadata, "write-metadata", false, "Store the extracted metadata in the PDF Info dictionary and XMP")
+	rootCmd.PersistentFlags().StringVar(&destSource, "dest", "", "File PDFs into this directory tree, e.g. ~/Archive/{organization}/{date:2006}/{document_type}")
+	rootCmd.PersistentFlags().StringVar(&destMode, "dest-mode", nombra.DestModeMove, "How files reach their new name: move or copy")
+	rootCmd.PersistentFlags().IntVar(&maxRetries, "max-retries", nombra.DefaultMaxRetries, "Retries for rate limited, timed out or failed API requests")
+	rootCmd.PersistentFlags().DurationVar(&requestTimeout, "request-timeout", nombra.DefaultRequestTimeout, "Timeout for a single API request (0 = none)")
+	rootCmd.PersistentFlags().IntVar(&requestsPerMinute, "requests-per-minute", 0, "Limit API requests per minute across all workers (0 = unlimited)")
+	rootCmd.PersistentFlags().IntVar(&tokensPerMinute, "tokens-per-minute", 0, "Limit API tokens per minute across all workers (0 = unlimited)")
+	rootCmd.PersistentFlags().StringVar(&onDuplicate, "on-duplicate", "", "Detect duplicate documents and skip, delete, link or report them; delete-near also deletes near-duplicates")
+	rootCmd.PersistentFlags().Float64Var(&duplicateThreshold, "duplicate-threshold", defaultDuplicateThreshold, "Text similarity (0-1) above which documents are near-duplicates")
+
+	rootCmd.AddCommand(newUndoCmd())
+	rootCmd.AddCommand(newCacheCmd())
+	rootCmd.AddCommand(newWatchCmd())
+	rootCmd.AddCommand(newSplitCmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newEvalCmd())
 
 	// Execute the command
 	if err := rootCmd.Execute(); err != nil {
@@ -274,925 +304,444 @@ func main() {
 	}
 }
 
-func collectInputPDFs(args []string, dir string) ([]string, error) {
-	candidates := append([]string{}, args...)
-
-	if dir != "" {
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read --dir %q: %w", dir, err)
-		}
-
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-			name := entry.Name()
-			if strings.EqualFold(filepath.Ext(name), ".pdf") {
-				candidates = append(candidates, filepath.Join(dir, name))
-			}
-		}
+// prepareRun fills unset flags from the environment and config file, validates
+// the flags shared by every command that names files and builds the namer
+// from them. It exits on error.
+func prepareRun(cmd *cobra.Command) {
+	if err := applyConfig(cmd); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	if len(candidates) == 0 {
-		return nil, fmt.Errorf("no PDF files found")
+	if providerName == nombra.ProviderOpenAICompatible && !cmd.Flags().Changed("model") {
+		fmt.Printf("Error: --model is required with --provider %s\n", nombra.ProviderOpenAICompatible)
+		os.Exit(1)
 	}
-
-	seen := make(map[string]struct{}, len(candidates))
-	files := make([]string, 0, len(candidates))
-	for _, candidate := range candidates {
-		if !strings.EqualFold(filepath.Ext(candidate), ".pdf") {
-			return nil, fmt.Errorf("not a PDF file: %s", candidate)
-		}
-		info, err := os.Stat(candidate)
-		if err != nil {
-			return nil, fmt.Errorf("file not accessible %q: %w", candidate, err)
-		}
-		if info.IsDir() {
-			return nil, fmt.Errorf("path is a directory, expected PDF file: %s", candidate)
-		}
-
-		abs, err := filepath.Abs(candidate)
-		if err != nil {
-			abs = candidate
-		}
-		if _, ok := seen[abs]; ok {
-			continue
-		}
-		seen[abs] = struct{}{}
-		files = append(files, abs)
+	if workers < 1 {
+		fmt.Println("Error: --workers must be at least 1")
+		os.Exit(1)
 	}
-
-	sort.Strings(files)
-	return files, nil
-}
-
-func processFiles(files []string, client *openai.Client, workerCount int) []fileResult {
-	jobs := make(chan fileJob)
-	results := make(chan fileResult, len(files))
-	var wg sync.WaitGroup
-
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for job := range jobs {
-				result := processSingleFile(job.path, client)
-				result.index = job.index
-				result.path = job.path
-				results <- result
-			}
-		}()
+	if err := validateOutputFormat(outputFormat); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	for i, path := range files {
-		jobs <- fileJob{index: i, path: path}
+	if err := validateDuplicateAction(onDuplicate); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-	close(jobs)
-	wg.Wait()
-	close(results)
-
-	out := make([]fileResult, 0, len(files))
-	for result := range results {
-		out = append(out, result)
+	if duplicateThreshold <= 0 || duplicateThreshold > 1 {
+		fmt.Println("Error: --duplicate-threshold must be greater than 0 and at most 1")
+		os.Exit(1)
 	}
-	sort.Slice(out, func(i, j int) bool {
-		return out[i].index < out[j].index
-	})
-	return out
-}
-
-func processSingleFile(filePath string, client *openai.Client) fileResult {
-	textContent, err := extractPDFContent(filePath, client)
-	if err != nil {
-		return fileResult{err: fmt.Errorf("PDF processing error: %w", err)}
+	if onDuplicate != "" {
+		onDuplicate = strings.ToLower(onDuplicate)
+		duplicates = newDuplicateIndex(duplicateThreshold)
 	}
 
-	title, err := generateOpenAITitle(textContent, client, model)
+	priceTable, err := parsePrices(prices)
 	if err != nil {
-		return fileResult{err: fmt.Errorf("title generation failed: %w", err)}
-	}
-
-	if printOnly {
-		return fileResult{title: title}
-	}
-
-	if dryRun {
-		return fileResult{title: title, newPath: buildProposedPath(filePath, title)}
-	}
-
-	if interactive && !confirmRename(filePath, title) {
-		return fileResult{title: title, skipped: true}
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	newPath, err := safeRenameFile(filePath, title)
+	pages, err := nombra.ParseVisionPages(visionPages)
 	if err != nil {
-		return fileResult{err: fmt.Errorf("renaming failed: %w", err)}
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-	return fileResult{title: title, newPath: newPath}
-}
-
-// safeRenameFile renames the original file based on the generated title.
-// It sanitizes the title to form a valid filename, ensures the filename length is safe,
-// and handles name collisions by generating a unique filename.
-func safeRenameFile(originalPath, title string) (string, error) {
-	// Sanitize title and prepare new filename
-	cleanTitle := sanitizeFilename(title)
-	if cleanTitle == "" {
-		return "", fmt.Errorf("generated title results in invalid filename")
+	opts := nombra.Options{
+		Provider:          providerName,
+		APIKey:            apiKey,
+		BaseURL:           baseURL,
+		Model:             model,
+		ReasoningEffort:   reasoningEffort,
+		ForceOCR:          ocr,
+		VisionPages:       pages,
+		VisionModel:       visionModel,
+		VisionDetail:      visionDetail,
+		VisionMaxSize:     visionMaxSize,
+		MaxContentLength:  maxContentLength,
+		MinContentLength:  minContentLength,
+		Template:          templateSource,
+		Dest:              destSource,
+		DestMode:          destMode,
+		MaxRetries:        maxRetries,
+		RequestTimeout:    requestTimeout,
+		RequestsPerMinute: requestsPerMinute,
+		TokensPerMinute:   tokensPerMinute,
+		Prices:            priceTable,
+		StructuredOutput:  structuredOutput,
+		SelfRating:        selfRate,
+		Offline:           offline,
+		Record:            expandHome(recordDir),
+		Replay:            expandHome(replayDir),
+		Logger:            log.Default(),
+		Verbose:           verbose,
+	}
+	if providerName == nombra.ProviderAnthropic && !cmd.Flags().Changed("model") {
+		opts.Model = ""
+	}
+	if promptFile != "" {
+		prompt, err := loadPromptFile(promptFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Prompt = prompt
 	}
-
-	newPath := buildProposedPath(originalPath, cleanTitle)
-	dir := filepath.Dir(originalPath)
-	ext := filepath.Ext(originalPath)
-
-	// Handle existing files with same name
-	if _, err := os.Stat(newPath); err == nil {
-		newPath = generateUniqueName(dir, cleanTitle, ext)
+	if schemaPath != "" {
+		fields, err := loadSchema(schemaPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Fields = fields
 	}
-
-	// Perform actual rename
-	if err := os.Rename(originalPath, newPath); err != nil {
-		return "", fmt.Errorf("could not rename file: %w", err)
+	if sendersPath != "" && !offline {
+		fmt.Println("Error: --known-senders requires --offline")
+		os.Exit(1)
 	}
-
-	return newPath, nil
-}
-
-func buildProposedPath(originalPath, title string) string {
-	dir := filepath.Dir(originalPath)
-	ext := filepath.Ext(originalPath)
-	baseName := sanitizeFilename(title) + ext
-	if len(baseName) > maxFilenameLength {
-		baseName = baseName[:maxFilenameLength-len(ext)] + ext
+	if sendersPath != "" {
+		senders, err := loadKnownSenders(sendersPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.KnownSenders = senders
 	}
-	return filepath.Join(dir, baseName)
-}
-
-// sanitizeFilename removes any invalid characters from the title and trims whitespace.
-// It ensures that the resulting string is safe to use as a filename.
-func sanitizeFilename(title string) string {
-	// Remove invalid characters
-	reg := regexp.MustCompile(sanitizeRegex)
-	clean := reg.ReplaceAllString(title, "")
-
-	// Trim whitespace and truncate
-	clean = strings.TrimSpace(clean)
-	if len(clean) > maxFilenameLength {
-		clean = clean[:maxFilenameLength]
+	n, err := nombra.New(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	// Handle cases where title becomes empty
-	if clean == "" {
-		return "untitled-document"
+	namer = n
+	// The cache key depends on the model actually used.
+	model = namer.Options().Model
+	if _, ok := namer.Price(model); !ok && maxCost > 0 {
+		log.Printf("Warning: no price known for %s, so --max-cost does not count its calls; set one with --price %s=INPUT/OUTPUT", model, model)
 	}
 
-	return clean
-}
-
-// generateUniqueName creates a unique filename by appending an incremental counter
-// to the base name until an unused filename is found in the specified directory.
-func generateUniqueName(dir, baseName, ext string) string {
-	counter := 1
-	pattern := filepath.Join(dir, baseName+"-%d"+ext)
-
-	for {
-		candidate := fmt.Sprintf(pattern, counter)
-		if _, err := os.Stat(candidate); os.IsNotExist(err) {
-			return candidate
+	// Cached metadata would keep requests from being recorded or replayed.
+	if !noCache && recordDir == "" && replayDir == "" {
+		cache, err := newResultCache()
+		if err != nil {
+			log.Printf("Warning: metadata cache disabled: %v", err)
 		}
-		counter++
+		metadataCache = cache
 	}
 }
 
-// validateContentLength checks if the content meets the minimum length requirement
-func validateContentLength(content string) error {
-	trimmedLength := len(strings.TrimSpace(content))
-	if trimmedLength < minContentLength {
-		return fmt.Errorf("extracted content length (%d) is below minimum required length (%d)", trimmedLength, minContentLength)
+// printResult prints the outcome of a single file in the human readable format.
+func printResult(w io.Writer, result fileResult) {
+	if result.err != nil {
+		fmt.Fprintf(w, "[FAIL] %s: %v\n", filepath.Base(result.path), result.err)
+		return
 	}
-	return nil
-}
 
-// extractPDFContent extracts text from the specified PDF file.
-// It first attempts to extract text using a standard method.
-// If that fails or produces empty content, it falls back to OCR-based extraction,
-// then to image analysis via OpenAI as a last resort.
-func extractPDFContent(path string, client *openai.Client) (string, error) {
-	// Define extraction methods
-	extractors := []struct {
-		name string
-		fn   func(string) (string, error)
-	}{
-		{"standard", extractTextFromPDF},
-		{"OCR", extractTextViaOCR},
+	if result.duplicate != nil && result.duplicate.action != duplicateReport {
+		printDuplicate(w, result)
+		return
 	}
 
-	// If OCR is forced, only use OCR
-	if ocr {
-		text, err := extractTextViaOCR(path)
-		if err != nil {
-			return extractContentViaVisionFallback(path, client, err)
-		}
-		if err := validateContentLength(text); err != nil {
-			return extractContentViaVisionFallback(path, client, err)
-		}
-		return text, nil
+	if result.skipped {
+		fmt.Fprintf(w, "[SKIP] %s: %s\n", filepath.Base(result.path), cmp.Or(result.skipReason, "rename cancelled"))
+		return
 	}
 
-	// Try each extraction method
-	var lastErr error
-	for _, extractor := range extractors {
-		if verbose {
-			log.Printf("Attempting %s text extraction...", extractor.name)
-		}
-
-		text, err := extractor.fn(path)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		if text != "" {
-			if err := validateContentLength(text); err != nil {
-				lastErr = err
-				continue
+	if result.review {
+		fmt.Fprintf(w, "[REVIEW] %s: %s\n", filepath.Base(result.path), result.title)
+		fmt.Fprintf(w, "  Confidence: %s\n", formatConfidence(result.confidence))
+		if result.newPath != "" {
+			from, to := displayPaths(result.path, result.newPath)
+			if dryRun {
+				fmt.Fprintf(w, "  Would move %s -> %s\n", from, to)
+			} else {
+				fmt.Fprintf(w, "  Moved %s -> %s\n", from, to)
 			}
-			return text, nil
 		}
+		fmt.Fprintln(w)
+		return
 	}
 
-	// If we get here, all extraction methods failed
-	return extractContentViaVisionFallback(path, client, lastErr)
-}
-
-func extractContentViaVisionFallback(path string, client *openai.Client, textExtractionErr error) (string, error) {
-	if verbose {
-		log.Printf("Text extraction failed; attempting OpenAI image analysis fallback (model: %s)...", visionModel)
-	}
-
-	description, err := describePDFImage(path, client)
-	if err == nil && strings.TrimSpace(description) != "" {
-		if verbose {
-			log.Printf("Vision fallback succeeded (description length: %d characters)", len(description))
+	switch {
+	case printOnly:
+		fmt.Fprintf(w, "%s: %s\n", filepath.Base(result.path), result.title)
+	case dryRun:
+		from, to := displayPaths(result.path, result.newPath)
+		fmt.Fprintf(w, "Dry run (no changes made):\n  %s\n  -> %s\n", from, to)
+	default:
+		from, to := displayPaths(result.path, result.newPath)
+		if destMode == nombra.DestModeCopy {
+			fmt.Fprintf(w, "Successfully copied:\n  %s\n  -> %s\n", from, to)
+		} else {
+			fmt.Fprintf(w, "Successfully renamed:\n  %s\n  -> %s\n", from, to)
 		}
-		return description, nil
-	}
-
-	if textExtractionErr != nil && err != nil {
-		return "", fmt.Errorf("all text extraction methods failed: %v; vision fallback failed: %w", textExtractionErr, err)
 	}
-	if textExtractionErr != nil {
-		return "", fmt.Errorf("all text extraction methods failed: %w", textExtractionErr)
+	if !printOnly {
+		if result.usage.TotalTokens > 0 {
+			fmt.Fprintf(w, "  Usage: %s\n", formatUsage(result.usage))
+		}
+		fmt.Fprintln(w)
 	}
-	if err != nil {
-		return "", fmt.Errorf("no text could be extracted from the PDF and vision fallback failed: %w", err)
+	if result.duplicate != nil {
+		fmt.Fprintf(w, "  Note: %s\n\n", describeDuplicate(result.duplicate))
 	}
-	return "", fmt.Errorf("no text could be extracted from the PDF")
 }
 
-// extractTextFromPDF extracts plain text from the PDF using the pdf library.
-// It iterates through all pages, concatenates the extracted text, and performs basic validations.
-// If the combined text becomes very long, consider trimming to include mostly
-// the beginning and end of the document where titles, parties, and dates are
-// usually located. This could yield better context for title generation when
-// approaching the `maxContentLength` limit.
-func extractTextFromPDF(path string) (string, error) {
-	file, reader, err := pdf.Open(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to open PDF: %w", err)
+func collectInputFiles(args []string, dir string, opts scanOptions) ([]string, error) {
+	candidates := append([]string{}, args...)
+
+	if dir != "" {
+		found, err := scanDirectory(dir, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --dir %q: %w", dir, err)
+		}
+		candidates = append(candidates, found...)
 	}
-	defer file.Close()
 
-	var content strings.Builder
-	totalPages := reader.NumPage()
-	if totalPages == 0 {
-		return "", fmt.Errorf("PDF appears to be empty")
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no supported files found")
 	}
 
-	for i := 1; i <= totalPages; i++ {
-		page := reader.Page(i)
-		if page.V.IsNull() {
-			continue
+	seen := make(map[string]struct{}, len(candidates))
+	files := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !nombra.IsSupported(candidate) {
+			return nil, fmt.Errorf("unsupported file type: %s (supported: %s)", candidate, strings.Join(nombra.SupportedExtensions(), " "))
 		}
-
-		text, err := page.GetPlainText(nil)
+		info, err := os.Stat(candidate)
 		if err != nil {
-			return "", fmt.Errorf("page %d text extraction failed: %w", i, err)
-		}
-		trimmed := strings.TrimSpace(text)
-		if trimmed == "" {
-			continue
+			return nil, fmt.Errorf("file not accessible %q: %w", candidate, err)
 		}
-		if content.Len() > 0 {
-			content.WriteString("\n\n")
+		if info.IsDir() {
+			return nil, fmt.Errorf("path is a directory, expected a file: %s", candidate)
 		}
-		content.WriteString(trimmed)
-	}
-
-	if content.Len() == 0 {
-		return "", fmt.Errorf("no extractable text found in PDF")
-	}
-
-	// If the extraction provides a long string of text with no spaces in it, throw an error
-	if len(content.String()) > 500 && !strings.Contains(content.String(), " ") {
-		return "", fmt.Errorf("text extraction failed: no spaces found in extracted text")
-	}
-
-	return content.String(), nil
-}
-
-// extractTextViaOCR extracts text from a PDF by converting each page to an image and running OCR on them.
-// It uses external tools: 'pdftoppm' to convert the PDF to PNG images and 'tesseract' to perform OCR.
-func extractTextViaOCR(pdfPath string) (string, error) {
-	tempDir, err := os.MkdirTemp("", "nombra-ocr")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Convert PDF to images
-	cmd := exec.Command("pdftoppm", "-png", pdfPath, filepath.Join(tempDir, "page"))
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("pdftoppm failed: %w", err)
-	}
-
-	// Process each page image
-	var content strings.Builder
-	pages, _ := filepath.Glob(filepath.Join(tempDir, "page-*.png"))
 
-	if len(pages) == 0 {
-		return "", fmt.Errorf("no pages converted from PDF")
-	}
-
-	// Ensure OCR processes pages in numeric order (page-2 before page-10).
-	sort.Slice(pages, func(i, j int) bool {
-		pi := pageNumberFromPath(pages[i])
-		pj := pageNumberFromPath(pages[j])
-		if pi == pj {
-			return pages[i] < pages[j]
+		abs, err := filepath.Abs(candidate)
+		if err != nil {
+			abs = candidate
 		}
-		return pi < pj
-	})
-
-	for _, page := range pages {
-		// Run OCR on each page
-		cmd := exec.Command("tesseract", page, "stdout")
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("tesseract failed: %w", err)
+		if _, ok := seen[abs]; ok {
+			continue
 		}
-
-		content.WriteString(out.String())
-		content.WriteString("\n")
-	}
-
-	if content.Len() == 0 {
-		return "", fmt.Errorf("OCR extracted no text")
+		seen[abs] = struct{}{}
+		files = append(files, abs)
 	}
 
-	return content.String(), nil
+	sort.Strings(files)
+	return files, nil
 }
 
-// describePDFImage analyzes the first page of the PDF as an image and returns
-// a short plain-text description that can be used for title generation.
-func describePDFImage(pdfPath string, client *openai.Client) (string, error) {
-	tempDir, err := os.MkdirTemp("", "nombra-vision")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory for vision fallback: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	imagePrefix := filepath.Join(tempDir, "page-1")
-	cmd := exec.Command("pdftoppm", "-f", "1", "-singlefile", "-png", pdfPath, imagePrefix)
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("pdftoppm failed for vision fallback: %w", err)
-	}
-
-	imagePath := imagePrefix + ".png"
-	imageBytes, err := os.ReadFile(imagePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read rendered page image: %w", err)
-	}
-
-	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(imageBytes)
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: visionModel,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role: openai.ChatMessageRoleSystem,
-					Content: "You analyze document images. Describe what the image likely is so a filename can be generated. " +
-						"Include document type, visible entities, and date if readable. " +
-						"If text is unreadable, give a concise visual description. Respond in plain text only.",
-				},
-				{
-					Role: openai.ChatMessageRoleUser,
-					MultiContent: []openai.ChatMessagePart{
-						{
-							Type: openai.ChatMessagePartTypeText,
-							Text: "Describe this PDF page image for naming the file.",
-						},
-						{
-							Type: openai.ChatMessagePartTypeImageURL,
-							ImageURL: &openai.ChatMessageImageURL{
-								URL:    dataURL,
-								Detail: openai.ImageURLDetailHigh,
-							},
-						},
-					},
-				},
-			},
-			Temperature: 0.2,
-		},
-	)
-	if err != nil {
-		return "", fmt.Errorf("OpenAI vision API error: %w", err)
-	}
-
-	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
-		return "", fmt.Errorf("empty response from OpenAI vision API")
-	}
-
-	return resp.Choices[0].Message.Content, nil
+func processFiles(files []string, workerCount int) []fileResult {
+	return processJobs(files, workerCount, false)
 }
 
-func pageNumberFromPath(path string) int {
-	matches := regexp.MustCompile(`page-(\d+)\.png$`).FindStringSubmatch(filepath.Base(path))
-	if len(matches) != 2 {
-		return 0
-	}
-
-	n, err := strconv.Atoi(matches[1])
-	if err != nil {
-		return 0
-	}
-
-	return n
-}
+// processJobs processes files with workerCount workers, renaming them unless
+// deferRename is set.
+func processJobs(files []string, workerCount int, deferRename bool) []fileResult {
+	jobs := make(chan fileJob)
+	results := make(chan fileResult, len(files))
+	wg := startWorkers(jobs, results, workerCount)
 
-func confirmRename(filePath, title string) bool {
-	ext := filepath.Ext(filePath)
-	proposedName := sanitizeFilename(title) + ext
-	if len(proposedName) > maxFilenameLength {
-		proposedName = proposedName[:maxFilenameLength-len(ext)] + ext
+	for i, path := range files {
+		jobs <- fileJob{index: i, path: path, deferRename: deferRename}
 	}
+	close(jobs)
+	wg.Wait()
+	close(results)
 
-	fmt.Printf("Rename file?\n  %s\n  -> %s\nProceed? [y/N]: ", filepath.Base(filePath), proposedName)
-	reader := bufio.NewReader(os.Stdin)
-	answer, err := reader.ReadString('\n')
-	if err != nil {
-		return false
+	out := make([]fileResult, 0, len(files))
+	for result := range results {
+		out = append(out, result)
 	}
-	answer = strings.TrimSpace(strings.ToLower(answer))
-	return answer == "y" || answer == "yes"
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].index < out[j].index
+	})
+	return out
 }
 
-// generateOpenAITitle sends the extracted PDF content to OpenAI's Chat Completion API
-// to generate an appropriate title based on specific formatting rules.
-// It then cleans the returned title to ensure proper formatting.
-func generateOpenAITitle(content string, client *openai.Client, model string) (string, error) {
-	if content == "" {
-		return "", fmt.Errorf("empty content provided for title generation")
-	}
-
-	content = truncateContent(content)
-
-	// Add debug logging
-	log.Printf("Sending content to OpenAI (length: %d characters)", len(content))
-
-	// If verbose logging is enabled, print the content
-	if verbose {
-		log.Println("Content:")
-		log.Println(content)
-	}
-
-	metadata, err := extractMetadata(content, client, model, extractionPrompt, "")
-	if err != nil {
-		return "", err
-	}
-	title, ok := buildTitleFromMetadata(metadata)
-	if ok {
-		return title, nil
-	}
-
-	metadata, err = extractMetadata(content, client, model, retryExtractionPrompt, weakMetadataReason(metadata))
-	if err != nil {
-		return "", err
-	}
-	title, ok = buildTitleFromMetadata(metadata)
-	if !ok {
-		return "", fmt.Errorf("model returned insufficient metadata for filename generation")
+// startWorkers starts workerCount goroutines that process jobs until the
+// channel is closed. The returned WaitGroup completes when all have exited.
+func startWorkers(jobs <-chan fileJob, results chan<- fileResult, workerCount int) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if reason := spend.reason(); reason != "" {
+					results <- fileResult{index: job.index, path: job.path, skipped: true, skipReason: reason}
+					continue
+				}
+				start := time.Now()
+				result := processSingleFile(job.path, job.deferRename)
+				result.index = job.index
+				result.path = job.path
+				result.duration = time.Since(start)
+				spend.add(result.usage)
+				results <- result
+			}
+		}()
 	}
-
-	return title, nil
+	return &wg
 }
 
-func extractMetadata(content string, client *openai.Client, model, prompt, feedback string) (extractedMetadata, error) {
-	req := openai.ChatCompletionRequest{
-		Model: model,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: prompt,
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: buildMetadataRequest(content, feedback),
-			},
-		},
+func processSingleFile(filePath string, deferRename bool) fileResult {
+	hash, err := fileSHA256(filePath)
+	if err != nil {
+		return fileResult{err: fmt.Errorf("hashing failed: %w", err)}
 	}
 
-	if isGPT5Model(model) {
-		req.ReasoningEffort = strings.ToLower(reasoningEffort)
-		// GPT-5.4 supports temperature/top_p only when reasoning effort is "none".
-		if strings.EqualFold(reasoningEffort, "none") {
-			req.Temperature = 0
+	// Identical content is recognized before any text is extracted.
+	var claimed *duplicateEntry
+	var exact *duplicateMatch
+	if duplicates != nil {
+		claimed, exact = duplicates.claim(hash, filePath)
+		if exact != nil && duplicateAction(exact) != duplicateReport {
+			return handleDuplicate(fileResult{duplicate: exact}, filePath, hash)
 		}
-	} else {
-		req.Temperature = 0
 	}
 
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		req,
-	)
-	if err != nil {
-		return extractedMetadata{}, fmt.Errorf("OpenAI metadata extraction error: %w", err)
+	result, err := titleForFile(filePath, hash, claimed)
+	if exact != nil {
+		result.duplicate = exact
 	}
-	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
-		return extractedMetadata{}, fmt.Errorf("empty response from OpenAI metadata extraction")
-	}
-
-	metadata, err := parseMetadataResponse(resp.Choices[0].Message.Content)
 	if err != nil {
-		return extractedMetadata{}, err
-	}
-
-	return normalizeMetadata(metadata), nil
-}
-
-func buildMetadataRequest(content, feedback string) string {
-	if strings.TrimSpace(feedback) == "" {
-		return content
-	}
-	return fmt.Sprintf("Previous extraction was weak for this reason: %s\n\nDocument text:\n%s", feedback, content)
-}
-
-func parseMetadataResponse(raw string) (extractedMetadata, error) {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return extractedMetadata{}, fmt.Errorf("empty metadata response")
-	}
-
-	raw = strings.TrimPrefix(raw, "```json")
-	raw = strings.TrimPrefix(raw, "```")
-	raw = strings.TrimSuffix(raw, "```")
-	raw = strings.TrimSpace(raw)
-
-	start := strings.Index(raw, "{")
-	end := strings.LastIndex(raw, "}")
-	if start == -1 || end == -1 || end < start {
-		return extractedMetadata{}, fmt.Errorf("metadata response did not contain JSON object")
-	}
-
-	var metadata extractedMetadata
-	if err := json.Unmarshal([]byte(raw[start:end+1]), &metadata); err != nil {
-		return extractedMetadata{}, fmt.Errorf("invalid metadata JSON: %w", err)
-	}
-
-	return metadata, nil
-}
-
-// truncateContent shortens the input content if it exceeds the maximum allowed length,
-// appending a suffix to indicate that the content has been truncated.
-// truncateContent ensures the most relevant parts of the document are
-// preserved when limiting the text sent to OpenAI. When the content exceeds
-// the configured maximum length, the function keeps portions from both the
-// beginning and end of the text. A suffix is inserted between the two segments
-// to indicate that the middle section has been omitted.
-func truncateContent(content string) string {
-	if len(content) <= maxContentLength {
-		return content
-	}
-
-	// Ensure we always keep at least 1 character from start and end
-	minKeep := 1
-	available := maxContentLength - len(truncationSuffix)
-	if available < 2*minKeep {
-		// Not enough space for both start and end, just return the start
-		return content[:maxContentLength]
-	}
-
-	keep := available / 2
-	start := content[:keep]
-	end := content[len(content)-keep:]
-	return start + truncationSuffix + end
-}
-
-func normalizeMetadata(metadata extractedMetadata) extractedMetadata {
-	metadata.Date = normalizeDateSeparators(strings.TrimSpace(metadata.Date))
-	metadata.Language = strings.TrimSpace(metadata.Language)
-	metadata.Title = normalizeMetadataField(metadata.Title)
-	metadata.DocumentType = normalizeMetadataField(metadata.DocumentType)
-	metadata.Organization = normalizeOrganizationField(metadata.Organization)
-	metadata.Author = normalizeMetadataField(metadata.Author)
-	metadata.Recipient = normalizeMetadataField(metadata.Recipient)
-	metadata.Topic = normalizeMetadataField(metadata.Topic)
-	return metadata
-}
-
-func normalizeMetadataField(value string) string {
-	value = stripTrailingTranslation(value)
-	value = cleanTitle(value)
-	if isGenericMetadataValue(value) {
-		return ""
-	}
-	return value
-}
-
-func normalizeOrganizationField(value string) string {
-	value = stripTrailingTranslation(value)
-	value = cleanTitle(value)
-	if isGenericMetadataValue(value) {
-		return ""
-	}
-	return shortenDescriptor(value, 42)
-}
-
-func weakMetadataReason(metadata extractedMetadata) string {
-	reasons := []string{}
-	if metadata.Date == "" {
-		reasons = append(reasons, "no relevant date found")
-	}
-	if metadata.Title == "" && metadata.DocumentType == "" && metadata.Topic == "" {
-		reasons = append(reasons, "document identity is missing")
-	}
-	if metadata.Title == "" && metadata.DocumentType == "" && metadata.Topic != "" && metadata.Author != "" && metadata.Recipient != "" {
-		reasons = append(reasons, "extraction overfocused on names instead of document kind")
-	}
-	if len(reasons) == 0 {
-		reasons = append(reasons, "metadata was too weak to build a reliable filename")
-	}
-	return strings.Join(reasons, "; ")
-}
-
-func buildTitleFromMetadata(metadata extractedMetadata) (string, bool) {
-	metadata = normalizeMetadata(metadata)
-	parts := []string{}
-
-	date := metadata.Date
-	if looksLikeDate(date) {
-		parts = append(parts, date)
+		result.err = err
+		return result
 	}
-
-	primary := selectPrimaryDescriptor(metadata)
-	if !hasMeaningfulDescriptor(primary) {
-		return "", false
-	}
-	parts = append(parts, shortenDescriptor(primary, 54))
-
-	for _, extra := range selectSecondaryDescriptors(metadata, primary) {
-		if !hasMeaningfulDescriptor(extra) {
-			continue
-		}
-		if containsFold(parts, extra) {
-			continue
-		}
-		if descriptorOverlaps(primary, extra) {
-			continue
-		}
-		parts = append(parts, shortenDescriptor(extra, descriptorLimit(extra, metadata)))
-		if len(parts) >= 4 {
-			break
+	if result.duplicate != nil {
+		result = handleDuplicate(result, filePath, hash)
+		if result.duplicate.action != duplicateReport {
+			return result
 		}
 	}
 
-	title := compactTitle(strings.Join(parts, " - "))
-	if !isLikelyFilename(title) {
-		return "", false
-	}
-	return title, true
-}
-
-func selectPrimaryDescriptor(metadata extractedMetadata) string {
-	switch {
-	case hasMeaningfulDescriptor(metadata.Title) && !isVerboseTitle(metadata.Title, metadata.DocumentType, metadata.Topic):
-		return metadata.Title
-	case hasMeaningfulDescriptor(metadata.DocumentType):
-		return metadata.DocumentType
-	case hasMeaningfulDescriptor(metadata.Title):
-		return metadata.Title
-	case hasMeaningfulDescriptor(metadata.Topic):
-		return metadata.Topic
-	default:
-		return ""
+	if printOnly {
+		return result
 	}
-}
-
-func selectSecondaryDescriptors(metadata extractedMetadata, primary string) []string {
-	extras := []string{}
 
-	if hasMeaningfulDescriptor(metadata.Organization) && !descriptorOverlaps(primary, metadata.Organization) {
-		extras = append(extras, metadata.Organization)
+	// The batch review renames the files the user accepts afterwards.
+	if deferRename {
+		result.newPath = namer.ProposedPath(filePath, result.title, result.metadata)
+		result.hash, result.claimed = hash, claimed
+		result.review = needsReview(result)
+		return result
 	}
 
-	if metadata.Organization == "" &&
-		hasMeaningfulDescriptor(metadata.Author) &&
-		!descriptorOverlaps(primary, metadata.Author) &&
-		!containsFold(extras, metadata.Author) {
-		extras = append(extras, metadata.Author)
+	if needsReview(result) {
+		return reviewFile(result, filePath, hash, claimed)
 	}
 
-	if hasMeaningfulDescriptor(metadata.Recipient) && !descriptorOverlaps(primary, metadata.Recipient) {
-		extras = append(extras, metadata.Recipient)
+	if dryRun {
+		result.newPath = namer.ProposedPath(filePath, result.title, result.metadata)
+		return result
 	}
 
-	if hasMeaningfulDescriptor(metadata.Topic) &&
-		!descriptorOverlaps(primary, metadata.Topic) &&
-		!descriptorOverlaps(metadata.DocumentType, metadata.Topic) &&
-		isConciseDescriptor(metadata.Topic) {
-		extras = append(extras, metadata.Topic)
+	if interactive && !confirmRename(filePath, namer.ProposedPath(filePath, result.title, result.metadata)) {
+		result.skipped = true
+		return result
 	}
-
-	return extras
+	return renameFile(result, filePath, hash, claimed)
 }
 
-func descriptorLimit(value string, metadata extractedMetadata) int {
-	switch {
-	case strings.EqualFold(value, metadata.Organization):
-		return 42
-	case strings.EqualFold(value, metadata.Recipient):
-		return 30
-	case strings.EqualFold(value, metadata.Author):
-		return 28
-	default:
-		return 34
+// renameFile renames or copies a named file, writes its metadata when asked
+// to and records the change in the undo journal.
+func renameFile(result fileResult, filePath, hash string, claimed *duplicateEntry) fileResult {
+	newPath, err := namer.Rename(context.Background(), filePath, result.title, result.metadata)
+	if err != nil {
+		result.err = fmt.Errorf("renaming failed: %w", err)
+		return result
 	}
-}
+	result.newPath = newPath
+	duplicates.moved(claimed, newPath)
 
-func compactTitle(title string) string {
-	title = cleanTitle(title)
-	title = removeOverlappingParts(title)
-	if len(title) <= maxFilenameLength {
-		return title
+	// Metadata goes into the renamed file so that --dest-mode copy leaves the
+	// original untouched.
+	if writeMetadata && nombra.IsPDF(newPath) {
+		if err := writePDFMetadata(newPath, result.metadata, result.title); err != nil {
+			log.Printf("Warning: could not write metadata to %s: %v", filepath.Base(newPath), err)
+		} else if updated, err := fileSHA256(newPath); err == nil {
+			hash = updated
+		}
 	}
+	result.hash = hash
 
-	parts := strings.Split(title, " - ")
-	for len(parts) > 2 {
-		removed := false
-		for i := len(parts) - 1; i >= 2; i-- {
-			candidate := cleanTitle(strings.Join(append(append([]string{}, parts[:i]...), parts[i+1:]...), " - "))
-			if len(candidate) < len(title) {
-				title = candidate
-				parts = strings.Split(title, " - ")
-				removed = true
-				if len(title) <= maxFilenameLength {
-					return title
-				}
-				break
-			}
+	if journal != nil {
+		record := journal.recordRename
+		if destMode == nombra.DestModeCopy {
+			record = journal.recordCopy
 		}
-		if !removed {
-			break
+		if err := record(filePath, newPath, hash, result.metadata); err != nil {
+			log.Printf("Warning: renamed %s but could not write undo journal: %v", filepath.Base(filePath), err)
 		}
 	}
-
-	if len(title) > maxFilenameLength {
-		title = title[:maxFilenameLength]
-		title = strings.TrimSpace(strings.TrimSuffix(title, "-"))
-	}
-	return cleanTitle(title)
+	return result
 }
 
-func removeOverlappingParts(title string) string {
-	parts := strings.Split(title, " - ")
-	filtered := make([]string, 0, len(parts))
-	for _, part := range parts {
-		skip := false
-		for _, existing := range filtered {
-			if descriptorOverlaps(existing, part) {
-				skip = true
-				break
+// titleForFile returns the title and metadata for a file, reusing cached
+// metadata for the same content and settings when available. The result also
+// carries the extraction method and token usage, even when naming fails.
+// When the text is a near-duplicate of a file claimed earlier, the result
+// reports it and, unless duplicates are only reported, carries no title.
+func titleForFile(filePath, hash string, claimed *duplicateEntry) (fileResult, error) {
+	key := cacheKey(hash)
+	if metadataCache != nil {
+		if cached, ok := metadataCache.get(key); ok {
+			if title, ok := namer.BuildTitle(cached.Metadata); ok {
+				if verbose {
+					log.Printf("Using cached metadata for %s", filepath.Base(filePath))
+				}
+				result := fileResult{title: title, metadata: cached.Metadata, method: methodCache}
+				result.confidence = namer.Confidence(nombra.Content{Method: cached.Method, OCRConfidence: cached.OCRConfidence}, cached.Metadata)
+				result.duplicate = duplicates.match(claimed, cached.Signature)
+				return result, nil
 			}
 		}
-		if !skip {
-			filtered = append(filtered, part)
-		}
-	}
-	return cleanTitle(strings.Join(filtered, " - "))
-}
-
-func descriptorOverlaps(a, b string) bool {
-	a = strings.ToLower(strings.TrimSpace(a))
-	b = strings.ToLower(strings.TrimSpace(b))
-	if a == "" || b == "" {
-		return false
 	}
-	return strings.Contains(a, b) || strings.Contains(b, a)
-}
 
-func isVerboseTitle(title, documentType, topic string) bool {
-	if !hasMeaningfulDescriptor(title) {
-		return false
-	}
-	if len(title) > 55 && hasMeaningfulDescriptor(documentType) {
-		return true
-	}
-	return descriptorOverlaps(title, topic) && len(title) > 45 && hasMeaningfulDescriptor(documentType)
-}
-
-func isConciseDescriptor(value string) bool {
-	return len(strings.TrimSpace(value)) <= 40
-}
-
-func stripTrailingTranslation(value string) string {
-	value = strings.TrimSpace(value)
-	matches := regexp.MustCompile(`^(.*?)\s+\(([^()]*)\)$`).FindStringSubmatch(value)
-	if len(matches) != 3 {
-		return value
-	}
-
-	base := strings.TrimSpace(matches[1])
-	translated := strings.TrimSpace(matches[2])
-	if base == "" || translated == "" {
-		return value
-	}
-
-	if descriptorOverlaps(base, translated) || likelyTranslatedDuplicate(base, translated) {
-		return base
+	content, err := namer.ExtractContent(context.Background(), filePath)
+	result := fileResult{method: content.Method, usage: content.Usage}
+	if err != nil {
+		return result, err
 	}
 
-	return value
-}
-
-func likelyTranslatedDuplicate(base, translated string) bool {
-	return len(translated) > 12 && (containsNonASCII(base) || containsAcronym(base) || len(strings.Fields(base)) >= 3)
-}
-
-func containsNonASCII(value string) bool {
-	for _, r := range value {
-		if r > 127 {
-			return true
-		}
+	// A vision description says too little about the text to compare scans.
+	var signature []uint64
+	if content.Method != nombra.MethodVision {
+		signature = minhashSignature(content.Text)
 	}
-	return false
-}
-
-func containsAcronym(value string) bool {
-	return regexp.MustCompile(`\b[A-Z]{2,}\b`).MatchString(value)
-}
-
-func shortenDescriptor(value string, limit int) string {
-	value = strings.TrimSpace(value)
-	if limit <= 0 || len(value) <= limit {
-		return value
+	if result.duplicate = duplicates.match(claimed, signature); result.duplicate != nil && duplicateAction(result.duplicate) != duplicateReport {
+		return result, nil
 	}
 
-	words := strings.Fields(value)
-	if len(words) == 0 {
-		return value[:limit]
+	metadata, usage, err := namer.ContentMetadata(context.Background(), content)
+	result.usage = result.usage.Add(usage)
+	if err != nil {
+		return result, fmt.Errorf("title generation failed: %w", err)
 	}
+	result.title, _ = namer.BuildTitle(metadata)
+	result.metadata = metadata
+	result.confidence = namer.Confidence(content, metadata)
 
-	var parts []string
-	current := 0
-	for _, word := range words {
-		added := len(word)
-		if len(parts) > 0 {
-			added++
-		}
-		if current+added > limit {
-			break
+	if metadataCache != nil {
+		if err := metadataCache.put(key, metadata, content, signature); err != nil {
+			log.Printf("Warning: could not write cache entry for %s: %v", filepath.Base(filePath), err)
 		}
-		parts = append(parts, word)
-		current += added
 	}
-	if len(parts) == 0 {
-		return strings.TrimSpace(value[:limit])
-	}
-	return strings.Join(parts, " ")
+	return result, nil
 }
 
-func hasMeaningfulDescriptor(value string) bool {
-	value = strings.TrimSpace(value)
-	return value != "" && !isGenericMetadataValue(value)
-}
-
-func isGenericMetadataValue(value string) bool {
-	switch strings.ToLower(strings.TrimSpace(value)) {
-	case "", "untitled", "document", "file", "pdf", "scan", "scanned document", "image", "unknown", "misc", "miscellaneous", "n a", "na", "none":
-		return true
-	default:
+func confirmRename(filePath, proposed string) bool {
+	fmt.Printf("Rename file?\n  %s\n  -> %s\nProceed? [y/N]: ", filepath.Base(filePath), filepath.Base(proposed))
+	reader := bufio.NewReader(os.Stdin)
+	answer, err := reader.ReadString('\n')
+	if err != nil {
 		return false
 	}
+	answer = strings.TrimSpace(strings.ToLower(answer))
+	return answer == "y" || answer == "yes"
 }
 
+// containsFold reports whether values holds candidate, ignoring case.
 func containsFold(values []string, candidate string) bool {
 	for _, value := range values {
 		if strings.EqualFold(value, candidate) {
@@ -1201,110 +750,3 @@ func containsFold(values []string, candidate string) bool {
 	}
 	return false
 }
-
-func looksLikeDate(value string) bool {
-	return regexp.MustCompile(`^\d{4}\.\d{2}\.\d{2}$`).MatchString(strings.TrimSpace(value))
-}
-
-// cleanTitle cleans and formats the generated title by removing extraneous quotes and whitespace,
-// normalizing spacing around dashes, and ensuring proper text formatting.
-func cleanTitle(title string) string {
-	// Remove extraneous quotes and surrounding whitespace
-	title = strings.Trim(title, "\"' \t\n")
-
-	// Replace newlines with a single space
-	title = strings.ReplaceAll(title, "\n", " ")
-
-	// Insert spaces between a lowercase letter followed immediately by an uppercase letter
-	title = regexp.MustCompile(`([a-z])([A-Z])`).ReplaceAllString(title, "$1 $2")
-
-	// Treat missing-space separators like "Name-Title" as section separators.
-	title = regexp.MustCompile(`([[:lower:]])-([[:upper:]][[:lower:]])`).ReplaceAllString(title, "$1 - $2")
-
-	// Collapse runs of whitespace
-	title = regexp.MustCompile(`\s+`).ReplaceAllString(title, " ")
-
-	// Ensure explicit separator dashes have a single space on each side without
-	// touching hyphens inside words like "COVID-19" or "COVID-Zertifikat".
-	title = regexp.MustCompile(`\s+-\s+`).ReplaceAllString(title, " - ")
-	title = regexp.MustCompile(`\s-\s*`).ReplaceAllString(title, " - ")
-	title = regexp.MustCompile(`\s*-\s`).ReplaceAllString(title, " - ")
-
-	title = regexp.MustCompile(`(?i)\.pdf$`).ReplaceAllString(title, "")
-
-	title = moveTrailingDateToFront(strings.TrimSpace(title))
-
-	// Trim any trailing or leading whitespace introduced by replacements
-	return strings.TrimSpace(title)
-}
-
-func isLikelyFilename(title string) bool {
-	title = strings.TrimSpace(title)
-	if title == "" {
-		return false
-	}
-
-	disallowedPhrases := []string{
-		"no clear",
-		"mentioned in the text",
-		"descriptive filename could be",
-		"filename should be",
-		"filename could be",
-		"document type",
-		"do not",
-		"respond only",
-	}
-	disallowedTitles := map[string]struct{}{
-		"untitled":         {},
-		"document":         {},
-		"file":             {},
-		"pdf":              {},
-		"scan":             {},
-		"scanned document": {},
-		"image":            {},
-		"unknown":          {},
-		"misc":             {},
-		"miscellaneous":    {},
-	}
-	lowerTitle := strings.ToLower(title)
-	if _, found := disallowedTitles[lowerTitle]; found {
-		return false
-	}
-	for _, phrase := range disallowedPhrases {
-		if strings.Contains(lowerTitle, phrase) {
-			return false
-		}
-	}
-
-	if strings.ContainsAny(title, "\n\r") {
-		return false
-	}
-
-	return !strings.Contains(title, ":")
-}
-
-func moveTrailingDateToFront(title string) string {
-	datePattern := `\d{4}(?:\s*[./-]\s*)\d{2}(?:\s*[./-]\s*)\d{2}`
-	leadingDate := regexp.MustCompile(`^` + datePattern + `(?:\s+-\s+|$)`)
-	if leadingDate.MatchString(title) {
-		return title
-	}
-
-	trailingDate := regexp.MustCompile(`^(.*?)(?:\s+-\s+)(` + datePattern + `)$`)
-	matches := trailingDate.FindStringSubmatch(title)
-	if len(matches) != 3 {
-		return title
-	}
-
-	body := strings.TrimSpace(matches[1])
-	date := normalizeDateSeparators(matches[2])
-	if body == "" {
-		return date
-	}
-	return date + " - " + body
-}
-
-func normalizeDateSeparators(date string) string {
-	date = regexp.MustCompile(`\s*([./-])\s*`).ReplaceAllString(date, "$1")
-	return strings.NewReplacer("/", ".", "-", ".").Replace(date)
-}
@@ -0,0 +1,201 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicBaseURL   = "https://api.anthropic.com"
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 1024
+	// DefaultAnthropicModel is used when Options.Model is empty.
+	DefaultAnthropicModel = "claude-sonnet-4-5"
+)
+
+// anthropicProvider talks to the Anthropic Messages API.
+type anthropicProvider struct {
+	apiKey  string
+	baseURL string
+	http    *http.Client
+}
+
+type anthropicMessagesRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Temperature float32            `json:"temperature"`
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+type anthropicContent struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicMessagesResponse struct {
+	Content []anthropicContent `json:"content"`
+	Usage   struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAnthropicProvider(apiKey, baseURL string) *anthropicProvider {
+	if baseURL == "" {
+		baseURL = anthropicBaseURL
+	}
+	return &anthropicProvider{
+		apiKey:  apiKey,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    http.DefaultClient,
+	}
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	reply, err := p.send(ctx, anthropicMessagesRequest{
+		Model:     req.Model,
+		MaxTokens: anthropicMaxTokens,
+		System:    req.System,
+		Messages: []anthropicMessage{
+			{
+				Role:    "user",
+				Content: []anthropicContent{{Type: "text", Text: req.User}},
+			},
+		},
+	})
+	if err != nil {
+		return Completion{}, fmt.Errorf("Anthropic metadata extraction error: %w", err)
+	}
+	if strings.TrimSpace(reply.Content) == "" {
+		return Completion{}, fmt.Errorf("empty response from Anthropic metadata extraction")
+	}
+	return reply, nil
+}
+
+func (p *anthropicProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	images := make([]anthropicContent, 0, len(req.Images)+1)
+	for _, image := range req.Images {
+		images = append(images, anthropicContent{
+			Type: "image",
+			Source: &anthropicImageSource{
+				Type:      "base64",
+				MediaType: image.MimeType,
+				Data:      base64.StdEncoding.EncodeToString(image.Data),
+			},
+		})
+	}
+	reply, err := p.send(ctx, anthropicMessagesRequest{
+		Model:     req.Model,
+		MaxTokens: anthropicMaxTokens,
+		System:    req.System,
+		Messages: []anthropicMessage{
+			{
+				Role:    "user",
+				Content: append(images, anthropicContent{Type: "text", Text: req.Prompt}),
+			},
+		},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return Completion{}, fmt.Errorf("Anthropic vision API error: %w", err)
+	}
+	if strings.TrimSpace(reply.Content) == "" {
+		return Completion{}, fmt.Errorf("empty response from Anthropic vision API")
+	}
+	return reply, nil
+}
+
+// send posts a Messages API request and concatenates the text blocks of the reply.
+func (p *anthropicProvider) send(ctx context.Context, body anthropicMessagesRequest) (Completion, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.http.Do(httpReq)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var decoded anthropicMessagesResponse
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		err = fmt.Errorf("invalid response (status %d): %w", resp.StatusCode, err)
+		if resp.StatusCode != http.StatusOK {
+			return Completion{}, &apiError{status: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header), err: err}
+		}
+		return Completion{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("status %d", resp.StatusCode)
+		if decoded.Error != nil {
+			err = fmt.Errorf("status %d: %s: %s", resp.StatusCode, decoded.Error.Type, decoded.Error.Message)
+		}
+		return Completion{}, &apiError{status: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header), err: err}
+	}
+
+	var text strings.Builder
+	for _, block := range decoded.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return Completion{
+		Content: text.String(),
+		Usage: Usage{
+			PromptTokens:     decoded.Usage.InputTokens,
+			CompletionTokens: decoded.Usage.OutputTokens,
+			TotalTokens:      decoded.Usage.InputTokens + decoded.Usage.OutputTokens,
+		},
+	}, nil
+}
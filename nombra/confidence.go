@@ -0,0 +1,127 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// selfRatingKey is the reply key of the model's rating with Options.SelfRating.
+const selfRatingKey = "confidence"
+
+const selfRatingPrompt = `Also return "confidence": how sure you are, from 0 to 1, that the metadata is correct and complete, e.g. "0.8". Rate low when the text is garbled, ambiguous or lacks a date, sender or document kind.`
+
+// Confidence estimates from 0 to 1 how well metadata names a document, with
+// the reasons it falls short.
+type Confidence struct {
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Weights of the metadata fields in Confidence. They add up to 1.
+const (
+	dateWeight         = 0.3
+	identityWeight     = 0.35
+	organizationWeight = 0.25
+	subjectWeight      = 0.1
+)
+
+// Confidence scores metadata extracted from content. It combines how
+// complete the metadata is, whether a title can be built from it, how the
+// text was obtained (the OCR confidence for scans, vision and offline
+// heuristics being less reliable) and, with Options.SelfRating, the model's
+// own rating. Pass a zero Content when the text is not at hand, e.g. for
+// cached metadata.
+func (n *Namer) Confidence(content Content, metadata Metadata) Confidence {
+	var c Confidence
+	if _, ok := n.BuildTitle(metadata); !ok {
+		return Confidence{Reasons: []string{weakMetadataReason(metadata)}}
+	}
+
+	switch {
+	case looksLikeDate(metadata.Date):
+		c.Score += dateWeight
+	case metadata.Date != "":
+		c.Score += dateWeight / 2
+		c.Reasons = append(c.Reasons, "incomplete date")
+	default:
+		c.Reasons = append(c.Reasons, "no date")
+	}
+	if metadata.DocumentType != "" || metadata.Title != "" {
+		c.Score += identityWeight
+	} else {
+		c.Reasons = append(c.Reasons, "no document type or title")
+	}
+	if metadata.Organization != "" || metadata.Author != "" {
+		c.Score += organizationWeight
+	} else {
+		c.Reasons = append(c.Reasons, "no organization")
+	}
+	if metadata.Topic != "" || metadata.Recipient != "" || (metadata.Title != "" && metadata.DocumentType != "") {
+		c.Score += subjectWeight
+	}
+
+	switch {
+	case n.opts.Offline:
+		c.Score *= 0.8
+		c.Reasons = append(c.Reasons, "guessed by offline heuristics")
+	case content.Method == MethodVision:
+		c.Score *= 0.75
+		c.Reasons = append(c.Reasons, "read from page images by the vision model")
+	case content.Method == MethodOCR && content.OCRConfidence > 0:
+		c.Score *= 0.6 + 0.4*content.OCRConfidence
+		if content.OCRConfidence < 0.8 {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("OCR confidence %.0f%%", 100*content.OCRConfidence))
+		}
+	case content.Method == MethodOCR:
+		c.Score *= 0.85
+	}
+
+	if rating := metadata.SelfRating; rating > 0 {
+		c.Score = (c.Score + rating) / 2
+		if rating < 0.7 {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("model rated its answer %.2f", rating))
+		}
+	}
+	c.Score = math.Round(min(max(c.Score, 0), 1)*100) / 100
+	return c
+}
+
+// parseSelfRating reads the model's rating, a number or numeric string from
+// 0 to 1, out of a metadata answer. Missing or invalid ratings are 0.
+func parseSelfRating(object []byte) float64 {
+	var values map[string]any
+	if err := json.Unmarshal(object, &values); err != nil {
+		return 0
+	}
+	var rating float64
+	switch v := values[selfRatingKey].(type) {
+	case float64:
+		rating = v
+	case string:
+		rating, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+		if strings.HasSuffix(strings.TrimSpace(v), "%") {
+			rating /= 100
+		}
+	}
+	if rating < 0 || rating > 1 || math.IsNaN(rating) {
+		return 0
+	}
+	return rating
+}
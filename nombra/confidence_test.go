@@ -0,0 +1,106 @@
+package nombra
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTesseractTSV(t *testing.T) {
+	tsv := "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+		"1\t1\t0\t0\t0\t0\t0\t0\t100\t100\t-1\t\n" +
+		"5\t1\t1\t1\t1\t1\t0\t0\t10\t10\t96\tInvoice\n" +
+		"5\t1\t1\t1\t1\t2\t0\t0\t10\t10\t90\tACME\n" +
+		"5\t1\t1\t1\t2\t1\t0\t0\t10\t10\t30\tGmbH\n" +
+		"5\t1\t1\t2\t1\t1\t0\t0\t10\t10\t-1\t \n" +
+		"5\t1\t2\t1\t1\t1\t0\t0\t10\t10\t80\tTotal\n"
+	text, confidence := parseTesseractTSV(tsv)
+	if want := "Invoice ACME\nGmbH\n\nTotal\n"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	// Word confidences weighted by length: (7*96 + 4*90 + 4*30 + 5*80) / 20.
+	if got := confidence.value(); math.Abs(got-0.776) > 1e-9 {
+		t.Errorf("confidence = %v, want 0.776", got)
+	}
+	if _, empty := parseTesseractTSV(""); empty.value() != 0 {
+		t.Errorf("confidence of empty output = %v", empty.value())
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	n := newTestNamer(t, Options{})
+	complete := Metadata{Date: "2025.01.15", DocumentType: "Invoice", Organization: "ACME", Topic: "Consulting"}
+	tests := []struct {
+		name     string
+		content  Content
+		metadata Metadata
+		score    float64
+		reason   string
+	}{
+		{"complete", Content{Method: MethodStandard}, complete, 1, ""},
+		{"cached", Content{}, complete, 1, ""},
+		{"partial date", Content{Method: MethodStandard}, Metadata{Date: "2025", DocumentType: "Invoice", Organization: "ACME"}, 0.75, "incomplete date"},
+		{"no organization", Content{Method: MethodStandard}, Metadata{Date: "2025.01.15", DocumentType: "Invoice"}, 0.65, "no organization"},
+		{"blurry scan", Content{Method: MethodOCR, OCRConfidence: 0.5}, complete, 0.8, "OCR confidence 50%"},
+		{"clear scan", Content{Method: MethodOCR, OCRConfidence: 0.95}, complete, 0.98, ""},
+		{"vision", Content{Method: MethodVision}, complete, 0.75, "vision model"},
+		{"self rated", Content{Method: MethodStandard}, Metadata{Date: "2025.01.15", DocumentType: "Invoice", Organization: "ACME", SelfRating: 0.4}, 0.65, "model rated its answer 0.40"},
+		{"no title", Content{Method: MethodStandard}, Metadata{Organization: "ACME"}, 0, "document identity is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := n.Confidence(tt.content, tt.metadata)
+			if math.Abs(got.Score-tt.score) > 1e-9 {
+				t.Errorf("score = %v, want %v (%v)", got.Score, tt.score, got.Reasons)
+			}
+			if tt.reason == "" && len(got.Reasons) > 0 {
+				t.Errorf("reasons = %v, want none", got.Reasons)
+			}
+			if tt.reason != "" && !slices.ContainsFunc(got.Reasons, func(r string) bool { return strings.Contains(r, tt.reason) }) {
+				t.Errorf("reasons = %v, want %q", got.Reasons, tt.reason)
+			}
+		})
+	}
+
+	offline := newTestNamer(t, Options{Offline: true})
+	if got := offline.Confidence(Content{Method: MethodStandard}, complete); got.Score != 0.8 {
+		t.Errorf("offline score = %v, want 0.8", got.Score)
+	}
+}
+
+func TestSelfRating(t *testing.T) {
+	for _, tc := range []struct {
+		reply string
+		want  float64
+	}{
+		{`{"confidence": "0.85"}`, 0.85},
+		{`{"confidence": 0.6}`, 0.6},
+		{`{"confidence": "70%"}`, 0.7},
+		{`{"confidence": "high"}`, 0},
+		{`{"confidence": 7}`, 0},
+		{`{}`, 0},
+	} {
+		if got := parseSelfRating([]byte(tc.reply)); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("parseSelfRating(%s) = %v, want %v", tc.reply, got, tc.want)
+		}
+	}
+
+	provider := &scriptedProvider{replies: []string{strings.TrimSuffix(completeMetadata, "}") + `,"confidence":"0.9"}`}}
+	n := newTestNamer(t, Options{Client: provider, SelfRating: true, StructuredOutput: StructuredOutputOn})
+	metadata, _, err := n.ExtractMetadata(context.Background(), "Invoice from ACME")
+	if err != nil {
+		t.Fatalf("ExtractMetadata returned error: %v", err)
+	}
+	if metadata.SelfRating != 0.9 {
+		t.Errorf("SelfRating = %v, want 0.9", metadata.SelfRating)
+	}
+	req := provider.requests[0]
+	if !strings.Contains(req.System, selfRatingPrompt) || !slices.ContainsFunc(req.Schema.Properties, func(p SchemaProperty) bool { return p.Name == selfRatingKey }) {
+		t.Errorf("request does not ask for a rating: %+v", req)
+	}
+	if _, err := New(Options{Client: provider, Fields: []Field{{Name: "confidence", Description: "x"}}}); err == nil {
+		t.Error("New() accepted a custom field named confidence")
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// Modes accepted in Options.DestMode.
+const (
+	DestModeMove = "move"
+	DestModeCopy = "copy"
+
+	// unknownDestFolder replaces a destination directory whose fields are all
+	// empty.
+	unknownDestFolder = "_unknown"
+)
+
+var validDestModes = []string{DestModeMove, DestModeCopy}
+
+// destTemplate is a parsed Options.Dest value: a directory path whose components may
+// contain placeholders, e.g. ~/Archive/{organization}/{date:2006}.
+type destTemplate struct {
+	source     string
+	components []destComponent
+}
+
+// destComponent is one path component, either literal or a template.
+type destComponent struct {
+	literal  string
+	template *titleTemplate
+}
+
+func parseDestTemplate(source string, extra []string) (*destTemplate, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("destination is empty")
+	}
+
+	path := filepath.ToSlash(source)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot expand ~: %w", err)
+		}
+		path = filepath.ToSlash(home) + path[1:]
+	}
+	// Resolve relative destinations now so journal entries stay valid from
+	// any working directory.
+	if !filepath.IsAbs(filepath.FromSlash(path)) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.ToSlash(cwd) + "/" + path
+	}
+
+	dest := &destTemplate{source: source}
+	for i, part := range strings.Split(path, "/") {
+		if !strings.ContainsAny(part, "{}") {
+			// Keep the leading empty component of absolute paths.
+			if part != "" || i == 0 {
+				dest.components = append(dest.components, destComponent{literal: part})
+			}
+			continue
+		}
+		tmpl, err := parseTitleTemplate(part, extra)
+		if err != nil {
+			return nil, err
+		}
+		dest.components = append(dest.components, destComponent{template: tmpl})
+	}
+	return dest, nil
+}
+
+// dir returns the directory a file with this metadata is filed into.
+// Rendered components are sanitized so metadata cannot escape the tree.
+func (d *destTemplate) dir(metadata Metadata) string {
+	parts := make([]string, 0, len(d.components))
+	for _, component := range d.components {
+		if component.template == nil {
+			parts = append(parts, component.literal)
+			continue
+		}
+		text, _ := component.template.fill(metadata)
+		parts = append(parts, sanitizeDirName(text))
+	}
+
+	dir := strings.Join(parts, "/")
+	if dir == "" {
+		dir = "/"
+	}
+	return filepath.Clean(filepath.FromSlash(dir))
+}
+
+func sanitizeDirName(name string) string {
+	clean := strings.Trim(regexp.MustCompile(sanitizeRegex).ReplaceAllString(name, ""), ". ")
+	if len(clean) > maxFilenameLength {
+		clean = strings.TrimSpace(clean[:maxFilenameLength])
+	}
+	if clean == "" {
+		return unknownDestFolder
+	}
+	return clean
+}
+
+func validateDestMode(mode string) error {
+	for _, v := range validDestModes {
+		if mode == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid dest mode %q. valid modes: %s", mode, strings.Join(validDestModes, ", "))
+}
+
+// MoveFile renames src to dst, falling back to copy and delete when they are
+// on different filesystems. It never replaces an existing dst; the error then
+// wraps fs.ErrExist.
+func MoveFile(src, dst string) error {
+	// A hard link claims dst atomically, even against concurrent moves.
+	err := os.Link(src, dst)
+	switch {
+	case err == nil:
+		return os.Remove(src)
+	case errors.Is(err, fs.ErrExist):
+		return err
+	case errors.Is(err, syscall.EXDEV):
+		return copyAndRemove(src, dst)
+	}
+
+	// Without hard links, reserve dst with an empty file that only this call
+	// replaces.
+	placeholder, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	placeholder.Close()
+	if err := os.Rename(src, dst); err != nil {
+		os.Remove(dst)
+		if errors.Is(err, syscall.EXDEV) {
+			return copyAndRemove(src, dst)
+		}
+		return err
+	}
+	return nil
+}
+
+func copyAndRemove(src, dst string) error {
+	if err := CopyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// CopyFile copies src to dst, keeping the permissions and modification time.
+// It never overwrites an existing dst.
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,169 @@
+package nombra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDestTemplateDir(t *testing.T) {
+	metadata := Metadata{
+		Date:         "2024.03.01",
+		DocumentType: "Invoice",
+		Organization: "ACME/Europe",
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		metadata Metadata
+		want     string
+	}{
+		{"nested fields", "/archive/{organization}/{date:2006}/{document_type}", metadata, "/archive/ACMEEurope/2024/Invoice"},
+		{"relative root", "archive/{document_type|title}", metadata, "archive/Invoice"},
+		{"literal within component", "/archive/{date:2006}-docs", metadata, "/archive/2024-docs"},
+		{"empty field", "/archive/{recipient}/{document_type}", metadata, "/archive/_unknown/Invoice"},
+		{"no path traversal", "/archive/{organization}", Metadata{Organization: ".."}, "/archive/_unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := parseDestTemplate(tt.source, nil)
+			if err != nil {
+				t.Fatalf("parseDestTemplate(%q) returned error: %v", tt.source, err)
+			}
+			want, _ := filepath.Abs(filepath.FromSlash(tt.want))
+			if got := dest.dir(tt.metadata); got != want {
+				t.Errorf("dir() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseDestTemplate("/archive/{nope}", nil); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
+
+func TestDestTemplateExpandsHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dest, err := parseDestTemplate("~/Archive/{document_type}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dest.dir(Metadata{DocumentType: "Letter"}), filepath.Join(home, "Archive", "Letter"); got != want {
+		t.Errorf("dir() = %q; want %q", got, want)
+	}
+}
+
+func TestRenameIntoDest(t *testing.T) {
+	src := t.TempDir()
+	archive := t.TempDir()
+	metadata := Metadata{Organization: "ACME", Date: "2024.03.01"}
+	dest := filepath.Join(archive, "{organization}", "{date:2006}")
+
+	write := func(name, content string) string {
+		path := filepath.Join(src, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	first := write("scan1.pdf", "one")
+	moved, err := newTestNamer(t, Options{Dest: dest}).Rename(context.Background(), first, "Invoice", metadata)
+	if err != nil {
+		t.Fatalf("move returned error: %v", err)
+	}
+	if want := filepath.Join(archive, "ACME", "2024", "Invoice.pdf"); moved != want {
+		t.Errorf("moved to %q; want %q", moved, want)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("original still exists after move")
+	}
+
+	second := write("scan2.pdf", "two")
+	copied, err := newTestNamer(t, Options{Dest: dest, DestMode: DestModeCopy}).Rename(context.Background(), second, "Invoice", metadata)
+	if err != nil {
+		t.Fatalf("copy returned error: %v", err)
+	}
+	if want := filepath.Join(archive, "ACME", "2024", "Invoice-1.pdf"); copied != want {
+		t.Errorf("copied to %q; want %q", copied, want)
+	}
+	if data, err := os.ReadFile(second); err != nil || string(data) != "two" {
+		t.Errorf("original was not kept by copy: %q, %v", data, err)
+	}
+	if data, _ := os.ReadFile(copied); string(data) != "two" {
+		t.Errorf("copy content = %q", data)
+	}
+}
+
+func TestRenameConcurrentlyIntoDest(t *testing.T) {
+	archive := t.TempDir()
+	metadata := Metadata{Organization: "ACME", Date: "2024.03.01"}
+	namer := newTestNamer(t, Options{Dest: filepath.Join(archive, "{organization}", "{date:2006}")})
+
+	// Same-titled files from different source directories race for one name.
+	const files = 16
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	paths := make([]string, files)
+	errs := make([]error, files)
+	for i := range files {
+		path := filepath.Join(t.TempDir(), "scan.pdf")
+		if err := os.WriteFile(path, []byte(fmt.Sprint(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			paths[i], errs[i] = namer.Rename(context.Background(), path, "Invoice", metadata)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := range files {
+		if errs[i] != nil {
+			t.Fatalf("rename %d returned error: %v", i, errs[i])
+		}
+		if seen[paths[i]] {
+			t.Errorf("two files were renamed to %s", paths[i])
+		}
+		seen[paths[i]] = true
+		if data, err := os.ReadFile(paths[i]); err != nil || string(data) != fmt.Sprint(i) {
+			t.Errorf("%s holds %q, %v; want file %d", paths[i], data, err, i)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(archive, "ACME", "2024"))
+	if err != nil || len(entries) != files {
+		t.Errorf("archive holds %d files, %v; want %d", len(entries), err, files)
+	}
+}
+
+func TestMoveFileNeverReplaces(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "scan.pdf"), filepath.Join(dir, "Invoice.pdf")
+	for path, content := range map[string]string{src: "new", dst: "old"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MoveFile(src, dst); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("MoveFile onto an existing file returned %v; want fs.ErrExist", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "old" {
+		t.Errorf("existing file now holds %q", data)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("source is gone: %v", err)
+	}
+}
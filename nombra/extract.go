@@ -0,0 +1,355 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// validateContentLength checks if the content meets the minimum length requirement
+func (n *Namer) validateContentLength(content string) error {
+	trimmedLength := len(strings.TrimSpace(content))
+	if trimmedLength < n.opts.MinContentLength {
+		return fmt.Errorf("extracted content length (%d) is below minimum required length (%d)", trimmedLength, n.opts.MinContentLength)
+	}
+	return nil
+}
+
+// extractPDFContent extracts text from the specified PDF file.
+// It first attempts to extract text using a standard method.
+// If that fails or produces empty content, it falls back to OCR-based extraction,
+// then to image analysis via the configured provider as a last resort.
+func (n *Namer) extractPDFContent(ctx context.Context, path string) (Content, error) {
+	// Define extraction methods
+	extractors := []struct {
+		name   string
+		method string
+		fn     func(context.Context, string) (string, float64, error)
+	}{
+		{"standard", MethodStandard, func(_ context.Context, path string) (string, float64, error) {
+			text, err := extractTextFromPDF(path)
+			return text, 0, err
+		}},
+		{"OCR", MethodOCR, extractTextViaOCR},
+	}
+
+	// If OCR is forced, only use OCR
+	if n.opts.ForceOCR {
+		text, confidence, err := extractTextViaOCR(ctx, path)
+		if err != nil {
+			return n.extractContentViaVisionFallback(ctx, path, err)
+		}
+		if err := n.validateContentLength(text); err != nil {
+			return n.extractContentViaVisionFallback(ctx, path, err)
+		}
+		return Content{Text: text, Method: MethodOCR, OCRConfidence: confidence}, nil
+	}
+
+	// Try each extraction method
+	var lastErr error
+	for _, extractor := range extractors {
+		n.debugf("Attempting %s text extraction...", extractor.name)
+
+		text, confidence, err := extractor.fn(ctx, path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if text != "" {
+			if err := n.validateContentLength(text); err != nil {
+				lastErr = err
+				continue
+			}
+			content := Content{Text: text, Method: extractor.method, OCRConfidence: confidence}
+			if n.opts.Offline && extractor.method == MethodStandard {
+				content.Headings = pdfHeadings(path)
+			}
+			return content, nil
+		}
+	}
+
+	// If we get here, all extraction methods failed
+	return n.extractContentViaVisionFallback(ctx, path, lastErr)
+}
+
+func (n *Namer) extractContentViaVisionFallback(ctx context.Context, path string, textExtractionErr error) (Content, error) {
+	n.debugf("Text extraction failed; attempting image analysis fallback (model: %s)...", n.visionModel())
+
+	// Only PDFs and images fall back to vision.
+	render := (*Namer).imageFileImages
+	if IsPDF(path) {
+		render = (*Namer).pdfPageImages
+	}
+	content := Content{Method: MethodVision}
+	images, prompt, err := render(n, ctx, path)
+	if err == nil {
+		content, err = n.visionMetadata(ctx, images, prompt)
+	}
+	if err == nil {
+		n.debugf("Vision fallback succeeded (%d images)", len(images))
+		return content, nil
+	}
+
+	failed := Content{Method: MethodVision, Usage: content.Usage}
+	if textExtractionErr != nil {
+		return failed, fmt.Errorf("all text extraction methods failed: %v; vision fallback failed: %w", textExtractionErr, err)
+	}
+	return failed, fmt.Errorf("no text could be extracted from the document and vision fallback failed: %w", err)
+}
+
+// extractTextFromPDF extracts plain text from the PDF using the pdf library.
+// It iterates through all pages, concatenates the extracted text, and performs basic validations.
+// If the combined text becomes very long, consider trimming to include mostly
+// the beginning and end of the document where titles, parties, and dates are
+// usually located. This could yield better context for title generation when
+// approaching Options.MaxContentLength.
+func extractTextFromPDF(path string) (string, error) {
+	pages, err := PDFPageTexts(path)
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	for _, text := range pages {
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" {
+			continue
+		}
+		if content.Len() > 0 {
+			content.WriteString("\n\n")
+		}
+		content.WriteString(trimmed)
+	}
+
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no extractable text found in PDF")
+	}
+
+	// If the extraction provides a long string of text with no spaces in it, throw an error
+	if len(content.String()) > 500 && !strings.Contains(content.String(), " ") {
+		return "", fmt.Errorf("text extraction failed: no spaces found in extracted text")
+	}
+
+	return content.String(), nil
+}
+
+// PDFPageTexts returns the text layer of every page, with an empty string for
+// pages without text.
+func PDFPageTexts(path string) ([]string, error) {
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	totalPages := reader.NumPage()
+	if totalPages == 0 {
+		return nil, fmt.Errorf("PDF appears to be empty")
+	}
+
+	pages := make([]string, totalPages)
+	for i := 1; i <= totalPages; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("page %d text extraction failed: %w", i, err)
+		}
+		pages[i-1] = text
+	}
+	return pages, nil
+}
+
+// extractTextViaOCR extracts text from a PDF by converting each page to an image and running OCR on them.
+// It uses external tools: 'pdftoppm' to convert the PDF to PNG images and 'tesseract' to perform OCR.
+// It also returns the mean confidence of the recognized words.
+func extractTextViaOCR(ctx context.Context, pdfPath string) (string, float64, error) {
+	pages, confidence, err := ocrPDF(ctx, pdfPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var content strings.Builder
+	for _, text := range pages {
+		content.WriteString(text)
+		content.WriteString("\n")
+	}
+
+	if strings.TrimSpace(content.String()) == "" {
+		return "", 0, fmt.Errorf("OCR extracted no text")
+	}
+
+	return content.String(), confidence.value(), nil
+}
+
+// OCRPageTexts runs OCR on every page of a PDF. It needs pdftoppm and
+// tesseract.
+func OCRPageTexts(ctx context.Context, pdfPath string) ([]string, error) {
+	pages, _, err := ocrPDF(ctx, pdfPath)
+	return pages, err
+}
+
+func ocrPDF(ctx context.Context, pdfPath string) ([]string, ocrConfidence, error) {
+	var confidence ocrConfidence
+	tempDir, err := os.MkdirTemp("", "nombra-ocr")
+	if err != nil {
+		return nil, confidence, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	images, err := RenderPDFPages(ctx, pdfPath, tempDir)
+	if err != nil {
+		return nil, confidence, err
+	}
+
+	pages := make([]string, len(images))
+	for i, image := range images {
+		// Run OCR on each page
+		text, pageConfidence, err := runTesseract(ctx, image)
+		if err != nil {
+			return nil, confidence, err
+		}
+		pages[i] = text
+		confidence.sum += pageConfidence.sum
+		confidence.weight += pageConfidence.weight
+	}
+	return pages, confidence, nil
+}
+
+// RenderPDFPages converts every page to a PNG in dir with pdftoppm and
+// returns the images in page order.
+func RenderPDFPages(ctx context.Context, pdfPath, dir string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "pdftoppm", "-png", pdfPath, filepath.Join(dir, "page"))
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %w", err)
+	}
+
+	pages, _ := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages converted from PDF")
+	}
+
+	// Ensure pages are returned in numeric order (page-2 before page-10).
+	sort.Slice(pages, func(i, j int) bool {
+		pi := pageNumberFromPath(pages[i])
+		pj := pageNumberFromPath(pages[j])
+		if pi == pj {
+			return pages[i] < pages[j]
+		}
+		return pi < pj
+	})
+	return pages, nil
+}
+
+// runTesseract returns the text tesseract recognizes in an image file and
+// the confidence of its words.
+func runTesseract(ctx context.Context, imagePath string) (string, ocrConfidence, error) {
+	cmd := exec.CommandContext(ctx, "tesseract", imagePath, "stdout", "tsv")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", ocrConfidence{}, fmt.Errorf("tesseract failed: %w", err)
+	}
+	text, confidence := parseTesseractTSV(out.String())
+	return text, confidence, nil
+}
+
+// ocrConfidence sums tesseract's word confidences (0-100) weighted by word
+// length.
+type ocrConfidence struct {
+	sum, weight float64
+}
+
+// value is the mean confidence from 0 to 1, or 0 when no word was read.
+func (c ocrConfidence) value() float64 {
+	if c.weight == 0 {
+		return 0
+	}
+	return c.sum / c.weight / 100
+}
+
+// parseTesseractTSV rebuilds the text from tesseract's TSV output, with
+// lines and paragraphs, and sums the confidence of its words.
+func parseTesseractTSV(tsv string) (string, ocrConfidence) {
+	var text strings.Builder
+	var confidence ocrConfidence
+	lastParagraph, lastLine := "", ""
+	for i, row := range strings.Split(tsv, "\n") {
+		// level page block paragraph line word left top width height conf text
+		cols := strings.SplitN(row, "\t", 12)
+		if i == 0 || len(cols) < 12 || cols[0] != "5" {
+			continue
+		}
+		word := strings.TrimSpace(cols[11])
+		if word == "" {
+			continue
+		}
+		paragraph := strings.Join(cols[1:4], ".")
+		line := paragraph + "." + cols[4]
+		switch {
+		case text.Len() == 0:
+		case paragraph != lastParagraph:
+			text.WriteString("\n\n")
+		case line != lastLine:
+			text.WriteString("\n")
+		default:
+			text.WriteString(" ")
+		}
+		text.WriteString(word)
+		lastParagraph, lastLine = paragraph, line
+
+		if conf, err := strconv.ParseFloat(cols[10], 64); err == nil && conf >= 0 {
+			weight := float64(len([]rune(word)))
+			confidence.sum += conf * weight
+			confidence.weight += weight
+		}
+	}
+	if text.Len() > 0 {
+		text.WriteString("\n")
+	}
+	return text.String(), confidence
+}
+
+func pageNumberFromPath(path string) int {
+	matches := regexp.MustCompile(`page-(\d+)\.png$`).FindStringSubmatch(filepath.Base(path))
+	if len(matches) != 2 {
+		return 0
+	}
+
+	n, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
@@ -0,0 +1,164 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Field is a custom metadata field the model extracts in addition to the
+// built-in ones, such as an invoice or policy number. Values are stored in
+// Metadata.Extra and can be used in templates like any other field.
+type Field struct {
+	// Name is the JSON key and template placeholder, e.g. invoice_number.
+	Name string `json:"name"`
+	// Description tells the model what the field holds.
+	Description string `json:"description"`
+	// Required fields must be returned; naming fails when the model cannot
+	// find them, even after a retry.
+	Required bool `json:"required,omitempty"`
+	// Pattern is a regular expression values must match. Values that do not
+	// match are dropped.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+var fieldNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// builtinFieldNames are the JSON keys of Metadata.
+var builtinFieldNames = []string{"date", "language", "title", "document_type", "organization", "author", "recipient", "topic"}
+
+// customFieldsPrompt is appended to the system prompt when custom fields are
+// configured.
+const customFieldsPrompt = "Also return these additional keys. Use an empty string when the document does not contain the value, and copy identifiers exactly as printed:"
+
+// customPromptFormat is appended to a custom prompt so that answers can still
+// be parsed.
+const customPromptFormat = "Return exactly one JSON object with the keys %s. Use an empty string for values the document does not contain. Return JSON only, with no markdown and no explanation."
+
+// compileFields validates custom fields and compiles their patterns.
+func compileFields(fields []Field) (map[string]*regexp.Regexp, error) {
+	patterns := map[string]*regexp.Regexp{}
+	seen := map[string]bool{}
+	for _, field := range fields {
+		switch {
+		case !fieldNameRegex.MatchString(field.Name):
+			return nil, fmt.Errorf("invalid field name %q: use lowercase letters, digits and underscores", field.Name)
+		case slices.Contains(builtinFieldNames, field.Name) || field.Name == "primary" || field.Name == selfRatingKey:
+			return nil, fmt.Errorf("field %q is built in", field.Name)
+		case seen[field.Name]:
+			return nil, fmt.Errorf("field %q defined twice", field.Name)
+		case strings.TrimSpace(field.Description) == "":
+			return nil, fmt.Errorf("field %q needs a description", field.Name)
+		}
+		seen[field.Name] = true
+		if field.Pattern != "" {
+			re, err := regexp.Compile(field.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern for field %q: %w", field.Name, err)
+			}
+			patterns[field.Name] = re
+		}
+	}
+	return patterns, nil
+}
+
+func fieldNames(fields []Field) []string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name
+	}
+	return names
+}
+
+// systemPrompt returns the prompt for the first attempt or the retry, with
+// the custom fields appended. A custom prompt is used for both attempts; the
+// retry still tells the model what was missing.
+func (n *Namer) systemPrompt(retry bool) string {
+	var b strings.Builder
+	switch {
+	case n.opts.Prompt != "":
+		b.WriteString(strings.TrimSpace(n.opts.Prompt))
+		b.WriteString("\n\n")
+		fmt.Fprintf(&b, customPromptFormat, strings.Join(append(slices.Clone(builtinFieldNames), fieldNames(n.opts.Fields)...), ", "))
+	case retry:
+		b.WriteString(retryExtractionPrompt)
+	default:
+		b.WriteString(extractionPrompt)
+	}
+
+	if len(n.opts.Fields) > 0 {
+		b.WriteString("\n\n")
+		b.WriteString(customFieldsPrompt)
+		for _, field := range n.opts.Fields {
+			fmt.Fprintf(&b, "\n- %s: %s", field.Name, strings.TrimSpace(field.Description))
+			if field.Required {
+				b.WriteString(" (required)")
+			}
+		}
+	}
+	if n.opts.SelfRating {
+		b.WriteString("\n\n")
+		b.WriteString(selfRatingPrompt)
+	}
+	return b.String()
+}
+
+// parseExtraFields picks the custom fields out of a metadata answer. Numbers
+// and booleans are kept in their JSON spelling.
+func parseExtraFields(object []byte, fields []Field) (map[string]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal(object, &values); err != nil {
+		return nil, fmt.Errorf("invalid metadata JSON: %w", err)
+	}
+
+	extra := map[string]string{}
+	for _, field := range fields {
+		switch v := values[field.Name].(type) {
+		case string:
+			extra[field.Name] = v
+		case float64:
+			extra[field.Name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			extra[field.Name] = strconv.FormatBool(v)
+		}
+	}
+	return extra, nil
+}
+
+// checkFields drops custom values that do not match their pattern and returns
+// the required fields that are still missing.
+func (n *Namer) checkFields(metadata Metadata) (Metadata, []string) {
+	var missing []string
+	for _, field := range n.opts.Fields {
+		value := metadata.Extra[field.Name]
+		if re := n.patterns[field.Name]; value != "" && re != nil && !re.MatchString(value) {
+			n.debugf("Dropping %s %q: does not match %s", field.Name, value, field.Pattern)
+			delete(metadata.Extra, field.Name)
+			value = ""
+		}
+		if value == "" && field.Required {
+			missing = append(missing, field.Name)
+		}
+	}
+	return metadata, missing
+}
@@ -0,0 +1,96 @@
+package nombra
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// scriptedProvider answers with the queued replies and records the requests.
+type scriptedProvider struct {
+	replies  []string
+	requests []CompletionRequest
+}
+
+func (s *scriptedProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	s.requests = append(s.requests, req)
+	reply := s.replies[0]
+	if len(s.replies) > 1 {
+		s.replies = s.replies[1:]
+	}
+	return Completion{Content: reply, Usage: Usage{TotalTokens: 10}}, nil
+}
+
+func (s *scriptedProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	return s.Complete(ctx, CompletionRequest{})
+}
+
+var invoiceFields = []Field{
+	{Name: "invoice_number", Description: "The invoice number", Required: true, Pattern: `^[A-Z]{2}-\d+$`},
+	{Name: "amount", Description: "The total amount"},
+}
+
+func TestNewRejectsInvalidFields(t *testing.T) {
+	for _, fields := range [][]Field{
+		{{Name: "Invoice", Description: "x"}},
+		{{Name: "title", Description: "x"}},
+		{{Name: "amount", Description: "x"}, {Name: "amount", Description: "y"}},
+		{{Name: "amount"}},
+		{{Name: "amount", Description: "x", Pattern: "("}},
+	} {
+		if _, err := New(Options{Client: &flakyProvider{}, Fields: fields}); err == nil {
+			t.Errorf("New() with fields %+v succeeded; want error", fields)
+		}
+	}
+	if _, err := New(Options{Client: &flakyProvider{}, Template: "{date}_{case_number}"}); err == nil {
+		t.Error("template with an undeclared field succeeded; want error")
+	}
+}
+
+func TestExtractMetadataCustomFields(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{
+		`{"date":"2024-03-01","title":"Invoice","organization":"ACME","invoice_number":"no number","amount":120.5}`,
+		`{"date":"2024-03-01","title":"Invoice","organization":"ACME","invoice_number":" AB-1234 ","amount":120.5}`,
+	}}
+	n := newTestNamer(t, Options{
+		Client:   provider,
+		Prompt:   "You read invoices of a small business.",
+		Fields:   invoiceFields,
+		Template: "{date:2006-01-02}_{organization}_{invoice_number}",
+	})
+
+	metadata, usage, err := n.ExtractMetadata(context.Background(), "Invoice AB-1234 from ACME")
+	if err != nil {
+		t.Fatalf("ExtractMetadata returned error: %v", err)
+	}
+	if metadata.Extra["invoice_number"] != "AB-1234" || metadata.Extra["amount"] != "120.5" || usage.TotalTokens != 20 {
+		t.Errorf("metadata = %+v, usage %+v", metadata, usage)
+	}
+	if title, _ := n.BuildTitle(metadata); title != "2024-03-01_ACME_AB-1234" {
+		t.Errorf("BuildTitle() = %q", title)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("got %d requests; want 2", len(provider.requests))
+	}
+	system := provider.requests[0].System
+	for _, want := range []string{"You read invoices", "invoice_number: The invoice number (required)", "amount: The total amount"} {
+		if !strings.Contains(system, want) {
+			t.Errorf("system prompt lacks %q:\n%s", want, system)
+		}
+	}
+	if !strings.Contains(provider.requests[1].User, "invoice_number") {
+		t.Errorf("retry does not name the missing field: %q", provider.requests[1].User)
+	}
+}
+
+func TestExtractMetadataFailsWithoutRequiredField(t *testing.T) {
+	n := newTestNamer(t, Options{
+		Client: &scriptedProvider{replies: []string{`{"date":"2024-03-01","title":"Invoice","organization":"ACME"}`}},
+		Fields: invoiceFields,
+	})
+	_, _, err := n.ExtractMetadata(context.Background(), "Invoice from ACME")
+	if err == nil || !strings.Contains(err.Error(), "invoice_number") {
+		t.Errorf("ExtractMetadata error = %v; want missing invoice_number", err)
+	}
+}
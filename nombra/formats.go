@@ -0,0 +1,476 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	formatPDF   = "PDF"
+	formatImage = "image"
+	formatDOCX  = "DOCX"
+	formatODT   = "ODT"
+	formatEmail = "email"
+	formatMSG   = "Outlook message"
+	formatText  = "text"
+)
+
+// Content is the text obtained from a file and how it was obtained.
+type Content struct {
+	Text string
+	// Method is one of the Method constants.
+	Method string
+	// Usage counts the tokens of vision requests.
+	Usage Usage
+	// OCRConfidence is tesseract's mean word confidence from 0 to 1 for
+	// MethodOCR, 0 otherwise.
+	OCRConfidence float64
+	// Headings are the lines of a PDF's first page set in its largest font.
+	// They are only read in offline mode, where they hint at the title.
+	Headings []string
+	// Metadata is what the vision model read off the page images for
+	// MethodVision, nil otherwise. Text then renders it.
+	Metadata *Metadata
+}
+
+// documentFormat ties file extensions to the extractor that turns such files
+// into text for ExtractMetadata.
+type documentFormat struct {
+	name       string
+	extensions []string
+	extract    func(n *Namer, ctx context.Context, path string) (Content, error)
+}
+
+var documentFormats = []documentFormat{
+	{formatPDF, []string{".pdf"}, (*Namer).extractPDFContent},
+	{formatImage, []string{".jpg", ".jpeg", ".png", ".tif", ".tiff", ".heic", ".heif"}, (*Namer).extractImageContent},
+	{formatDOCX, []string{".docx"}, (*Namer).extractDOCXContent},
+	{formatODT, []string{".odt"}, (*Namer).extractODTContent},
+	{formatEmail, []string{".eml"}, (*Namer).extractEMLContent},
+	{formatMSG, []string{".msg"}, (*Namer).extractMSGContent},
+	{formatText, []string{".txt", ".text", ".md"}, (*Namer).extractPlainTextContent},
+}
+
+func formatForPath(path string) (documentFormat, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, format := range documentFormats {
+		for _, e := range format.extensions {
+			if ext == e {
+				return format, true
+			}
+		}
+	}
+	return documentFormat{}, false
+}
+
+// IsSupported reports whether path has the extension of a supported format.
+func IsSupported(path string) bool {
+	_, ok := formatForPath(path)
+	return ok
+}
+
+// IsPDF reports whether path has a .pdf extension.
+func IsPDF(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".pdf")
+}
+
+// SupportedExtensions lists the extensions of all supported formats.
+func SupportedExtensions() []string {
+	var exts []string
+	for _, format := range documentFormats {
+		exts = append(exts, format.extensions...)
+	}
+	return exts
+}
+
+// ExtractContent extracts the text of any supported file, running OCR or the
+// vision model when a document has no usable text layer.
+func (n *Namer) ExtractContent(ctx context.Context, path string) (Content, error) {
+	format, ok := formatForPath(path)
+	if !ok {
+		return Content{}, fmt.Errorf("unsupported file type %q", filepath.Ext(path))
+	}
+	content, err := format.extract(n, ctx, path)
+	if err != nil {
+		return content, fmt.Errorf("%s processing error: %w", format.name, err)
+	}
+	return content, nil
+}
+
+// textContent validates text produced by a native extractor.
+func (n *Namer) textContent(text string) (Content, error) {
+	if err := n.validateContentLength(text); err != nil {
+		return Content{}, err
+	}
+	return Content{Text: text, Method: MethodStandard}, nil
+}
+
+// extractImageContent runs OCR on a scanned image and falls back to the
+// vision model when OCR finds too little text.
+func (n *Namer) extractImageContent(ctx context.Context, path string) (Content, error) {
+	tempDir, err := os.MkdirTemp("", "nombra-image")
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	source := path
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".heic" || ext == ".heif" {
+		// tesseract cannot read HEIC.
+		source, err = n.convertImageToPNG(ctx, path, tempDir)
+		if err != nil {
+			return n.extractContentViaVisionFallback(ctx, path, err)
+		}
+	}
+
+	n.debugf("Attempting OCR text extraction...")
+	text, confidence, err := runTesseract(ctx, source)
+	if err == nil {
+		err = n.validateContentLength(text)
+	}
+	if err != nil {
+		return n.extractContentViaVisionFallback(ctx, path, err)
+	}
+	return Content{Text: text, Method: MethodOCR, OCRConfidence: confidence.value()}, nil
+}
+
+// imageFileImages reads an image file for the vision model. Formats vision
+// APIs do not accept are converted to PNG first.
+func (n *Namer) imageFileImages(ctx context.Context, path string) ([]Image, string, error) {
+	var mimeType string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		mimeType = "image/jpeg"
+	case ".png":
+		mimeType = "image/png"
+	}
+
+	imagePath := path
+	if mimeType == "" {
+		tempDir, err := os.MkdirTemp("", "nombra-vision")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create temp directory for vision fallback: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		imagePath, err = n.convertImageToPNG(ctx, path, tempDir)
+		if err != nil {
+			return nil, "", err
+		}
+		mimeType = "image/png"
+	}
+
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read image: %w", err)
+	}
+	return []Image{{Data: data, MimeType: mimeType}}, "A scanned document image.", nil
+}
+
+// convertImageToPNG converts TIFF and HEIC images with the first available
+// converter: ImageMagick, libheif's heif-convert or macOS sips.
+func (n *Namer) convertImageToPNG(ctx context.Context, path, dir string) (string, error) {
+	out := filepath.Join(dir, "converted.png")
+	converters := [][]string{
+		{"magick", path, out},
+		{"convert", path, out},
+		{"heif-convert", path, out},
+		{"sips", "-s", "format", "png", path, "--out", out},
+	}
+	for _, args := range converters {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		if n.opts.Verbose {
+			cmd.Stderr = os.Stderr
+		}
+		if err := cmd.Run(); err == nil {
+			return out, nil
+		}
+	}
+	return "", fmt.Errorf("cannot convert %s to PNG: install ImageMagick or libheif", filepath.Ext(path))
+}
+
+func (n *Namer) extractDOCXContent(ctx context.Context, path string) (Content, error) {
+	text, err := zippedXMLText(path, "word/document.xml")
+	if err != nil {
+		return Content{}, err
+	}
+	return n.textContent(text)
+}
+
+func (n *Namer) extractODTContent(ctx context.Context, path string) (Content, error) {
+	text, err := zippedXMLText(path, "content.xml")
+	if err != nil {
+		return Content{}, err
+	}
+	return n.textContent(text)
+}
+
+// zippedXMLText returns the text of one XML member of a zip based office document.
+func zippedXMLText(path, member string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open document: %w", err)
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != member {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", member, err)
+		}
+		defer rc.Close()
+		return xmlDocumentText(rc)
+	}
+	return "", fmt.Errorf("%s not found in document", member)
+}
+
+// xmlDocumentText collects the character data of WordprocessingML and
+// OpenDocument markup, breaking lines at paragraphs and headings.
+func xmlDocumentText(r io.Reader) (string, error) {
+	decoder := xml.NewDecoder(r)
+	var text strings.Builder
+	skip := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid document XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "instrText", "delText":
+				skip++
+			case "tab", "s":
+				text.WriteString(" ")
+			case "br", "line-break":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "instrText", "delText":
+				skip--
+			case "p", "h":
+				text.WriteString("\n")
+			}
+		case xml.CharData:
+			if skip == 0 {
+				text.Write(t)
+			}
+		}
+	}
+	return text.String(), nil
+}
+
+func (n *Namer) extractPlainTextContent(ctx context.Context, path string) (Content, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Content{}, err
+	}
+	return n.textContent(decodeText(raw, ""))
+}
+
+// decodeText converts raw text to UTF-8. Latin-1 is assumed for anything
+// that is neither declared nor valid UTF-8.
+func decodeText(raw []byte, charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	if (charset == "" || charset == "utf-8" || charset == "us-ascii") && utf8.Valid(raw) {
+		return string(raw)
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+var headerDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		raw, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(decodeText(raw, charset)), nil
+	},
+}
+
+// extractEMLContent turns the headers and the text body of an RFC 822 message
+// into a plain text document.
+func (n *Namer) extractEMLContent(ctx context.Context, path string) (Content, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Content{}, err
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		return Content{}, fmt.Errorf("invalid email: %w", err)
+	}
+
+	var text strings.Builder
+	for _, key := range []string{"Subject", "From", "To", "Cc", "Date"} {
+		if value := msg.Header.Get(key); value != "" {
+			if decoded, err := headerDecoder.DecodeHeader(value); err == nil {
+				value = decoded
+			}
+			fmt.Fprintf(&text, "%s: %s\n", key, value)
+		}
+	}
+
+	body, attachments, err := emailBody(msg.Header, msg.Body)
+	if err != nil {
+		return Content{}, err
+	}
+	if len(attachments) > 0 {
+		fmt.Fprintf(&text, "Attachments: %s\n", strings.Join(attachments, ", "))
+	}
+	text.WriteString("\n")
+	text.WriteString(body)
+	return n.textContent(text.String())
+}
+
+// partHeader is the subset of MIME headers emailBody needs.
+type partHeader interface {
+	Get(key string) string
+}
+
+// emailBody returns the preferred text of a message part, preferring
+// text/plain over HTML, and the names of attached files.
+func emailBody(header partHeader, body io.Reader) (string, []string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		var plain, html string
+		var attachments []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid multipart email: %w", err)
+			}
+			if name := part.FileName(); name != "" {
+				if decoded, err := headerDecoder.DecodeHeader(name); err == nil {
+					name = decoded
+				}
+				attachments = append(attachments, name)
+				continue
+			}
+
+			text, nested, err := emailBody(part.Header, part)
+			if err != nil {
+				return "", nil, err
+			}
+			attachments = append(attachments, nested...)
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			switch {
+			case partType == "text/html" && html == "":
+				html = text
+			case plain == "" && strings.TrimSpace(text) != "":
+				plain = text
+			}
+		}
+		if plain != "" {
+			return plain, attachments, nil
+		}
+		return html, attachments, nil
+	}
+
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", nil, nil
+	}
+
+	var decoded io.Reader = body
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		decoded = quotedprintable.NewReader(body)
+	case "base64":
+		decoded = base64.NewDecoder(base64.StdEncoding, newlineStripper{body})
+	}
+	raw, err := io.ReadAll(decoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode email body: %w", err)
+	}
+
+	text := decodeText(raw, params["charset"])
+	if mediaType == "text/html" {
+		text = htmlToText(text)
+	}
+	return text, nil, nil
+}
+
+// newlineStripper drops line breaks so base64 bodies can be decoded.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	kept := 0
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+var (
+	htmlDropRegex  = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlBreakRegex = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/h[1-6]|/li)[^>]*>`)
+	htmlTagRegex   = regexp.MustCompile(`<[^>]*>`)
+	htmlEntities   = strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'")
+)
+
+func htmlToText(html string) string {
+	text := htmlDropRegex.ReplaceAllString(html, "")
+	text = htmlBreakRegex.ReplaceAllString(text, "\n")
+	text = htmlTagRegex.ReplaceAllString(text, "")
+	return htmlEntities.Replace(text)
+}
@@ -0,0 +1,380 @@
+package nombra
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsSupported(t *testing.T) {
+	for name, want := range map[string]bool{
+		"scan.PDF":    true,
+		"photo.jpeg":  true,
+		"photo.HEIC":  true,
+		"letter.docx": true,
+		"letter.odt":  true,
+		"mail.eml":    true,
+		"mail.msg":    true,
+		"notes.md":    true,
+		"budget.xlsx": false,
+		"archive.zip": false,
+		"README":      false,
+	} {
+		if got := IsSupported(name); got != want {
+			t.Errorf("IsSupported(%q) = %v; want %v", name, got, want)
+		}
+	}
+}
+
+func TestExtractDOCXAndODTContent(t *testing.T) {
+	dir := t.TempDir()
+	docx := filepath.Join(dir, "letter.docx")
+	writeZip(t, docx, map[string]string{
+		"[Content_Types].xml": `<Types/>`,
+		"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			`<w:p><w:r><w:t>Acme Corp</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:instrText>PAGE</w:instrText></w:r><w:r><w:t>Invoice</w:t><w:tab/><w:t>2025-03</w:t></w:r></w:p>` +
+			`</w:body></w:document>`,
+	})
+	odt := filepath.Join(dir, "letter.odt")
+	writeZip(t, odt, map[string]string{
+		"mimetype": "application/vnd.oasis.opendocument.text",
+		"content.xml": `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:text>` +
+			`<text:h>Acme Corp</text:h><text:p>Invoice<text:s/>2025-03</text:p>` +
+			`</office:text></office:body></office:document-content>`,
+	})
+
+	for _, path := range []string{docx, odt} {
+		content, err := newTestNamer(t, Options{}).ExtractContent(context.Background(), path)
+		if err != nil {
+			t.Fatalf("ExtractContent(%s) returned error: %v", filepath.Base(path), err)
+		}
+		if content.Text != "Acme Corp\nInvoice 2025-03\n" || content.Method != MethodStandard {
+			t.Errorf("ExtractContent(%s) = %q (%s)", filepath.Base(path), content.Text, content.Method)
+		}
+	}
+}
+
+func TestExtractEMLContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.eml")
+	message := strings.Join([]string{
+		"From: Billing <billing@acme.example>",
+		"To: rafa@example.com",
+		"Subject: =?UTF-8?B?RmFjdHVyYSBkZSBtYXJ6bw==?=",
+		"Date: Mon, 3 Mar 2025 10:00:00 +0100",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"--outer",
+		`Content-Type: multipart/alternative; boundary="inner"`,
+		"",
+		"--inner",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"Adjuntamos la factura n=C2=BA 42.",
+		"--inner",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<p>Adjuntamos la factura</p>",
+		"--inner--",
+		"--outer",
+		"Content-Type: application/pdf",
+		`Content-Disposition: attachment; filename="factura-42.pdf"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"JVBERi0xLjQK",
+		"--outer--",
+		"",
+	}, "\r\n")
+	if err := os.WriteFile(path, []byte(message), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := newTestNamer(t, Options{}).ExtractContent(context.Background(), path)
+	if err != nil {
+		t.Fatalf("extractContent returned error: %v", err)
+	}
+	for _, want := range []string{
+		"Subject: Factura de marzo\n",
+		"From: Billing <billing@acme.example>\n",
+		"Attachments: factura-42.pdf\n",
+		"Adjuntamos la factura nº 42.",
+	} {
+		if !strings.Contains(content.Text, want) {
+			t.Errorf("content missing %q:\n%s", want, content.Text)
+		}
+	}
+	if strings.Contains(content.Text, "<p>") {
+		t.Errorf("HTML alternative used instead of text/plain:\n%s", content.Text)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	got := htmlToText("<html><head><title>x</title></head><body><p>Hello&nbsp;<b>world</b></p>Bye<br>now</body></html>")
+	if got != "Hello world\nBye\nnow" {
+		t.Errorf("htmlToText() = %q", got)
+	}
+}
+
+func TestExtractPlainTextContent(t *testing.T) {
+	dir := t.TempDir()
+	utf := filepath.Join(dir, "utf8.txt")
+	latin := filepath.Join(dir, "latin1.txt")
+	if err := os.WriteFile(utf, []byte("\xef\xbb\xbfRecibo de alquiler, año 2025"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(latin, []byte("Recibo de alquiler, a\xf1o 2025"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{utf, latin} {
+		content, err := newTestNamer(t, Options{}).ExtractContent(context.Background(), path)
+		if err != nil {
+			t.Fatalf("ExtractContent(%s) returned error: %v", filepath.Base(path), err)
+		}
+		if content.Text != "Recibo de alquiler, año 2025" {
+			t.Errorf("ExtractContent(%s) = %q", filepath.Base(path), content.Text)
+		}
+	}
+
+	short := filepath.Join(dir, "short.txt")
+	if err := os.WriteFile(short, []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestNamer(t, Options{}).ExtractContent(context.Background(), short); err == nil || !strings.Contains(err.Error(), "text processing error") {
+		t.Errorf("short text error = %v", err)
+	}
+}
+
+// cfbTestEntry is a directory entry for buildCompoundFile. Children are
+// chained through their right siblings.
+type cfbTestEntry struct {
+	name     string
+	kind     byte
+	data     []byte
+	children []int
+}
+
+func utf16LE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+// buildCompoundFile writes a version 3 compound file whose streams all live
+// in the mini stream.
+func buildCompoundFile(entries []cfbTestEntry) []byte {
+	le := binary.LittleEndian
+	const sectorSize = 512
+
+	var mini []byte
+	var miniFAT []uint32
+	starts := make([]uint32, len(entries))
+	for i, e := range entries {
+		starts[i] = cfbEndOfChain
+		if e.kind != cfbTypeStream || len(e.data) == 0 {
+			continue
+		}
+		starts[i] = uint32(len(mini) / 64)
+		sectors := (len(e.data) + 63) / 64
+		for k := 0; k < sectors; k++ {
+			miniFAT = append(miniFAT, starts[i]+uint32(k)+1)
+		}
+		miniFAT[len(miniFAT)-1] = cfbEndOfChain
+		mini = append(mini, e.data...)
+		mini = append(mini, make([]byte, sectors*64-len(e.data))...)
+	}
+
+	sectorsFor := func(n int) int { return (n + sectorSize - 1) / sectorSize }
+	dirSectors := sectorsFor(len(entries) * 128)
+	miniFATSectors := sectorsFor(len(miniFAT) * 4)
+	miniSectors := sectorsFor(len(mini))
+
+	fat := []uint32{0xFFFFFFFD}
+	chain := func(count int) uint32 {
+		if count == 0 {
+			return cfbEndOfChain
+		}
+		start := uint32(len(fat))
+		for k := 1; k < count; k++ {
+			fat = append(fat, start+uint32(k))
+		}
+		fat = append(fat, cfbEndOfChain)
+		return start
+	}
+	dirStart := chain(dirSectors)
+	miniFATStart := chain(miniFATSectors)
+	miniStart := chain(miniSectors)
+
+	header := make([]byte, sectorSize)
+	copy(header, cfbSignature)
+	le.PutUint16(header[0x18:], 0x3E)
+	le.PutUint16(header[0x1A:], 3)
+	le.PutUint16(header[0x1C:], 0xFFFE)
+	le.PutUint16(header[0x1E:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2C:], 1)
+	le.PutUint32(header[0x30:], dirStart)
+	le.PutUint32(header[0x38:], 4096)
+	le.PutUint32(header[0x3C:], miniFATStart)
+	le.PutUint32(header[0x40:], uint32(miniFATSectors))
+	le.PutUint32(header[0x44:], cfbEndOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(header[0x4C+4*i:], cfbNoStream)
+	}
+	le.PutUint32(header[0x4C:], 0)
+
+	fatSector := make([]byte, sectorSize)
+	for i := 0; i < sectorSize/4; i++ {
+		value := uint32(cfbNoStream)
+		if i < len(fat) {
+			value = fat[i]
+		}
+		le.PutUint32(fatSector[4*i:], value)
+	}
+
+	dir := make([]byte, dirSectors*sectorSize)
+	right := make([]uint32, len(entries))
+	child := make([]uint32, len(entries))
+	for i := range entries {
+		right[i], child[i] = cfbNoStream, cfbNoStream
+	}
+	for i, e := range entries {
+		for k, c := range e.children {
+			if k == 0 {
+				child[i] = uint32(c)
+			} else {
+				right[e.children[k-1]] = uint32(c)
+			}
+		}
+	}
+	for i, e := range entries {
+		raw := dir[i*128 : (i+1)*128]
+		name := utf16LE(e.name)
+		copy(raw, name)
+		le.PutUint16(raw[0x40:], uint16(len(name)+2))
+		raw[0x42] = e.kind
+		le.PutUint32(raw[0x44:], cfbNoStream)
+		le.PutUint32(raw[0x48:], right[i])
+		le.PutUint32(raw[0x4C:], child[i])
+		start, size := starts[i], uint64(len(e.data))
+		if e.kind == cfbTypeRoot {
+			start, size = miniStart, uint64(len(mini))
+		}
+		le.PutUint32(raw[0x74:], start)
+		le.PutUint64(raw[0x78:], size)
+	}
+	for i := len(entries); i < dirSectors*4; i++ {
+		le.PutUint32(dir[i*128+0x44:], cfbNoStream)
+		le.PutUint32(dir[i*128+0x48:], cfbNoStream)
+		le.PutUint32(dir[i*128+0x4C:], cfbNoStream)
+	}
+
+	miniFATBytes := make([]byte, miniFATSectors*sectorSize)
+	for i := range miniFATBytes {
+		miniFATBytes[i] = 0xFF
+	}
+	for i, v := range miniFAT {
+		le.PutUint32(miniFATBytes[4*i:], v)
+	}
+	miniBytes := make([]byte, miniSectors*sectorSize)
+	copy(miniBytes, mini)
+
+	out := append(header, fatSector...)
+	out = append(out, dir...)
+	out = append(out, miniFATBytes...)
+	return append(out, miniBytes...)
+}
+
+func TestExtractMSGContent(t *testing.T) {
+	sent := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	props := make([]byte, 48)
+	binary.LittleEndian.PutUint32(props[32:], 0x00390040)
+	binary.LittleEndian.PutUint64(props[40:], uint64(sent.UnixNano()/100)+116444736000000000)
+
+	body := strings.Repeat("Adjuntamos la factura de marzo. ", 4)
+	data := buildCompoundFile([]cfbTestEntry{
+		{name: "Root Entry", kind: cfbTypeRoot, children: []int{1, 2, 3, 4, 5, 6}},
+		{name: "__substg1.0_0037001F", kind: cfbTypeStream, data: utf16LE("Factura de marzo")},
+		{name: "__substg1.0_0C1A001F", kind: cfbTypeStream, data: utf16LE("Acme Billing")},
+		{name: "__substg1.0_0E04001E", kind: cfbTypeStream, data: []byte("Rafa\x00")},
+		{name: "__substg1.0_1000001F", kind: cfbTypeStream, data: utf16LE(body)},
+		{name: "__properties_version1.0", kind: cfbTypeStream, data: props},
+		{name: "__attach_version1.0_#00000000", kind: cfbTypeStorage, children: []int{7}},
+		{name: "__substg1.0_3707001F", kind: cfbTypeStream, data: utf16LE("factura-03.pdf")},
+	})
+	path := filepath.Join(t.TempDir(), "mail.msg")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := newTestNamer(t, Options{}).ExtractContent(context.Background(), path)
+	if err != nil {
+		t.Fatalf("extractContent returned error: %v", err)
+	}
+	want := "Subject: Factura de marzo\nFrom: Acme Billing\nTo: Rafa\n" +
+		"Date: Mon, 03 Mar 2025 09:00:00 +0000\nAttachments: factura-03.pdf\n\n" + body
+	if content.Text != want {
+		t.Errorf("ExtractContent() = %q; want %q", content.Text, want)
+	}
+
+	if err := os.WriteFile(path, []byte("not an OLE file, just some text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestNamer(t, Options{}).ExtractContent(context.Background(), path); err == nil {
+		t.Error("expected error for invalid message")
+	}
+}
+
+func TestExtractImageContentOCR(t *testing.T) {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		t.Skip("tesseract not installed")
+	}
+	if _, err := exec.LookPath("convert"); err != nil {
+		t.Skip("ImageMagick not installed")
+	}
+	path := filepath.Join(t.TempDir(), "scan.png")
+	cmd := exec.Command("convert", "-size", "800x120", "xc:white", "-pointsize", "48", "-annotate", "+20+80", "INVOICE ACME 2025", path)
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot render test image: %v", err)
+	}
+	content, err := newTestNamer(t, Options{}).ExtractContent(context.Background(), path)
+	if err != nil {
+		t.Fatalf("extractContent returned error: %v", err)
+	}
+	if content.Method != MethodOCR || !strings.Contains(strings.ToUpper(content.Text), "INVOICE") {
+		t.Errorf("ExtractContent() = %q (%s)", content.Text, content.Method)
+	}
+}
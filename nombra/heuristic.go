@@ -0,0 +1,623 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ErrOffline is returned for model requests of a Namer in offline mode.
+var ErrOffline = errors.New("no model available in offline mode")
+
+// offlineProvider stands in for the model in offline mode so that the vision
+// fallback and other model requests fail cleanly.
+type offlineProvider struct{}
+
+func (offlineProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	return Completion{}, ErrOffline
+}
+
+func (offlineProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	return Completion{}, ErrOffline
+}
+
+const (
+	// heuristicScanLength is how much text the heuristics look at.
+	heuristicScanLength = 6000
+	// letterheadLines is how many lines at the top are taken as letterhead.
+	letterheadLines = 8
+	// headingLines is how many lines at the top may hold the title.
+	headingLines = 15
+)
+
+// GuessMetadata builds metadata from content with local heuristics instead
+// of a model: the date from numeric and written-out dates in seven
+// languages, the title from the largest-font or first heading lines, the
+// organization from Options.KnownSenders and letterhead lines, and the
+// document type from keyword dictionaries. Custom fields with a pattern are
+// filled with the first matching word or line. In offline mode Suggest and
+// ExtractMetadata use it instead of the model.
+func (n *Namer) GuessMetadata(content Content) Metadata {
+	text := content.Text
+	if len(text) > heuristicScanLength {
+		text = text[:heuristicScanLength]
+	}
+	lines := documentLines(text)
+	header := emailHeader(lines)
+
+	metadata := Metadata{Language: detectLanguage(text)}
+	metadata.Date = findDocumentDate(text)
+	if metadata.Date == "" && header["date"] != "" {
+		if date, err := mail.ParseDate(header["date"]); err == nil {
+			metadata.Date = date.Format(DateLayout)
+		}
+	}
+	metadata.DocumentType = detectDocumentType(lines, metadata.Language)
+	metadata.Organization = n.findOrganization(text, lines, header["from"])
+	metadata.Topic = findSubject(lines, header["subject"])
+	metadata.Title = guessTitle(content.Headings, lines, metadata)
+	if header["to"] != "" {
+		metadata.Recipient = mailDisplayName(header["to"])
+	}
+	if header["from"] != "" && metadata.Organization == "" {
+		metadata.Author = mailDisplayName(header["from"])
+	}
+	metadata.Extra = n.guessFields(content.Text, lines)
+	return normalizeMetadata(metadata)
+}
+
+// documentLines returns the non-empty lines of text with collapsed spaces.
+func documentLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// emailHeader returns the headers the email extractor puts at the top of
+// the text, keyed in lowercase.
+func emailHeader(lines []string) map[string]string {
+	header := map[string]string{}
+	for _, line := range lines[:min(len(lines), 6)] {
+		key, value, ok := strings.Cut(line, ": ")
+		switch key = strings.ToLower(key); {
+		case !ok:
+			return header
+		case key == "subject" || key == "from" || key == "to" || key == "cc" || key == "date" || key == "attachments":
+			header[key] = strings.TrimSpace(value)
+		default:
+			return header
+		}
+	}
+	return header
+}
+
+func mailDisplayName(value string) string {
+	if addr, err := mail.ParseAddress(strings.Split(value, ",")[0]); err == nil {
+		if addr.Name != "" {
+			return addr.Name
+		}
+		return ""
+	}
+	return value
+}
+
+// words splits text into lowercase words of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// detectLanguage picks the language whose stopwords are most frequent.
+func detectLanguage(text string) string {
+	counts := map[string]int{}
+	for _, word := range words(text) {
+		counts[word]++
+	}
+	best, bestScore := "", 2
+	for _, lang := range languageStopwords {
+		score := 0
+		for _, word := range lang.words {
+			score += counts[word]
+		}
+		if score > bestScore {
+			best, bestScore = lang.language, score
+		}
+	}
+	return best
+}
+
+var (
+	dateRegexOnce sync.Once
+	isoDateRegex  = regexp.MustCompile(`\b(\d{4})([./-])(\d{1,2})([./-])(\d{1,2})\b`)
+	numDateRegex  = regexp.MustCompile(`\b(\d{1,2})([./-])(\d{1,2})([./-])(\d{4}|\d{2})\b`)
+	// Set by compileDateRegexes from monthNames.
+	dayMonthRegex *regexp.Regexp
+	monthDayRegex *regexp.Regexp
+)
+
+func compileDateRegexes() {
+	names := make([]string, 0, len(monthNames))
+	for name := range monthNames {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	// Longest first so that "september" wins over "sep".
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	months := strings.Join(names, "|")
+	dayMonthRegex = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th|er|º|\.)?\s+(?:de\s+)?(` + months + `)\.?,?\s+(?:de\s+|del\s+)?(\d{4})\b`)
+	monthDayRegex = regexp.MustCompile(`(?i)\b(` + months + `)\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+}
+
+// datedLine is a date found in the text and where.
+type datedLine struct {
+	date   string
+	offset int
+}
+
+// findDocumentDate returns the most relevant date of text in DateLayout: the
+// first one on a line that names a date, such as "Invoice date:", or else
+// the first one. Dates of birth are ignored. Numeric dates are read day
+// first unless that is impossible.
+func findDocumentDate(text string) string {
+	dateRegexOnce.Do(compileDateRegexes)
+
+	var found []datedLine
+	add := func(offset, year, month, day int) {
+		if year < 100 {
+			year += 2000
+			if year > time.Now().Year()+1 {
+				year -= 100
+			}
+		}
+		if year < 1950 || year > 2100 {
+			return
+		}
+		date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+			return
+		}
+		found = append(found, datedLine{date: date.Format(DateLayout), offset: offset})
+	}
+	atoi := func(s string) int {
+		v, _ := strconv.Atoi(s)
+		return v
+	}
+
+	for _, m := range isoDateRegex.FindAllStringSubmatchIndex(text, -1) {
+		g := submatches(text, m)
+		if g[2] == g[4] {
+			add(m[0], atoi(g[1]), atoi(g[3]), atoi(g[5]))
+		}
+	}
+	for _, m := range numDateRegex.FindAllStringSubmatchIndex(text, -1) {
+		g := submatches(text, m)
+		if g[2] != g[4] || (len(g[5]) == 2 && g[2] == "-") {
+			continue
+		}
+		day, month := atoi(g[1]), atoi(g[3])
+		if month > 12 && day <= 12 {
+			day, month = month, day
+		}
+		add(m[0], atoi(g[5]), month, day)
+	}
+	for _, m := range dayMonthRegex.FindAllStringSubmatchIndex(text, -1) {
+		g := submatches(text, m)
+		add(m[0], atoi(g[3]), monthNames[strings.ToLower(g[2])], atoi(g[1]))
+	}
+	for _, m := range monthDayRegex.FindAllStringSubmatchIndex(text, -1) {
+		g := submatches(text, m)
+		add(m[0], atoi(g[3]), monthNames[strings.ToLower(g[1])], atoi(g[2]))
+	}
+	if len(found) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].offset < found[j].offset })
+	first := ""
+	for _, d := range found {
+		line := strings.ToLower(lineAt(text, d.offset))
+		if containsAny(line, birthWords) {
+			continue
+		}
+		if first == "" {
+			first = d.date
+		}
+		if containsAny(line, dateWords) {
+			return d.date
+		}
+	}
+	return first
+}
+
+func submatches(text string, loc []int) []string {
+	groups := make([]string, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] >= 0 {
+			groups[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return groups
+}
+
+// lineAt returns the line of text containing offset.
+func lineAt(text string, offset int) string {
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	end := strings.IndexByte(text[offset:], '\n')
+	if end < 0 {
+		return text[start:]
+	}
+	return text[start : offset+end]
+}
+
+func containsAny(text string, needles []string) bool {
+	return slices.ContainsFunc(needles, func(needle string) bool { return strings.Contains(text, needle) })
+}
+
+// containsKeyword reports whether text contains keyword as a whole word, or
+// for German as the end of a compound word.
+func containsKeyword(text, keyword string, compound bool) bool {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], keyword)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(keyword)
+		before := start == 0 || !isWordRune(lastRune(text[:start]))
+		after := end == len(text) || !isWordRune(firstRune(text[end:]))
+		if after && (before || compound) {
+			return true
+		}
+		offset = end
+	}
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return 0
+}
+
+func lastRune(s string) rune {
+	r := []rune(s)
+	return r[len(r)-1]
+}
+
+// detectDocumentType scores every document kind by its keywords, counting
+// heading lines three times, and returns the label of the best one in the
+// document language.
+func detectDocumentType(lines []string, language string) string {
+	best, bestScore := -1, 0
+	for i, kind := range documentKinds {
+		score := 0
+		for lang, keywords := range kind.keywords {
+			if language != "" && lang != language {
+				continue
+			}
+			for j, line := range lines {
+				line = strings.ToLower(line)
+				for _, keyword := range keywords {
+					if containsKeyword(line, keyword, lang == "German") {
+						if j < headingLines {
+							score += 3
+						} else {
+							score++
+						}
+					}
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return cmp.Or(documentKinds[best].labels[language], documentKinds[best].labels["English"])
+}
+
+// findOrganization returns the known sender mentioned first, or else the
+// first letterhead line that names a company or institution.
+func (n *Namer) findOrganization(text string, lines []string, from string) string {
+	lower := strings.ToLower(text)
+	best, bestOffset := "", math.MaxInt
+	for _, sender := range n.opts.KnownSenders {
+		sender = strings.TrimSpace(sender)
+		if sender == "" {
+			continue
+		}
+		if i := strings.Index(lower, strings.ToLower(sender)); i >= 0 && i < bestOffset {
+			best, bestOffset = sender, i
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	candidates := lines[:min(len(lines), letterheadLines)]
+	if from != "" {
+		candidates = append([]string{mailDisplayName(from)}, candidates...)
+	}
+	for _, line := range candidates {
+		if name := organizationName(line); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// organizationName returns the company or institution a letterhead line
+// names, without the address that often follows it and without a trailing
+// legal form.
+func organizationName(line string) string {
+	for _, sep := range []string{" · ", " | ", " • ", ", ", " - "} {
+		line, _, _ = strings.Cut(line, sep)
+	}
+	line = strings.TrimSpace(line)
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(line) > 60 || !unicode.IsUpper(firstRune(line)) {
+		if !(len(fields) == 1 && containsAny(strings.ToLower(line), institutionWords)) {
+			return ""
+		}
+	}
+	last := strings.ToLower(fields[len(fields)-1])
+	if slices.Contains(legalForms, last) {
+		// The legal form is dropped, as in names given by the model.
+		return strings.Join(fields[:len(fields)-1], " ")
+	}
+	if _, form, ok := strings.Cut(last, "-"); ok && slices.Contains(legalForms, form) {
+		return line
+	}
+	lower := strings.ToLower(line)
+	for _, word := range institutionWords {
+		if containsKeyword(lower, word, true) {
+			return line
+		}
+	}
+	return ""
+}
+
+// findSubject returns the subject line of a letter or email.
+func findSubject(lines []string, subject string) string {
+	if subject != "" {
+		return stripReplyPrefix(subject)
+	}
+	for _, line := range lines[:min(len(lines), 40)] {
+		lower := strings.ToLower(line)
+		for _, prefix := range subjectPrefixes {
+			if strings.HasPrefix(lower, prefix) {
+				return strings.TrimSpace(line[len(prefix):])
+			}
+		}
+	}
+	return ""
+}
+
+func stripReplyPrefix(subject string) string {
+	for {
+		lower := strings.ToLower(subject)
+		trimmed := false
+		for _, prefix := range []string{"re:", "aw:", "fw:", "fwd:", "wg:", "tr:", "rv:"} {
+			if strings.HasPrefix(lower, prefix) {
+				subject, trimmed = strings.TrimSpace(subject[len(prefix):]), true
+				break
+			}
+		}
+		if !trimmed {
+			return subject
+		}
+	}
+}
+
+var (
+	addressLikeRegex = regexp.MustCompile(`(?i)(@|www\.|https?://|\btel\b|\bfax\b|\biban\b|\bbic\b|\+\d|\b\d{4,5}\s+\p{Lu}\p{L}+)`)
+	digitsRegex      = regexp.MustCompile(`\d`)
+)
+
+// guessTitle picks a heading: the lines set in the largest font when the
+// PDF tells, or else the first line near the top that looks like one.
+func guessTitle(headings, lines []string, metadata Metadata) string {
+	for _, heading := range headings {
+		if isHeadingLine(heading, metadata) {
+			return headingCase(heading)
+		}
+	}
+	for _, line := range lines[:min(len(lines), headingLines)] {
+		if !isHeadingLine(line, metadata) {
+			continue
+		}
+		// Only lines that stand out are taken as titles; ordinary first
+		// sentences are not.
+		if isUpperLine(line) || (metadata.DocumentType != "" && containsKeyword(strings.ToLower(line), strings.ToLower(metadata.DocumentType), true)) {
+			return headingCase(line)
+		}
+	}
+	return ""
+}
+
+func isHeadingLine(line string, metadata Metadata) bool {
+	letters := 0
+	for _, r := range line {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	switch {
+	case letters < 4, len(line) > 80, letters*2 < len([]rune(line)):
+		return false
+	case strings.HasSuffix(line, ".") || strings.HasSuffix(line, ":") || strings.HasSuffix(line, ","):
+		return false
+	case addressLikeRegex.MatchString(line), strings.Contains(line, ": "):
+		return false
+	case metadata.Organization != "" && strings.EqualFold(line, metadata.Organization):
+		return false
+	case len(digitsRegex.FindAllString(line, -1)) > 8:
+		return false
+	}
+	return true
+}
+
+func isUpperLine(line string) bool {
+	hasUpper := false
+	for _, r := range line {
+		if unicode.IsLower(r) {
+			return false
+		}
+		hasUpper = hasUpper || unicode.IsUpper(r)
+	}
+	return hasUpper
+}
+
+// headingCase turns an all-caps heading into sentence case.
+func headingCase(line string) string {
+	if !isUpperLine(line) {
+		return line
+	}
+	runes := []rune(strings.ToLower(line))
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// guessFields fills custom fields that have a pattern with the first word
+// or line of text matching it.
+func (n *Namer) guessFields(text string, lines []string) map[string]string {
+	if len(n.patterns) == 0 {
+		return nil
+	}
+	extra := map[string]string{}
+	for _, field := range n.opts.Fields {
+		re := n.patterns[field.Name]
+		if re == nil {
+			continue
+		}
+	search:
+		for _, line := range lines {
+			for _, candidate := range append([]string{line}, strings.Fields(line)...) {
+				candidate = strings.Trim(candidate, ".,;:()[]")
+				if candidate != "" && re.MatchString(candidate) {
+					extra[field.Name] = candidate
+					break search
+				}
+			}
+		}
+	}
+	return extra
+}
+
+// pdfHeadings returns the lines of the first page set in its largest font,
+// largest first, or nil when the text layer has no clear heading.
+func pdfHeadings(path string) (headings []string) {
+	defer func() {
+		// The PDF library panics on some malformed content streams.
+		if recover() != nil {
+			headings = nil
+		}
+	}()
+
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	if reader.NumPage() == 0 {
+		return nil
+	}
+	page := reader.Page(1)
+	if page.V.IsNull() {
+		return nil
+	}
+
+	type textLine struct {
+		y, size float64
+		text    strings.Builder
+		lastX   float64
+	}
+	var lines []*textLine
+	var sizes []float64
+	for _, t := range page.Content().Text {
+		sizes = append(sizes, t.FontSize)
+		var line *textLine
+		for _, l := range lines {
+			if math.Abs(l.y-t.Y) < t.FontSize/2 {
+				line = l
+				break
+			}
+		}
+		if line == nil {
+			line = &textLine{y: t.Y}
+			lines = append(lines, line)
+		} else if t.X-line.lastX > t.FontSize/4 && !strings.HasSuffix(line.text.String(), " ") {
+			line.text.WriteString(" ")
+		}
+		line.text.WriteString(t.S)
+		line.lastX = t.X + t.W
+		line.size = max(line.size, t.FontSize)
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	sort.Float64s(sizes)
+	body := sizes[len(sizes)/2]
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].size != lines[j].size {
+			return lines[i].size > lines[j].size
+		}
+		return lines[i].y > lines[j].y
+	})
+	for _, line := range lines {
+		if line.size < body*1.2 {
+			break
+		}
+		if text := strings.Join(strings.Fields(line.text.String()), " "); text != "" {
+			headings = append(headings, text)
+		}
+	}
+	return headings
+}
+
+// offlineMetadata is ExtractMetadata in offline mode.
+func (n *Namer) offlineMetadata(content Content) (Metadata, error) {
+	metadata, missing := n.checkFields(n.GuessMetadata(content))
+	if len(missing) > 0 {
+		return Metadata{}, fmt.Errorf("required fields not found offline: %s", strings.Join(missing, ", "))
+	}
+	if _, ok := n.BuildTitle(metadata); !ok {
+		return Metadata{}, fmt.Errorf("not enough metadata found offline for filename generation")
+	}
+	return metadata, nil
+}
@@ -0,0 +1,184 @@
+package nombra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindDocumentDate(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"iso", "Generated 2024-03-07 by the portal", "2024.03.07"},
+		{"day first", "Berlin, 05.11.2023", "2023.11.05"},
+		{"month first when day first is impossible", "Issued 12/25/2023", "2023.12.25"},
+		{"english", "March 3, 2024", "2024.03.03"},
+		{"spanish", "Madrid, 14 de febrero de 2025", "2025.02.14"},
+		{"german", "München, den 2. Mai 2024", "2024.05.02"},
+		{"french", "Paris, le 1er août 2022", "2022.08.01"},
+		{"dutch", "Amsterdam, 9 maart 2021", "2021.03.09"},
+		{"date line wins", "Delivered 01.02.2024\nInvoice date: 15.02.2024", "2024.02.15"},
+		{"birth date skipped", "Date of birth: 04.07.1980\nSigned 12 June 2024", "2024.06.12"},
+		{"invalid day", "31.02.2024", ""},
+		{"no full date", "Valid through March 2024", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findDocumentDate(tt.text); got != tt.want {
+				t.Errorf("findDocumentDate(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"Sehr geehrte Damen und Herren, die Rechnung für den Monat ist mit der Post gekommen und wir bitten Sie um Zahlung.": "German",
+		"Estimado cliente, le enviamos la factura del mes de marzo para que la revise con su gestor y nos la devuelva.":      "Spanish",
+		"Please find attached the invoice for the services we provided to you this month and pay it within 14 days.":         "English",
+		"Total 12.50": "",
+	}
+	for text, want := range tests {
+		if got := detectLanguage(text); got != want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestGuessMetadata(t *testing.T) {
+	n := newTestNamer(t, Options{Offline: true, KnownSenders: []string{"Vodafone"}})
+	tests := []struct {
+		name    string
+		content Content
+		want    Metadata
+	}{
+		{
+			name: "german letter with letterhead",
+			content: Content{Text: "Stadtwerke München GmbH · Emmy-Noether-Str. 2 · 80992 München\n" +
+				"Herrn Max Mustermann\nBeispielweg 1\n80331 München\n" +
+				"München, 12. März 2024\n" +
+				"Jahresabrechnung Strom 2023\n" +
+				"Sehr geehrter Herr Mustermann, mit dieser Rechnung erhalten Sie die Abrechnung für den Zeitraum vom 01.01.2023 bis 31.12.2023. Der Betrag wird von Ihrem Konto abgebucht.\n"},
+			want: Metadata{Date: "2024.03.12", Language: "German", Organization: "Stadtwerke München", DocumentType: "Rechnung", Title: "Jahresabrechnung Strom 2023"},
+		},
+		{
+			name: "known sender and heading",
+			content: Content{
+				Text:     "Your bill\nCustomer number 123456\nBill date: 4 June 2024\nThank you for choosing Vodafone. This is the bill for your mobile contract and the amount will be collected from your account.\n",
+				Headings: []string{"Your bill"},
+			},
+			want: Metadata{Date: "2024.06.04", Language: "English", Organization: "Vodafone", DocumentType: "Invoice", Title: "Your bill"},
+		},
+		{
+			name: "email",
+			content: Content{Text: "Subject: Re: Lease renewal for flat 3B\nFrom: Jane Doe <jane@example.com>\nTo: John Smith <john@example.com>\nDate: Tue, 02 Jan 2024 10:00:00 +0100\n\n" +
+				"Hi John, the new lease is attached. Let me know if you have questions about the contract.\n"},
+			want: Metadata{Date: "2024.01.02", Language: "English", DocumentType: "Contract", Author: "Jane Doe", Recipient: "John Smith", Topic: "Lease renewal for flat 3B"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := n.GuessMetadata(tt.content)
+			got.Extra = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GuessMetadata() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuessMetadataCustomFields(t *testing.T) {
+	n := newTestNamer(t, Options{Offline: true, Fields: []Field{{Name: "invoice_number", Description: "Invoice number", Pattern: `^INV-\d+$`, Required: true}}})
+	metadata, _, err := n.ExtractMetadata(context.Background(), "ACME Ltd\nINVOICE\nInvoice no. INV-4711, dated 2024-05-01\n")
+	if err != nil {
+		t.Fatalf("ExtractMetadata() returned error: %v", err)
+	}
+	if metadata.Extra["invoice_number"] != "INV-4711" {
+		t.Errorf("invoice_number = %q, want INV-4711", metadata.Extra["invoice_number"])
+	}
+
+	_, _, err = n.ExtractMetadata(context.Background(), "ACME Ltd\nINVOICE\nNo number here, dated 2024-05-01\n")
+	if err == nil {
+		t.Fatal("ExtractMetadata() succeeded without the required field")
+	}
+}
+
+func TestOfflineNeedsNoKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	n, err := New(Options{Offline: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if _, err := n.Provider().Complete(context.Background(), CompletionRequest{}); !errors.Is(err, ErrOffline) {
+		t.Errorf("Complete() error = %v, want ErrOffline", err)
+	}
+	online, err := New(Options{APIKey: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.PromptVersion() == online.PromptVersion() {
+		t.Error("offline and online prompt versions are equal")
+	}
+}
+
+func TestSuggestOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.txt")
+	text := "Allianz Versicherungs-AG\nVERSICHERUNGSSCHEIN\nDatum: 03.04.2024\nSehr geehrte Frau Schmidt, anbei erhalten Sie Ihren Versicherungsschein für die Hausratversicherung.\n"
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n := newTestNamer(t, Options{Offline: true})
+	suggestion, err := n.Suggest(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Suggest() returned error: %v", err)
+	}
+	if want := "2024.04.03 - Versicherungsschein - Allianz Versicherungs-AG"; suggestion.Title != want {
+		t.Errorf("Title = %q, want %q", suggestion.Title, want)
+	}
+}
+
+func TestPDFHeadings(t *testing.T) {
+	stream := "BT /F1 22 Tf 72 720 Td (Annual Statement) Tj ET\n" +
+		"BT /F1 10 Tf 72 680 Td (Dear customer, this is the body text of the letter.) Tj ET\n" +
+		"BT /F1 10 Tf 72 665 Td (It goes on for a few lines.) Tj ET\n" +
+		"BT /F1 10 Tf 72 650 Td (Kind regards) Tj ET"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [4 0 R] /Count 1 /MediaBox [0 0 612 792] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R /Resources << /Font << /F1 3 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, body := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n\r\n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	path := filepath.Join(t.TempDir(), "statement.pdf")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pdfHeadings(path); !reflect.DeepEqual(got, []string{"Annual Statement"}) {
+		t.Errorf("pdfHeadings() = %q, want [Annual Statement]", got)
+	}
+	if got := pdfHeadings(filepath.Join(t.TempDir(), "missing.pdf")); got != nil {
+		t.Errorf("pdfHeadings() of a missing file = %q, want nil", got)
+	}
+}
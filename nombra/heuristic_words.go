@@ -0,0 +1,210 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+// Word lists of the offline heuristics, for English, Spanish, German,
+// French, Italian, Portuguese and Dutch. All entries are lowercase.
+
+// monthNames maps month names and their abbreviations to month numbers.
+var monthNames = map[string]int{
+	// English
+	"january": 1, "february": 2, "march": 3, "april": 4, "may": 5, "june": 6,
+	"july": 7, "august": 8, "september": 9, "october": 10, "november": 11, "december": 12,
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "sept": 9, "oct": 10, "nov": 11, "dec": 12,
+	// Spanish
+	"enero": 1, "febrero": 2, "marzo": 3, "abril": 4, "mayo": 5, "junio": 6,
+	"julio": 7, "agosto": 8, "septiembre": 9, "setiembre": 9, "octubre": 10, "noviembre": 11, "diciembre": 12,
+	"ene": 1, "abr": 4, "ago": 8, "dic": 12,
+	// German
+	"januar": 1, "jänner": 1, "februar": 2, "märz": 3, "maerz": 3, "mai": 5, "juni": 6,
+	"juli": 7, "oktober": 10, "dezember": 12,
+	"mär": 3, "mrz": 3, "okt": 10, "dez": 12,
+	// French
+	"janvier": 1, "février": 2, "fevrier": 2, "mars": 3, "avril": 4, "juin": 6,
+	"juillet": 7, "août": 8, "aout": 8, "septembre": 9, "octobre": 10, "novembre": 11, "décembre": 12, "decembre": 12,
+	"janv": 1, "févr": 2, "fév": 2, "avr": 4, "juil": 7, "déc": 12,
+	// Italian
+	"gennaio": 1, "febbraio": 2, "aprile": 4, "maggio": 5, "giugno": 6,
+	"luglio": 7, "settembre": 9, "ottobre": 10, "dicembre": 12,
+	"gen": 1, "mag": 5, "giu": 6, "lug": 7, "set": 9, "ott": 10,
+	// Portuguese
+	"janeiro": 1, "fevereiro": 2, "março": 3, "marco": 3, "maio": 5, "junho": 6,
+	"julho": 7, "setembro": 9, "outubro": 10, "dezembro": 12,
+	"fev": 2, "out": 10,
+	// Dutch
+	"januari": 1, "februari": 2, "maart": 3, "mei": 5, "augustus": 8,
+	"mrt": 3,
+}
+
+// languageStopwords are frequent short words that tell languages apart.
+var languageStopwords = []struct {
+	language string
+	words    []string
+}{
+	{"English", []string{"the", "and", "of", "to", "for", "with", "your", "this", "is", "are", "from", "we", "you"}},
+	{"Spanish", []string{"el", "los", "las", "del", "que", "y", "para", "con", "por", "una", "su", "es", "al"}},
+	{"German", []string{"der", "die", "das", "und", "ist", "nicht", "mit", "für", "sie", "ihre", "wir", "den", "dem", "von"}},
+	{"French", []string{"le", "les", "des", "et", "est", "pour", "avec", "vous", "votre", "une", "du", "dans", "au"}},
+	{"Italian", []string{"il", "gli", "della", "che", "per", "con", "sono", "una", "alla", "nel", "di", "si", "è"}},
+	{"Portuguese", []string{"os", "da", "do", "que", "para", "com", "uma", "não", "seu", "em", "ao", "dos", "é"}},
+	{"Dutch", []string{"het", "een", "en", "van", "voor", "met", "niet", "uw", "op", "dat", "wij", "zijn", "u"}},
+}
+
+// documentKind is a document type with its name and the words that give it
+// away, per language. German keywords also match as the end of compounds
+// such as Stromrechnung.
+type documentKind struct {
+	labels   map[string]string
+	keywords map[string][]string
+}
+
+// documentKinds are ordered from specific to generic; ties go to the first.
+var documentKinds = []documentKind{
+	{
+		labels: map[string]string{"English": "Payslip", "Spanish": "Nómina", "German": "Gehaltsabrechnung", "French": "Bulletin de paie", "Italian": "Busta paga", "Portuguese": "Recibo de vencimento", "Dutch": "Loonstrook"},
+		keywords: map[string][]string{
+			"English": {"payslip", "pay slip", "salary statement", "earnings statement"}, "Spanish": {"nómina", "recibo de salarios"},
+			"German": {"gehaltsabrechnung", "lohnabrechnung", "entgeltabrechnung"}, "French": {"bulletin de paie", "fiche de paie", "bulletin de salaire"},
+			"Italian": {"busta paga", "cedolino"}, "Portuguese": {"recibo de vencimento", "holerite", "contracheque"}, "Dutch": {"loonstrook", "salarisstrook"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Bank statement", "Spanish": "Extracto bancario", "German": "Kontoauszug", "French": "Relevé de compte", "Italian": "Estratto conto", "Portuguese": "Extrato bancário", "Dutch": "Rekeningafschrift"},
+		keywords: map[string][]string{
+			"English": {"bank statement", "account statement", "statement of account"}, "Spanish": {"extracto bancario", "extracto de cuenta", "extracto de movimientos"},
+			"German": {"kontoauszug"}, "French": {"relevé de compte", "relevé bancaire"}, "Italian": {"estratto conto"},
+			"Portuguese": {"extrato bancário", "extrato de conta"}, "Dutch": {"rekeningafschrift", "bankafschrift"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Tax assessment", "Spanish": "Declaración de la renta", "German": "Steuerbescheid", "French": "Avis d'imposition", "Italian": "Dichiarazione dei redditi", "Portuguese": "Declaração de IRS", "Dutch": "Belastingaanslag"},
+		keywords: map[string][]string{
+			"English": {"tax return", "tax assessment", "notice of assessment"}, "Spanish": {"declaración de la renta", "irpf", "modelo 100"},
+			"German": {"steuerbescheid", "steuererklärung", "einkommensteuerbescheid"}, "French": {"avis d'imposition", "déclaration de revenus"},
+			"Italian": {"dichiarazione dei redditi", "modello 730"}, "Portuguese": {"declaração de irs", "nota de liquidação"}, "Dutch": {"belastingaanslag", "belastingaangifte", "aanslag inkomstenbelasting"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Payment reminder", "Spanish": "Recordatorio de pago", "German": "Mahnung", "French": "Relance", "Italian": "Sollecito", "Portuguese": "Lembrete de pagamento", "Dutch": "Herinnering"},
+		keywords: map[string][]string{
+			"English": {"payment reminder", "overdue notice", "final notice"}, "Spanish": {"recordatorio de pago", "requerimiento de pago"},
+			"German": {"mahnung", "zahlungserinnerung"}, "French": {"relance", "rappel de paiement", "mise en demeure"},
+			"Italian": {"sollecito"}, "Portuguese": {"lembrete de pagamento", "aviso de cobrança"}, "Dutch": {"herinnering", "aanmaning"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Invoice", "Spanish": "Factura", "German": "Rechnung", "French": "Facture", "Italian": "Fattura", "Portuguese": "Fatura", "Dutch": "Factuur"},
+		keywords: map[string][]string{
+			"English": {"invoice", "bill"}, "Spanish": {"factura"}, "German": {"rechnung"}, "French": {"facture"},
+			"Italian": {"fattura"}, "Portuguese": {"fatura", "nota fiscal"}, "Dutch": {"factuur", "nota"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Receipt", "Spanish": "Recibo", "German": "Quittung", "French": "Reçu", "Italian": "Ricevuta", "Portuguese": "Recibo", "Dutch": "Kwitantie"},
+		keywords: map[string][]string{
+			"English": {"receipt"}, "Spanish": {"recibo", "ticket de compra"}, "German": {"quittung", "kassenbon", "kaufbeleg"}, "French": {"reçu", "ticket de caisse"},
+			"Italian": {"ricevuta", "scontrino"}, "Portuguese": {"recibo", "comprovante"}, "Dutch": {"kwitantie", "kassabon"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Quote", "Spanish": "Presupuesto", "German": "Angebot", "French": "Devis", "Italian": "Preventivo", "Portuguese": "Orçamento", "Dutch": "Offerte"},
+		keywords: map[string][]string{
+			"English": {"quotation", "quote", "estimate"}, "Spanish": {"presupuesto"}, "German": {"angebot", "kostenvoranschlag"}, "French": {"devis"},
+			"Italian": {"preventivo"}, "Portuguese": {"orçamento"}, "Dutch": {"offerte"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Insurance policy", "Spanish": "Póliza", "German": "Versicherungsschein", "French": "Police d'assurance", "Italian": "Polizza", "Portuguese": "Apólice", "Dutch": "Polis"},
+		keywords: map[string][]string{
+			"English": {"insurance policy", "policy schedule"}, "Spanish": {"póliza"}, "German": {"versicherungsschein", "versicherungspolice"}, "French": {"police d'assurance"},
+			"Italian": {"polizza"}, "Portuguese": {"apólice"}, "Dutch": {"polis", "polisblad"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Contract", "Spanish": "Contrato", "German": "Vertrag", "French": "Contrat", "Italian": "Contratto", "Portuguese": "Contrato", "Dutch": "Overeenkomst"},
+		keywords: map[string][]string{
+			"English": {"contract", "agreement"}, "Spanish": {"contrato"}, "German": {"vertrag"}, "French": {"contrat"},
+			"Italian": {"contratto"}, "Portuguese": {"contrato"}, "Dutch": {"overeenkomst", "contract"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Certificate", "Spanish": "Certificado", "German": "Bescheinigung", "French": "Attestation", "Italian": "Certificato", "Portuguese": "Certificado", "Dutch": "Verklaring"},
+		keywords: map[string][]string{
+			"English": {"certificate", "certification"}, "Spanish": {"certificado", "certificación"}, "German": {"bescheinigung", "zertifikat", "nachweis"},
+			"French": {"attestation", "certificat"}, "Italian": {"certificato", "attestato"}, "Portuguese": {"certificado", "atestado", "declaração"}, "Dutch": {"verklaring", "certificaat"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Permit", "Spanish": "Permiso", "German": "Genehmigung", "French": "Permis", "Italian": "Permesso", "Portuguese": "Licença", "Dutch": "Vergunning"},
+		keywords: map[string][]string{
+			"English": {"permit", "licence", "license"}, "Spanish": {"permiso", "licencia", "autorización"}, "German": {"genehmigung", "erlaubnis", "bewilligung"},
+			"French": {"permis", "autorisation"}, "Italian": {"permesso", "licenza", "autorizzazione"}, "Portuguese": {"licença", "autorização", "alvará"}, "Dutch": {"vergunning"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Application", "Spanish": "Solicitud", "German": "Antrag", "French": "Demande", "Italian": "Domanda", "Portuguese": "Requerimento", "Dutch": "Aanvraag"},
+		keywords: map[string][]string{
+			"English": {"application form", "application"}, "Spanish": {"solicitud", "formulario"}, "German": {"antrag", "formular"},
+			"French": {"demande", "formulaire"}, "Italian": {"domanda", "modulo"}, "Portuguese": {"requerimento", "formulário"}, "Dutch": {"aanvraag", "formulier"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Report", "Spanish": "Informe", "German": "Bericht", "French": "Rapport", "Italian": "Relazione", "Portuguese": "Relatório", "Dutch": "Rapport"},
+		keywords: map[string][]string{
+			"English": {"report"}, "Spanish": {"informe"}, "German": {"bericht", "befund", "gutachten"}, "French": {"rapport", "compte rendu"},
+			"Italian": {"relazione", "rapporto", "referto"}, "Portuguese": {"relatório", "laudo"}, "Dutch": {"rapport", "verslag"},
+		},
+	},
+	{
+		labels: map[string]string{"English": "Letter", "Spanish": "Carta", "German": "Brief", "French": "Lettre", "Italian": "Lettera", "Portuguese": "Carta", "Dutch": "Brief"},
+		keywords: map[string][]string{
+			"English": {"dear"}, "Spanish": {"estimado", "estimada", "muy señor"}, "German": {"sehr geehrte", "sehr geehrter"},
+			"French": {"madame, monsieur", "chère madame", "cher monsieur"}, "Italian": {"gentile", "egregio"},
+			"Portuguese": {"prezado", "prezada", "exmo"}, "Dutch": {"geachte"},
+		},
+	},
+}
+
+// legalForms end company names in letterheads.
+var legalForms = []string{
+	"gmbh", "ag", "kg", "ohg", "ug", "e.v.", "gbr", "se",
+	"s.l.", "s.l.u.", "sl", "s.a.", "sa", "s.a.u.", "s.coop.",
+	"sas", "sarl", "sasu", "eurl", "s.p.a.", "spa", "s.r.l.", "srl", "lda", "ltda",
+	"ltd", "ltd.", "limited", "llc", "inc", "inc.", "corp", "corp.", "plc", "llp",
+	"b.v.", "bv", "n.v.", "nv", "v.o.f.",
+}
+
+// institutionWords mark issuers without a legal form, such as authorities
+// and banks.
+var institutionWords = []string{
+	"bank", "banco", "banque", "banca", "sparkasse", "volksbank", "bausparkasse",
+	"versicherung", "insurance", "seguros", "assurance", "assicurazioni", "verzekering",
+	"ministry", "ministerio", "ministerium", "ministère", "ministero", "ministério", "ministerie",
+	"finanzamt", "agencia tributaria", "tax office", "hmrc", "impôts", "agenzia delle entrate", "belastingdienst",
+	"ayuntamiento", "city council", "stadtverwaltung", "gemeinde", "mairie", "comune", "câmara municipal", "gemeente",
+	"university", "universidad", "universität", "université", "università", "universidade", "universiteit",
+	"hospital", "klinikum", "krankenkasse", "hôpital", "ospedale", "ziekenhuis",
+	"seguridad social", "social security", "rentenversicherung", "sécurité sociale", "inps",
+	"stadtwerke", "jobcenter", "bundesamt", "landesamt", "agentur für arbeit", "consulado", "consulate", "embassy", "embajada", "botschaft",
+}
+
+// birthWords mark dates that are not the date of the document.
+var birthWords = []string{"birth", "born", "geburt", "geboren", "nacimiento", "naissance", "né le", "nascita", "nascimento", "geboorte"}
+
+// dateWords mark the line with the date of the document.
+var dateWords = []string{"date", "dated", "datum", "fecha", "data", "fait le"}
+
+// subjectPrefixes introduce the subject of letters and emails.
+var subjectPrefixes = []string{"subject:", "re:", "betreff:", "betrifft:", "asunto:", "objet :", "objet:", "oggetto:", "assunto:", "onderwerp:", "concerning:"}
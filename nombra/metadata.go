@@ -0,0 +1,262 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// TruncationSuffix marks where a text sent to the model was shortened.
+	TruncationSuffix      = "... [content truncated]"
+	extractionPrompt      = "You extract structured metadata from PDF documents for filename generation.\n\nRead the document and return exactly one JSON object with these keys:\n- date: most relevant date in YYYY.MM.DD format, or empty string\n- language: main language of the document, or empty string\n- title: explicit document title or heading, or empty string\n- document_type: what the document actually is, or empty string\n- organization: the institution, company, authority, or organization speaking or issuing the document, or empty string\n- author: the specific person who signed or authored it, or empty string\n- recipient: who it is addressed to, or empty string\n- topic: the main subject or purpose, or empty string\n\nQuestions to answer internally before filling the JSON:\n- What is the most relevant date in this document?\n- What is the main language of this document?\n- What is this document?\n- What does it look like it is for?\n- Is there a visible title or heading?\n- Which institution, company, authority, or organization is issuing or speaking in this document?\n- Which specific person signed or authored it?\n- Who is it addressed to?\n- What is the main topic?\n\nRules:\n- Use the main language of the document for title, document_type, organization, recipient, and topic\n- Do not translate field values into another language\n- Do not include bilingual duplicates like 'Bundesamt ... (Federal Office ...)' in one field\n- Prefer specific document kinds like permit, questionnaire, application, certificate, invoice, letter, report, contract, or form\n- Distinguish the organization from the individual signer when both are present\n- If there is no useful title, leave title empty instead of inventing one\n- Do not use placeholders like Untitled, Document, File, Unknown, Misc, or N A\n- Do not invent facts that are not supported by the text\n- Return JSON only, with no markdown and no explanation."
+	retryExtractionPrompt = "You previously extracted weak metadata for filename generation. Re-read the document and return a better JSON object.\n\nReturn exactly one JSON object with these keys:\n- date\n- language\n- title\n- document_type\n- organization\n- author\n- recipient\n- topic\n\nRules:\n- Find the most relevant date and format it as YYYY.MM.DD when possible\n- Keep all textual fields in the main language of the document\n- Do not translate values or mix languages in the same field\n- Do not include bilingual duplicates in parentheses or after dashes\n- Focus first on what the document actually is, not just which names appear in it\n- Distinguish the institution or company from the individual signer when both are present\n- If there is no title, identify the document kind or concrete subject\n- Only include person names after the document itself has been identified\n- Do not use placeholders like Untitled, Document, File, Unknown, Misc, or N A\n- Do not return markdown, prose, or explanations\n- Return JSON only."
+)
+
+// Metadata describes a document. Dates use DateLayout; fields the model could
+// not fill are empty.
+type Metadata struct {
+	Date         string `json:"date"`
+	Language     string `json:"language"`
+	Title        string `json:"title"`
+	DocumentType string `json:"document_type"`
+	Organization string `json:"organization"`
+	Author       string `json:"author"`
+	Recipient    string `json:"recipient"`
+	Topic        string `json:"topic"`
+	// Extra holds the values of Options.Fields by field name.
+	Extra map[string]string `json:"extra,omitempty"`
+	// SelfRating is the model's rating of its answer from 0 to 1 with
+	// Options.SelfRating, 0 when not rated.
+	SelfRating float64 `json:"self_rating,omitempty"`
+}
+
+// IsZero reports whether no field is set.
+func (m Metadata) IsZero() bool {
+	return m.Date == "" && m.Language == "" && m.Title == "" && m.DocumentType == "" &&
+		m.Organization == "" && m.Author == "" && m.Recipient == "" && m.Topic == "" && len(m.Extra) == 0
+}
+
+// ExtractMetadata sends document text to the model and returns the metadata
+// it found. When the answer is too weak to build a title from or lacks a
+// required custom field, the model is asked once more and told what was
+// missing. In offline mode the metadata is guessed by GuessMetadata.
+func (n *Namer) ExtractMetadata(ctx context.Context, text string) (Metadata, Usage, error) {
+	if text == "" {
+		return Metadata{}, Usage{}, fmt.Errorf("empty content provided for title generation")
+	}
+	if n.opts.Offline {
+		metadata, err := n.offlineMetadata(Content{Text: text})
+		return metadata, Usage{}, err
+	}
+
+	text = truncateContent(text, n.opts.MaxContentLength)
+
+	n.logf("Sending content to %s (length: %d characters)", n.opts.Provider, len(text))
+	n.debugf("Content:\n%s", text)
+
+	metadata, usage, err := n.extractMetadata(ctx, text, false, "")
+	if err != nil {
+		return Metadata{}, usage, err
+	}
+	metadata, missing := n.checkFields(metadata)
+	_, ok := n.BuildTitle(metadata)
+	if ok && len(missing) == 0 {
+		return metadata, usage, nil
+	}
+
+	feedback := ""
+	if !ok {
+		feedback = weakMetadataReason(metadata)
+	}
+	if len(missing) > 0 {
+		feedback = strings.TrimPrefix(feedback+"; required fields missing or invalid: "+strings.Join(missing, ", "), "; ")
+	}
+	metadata, retryUsage, err := n.extractMetadata(ctx, text, true, feedback)
+	usage = usage.Add(retryUsage)
+	if err != nil {
+		return Metadata{}, usage, err
+	}
+	metadata, missing = n.checkFields(metadata)
+	if _, ok := n.BuildTitle(metadata); !ok {
+		return Metadata{}, usage, fmt.Errorf("model returned insufficient metadata for filename generation")
+	}
+	if len(missing) > 0 {
+		return Metadata{}, usage, fmt.Errorf("model did not return required fields: %s", strings.Join(missing, ", "))
+	}
+	return metadata, usage, nil
+}
+
+// ContentMetadata is ExtractMetadata for extracted content. In offline mode
+// it also uses the headings of the content.
+func (n *Namer) ContentMetadata(ctx context.Context, content Content) (Metadata, Usage, error) {
+	// The vision model already answered; ExtractMetadata retries from its
+	// answer when it is not enough for a title.
+	if content.Metadata != nil && !n.opts.Offline {
+		metadata, missing := n.checkFields(*content.Metadata)
+		if _, ok := n.BuildTitle(metadata); ok && len(missing) == 0 {
+			return metadata, Usage{}, nil
+		}
+	}
+	if n.opts.Offline && strings.TrimSpace(content.Text) != "" {
+		metadata, err := n.offlineMetadata(content)
+		return metadata, Usage{}, err
+	}
+	return n.ExtractMetadata(ctx, content.Text)
+}
+
+func (n *Namer) extractMetadata(ctx context.Context, content string, retry bool, feedback string) (Metadata, Usage, error) {
+	reply, err := n.llm.Complete(ctx, CompletionRequest{
+		Model:           n.opts.Model,
+		System:          n.systemPrompt(retry),
+		User:            buildMetadataRequest(content, feedback),
+		ReasoningEffort: n.opts.ReasoningEffort,
+		Schema:          n.schema,
+	})
+	if err != nil {
+		return Metadata{}, reply.Usage, err
+	}
+
+	metadata, err := parseMetadataResponse(reply.Content, n.opts.Fields)
+	if err != nil {
+		return Metadata{}, reply.Usage, err
+	}
+
+	return normalizeMetadata(metadata), reply.Usage, nil
+}
+
+func buildMetadataRequest(content, feedback string) string {
+	if strings.TrimSpace(feedback) == "" {
+		return content
+	}
+	return fmt.Sprintf("Previous extraction was weak for this reason: %s\n\nDocument text:\n%s", feedback, content)
+}
+
+func parseMetadataResponse(raw string, fields []Field) (Metadata, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Metadata{}, fmt.Errorf("empty metadata response")
+	}
+
+	raw = strings.TrimPrefix(raw, "```json")
+	raw = strings.TrimPrefix(raw, "```")
+	raw = strings.TrimSuffix(raw, "```")
+	raw = strings.TrimSpace(raw)
+
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start == -1 || end == -1 || end < start {
+		return Metadata{}, fmt.Errorf("metadata response did not contain JSON object")
+	}
+
+	var metadata Metadata
+	object := []byte(raw[start : end+1])
+	if err := json.Unmarshal(object, &metadata); err != nil {
+		return Metadata{}, fmt.Errorf("invalid metadata JSON: %w", err)
+	}
+	extra, err := parseExtraFields(object, fields)
+	if err != nil {
+		return Metadata{}, err
+	}
+	metadata.Extra = extra
+	metadata.SelfRating = parseSelfRating(object)
+
+	return metadata, nil
+}
+
+// truncateContent shortens the input content if it exceeds maxContentLength,
+// appending a suffix to indicate that the content has been truncated.
+// truncateContent ensures the most relevant parts of the document are
+// preserved when limiting the text sent to the model. When the content exceeds
+// the configured maximum length, the function keeps portions from both the
+// beginning and end of the text. A suffix is inserted between the two segments
+// to indicate that the middle section has been omitted.
+func truncateContent(content string, maxContentLength int) string {
+	if len(content) <= maxContentLength {
+		return content
+	}
+
+	// Ensure we always keep at least 1 character from start and end
+	minKeep := 1
+	available := maxContentLength - len(TruncationSuffix)
+	if available < 2*minKeep {
+		// Not enough space for both start and end, just return the start
+		return content[:maxContentLength]
+	}
+
+	keep := available / 2
+	start := content[:keep]
+	end := content[len(content)-keep:]
+	return start + TruncationSuffix + end
+}
+
+func normalizeMetadata(metadata Metadata) Metadata {
+	metadata.Date = normalizeDateSeparators(strings.TrimSpace(metadata.Date))
+	metadata.Language = strings.TrimSpace(metadata.Language)
+	metadata.Title = normalizeMetadataField(metadata.Title)
+	metadata.DocumentType = normalizeMetadataField(metadata.DocumentType)
+	metadata.Organization = normalizeOrganizationField(metadata.Organization)
+	metadata.Author = normalizeMetadataField(metadata.Author)
+	metadata.Recipient = normalizeMetadataField(metadata.Recipient)
+	metadata.Topic = normalizeMetadataField(metadata.Topic)
+	if metadata.Extra != nil {
+		extra := make(map[string]string, len(metadata.Extra))
+		for name, value := range metadata.Extra {
+			if value = strings.Join(strings.Fields(value), " "); value != "" {
+				extra[name] = value
+			}
+		}
+		metadata.Extra = extra
+	}
+	return metadata
+}
+
+func normalizeMetadataField(value string) string {
+	value = stripTrailingTranslation(value)
+	value = cleanTitle(value)
+	if isGenericMetadataValue(value) {
+		return ""
+	}
+	return value
+}
+
+func normalizeOrganizationField(value string) string {
+	value = stripTrailingTranslation(value)
+	value = cleanTitle(value)
+	if isGenericMetadataValue(value) {
+		return ""
+	}
+	return shortenDescriptor(value, 42)
+}
+
+func weakMetadataReason(metadata Metadata) string {
+	reasons := []string{}
+	if metadata.Date == "" {
+		reasons = append(reasons, "no relevant date found")
+	}
+	if metadata.Title == "" && metadata.DocumentType == "" && metadata.Topic == "" {
+		reasons = append(reasons, "document identity is missing")
+	}
+	if metadata.Title == "" && metadata.DocumentType == "" && metadata.Topic != "" && metadata.Author != "" && metadata.Recipient != "" {
+		reasons = append(reasons, "extraction overfocused on names instead of document kind")
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "metadata was too weak to build a reliable filename")
+	}
+	return strings.Join(reasons, "; ")
+}
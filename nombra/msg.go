@@ -0,0 +1,343 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Outlook .msg files are OLE compound files (MS-CFB) holding one stream per
+// MAPI property (MS-OXMSG). Only what is needed to name a message is read.
+
+const (
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbNoStream   = 0xFFFFFFFF
+
+	cfbTypeStorage = 1
+	cfbTypeStream  = 2
+	cfbTypeRoot    = 5
+)
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+type cfbEntry struct {
+	name        string
+	kind        byte
+	left, right uint32
+	child       uint32
+	start       uint32
+	size        uint64
+}
+
+// compoundFile is a read-only view of an OLE compound file held in memory.
+type compoundFile struct {
+	data          []byte
+	sectorSize    int
+	miniCutoff    uint64
+	fat           []uint32
+	miniFAT       []uint32
+	entries       []cfbEntry
+	miniStream    []byte
+	maxChainSteps int
+}
+
+func openCompoundFile(data []byte) (*compoundFile, error) {
+	if len(data) < 512 || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, fmt.Errorf("not an OLE compound file")
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(data[0x1E:])
+	if shift != 9 && shift != 12 {
+		return nil, fmt.Errorf("unsupported sector size")
+	}
+	cf := &compoundFile{
+		data:       data,
+		sectorSize: 1 << shift,
+		miniCutoff: uint64(le.Uint32(data[0x38:])),
+	}
+	cf.maxChainSteps = len(data)/64 + 1
+
+	// The FAT sector list starts in the header and continues in DIFAT sectors.
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := le.Uint32(data[0x4C+4*i:]); s < cfbEndOfChain {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	next := le.Uint32(data[0x44:])
+	for steps := 0; next < cfbEndOfChain && steps < cf.maxChainSteps; steps++ {
+		sector, err := cf.sector(next)
+		if err != nil {
+			return nil, err
+		}
+		per := cf.sectorSize/4 - 1
+		for i := 0; i < per; i++ {
+			if s := le.Uint32(sector[4*i:]); s < cfbEndOfChain {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		next = le.Uint32(sector[4*per:])
+	}
+	for _, s := range fatSectors {
+		sector, err := cf.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < cf.sectorSize/4; i++ {
+			cf.fat = append(cf.fat, le.Uint32(sector[4*i:]))
+		}
+	}
+
+	dir, err := cf.chain(le.Uint32(data[0x30:]), cf.fat, cf.sectorSize, cf.sector)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory: %w", err)
+	}
+	for off := 0; off+128 <= len(dir); off += 128 {
+		raw := dir[off : off+128]
+		nameLen := int(le.Uint16(raw[0x40:]))
+		if nameLen > 64 {
+			nameLen = 64
+		}
+		cf.entries = append(cf.entries, cfbEntry{
+			name:  decodeUTF16LE(raw[:max(nameLen-2, 0)]),
+			kind:  raw[0x42],
+			left:  le.Uint32(raw[0x44:]),
+			right: le.Uint32(raw[0x48:]),
+			child: le.Uint32(raw[0x4C:]),
+			start: le.Uint32(raw[0x74:]),
+			size:  le.Uint64(raw[0x78:]),
+		})
+	}
+	if len(cf.entries) == 0 || cf.entries[0].kind != cfbTypeRoot {
+		return nil, fmt.Errorf("root entry not found")
+	}
+	if shift == 9 {
+		// Version 3 files may leave garbage in the high size bits.
+		for i := range cf.entries {
+			cf.entries[i].size &= 0xFFFFFFFF
+		}
+	}
+
+	miniFAT, err := cf.chain(le.Uint32(data[0x3C:]), cf.fat, cf.sectorSize, cf.sector)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mini FAT: %w", err)
+	}
+	for i := 0; i+4 <= len(miniFAT); i += 4 {
+		cf.miniFAT = append(cf.miniFAT, le.Uint32(miniFAT[i:]))
+	}
+	root := cf.entries[0]
+	cf.miniStream, err = cf.chain(root.start, cf.fat, cf.sectorSize, cf.sector)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mini stream: %w", err)
+	}
+	return cf, nil
+}
+
+func (cf *compoundFile) sector(n uint32) ([]byte, error) {
+	start := (int(n) + 1) * cf.sectorSize
+	if start < 0 || start+cf.sectorSize > len(cf.data) {
+		// The last sector may be truncated.
+		if start >= 0 && start < len(cf.data) {
+			return append(cf.data[start:len(cf.data):len(cf.data)], make([]byte, start+cf.sectorSize-len(cf.data))...), nil
+		}
+		return nil, fmt.Errorf("sector %d out of range", n)
+	}
+	return cf.data[start : start+cf.sectorSize], nil
+}
+
+func (cf *compoundFile) miniSector(n uint32) ([]byte, error) {
+	start := int(n) * 64
+	if start < 0 || start+64 > len(cf.miniStream) {
+		return nil, fmt.Errorf("mini sector %d out of range", n)
+	}
+	return cf.miniStream[start : start+64], nil
+}
+
+// chain concatenates the sectors of an allocation chain.
+func (cf *compoundFile) chain(start uint32, table []uint32, size int, read func(uint32) ([]byte, error)) ([]byte, error) {
+	var out []byte
+	for n, steps := start, 0; n < cfbEndOfChain; steps++ {
+		if steps > cf.maxChainSteps || int(n) >= len(table) {
+			return nil, fmt.Errorf("corrupt allocation chain")
+		}
+		sector, err := read(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sector[:size]...)
+		n = table[n]
+	}
+	return out, nil
+}
+
+func (cf *compoundFile) stream(entry cfbEntry) ([]byte, error) {
+	var data []byte
+	var err error
+	if entry.size < cf.miniCutoff {
+		data, err = cf.chain(entry.start, cf.miniFAT, 64, cf.miniSector)
+	} else {
+		data, err = cf.chain(entry.start, cf.fat, cf.sectorSize, cf.sector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) < entry.size {
+		return nil, fmt.Errorf("stream %q is truncated", entry.name)
+	}
+	return data[:entry.size], nil
+}
+
+// children returns the entries directly inside the storage at index.
+func (cf *compoundFile) children(index int) []cfbEntry {
+	var out []cfbEntry
+	seen := map[uint32]bool{}
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == cfbNoStream || int(id) >= len(cf.entries) || seen[id] {
+			return
+		}
+		seen[id] = true
+		entry := cf.entries[id]
+		walk(entry.left)
+		out = append(out, entry)
+		walk(entry.right)
+	}
+	walk(cf.entries[index].child)
+	return out
+}
+
+func (cf *compoundFile) indexOf(entry cfbEntry) int {
+	for i, e := range cf.entries {
+		if e == entry {
+			return i
+		}
+	}
+	return -1
+}
+
+// msgProperties maps MAPI property IDs (as four hex digits) to their string
+// values for the streams directly inside one storage.
+func (cf *compoundFile) msgProperties(index int) map[string]string {
+	props := map[string]string{}
+	for _, entry := range cf.children(index) {
+		if entry.kind != cfbTypeStream || !strings.HasPrefix(entry.name, "__substg1.0_") || len(entry.name) != 20 {
+			continue
+		}
+		id, kind := entry.name[12:16], entry.name[16:20]
+		raw, err := cf.stream(entry)
+		if err != nil {
+			continue
+		}
+		switch kind {
+		case "001F":
+			props[id] = strings.TrimRight(decodeUTF16LE(raw), "\x00")
+		case "001E":
+			props[id] = strings.TrimRight(decodeText(raw, ""), "\x00")
+		}
+	}
+	return props
+}
+
+// msgSubmitTime reads PidTagClientSubmitTime (0x0039) or
+// PidTagMessageDeliveryTime (0x0E06) from the fixed-size property stream.
+func (cf *compoundFile) msgSubmitTime() (time.Time, bool) {
+	for _, entry := range cf.children(0) {
+		if entry.name != "__properties_version1.0" {
+			continue
+		}
+		raw, err := cf.stream(entry)
+		if err != nil {
+			return time.Time{}, false
+		}
+		// The top-level header is 32 bytes, followed by 16-byte entries.
+		for off := 32; off+16 <= len(raw); off += 16 {
+			tag := binary.LittleEndian.Uint32(raw[off:])
+			if tag != 0x00390040 && tag != 0x0E060040 {
+				continue
+			}
+			filetime := binary.LittleEndian.Uint64(raw[off+8:])
+			if filetime == 0 {
+				continue
+			}
+			// FILETIME counts 100ns intervals since 1601-01-01.
+			const epochDelta = 116444736000000000
+			return time.Unix(0, int64(filetime-epochDelta)*100).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func decodeUTF16LE(raw []byte) string {
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// extractMSGContent reads subject, sender, recipients, date, attachment names
+// and the plain text body of an Outlook message.
+func (n *Namer) extractMSGContent(ctx context.Context, path string) (Content, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Content{}, err
+	}
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		return Content{}, fmt.Errorf("invalid Outlook message: %w", err)
+	}
+
+	props := cf.msgProperties(0)
+	var text strings.Builder
+	for _, field := range []struct{ label, id string }{
+		{"Subject", "0037"},
+		{"From", "0C1A"},
+		{"To", "0E04"},
+		{"Cc", "0E03"},
+	} {
+		if value := strings.TrimSpace(props[field.id]); value != "" {
+			fmt.Fprintf(&text, "%s: %s\n", field.label, value)
+		}
+	}
+	if sent, ok := cf.msgSubmitTime(); ok {
+		fmt.Fprintf(&text, "Date: %s\n", sent.Format(time.RFC1123Z))
+	}
+
+	var attachments []string
+	for _, entry := range cf.children(0) {
+		if entry.kind != cfbTypeStorage || !strings.HasPrefix(entry.name, "__attach_version1.0_") {
+			continue
+		}
+		attach := cf.msgProperties(cf.indexOf(entry))
+		if name := cmp.Or(attach["3707"], attach["3704"]); name != "" {
+			attachments = append(attachments, name)
+		}
+	}
+	if len(attachments) > 0 {
+		fmt.Fprintf(&text, "Attachments: %s\n", strings.Join(attachments, ", "))
+	}
+
+	text.WriteString("\n")
+	text.WriteString(props["1000"])
+	return n.textContent(text.String())
+}
@@ -0,0 +1,375 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nombra names documents after their content. It extracts the text of
+// PDFs, images, office documents, emails and text files, asks a language
+// model for structured metadata and builds a filename from it.
+//
+//	n, err := nombra.New(nombra.Options{Provider: nombra.ProviderAnthropic})
+//	if err != nil {
+//		return err
+//	}
+//	suggestion, err := n.Suggest(ctx, "scan.pdf")
+//	if err != nil {
+//		return err
+//	}
+//	newPath, err := n.Rename(ctx, "scan.pdf", suggestion.Title, suggestion.Metadata)
+//
+// The nombra command is a thin wrapper around this package.
+package nombra
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultModel is the OpenAI model used when Options.Model is empty.
+	DefaultModel = "gpt-5.4"
+	// DefaultMaxContentLength is used when Options.MaxContentLength is 0.
+	DefaultMaxContentLength = 3000
+
+	visionModel = openai.GPT4oMini
+)
+
+// Extraction methods reported in Content.Method.
+const (
+	MethodStandard = "standard"
+	MethodOCR      = "ocr"
+	MethodVision   = "vision"
+)
+
+// Options configure a Namer. The zero value uses OpenAI with the key from
+// $OPENAI_API_KEY, no retries and no rate limits.
+type Options struct {
+	// Provider is the model backend: openai (default), openai-compatible or
+	// anthropic.
+	Provider string
+	// APIKey defaults to $OPENAI_API_KEY, or $ANTHROPIC_API_KEY for Anthropic.
+	APIKey string
+	// BaseURL overrides the provider's endpoint. openai-compatible needs it.
+	BaseURL string
+	// Client replaces the backend built from Provider, APIKey and BaseURL.
+	// Retries and rate limits still apply.
+	Client Provider
+	// Model extracts the metadata. It defaults to DefaultModel for OpenAI and
+	// DefaultAnthropicModel for Anthropic.
+	Model string
+	// ReasoningEffort of GPT-5 models: none (default), low, medium, high or
+	// xhigh.
+	ReasoningEffort string
+
+	// ForceOCR skips the text layer of PDFs.
+	ForceOCR bool
+	// VisionPages are the pages of a PDF shown to the vision model when no
+	// text can be extracted, counting from 1; negative numbers count from
+	// the end, so -1 is the last page. See ParseVisionPages. Empty sends the
+	// first page.
+	VisionPages []int
+	// VisionModel reads scans that yield no text. Empty uses gpt-4o-mini
+	// with OpenAI and Model with other providers.
+	VisionModel string
+	// VisionDetail is VisionDetailHigh (default), VisionDetailLow or
+	// VisionDetailAuto.
+	VisionDetail string
+	// VisionMaxSize scales images down so that their longer side has at most
+	// this many pixels before they are sent. 0 uses DefaultVisionMaxSize.
+	VisionMaxSize int
+	// MaxContentLength caps the characters sent to the model. The beginning
+	// and end of longer texts are kept.
+	MaxContentLength int
+	// MinContentLength is the shortest text accepted from an extractor before
+	// falling back to the next one.
+	MinContentLength int
+
+	// Prompt replaces the built-in instructions for extracting metadata. The
+	// expected JSON keys are appended to it.
+	Prompt string
+	// Fields are extracted in addition to the built-in metadata.
+	Fields []Field
+	// SelfRating asks the model to rate its own answer, which is stored in
+	// Metadata.SelfRating and weighs into Confidence.
+	SelfRating bool
+	// StructuredOutput is StructuredOutputAuto (default), StructuredOutputOn
+	// or StructuredOutputOff. With structured outputs the model is held to a
+	// strict JSON schema and replies breaking it are retried; otherwise the
+	// JSON object is picked leniently out of the reply.
+	StructuredOutput string
+
+	// Template lays out filenames, e.g. {date:2006-01-02}_{organization}.
+	// Empty uses "date - document - organization - recipient - topic".
+	Template string
+	// Dest files renamed documents into a directory tree such as
+	// ~/Archive/{organization}/{date:2006}. Empty keeps them in place.
+	Dest string
+	// DestMode is DestModeMove (default) or DestModeCopy.
+	DestMode string
+
+	// MaxRetries is how often a failed or rate limited request is retried.
+	MaxRetries int
+	// RequestTimeout limits a single request; 0 means no limit.
+	RequestTimeout time.Duration
+	// RequestsPerMinute and TokensPerMinute limit all requests of the Namer;
+	// 0 means no limit.
+	RequestsPerMinute int
+	TokensPerMinute   int
+
+	// Prices overrides or extends DefaultPrices, keyed by model name.
+	Prices map[string]Price
+
+	// Offline guesses metadata with local heuristics instead of asking a
+	// model, so no API key is needed. See GuessMetadata.
+	Offline bool
+	// KnownSenders are organizations looked for in documents in offline
+	// mode, e.g. "Deutsche Telekom".
+	KnownSenders []string
+
+	// Record saves every model request and its reply in this directory.
+	Record string
+	// Replay answers model requests from a directory written by Record
+	// instead of the provider, so runs can be repeated without network or
+	// API key. Requests that were not recorded fail with ErrNotRecorded.
+	Replay string
+
+	// Logger receives progress messages. Nil discards them.
+	Logger *log.Logger
+	// Verbose also logs each extraction step and the text sent to the model.
+	Verbose bool
+}
+
+// Namer extracts metadata from documents and names them. It is safe for
+// concurrent use; rate limits are shared by all callers.
+type Namer struct {
+	opts     Options
+	llm      Provider
+	template *titleTemplate
+	dest     *destTemplate
+	patterns map[string]*regexp.Regexp
+	schema   *ResponseSchema // nil without structured outputs
+	// visionSchema is schema for the vision model, which may lack
+	// structured outputs when the metadata model has them or vice versa.
+	visionSchema *ResponseSchema
+	prices       priceTable
+}
+
+// Suggestion is the name proposed for a document and what it is based on.
+type Suggestion struct {
+	Title    string
+	Metadata Metadata
+	// Method is how the text was extracted, one of the Method constants.
+	Method string
+	// Confidence rates how reliable the title is.
+	Confidence Confidence
+	Usage      Usage
+}
+
+// New validates opts, fills in defaults and connects to the provider.
+func New(opts Options) (*Namer, error) {
+	opts.Provider = cmp.Or(opts.Provider, ProviderOpenAI)
+	opts.ReasoningEffort = cmp.Or(opts.ReasoningEffort, "none")
+	opts.DestMode = cmp.Or(opts.DestMode, DestModeMove)
+	opts.MaxContentLength = cmp.Or(opts.MaxContentLength, DefaultMaxContentLength)
+	opts.VisionDetail = cmp.Or(strings.ToLower(opts.VisionDetail), VisionDetailHigh)
+	opts.VisionMaxSize = cmp.Or(opts.VisionMaxSize, DefaultVisionMaxSize)
+	if len(opts.VisionPages) == 0 {
+		opts.VisionPages = []int{1}
+	}
+
+	if err := validateProvider(opts.Provider); err != nil {
+		return nil, err
+	}
+	switch opts.Provider {
+	case ProviderOpenAI:
+		opts.Model = cmp.Or(opts.Model, DefaultModel)
+		if err := validateModel(opts.Model); err != nil {
+			return nil, err
+		}
+	case ProviderAnthropic:
+		opts.Model = cmp.Or(opts.Model, DefaultAnthropicModel)
+	case ProviderOpenAICompatible:
+		if opts.Model == "" {
+			return nil, fmt.Errorf("a model is required with provider %s", ProviderOpenAICompatible)
+		}
+	}
+	if opts.VisionModel == "" {
+		// OpenAI keeps its dedicated vision model, other providers reuse
+		// the metadata model.
+		opts.VisionModel = opts.Model
+		if opts.Provider == ProviderOpenAI {
+			opts.VisionModel = visionModel
+		}
+	}
+	if err := validateReasoningEffort(opts.ReasoningEffort); err != nil {
+		return nil, err
+	}
+	if err := validateVisionOptions(opts); err != nil {
+		return nil, err
+	}
+	if err := validateDestMode(opts.DestMode); err != nil {
+		return nil, err
+	}
+	if opts.MaxContentLength < 0 || opts.MinContentLength < 0 {
+		return nil, fmt.Errorf("content lengths cannot be negative")
+	}
+	if opts.MaxRetries < 0 || opts.RequestTimeout < 0 || opts.RequestsPerMinute < 0 || opts.TokensPerMinute < 0 {
+		return nil, fmt.Errorf("retries, timeouts and rate limits cannot be negative")
+	}
+
+	patterns, err := compileFields(opts.Fields)
+	if err != nil {
+		return nil, err
+	}
+	structured, err := useStructuredOutput(opts)
+	if err != nil {
+		return nil, err
+	}
+	visionOpts := opts
+	visionOpts.Model = opts.VisionModel
+	visionStructured, err := useStructuredOutput(visionOpts)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := newPriceTable(opts.Prices)
+	if err != nil {
+		return nil, err
+	}
+	n := &Namer{opts: opts, patterns: patterns, prices: prices}
+	schema := metadataSchema(opts.Fields)
+	if opts.SelfRating {
+		schema.Properties = append(schema.Properties, SchemaProperty{Name: selfRatingKey, Description: "How sure you are that the metadata is correct, from 0 to 1."})
+	}
+	if structured {
+		n.schema = schema
+	}
+	if visionStructured {
+		n.visionSchema = schema
+	}
+	extra := fieldNames(opts.Fields)
+	if opts.Template != "" {
+		tmpl, err := parseTitleTemplate(opts.Template, extra)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		n.template = tmpl
+	}
+	if opts.Dest != "" {
+		dest, err := parseDestTemplate(opts.Dest, extra)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination: %w", err)
+		}
+		n.dest = dest
+	}
+
+	if opts.Record != "" && opts.Replay != "" {
+		return nil, fmt.Errorf("recording and replaying cannot be combined")
+	}
+	llm := opts.Client
+	switch {
+	case opts.Offline:
+		llm = offlineProvider{}
+	case opts.Replay != "":
+		if llm, err = newReplayProvider(opts.Replay); err != nil {
+			return nil, err
+		}
+	case llm == nil:
+		key, err := resolveAPIKey(opts.Provider, opts.APIKey)
+		if err != nil {
+			return nil, err
+		}
+		if llm, err = newBaseProvider(opts.Provider, key, opts.BaseURL); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Record != "" {
+		if llm, err = newRecordingProvider(llm, opts.Record); err != nil {
+			return nil, err
+		}
+	}
+	n.llm = newRetryingProvider(llm, opts, prices, n.debugf)
+	return n, nil
+}
+
+// Options returns the options of n with defaults filled in.
+func (n *Namer) Options() Options {
+	return n.opts
+}
+
+// Provider returns the model backend with retries and rate limits applied,
+// for requests of your own that should share the limits of n.
+func (n *Namer) Provider() Provider {
+	return n.llm
+}
+
+// Suggest extracts the content and metadata of a file and returns the title
+// it would be renamed to. The file is not touched. Usage is reported even
+// when naming fails.
+func (n *Namer) Suggest(ctx context.Context, path string) (Suggestion, error) {
+	content, err := n.ExtractContent(ctx, path)
+	suggestion := Suggestion{Method: content.Method, Usage: content.Usage}
+	if err != nil {
+		return suggestion, err
+	}
+
+	metadata, usage, err := n.ContentMetadata(ctx, content)
+	suggestion.Usage = suggestion.Usage.Add(usage)
+	if err != nil {
+		return suggestion, fmt.Errorf("title generation failed: %w", err)
+	}
+	suggestion.Metadata = metadata
+	suggestion.Title, _ = n.BuildTitle(metadata)
+	suggestion.Confidence = n.Confidence(content, metadata)
+	return suggestion, nil
+}
+
+// PromptVersion fingerprints the extraction prompts, including a custom
+// prompt and fields, so that caches of model answers can be invalidated when
+// they change. Offline mode has its own version.
+func (n *Namer) PromptVersion() string {
+	fields, _ := json.Marshal(n.opts.Fields)
+	if n.opts.Offline {
+		senders, _ := json.Marshal(n.opts.KnownSenders)
+		sum := sha256.Sum256([]byte("offline\x00" + string(fields) + "\x00" + string(senders)))
+		return hex.EncodeToString(sum[:6])
+	}
+	schema, _ := json.Marshal(n.schema)
+	sum := sha256.Sum256([]byte(n.systemPrompt(false) + "\x00" + n.systemPrompt(true) + "\x00" + string(fields) + "\x00" + string(schema)))
+	return hex.EncodeToString(sum[:6])
+}
+
+// visionModel returns the model used for the image fallback.
+func (n *Namer) visionModel() string {
+	return n.opts.VisionModel
+}
+
+func (n *Namer) logf(format string, args ...any) {
+	if n.opts.Logger != nil {
+		n.opts.Logger.Printf(format, args...)
+	}
+}
+
+func (n *Namer) debugf(format string, args ...any) {
+	if n.opts.Verbose {
+		n.logf(format, args...)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nombratest provides an in-process fake of the OpenAI Chat
+// Completions API, so that code using nombra can be tested end to end
+// without network access or an API key:
+//
+//	server := nombratest.NewServer(func(req nombratest.Request) nombratest.Response {
+//		return nombratest.Response{Content: `{"document_type": "Invoice", "organization": "ACME"}`}
+//	})
+//	defer server.Close()
+//	n, err := nombra.New(nombra.Options{APIKey: "test", BaseURL: server.URL})
+package nombratest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Request is a chat completion request received by the Server.
+type Request struct {
+	Model  string
+	System string
+	// User is the text of the user message.
+	User string
+	// Images are the decoded images of a vision request, in order.
+	Images [][]byte
+	// Detail is the detail level requested for the images.
+	Detail string
+	// Schema is the name of the requested JSON schema response format, if
+	// any.
+	Schema string
+}
+
+// Response is what the Server answers to a Request.
+type Response struct {
+	Content string
+	// Status, when not 0 or 200, fails the request with this HTTP status and
+	// Content as error message.
+	Status int
+	// RetryAfter is sent with failed requests.
+	RetryAfter time.Duration
+	// PromptTokens and CompletionTokens are reported as usage. When both are
+	// 0 they are estimated at four characters per token.
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Server is a fake OpenAI API. Point Options.BaseURL at Server.URL.
+type Server struct {
+	URL string
+
+	server   *httptest.Server
+	reply    func(Request) Response
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewServer starts a Server answering every request with reply, which may
+// be called concurrently.
+func NewServer(reply func(Request) Response) *Server {
+	s := &Server{reply: reply}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Requests returns the requests received so far, in order of arrival.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		writeError(w, http.StatusNotFound, "unknown endpoint "+r.URL.Path, 0)
+		return
+	}
+	var body chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error(), 0)
+		return
+	}
+	req, err := parseRequest(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), 0)
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	resp := s.reply(req)
+	if resp.Status != 0 && resp.Status != http.StatusOK {
+		writeError(w, resp.Status, resp.Content, resp.RetryAfter)
+		return
+	}
+	if resp.PromptTokens == 0 && resp.CompletionTokens == 0 {
+		resp.PromptTokens = (len(req.System) + len(req.User)) / 4
+		for _, image := range req.Images {
+			resp.PromptTokens += len(image) / 4
+		}
+		resp.CompletionTokens = len(resp.Content) / 4
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID:      "chatcmpl-nombratest",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: resp.Content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     resp.PromptTokens,
+			CompletionTokens: resp.CompletionTokens,
+			TotalTokens:      resp.PromptTokens + resp.CompletionTokens,
+		},
+	})
+}
+
+// chatRequest is the part of a chat completion request the Server reads.
+// Message content is a string, or a list of parts for vision requests.
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	ResponseFormat *struct {
+		JSONSchema *struct {
+			Name string `json:"name"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+func parseRequest(body chatRequest) (Request, error) {
+	req := Request{Model: body.Model}
+	if body.ResponseFormat != nil && body.ResponseFormat.JSONSchema != nil {
+		req.Schema = body.ResponseFormat.JSONSchema.Name
+	}
+	for _, message := range body.Messages {
+		var text string
+		var parts []openai.ChatMessagePart
+		if err := json.Unmarshal(message.Content, &text); err != nil {
+			if err := json.Unmarshal(message.Content, &parts); err != nil {
+				return Request{}, fmt.Errorf("invalid %s message: %w", message.Role, err)
+			}
+		}
+		for _, part := range parts {
+			switch part.Type {
+			case openai.ChatMessagePartTypeText:
+				text = part.Text
+			case openai.ChatMessagePartTypeImageURL:
+				image, err := decodeDataURL(part.ImageURL.URL)
+				if err != nil {
+					return Request{}, err
+				}
+				req.Images = append(req.Images, image)
+				req.Detail = string(part.ImageURL.Detail)
+			}
+		}
+		switch message.Role {
+		case openai.ChatMessageRoleSystem:
+			req.System = text
+		case openai.ChatMessageRoleUser:
+			req.User = text
+		}
+	}
+	return req, nil
+}
+
+func decodeDataURL(url string) ([]byte, error) {
+	_, data, ok := strings.Cut(url, ";base64,")
+	if !ok {
+		return nil, fmt.Errorf("image is not a base64 data URL")
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string, retryAfter time.Duration) {
+	w.Header().Set("Content-Type", "application/json")
+	if retryAfter > 0 {
+		w.Header().Set("retry-after-ms", strconv.FormatInt(retryAfter.Milliseconds(), 10))
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": http.StatusText(status), "code": nil},
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Price is what a model costs in USD per million tokens. Reasoning tokens
+// are billed as output.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// DefaultPrices are list prices of common models. Options.Prices overrides
+// or extends them; prices change, so check your provider's pricing page.
+var DefaultPrices = map[string]Price{
+	"gpt-5.4":           {Input: 2.50, Output: 15},
+	"gpt-5.4-pro":       {Input: 30, Output: 180},
+	"gpt-5":             {Input: 1.25, Output: 10},
+	"gpt-5-mini":        {Input: 0.25, Output: 2},
+	"gpt-5-nano":        {Input: 0.05, Output: 0.40},
+	"gpt-5-chat-latest": {Input: 1.25, Output: 10},
+	"gpt-4.1":           {Input: 2, Output: 8},
+	"gpt-4.1-mini":      {Input: 0.40, Output: 1.60},
+	"gpt-4o":            {Input: 2.50, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60},
+	"gpt-4-turbo":       {Input: 10, Output: 30},
+	"gpt-4":             {Input: 30, Output: 60},
+	"gpt-3.5-turbo":     {Input: 0.50, Output: 1.50},
+	"claude-sonnet-4-5": {Input: 3, Output: 15},
+	"claude-haiku-4-5":  {Input: 1, Output: 5},
+	"claude-opus-4-1":   {Input: 15, Output: 75},
+}
+
+// priceTable looks up the price of a model.
+type priceTable map[string]Price
+
+func newPriceTable(overrides map[string]Price) (priceTable, error) {
+	table := priceTable{}
+	for model, price := range DefaultPrices {
+		table[model] = price
+	}
+	for model, price := range overrides {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("price of %s cannot be negative", model)
+		}
+		table[model] = price
+	}
+	return table, nil
+}
+
+// lookup returns the price of model, or of the longest known name it
+// starts with, so that dated snapshots such as gpt-4o-2024-08-06 are found.
+func (t priceTable) lookup(model string) (Price, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+	best, found := "", false
+	for name := range t {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best, found = name, true
+		}
+	}
+	return t[best], found
+}
+
+// cost sets the cost of usage spent on model, when the price is known.
+func (t priceTable) cost(model string, usage Usage) Usage {
+	if price, ok := t.lookup(model); ok {
+		usage.Cost = (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6
+	}
+	return usage
+}
+
+// Price returns the price used for model and whether one is known. Costs of
+// models without a price are reported as 0.
+func (n *Namer) Price(model string) (Price, bool) {
+	return n.prices.lookup(model)
+}
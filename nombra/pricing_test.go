@@ -0,0 +1,52 @@
+package nombra
+
+import (
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestPriceTableLookup(t *testing.T) {
+	table, err := newPriceTable(map[string]Price{"llama3": {}, "gpt-4o": {Input: 5, Output: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		model string
+		want  Price
+		found bool
+	}{
+		{"gpt-4o-mini", DefaultPrices["gpt-4o-mini"], true},
+		{"gpt-4o-mini-2024-07-18", DefaultPrices["gpt-4o-mini"], true},
+		{"gpt-4o-2024-08-06", Price{Input: 5, Output: 20}, true},
+		{"llama3", Price{}, true},
+		{"mistral", Price{}, false},
+	} {
+		if got, found := table.lookup(tc.model); got != tc.want || found != tc.found {
+			t.Errorf("lookup(%q) = %v, %v; want %v, %v", tc.model, got, found, tc.want, tc.found)
+		}
+	}
+
+	usage := table.cost("gpt-4o", Usage{PromptTokens: 2000, CompletionTokens: 500, TotalTokens: 2500})
+	if usage.Cost != 0.02 {
+		t.Errorf("cost = %v; want 0.02", usage.Cost)
+	}
+	if _, err := newPriceTable(map[string]Price{"x": {Input: -1}}); err == nil {
+		t.Error("negative price accepted")
+	}
+}
+
+func TestOpenAIUsageReasoningTokens(t *testing.T) {
+	got := openAIUsage(openai.Usage{
+		PromptTokens:            100,
+		CompletionTokens:        60,
+		TotalTokens:             160,
+		CompletionTokensDetails: &openai.CompletionTokensDetails{ReasoningTokens: 40},
+	})
+	if got.ReasoningTokens != 40 || got.CompletionTokens != 60 {
+		t.Errorf("openAIUsage() = %+v", got)
+	}
+	if sum := got.Add(got); sum.ReasoningTokens != 80 || sum.TotalTokens != 320 {
+		t.Errorf("Add() = %+v", sum)
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Providers accepted in Options.Provider.
+const (
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai-compatible"
+	ProviderAnthropic        = "anthropic"
+)
+
+var validProviders = []string{ProviderOpenAI, ProviderOpenAICompatible, ProviderAnthropic}
+
+// Provider is the language model backend used to extract metadata from
+// document text and to describe rendered page images. Options.Client accepts
+// any implementation, for example a fake in tests.
+type Provider interface {
+	// Complete sends a system prompt and document text and returns the raw reply.
+	Complete(ctx context.Context, req CompletionRequest) (Completion, error)
+	// DescribeImage sends images with instructions and returns the raw reply.
+	DescribeImage(ctx context.Context, req ImageRequest) (Completion, error)
+}
+
+// Completion is a model reply together with the tokens it consumed.
+type Completion struct {
+	Content string
+	Usage   Usage
+}
+
+// Usage counts the tokens of one or more model calls and what they cost.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// ReasoningTokens are the part of CompletionTokens spent on reasoning.
+	ReasoningTokens int `json:"reasoning_tokens"`
+	TotalTokens     int `json:"total_tokens"`
+	// Cost is in USD, from the price table of the Namer. Calls to models
+	// without a known price cost 0.
+	Cost float64 `json:"cost_usd"`
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		ReasoningTokens:  u.ReasoningTokens + other.ReasoningTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+		Cost:             u.Cost + other.Cost,
+	}
+}
+
+// CompletionRequest asks for a text reply to a system prompt and document text.
+type CompletionRequest struct {
+	Model  string
+	System string
+	User   string
+	// ReasoningEffort applies to GPT-5 models: none, low, medium, high or xhigh.
+	ReasoningEffort string
+	// Schema, when set, is the structure the reply must follow. Providers
+	// supporting structured outputs pass it on to the model; the reply is
+	// validated against it either way.
+	Schema *ResponseSchema
+}
+
+// ImageRequest asks for a text reply about one or more images, such as the
+// selected pages of a scan.
+type ImageRequest struct {
+	Model  string
+	System string
+	Prompt string
+	Images []Image
+	// Detail is one of the VisionDetail constants. Providers without such a
+	// setting ignore it.
+	Detail string
+	// Schema is the structure the reply must follow, as in CompletionRequest.
+	Schema *ResponseSchema
+}
+
+func validateProvider(name string) error {
+	for _, v := range validProviders {
+		if name == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid provider %q. valid providers: %s", name, strings.Join(validProviders, ", "))
+}
+
+// resolveAPIKey returns the given key or the environment variable used by the
+// provider. Only OpenAI-compatible servers may run without a key.
+func resolveAPIKey(providerName, key string) (string, error) {
+	if key != "" {
+		return key, nil
+	}
+
+	switch providerName {
+	case ProviderAnthropic:
+		key = os.Getenv("ANTHROPIC_API_KEY")
+		if key == "" {
+			return "", fmt.Errorf("API key required. Set ANTHROPIC_API_KEY or pass a key")
+		}
+	case ProviderOpenAICompatible:
+		key = os.Getenv("OPENAI_API_KEY")
+	default:
+		key = os.Getenv("OPENAI_API_KEY")
+		if key == "" {
+			return "", fmt.Errorf("API key required. Set OPENAI_API_KEY or pass a key")
+		}
+	}
+	return key, nil
+}
+
+// newBaseProvider builds the client for a provider. An empty baseURL keeps
+// the provider's public endpoint.
+func newBaseProvider(name, apiKey, baseURL string) (Provider, error) {
+	switch name {
+	case ProviderOpenAI, ProviderOpenAICompatible:
+		if name == ProviderOpenAICompatible && baseURL == "" {
+			return nil, fmt.Errorf("a base URL is required with provider %s", ProviderOpenAICompatible)
+		}
+		config := openai.DefaultConfig(apiKey)
+		config.HTTPClient = headerCapturingClient{client: &http.Client{}}
+		if baseURL != "" {
+			config.BaseURL = strings.TrimRight(baseURL, "/")
+		}
+		return &openAIProvider{client: openai.NewClientWithConfig(config)}, nil
+	case ProviderAnthropic:
+		return newAnthropicProvider(apiKey, baseURL), nil
+	default:
+		return nil, validateProvider(name)
+	}
+}
+
+// openAIProvider talks to the OpenAI Chat Completions API or to any server
+// implementing it, such as Ollama, llama.cpp server or vLLM.
+type openAIProvider struct {
+	client *openai.Client
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	chatReq := openai.ChatCompletionRequest{
+		Model: req.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: req.System,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: req.User,
+			},
+		},
+	}
+
+	if isGPT5Model(req.Model) {
+		effort := strings.ToLower(cmp.Or(req.ReasoningEffort, "none"))
+		chatReq.ReasoningEffort = effort
+		// GPT-5.4 supports temperature/top_p only when reasoning effort is "none".
+		if effort == "none" {
+			chatReq.Temperature = 0
+		}
+	} else {
+		chatReq.Temperature = 0
+	}
+	if req.Schema != nil {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   req.Schema.Name,
+				Schema: req.Schema,
+				Strict: true,
+			},
+		}
+	}
+
+	var retryAfter time.Duration
+	resp, err := p.client.CreateChatCompletion(context.WithValue(ctx, retryAfterKey{}, &retryAfter), chatReq)
+	if err != nil {
+		return Completion{}, fmt.Errorf("OpenAI metadata extraction error: %w", openAIError(err, retryAfter))
+	}
+	if len(resp.Choices) > 0 && resp.Choices[0].Message.Refusal != "" {
+		return Completion{Usage: openAIUsage(resp.Usage)}, fmt.Errorf("OpenAI refused metadata extraction: %s", resp.Choices[0].Message.Refusal)
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return Completion{}, fmt.Errorf("empty response from OpenAI metadata extraction")
+	}
+	return Completion{Content: resp.Choices[0].Message.Content, Usage: openAIUsage(resp.Usage)}, nil
+}
+
+func (p *openAIProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	parts := []openai.ChatMessagePart{{
+		Type: openai.ChatMessagePartTypeText,
+		Text: req.Prompt,
+	}}
+	for _, image := range req.Images {
+		parts = append(parts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL:    "data:" + image.MimeType + ";base64," + base64.StdEncoding.EncodeToString(image.Data),
+				Detail: openai.ImageURLDetail(cmp.Or(req.Detail, VisionDetailHigh)),
+			},
+		})
+	}
+	chatReq := openai.ChatCompletionRequest{
+		Model: req.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: req.System,
+			},
+			{
+				Role:         openai.ChatMessageRoleUser,
+				MultiContent: parts,
+			},
+		},
+	}
+	// GPT-5 models only accept the default temperature here.
+	if !isGPT5Model(req.Model) {
+		chatReq.Temperature = 0.2
+	}
+	if req.Schema != nil {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   req.Schema.Name,
+				Schema: req.Schema,
+				Strict: true,
+			},
+		}
+	}
+
+	var retryAfter time.Duration
+	resp, err := p.client.CreateChatCompletion(context.WithValue(ctx, retryAfterKey{}, &retryAfter), chatReq)
+	if err != nil {
+		return Completion{}, fmt.Errorf("OpenAI vision API error: %w", openAIError(err, retryAfter))
+	}
+
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return Completion{}, fmt.Errorf("empty response from OpenAI vision API")
+	}
+	return Completion{Content: resp.Choices[0].Message.Content, Usage: openAIUsage(resp.Usage)}, nil
+}
+
+// openAIError attaches the HTTP status and Retry-After to an error of the
+// OpenAI client so the retry logic can classify it.
+func openAIError(err error, retryAfter time.Duration) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		code, _ := apiErr.Code.(string)
+		return &apiError{status: apiErr.HTTPStatusCode, code: code, retryAfter: retryAfter, err: err}
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return &apiError{status: reqErr.HTTPStatusCode, retryAfter: retryAfter, err: err}
+	}
+	return err
+}
+
+func openAIUsage(usage openai.Usage) Usage {
+	u := Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	if usage.CompletionTokensDetails != nil {
+		u.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	return u
+}
+
+// validModels lists the OpenAI models that can be used with the OpenAI provider.
+// The slice is used for validating user input and constructing helpful error
+// messages when an unsupported model is supplied.
+var validModels = []string{
+	"gpt-5.4",
+	"gpt-5.4-pro",
+	"gpt-5-mini",
+	"gpt-5-nano",
+	"gpt-5-chat-latest",
+	openai.GPT3Dot5Turbo,
+	openai.GPT3Dot5Turbo0125,
+	openai.GPT3Dot5Turbo1106,
+	openai.GPT3Dot5Turbo16K,
+	openai.GPT4Turbo,
+	openai.GPT4Turbo0125,
+	openai.GPT4Turbo1106,
+	openai.GPT4TurboPreview,
+	openai.GPT4Turbo20240409,
+	openai.GPT4,
+	openai.GPT4o,
+	openai.GPT4oMini,
+	openai.GPT4VisionPreview,
+}
+
+var validReasoningEfforts = map[string]struct{}{
+	"none":   {},
+	"low":    {},
+	"medium": {},
+	"high":   {},
+	"xhigh":  {},
+}
+
+// validateModel ensures the provided model is one of the supported values.
+// It returns an error listing the allowed models when validation fails.
+func validateModel(m string) error {
+	for _, v := range validModels {
+		if m == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid model %q. valid models: %s", m, strings.Join(validModels, ", "))
+}
+
+func validateReasoningEffort(effort string) error {
+	e := strings.TrimSpace(strings.ToLower(effort))
+	if _, ok := validReasoningEfforts[e]; ok {
+		return nil
+	}
+
+	allowed := []string{"none", "low", "medium", "high", "xhigh"}
+	return fmt.Errorf("invalid reasoning effort %q. valid values: %s", effort, strings.Join(allowed, ", "))
+}
+
+func isGPT5Model(name string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(name)), "gpt-5")
+}
@@ -0,0 +1,82 @@
+package nombra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateProvider(t *testing.T) {
+	for _, name := range validProviders {
+		if err := validateProvider(name); err != nil {
+			t.Errorf("validateProvider(%q) returned error: %v", name, err)
+		}
+	}
+	if err := validateProvider("bard"); err == nil {
+		t.Fatalf("expected error for invalid provider")
+	}
+}
+
+func TestResolveAPIKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+
+	if _, err := resolveAPIKey(ProviderOpenAI, ""); err == nil {
+		t.Errorf("expected error for missing OpenAI key")
+	}
+	if _, err := resolveAPIKey(ProviderAnthropic, ""); err == nil {
+		t.Errorf("expected error for missing Anthropic key")
+	}
+	if _, err := resolveAPIKey(ProviderOpenAICompatible, ""); err != nil {
+		t.Errorf("OpenAI-compatible provider should not require a key: %v", err)
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "env-key")
+	if key, _ := resolveAPIKey(ProviderAnthropic, ""); key != "env-key" {
+		t.Errorf("resolveAPIKey(anthropic) = %q; want env-key", key)
+	}
+	if key, _ := resolveAPIKey(ProviderAnthropic, "flag-key"); key != "flag-key" {
+		t.Errorf("resolveAPIKey(anthropic) = %q; want flag-key", key)
+	}
+}
+
+func TestAnthropicProviderComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("missing API key header")
+		}
+
+		var req anthropicMessagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.System != "system prompt" || req.Messages[0].Content[0].Text != "document text" {
+			t.Errorf("unexpected request: %+v", req)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"{\"title\":\"Invoice\"}"}],"usage":{"input_tokens":12,"output_tokens":5}}`))
+	}))
+	defer server.Close()
+
+	llm := newAnthropicProvider("test-key", server.URL)
+	got, err := llm.Complete(context.Background(), CompletionRequest{
+		Model:  DefaultAnthropicModel,
+		System: "system prompt",
+		User:   "document text",
+	})
+	if err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	if got.Content != `{"title":"Invoice"}` {
+		t.Fatalf("complete() = %q", got.Content)
+	}
+	if got.Usage.TotalTokens != 17 {
+		t.Fatalf("complete() usage = %+v; want 17 total tokens", got.Usage)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRecorded is returned in replay mode for requests that were never
+// recorded.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// recordedRequest is the normalized form of a request. Its hash names the
+// recording, so requests that differ only in whitespace or letter case of
+// the model share one.
+type recordedRequest struct {
+	Kind            string          `json:"kind"`
+	Model           string          `json:"model"`
+	System          string          `json:"system"`
+	User            string          `json:"user,omitempty"`
+	ReasoningEffort string          `json:"reasoning_effort,omitempty"`
+	Schema          json.RawMessage `json:"schema,omitempty"`
+	// Image lists the SHA-256 of each image of an image request.
+	Image    string `json:"image_sha256,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// recording is the file written for a request and its reply.
+type recording struct {
+	Request  recordedRequest `json:"request"`
+	Response struct {
+		Content string `json:"content"`
+		Usage   Usage  `json:"usage"`
+	} `json:"response"`
+}
+
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func completionRecord(req CompletionRequest) recordedRequest {
+	record := recordedRequest{
+		Kind:            "completion",
+		Model:           strings.ToLower(strings.TrimSpace(req.Model)),
+		System:          normalizeText(req.System),
+		User:            normalizeText(req.User),
+		ReasoningEffort: strings.ToLower(cmp.Or(req.ReasoningEffort, "none")),
+	}
+	if req.Schema != nil {
+		record.Schema, _ = json.Marshal(req.Schema)
+	}
+	return record
+}
+
+func imageRecord(req ImageRequest) recordedRequest {
+	sums := make([]string, len(req.Images))
+	mimeTypes := make([]string, len(req.Images))
+	for i, image := range req.Images {
+		sum := sha256.Sum256(image.Data)
+		sums[i], mimeTypes[i] = hex.EncodeToString(sum[:]), image.MimeType
+	}
+	record := recordedRequest{
+		Kind:     "image",
+		Model:    strings.ToLower(strings.TrimSpace(req.Model)),
+		System:   normalizeText(req.System),
+		User:     normalizeText(req.Prompt),
+		Image:    strings.Join(sums, ","),
+		MimeType: strings.Join(mimeTypes, ","),
+		Detail:   strings.ToLower(req.Detail),
+	}
+	if req.Schema != nil {
+		record.Schema, _ = json.Marshal(req.Schema)
+	}
+	return record
+}
+
+// key names the recording of r.
+func (r recordedRequest) key() string {
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// recordingProvider saves every successful reply of next in dir.
+type recordingProvider struct {
+	next Provider
+	dir  string
+}
+
+func newRecordingProvider(next Provider, dir string) (*recordingProvider, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create recording directory: %w", err)
+	}
+	return &recordingProvider{next: next, dir: dir}, nil
+}
+
+func (p *recordingProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	reply, err := p.next.Complete(ctx, req)
+	if err == nil {
+		err = p.save(completionRecord(req), reply)
+	}
+	return reply, err
+}
+
+func (p *recordingProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	reply, err := p.next.DescribeImage(ctx, req)
+	if err == nil {
+		err = p.save(imageRecord(req), reply)
+	}
+	return reply, err
+}
+
+// save writes the recording through a temporary file so that concurrent
+// identical requests and interrupted runs never leave partial files.
+func (p *recordingProvider) save(req recordedRequest, reply Completion) error {
+	var rec recording
+	rec.Request = req
+	rec.Response.Content = reply.Content
+	rec.Response.Usage = reply.Usage
+	rec.Response.Usage.Cost = 0
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(p.dir, ".recording-*")
+	if err != nil {
+		return fmt.Errorf("cannot record response: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot record response: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot record response: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(p.dir, req.key()+".json")); err != nil {
+		return fmt.Errorf("cannot record response: %w", err)
+	}
+	return nil
+}
+
+// replayProvider answers requests from the recordings in dir without
+// contacting any model.
+type replayProvider struct {
+	dir string
+}
+
+func newReplayProvider(dir string) (*replayProvider, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recordings: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("recordings %s is not a directory", dir)
+	}
+	return &replayProvider{dir: dir}, nil
+}
+
+func (p *replayProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	return p.load(completionRecord(req))
+}
+
+func (p *replayProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	return p.load(imageRecord(req))
+}
+
+func (p *replayProvider) load(req recordedRequest) (Completion, error) {
+	key := req.key()
+	data, err := os.ReadFile(filepath.Join(p.dir, key+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Completion{}, fmt.Errorf("%w for %s request %s to %s in %s", ErrNotRecorded, req.Kind, key, req.Model, p.dir)
+	}
+	if err != nil {
+		return Completion{}, fmt.Errorf("cannot read recording: %w", err)
+	}
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Completion{}, fmt.Errorf("invalid recording %s: %w", key, err)
+	}
+	return Completion{Content: rec.Response.Content, Usage: rec.Response.Usage}, nil
+}
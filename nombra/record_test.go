@@ -0,0 +1,143 @@
+package nombra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rtyx/nombra/nombra/nombratest"
+)
+
+func TestRecordedRequestKey(t *testing.T) {
+	a := completionRecord(CompletionRequest{Model: "GPT-5.4", System: "Extract  metadata.", User: "Invoice\n\nACME "})
+	b := completionRecord(CompletionRequest{Model: "gpt-5.4", System: "Extract metadata.", User: "Invoice ACME", ReasoningEffort: "none"})
+	if a.key() != b.key() {
+		t.Error("requests differing only in whitespace, case and defaults have different keys")
+	}
+	c := completionRecord(CompletionRequest{Model: "gpt-5.4", System: "Extract metadata.", User: "Invoice Initech"})
+	if a.key() == c.key() {
+		t.Error("different requests have the same key")
+	}
+	page := func(data string) Image { return Image{Data: []byte(data), MimeType: "image/png"} }
+	image := imageRecord(ImageRequest{Model: "gpt-4o-mini", Prompt: "Invoice ACME", Images: []Image{page("png")}})
+	for _, other := range []ImageRequest{
+		{Model: "gpt-4o-mini", Prompt: "Invoice ACME", Images: []Image{page("jpg")}},
+		{Model: "gpt-4o-mini", Prompt: "Invoice ACME", Images: []Image{page("png"), page("jpg")}},
+		{Model: "gpt-4o-mini", Prompt: "Invoice ACME", Images: []Image{page("png")}, Detail: VisionDetailLow},
+	} {
+		if image.key() == a.key() || image.key() == imageRecord(other).key() {
+			t.Errorf("image requests share keys: %+v", other)
+		}
+	}
+}
+
+// TestSuggestRecordAndReplay runs the whole pipeline against the fake
+// OpenAI server, including a rate limited first attempt, and repeats it
+// from the recordings after the server is gone.
+func TestSuggestRecordAndReplay(t *testing.T) {
+	var calls atomic.Int32
+	server := nombratest.NewServer(func(req nombratest.Request) nombratest.Response {
+		if calls.Add(1) == 1 {
+			return nombratest.Response{Status: http.StatusTooManyRequests, Content: "Rate limit reached", RetryAfter: 10 * time.Millisecond}
+		}
+		return nombratest.Response{Content: completeMetadata, PromptTokens: 500, CompletionTokens: 50}
+	})
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "scan.txt")
+	if err := os.WriteFile(path, []byte("Invoice from ACME for consulting services"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	opts := Options{APIKey: "test", BaseURL: server.URL, Record: dir, MaxRetries: 2, MinContentLength: 10}
+	recorder, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := recorder.Suggest(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Suggest() returned error: %v", err)
+	}
+	requests := server.Requests()
+	if len(requests) != 2 || requests[1].Model != DefaultModel || requests[1].Schema == "" || !strings.Contains(requests[1].User, "consulting services") {
+		t.Fatalf("server received %+v", requests)
+	}
+	if recorded.Title == "" || recorded.Usage.TotalTokens != 550 || recorded.Usage.Cost == 0 {
+		t.Errorf("recorded suggestion = %+v", recorded)
+	}
+	server.Close()
+
+	opts.Record, opts.Replay, opts.APIKey, opts.BaseURL = "", dir, "", ""
+	t.Setenv("OPENAI_API_KEY", "")
+	replayer, err := New(opts)
+	if err != nil {
+		t.Fatalf("New() in replay mode returned error: %v", err)
+	}
+	replayed, err := replayer.Suggest(context.Background(), path)
+	if err != nil {
+		t.Fatalf("replayed Suggest() returned error: %v", err)
+	}
+	if replayed.Title != recorded.Title || replayed.Usage != recorded.Usage {
+		t.Errorf("replayed %+v, recorded %+v", replayed, recorded)
+	}
+
+	if err := os.WriteFile(path, []byte("Contract between ACME and Initech"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replayer.Suggest(context.Background(), path); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("Suggest() of an unrecorded request = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestVisionMetadataAgainstFakeServer(t *testing.T) {
+	server := nombratest.NewServer(func(req nombratest.Request) nombratest.Response {
+		return nombratest.Response{Content: fmt.Sprintf(`{"date":"2024.03.01","language":"English","title":"","document_type":"Lease","organization":%q,"author":"","recipient":"","topic":""}`, req.Images[len(req.Images)-1])}
+	})
+	defer server.Close()
+
+	n, err := New(Options{APIKey: "test", BaseURL: server.URL, VisionDetail: "LOW"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := []Image{{Data: []byte("page one"), MimeType: "image/png"}, {Data: []byte("Thames Water"), MimeType: "image/png"}}
+	content, err := n.visionMetadata(context.Background(), pages, describePages([]int{1, 3}, 3))
+	if err != nil {
+		t.Fatalf("visionMetadata returned error: %v", err)
+	}
+	if content.Metadata == nil || content.Metadata.Organization != "Thames Water" || content.Usage.TotalTokens == 0 {
+		t.Fatalf("content = %+v", content)
+	}
+	if want := "date: 2024.03.01\nlanguage: English\ndocument_type: Lease\norganization: Thames Water\n"; content.Text != want {
+		t.Errorf("text = %q, want %q", content.Text, want)
+	}
+	metadata, usage, err := n.ContentMetadata(context.Background(), content)
+	if err != nil || !reflect.DeepEqual(metadata, *content.Metadata) || usage.TotalTokens != 0 {
+		t.Errorf("ContentMetadata = %+v, %+v, %v; want the vision metadata without another request", metadata, usage, err)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests", len(requests))
+	}
+	req := requests[0]
+	if req.Model != visionModel || len(req.Images) != 2 || req.Detail != VisionDetailLow || req.Schema == "" || req.User != "Pages 1 and 3 of 3 of a scanned PDF, in order." {
+		t.Errorf("server received %+v", req)
+	}
+}
+
+func TestNewRejectsRecordWithReplay(t *testing.T) {
+	if _, err := New(Options{Client: &flakyProvider{}, Record: t.TempDir(), Replay: t.TempDir()}); err == nil {
+		t.Error("New() accepted Record and Replay together")
+	}
+	if _, err := New(Options{Replay: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("New() accepted a missing replay directory")
+	}
+}
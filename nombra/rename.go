@@ -0,0 +1,99 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Rename moves or copies a file to the name built from title and returns the
+// new path. With Options.Dest the file goes into the directory rendered from
+// metadata, which is created as needed. Existing files are never overwritten.
+func (n *Namer) Rename(ctx context.Context, originalPath, title string, metadata Metadata) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Sanitize title and prepare new filename
+	cleanTitle := sanitizeFilename(title)
+	if cleanTitle == "" {
+		return "", fmt.Errorf("generated title results in invalid filename")
+	}
+
+	newPath := n.ProposedPath(originalPath, cleanTitle, metadata)
+	dir := filepath.Dir(newPath)
+	ext := filepath.Ext(originalPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("could not create destination directory: %w", err)
+	}
+
+	place, action := MoveFile, "rename"
+	if n.opts.DestMode == DestModeCopy {
+		place, action = CopyFile, "copy"
+	}
+
+	// Both place functions fail rather than overwrite, so a name taken by
+	// another worker in the meantime just moves on to the next counter.
+	for {
+		err := place(originalPath, newPath)
+		if err == nil {
+			return newPath, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", fmt.Errorf("could not %s file: %w", action, err)
+		}
+		newPath = generateUniqueName(dir, cleanTitle, ext)
+	}
+}
+
+// ProposedPath is the path Rename gives the file, before a counter is added
+// to avoid clashing with an existing file.
+func (n *Namer) ProposedPath(originalPath, title string, metadata Metadata) string {
+	path := buildProposedPath(originalPath, title)
+	if n.dest == nil {
+		return path
+	}
+	return filepath.Join(n.dest.dir(metadata), filepath.Base(path))
+}
+
+func buildProposedPath(originalPath, title string) string {
+	dir := filepath.Dir(originalPath)
+	ext := filepath.Ext(originalPath)
+	baseName := sanitizeFilename(title) + ext
+	if len(baseName) > maxFilenameLength {
+		baseName = baseName[:maxFilenameLength-len(ext)] + ext
+	}
+	return filepath.Join(dir, baseName)
+}
+
+// generateUniqueName creates a unique filename by appending an incremental counter
+// to the base name until an unused filename is found in the specified directory.
+func generateUniqueName(dir, baseName, ext string) string {
+	counter := 1
+	pattern := filepath.Join(dir, baseName+"-%d"+ext)
+
+	for {
+		candidate := fmt.Sprintf(pattern, counter)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		counter++
+	}
+}
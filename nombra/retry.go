@@ -0,0 +1,349 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries and DefaultRequestTimeout are the settings of the
+	// nombra command; zero Options disable retries and timeouts.
+	DefaultMaxRetries     = 5
+	DefaultRequestTimeout = 2 * time.Minute
+	retryBaseDelay        = time.Second
+	retryMaxDelay         = time.Minute
+
+	// imageTokenEstimate is what a rendered page costs against the tokens per
+	// minute limit before the real usage is known.
+	imageTokenEstimate = 1000
+	// completionTokenEstimate is the reply's share of that estimate; metadata
+	// replies stay well below it with any provider.
+	completionTokenEstimate = 1024
+)
+
+// apiError is an HTTP error returned by a provider, with the delay the server
+// asked for in Retry-After.
+type apiError struct {
+	status     int
+	code       string
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+func (e *apiError) Unwrap() error { return e.err }
+
+// retryable reports whether err is worth another attempt and how long the
+// server asked to wait, 0 when it did not say.
+func retryable(err error) (bool, time.Duration) {
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		return true, 0
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		if apiErr.code == "insufficient_quota" {
+			return false, 0
+		}
+		ok := apiErr.status == http.StatusTooManyRequests || apiErr.status == http.StatusRequestTimeout || apiErr.status >= 500
+		return ok, apiErr.retryAfter
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, 0
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr), 0
+}
+
+// parseRetryAfter reads retry-after-ms or Retry-After (seconds or HTTP date).
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// backoff returns the delay before retry number attempt (starting at 1):
+// exponential with jitter, or the server's Retry-After when that is longer.
+func backoff(attempt int, base, limit, retryAfter time.Duration) time.Duration {
+	delay := base << (attempt - 1)
+	if delay > limit || delay <= 0 {
+		delay = limit
+	}
+	delay = delay/2 + time.Duration(rand.Int64N(int64(delay/2)+1))
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+// tokenBucket refills continuously up to capacity. reserve takes n units
+// immediately, possibly going negative, and returns how long the caller must
+// wait until the debt is repaid. A nil bucket never waits.
+type tokenBucket struct {
+	capacity  float64
+	available float64
+	perSecond float64
+	last      time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity:  float64(perMinute),
+		available: float64(perMinute),
+		perSecond: float64(perMinute) / 60,
+	}
+}
+
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	b.available -= min(n, b.capacity)
+	if b.available >= 0 {
+		return 0
+	}
+	return time.Duration(-b.available / b.perSecond * float64(time.Second))
+}
+
+// adjust corrects an earlier reservation once the real amount is known.
+func (b *tokenBucket) adjust(now time.Time, delta float64) {
+	if b == nil {
+		return
+	}
+	b.refill(now)
+	b.available -= delta
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.available = min(b.capacity, b.available+now.Sub(b.last).Seconds()*b.perSecond)
+	}
+	b.last = now
+}
+
+// rateLimiter enforces the requests and tokens per minute limits across
+// all workers, and holds everyone back after a 429 with Retry-After.
+type rateLimiter struct {
+	mu        sync.Mutex
+	requests  *tokenBucket
+	tokens    *tokenBucket
+	pausedTil time.Time
+}
+
+func newRateLimiter(requestsPerMinute, tokensPerMinute int) *rateLimiter {
+	return &rateLimiter{
+		requests: newTokenBucket(requestsPerMinute),
+		tokens:   newTokenBucket(tokensPerMinute),
+	}
+}
+
+// reserve books a request estimated at tokens and returns how long to wait
+// before sending it.
+func (l *rateLimiter) reserve(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	return max(l.requests.reserve(now, 1), l.tokens.reserve(now, float64(tokens)), l.pausedTil.Sub(now))
+}
+
+func (l *rateLimiter) settle(estimated, actual int) {
+	if actual <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.adjust(time.Now(), float64(actual-estimated))
+}
+
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedTil) {
+		l.pausedTil = until
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryingProvider adds rate limiting, per-request timeouts and retries with
+// backoff to another provider.
+type retryingProvider struct {
+	next       Provider
+	limiter    *rateLimiter
+	maxRetries int
+	timeout    time.Duration
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	prices     priceTable
+	debugf     func(format string, args ...any)
+}
+
+func newRetryingProvider(next Provider, opts Options, prices priceTable, debugf func(format string, args ...any)) *retryingProvider {
+	return &retryingProvider{
+		next:       next,
+		limiter:    newRateLimiter(opts.RequestsPerMinute, opts.TokensPerMinute),
+		maxRetries: opts.MaxRetries,
+		timeout:    opts.RequestTimeout,
+		baseDelay:  retryBaseDelay,
+		maxDelay:   retryMaxDelay,
+		prices:     prices,
+		debugf:     debugf,
+	}
+}
+
+func (p *retryingProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	estimate := (len(req.System)+len(req.User))/4 + completionTokenEstimate
+	reply, err := p.do(ctx, estimate, func(ctx context.Context) (Completion, error) {
+		reply, err := p.next.Complete(ctx, req)
+		if err == nil && req.Schema != nil {
+			err = req.Schema.Validate(reply.Content)
+		}
+		return reply, err
+	})
+	reply.Usage = p.account(req.Model, reply.Usage)
+	return reply, err
+}
+
+func (p *retryingProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	estimate := (len(req.System)+len(req.Prompt))/4 + len(req.Images)*imageTokenEstimate + completionTokenEstimate
+	reply, err := p.do(ctx, estimate, func(ctx context.Context) (Completion, error) {
+		reply, err := p.next.DescribeImage(ctx, req)
+		if err == nil && req.Schema != nil {
+			err = req.Schema.Validate(reply.Content)
+		}
+		return reply, err
+	})
+	reply.Usage = p.account(req.Model, reply.Usage)
+	return reply, err
+}
+
+// account prices the usage of all attempts of one call and logs it.
+func (p *retryingProvider) account(model string, usage Usage) Usage {
+	if usage.TotalTokens == 0 {
+		return usage
+	}
+	usage = p.prices.cost(model, usage)
+	p.logf("%s: %d prompt, %d completion (%d reasoning) tokens, $%.4f", model, usage.PromptTokens, usage.CompletionTokens, usage.ReasoningTokens, usage.Cost)
+	return usage
+}
+
+func (p *retryingProvider) do(ctx context.Context, estimate int, call func(context.Context) (Completion, error)) (Completion, error) {
+	var usage Usage
+	for attempt := 0; ; attempt++ {
+		if delay := p.limiter.reserve(estimate); delay > 0 {
+			p.logf("Rate limit: waiting %s", delay.Round(time.Millisecond))
+			if err := sleepContext(ctx, delay); err != nil {
+				return Completion{Usage: usage}, err
+			}
+		}
+
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		}
+		reply, err := call(callCtx)
+		cancel()
+		p.limiter.settle(estimate, reply.Usage.TotalTokens)
+		usage = usage.Add(reply.Usage)
+		if err == nil {
+			reply.Usage = usage
+			return reply, nil
+		}
+
+		retry, retryAfter := retryable(err)
+		if !retry || ctx.Err() != nil || attempt >= p.maxRetries {
+			if attempt > 0 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return Completion{Usage: usage}, err
+		}
+		if retryAfter > 0 {
+			p.limiter.pause(retryAfter)
+		}
+
+		delay := backoff(attempt+1, p.baseDelay, p.maxDelay, retryAfter)
+		var schemaErr *SchemaError
+		if errors.As(err, &schemaErr) {
+			// The server is fine, only the answer was malformed.
+			delay = 0
+		}
+		p.logf("Request failed (%v); retrying in %s (%d/%d)", err, delay.Round(time.Millisecond), attempt+1, p.maxRetries)
+		if err := sleepContext(ctx, delay); err != nil {
+			return Completion{Usage: usage}, err
+		}
+	}
+}
+
+func (p *retryingProvider) logf(format string, args ...any) {
+	if p.debugf != nil {
+		p.debugf(format, args...)
+	}
+}
+
+// retryAfterKey carries a *time.Duration through the request context so the
+// OpenAI client, which hides response headers, can report Retry-After.
+type retryAfterKey struct{}
+
+// headerCapturingClient records Retry-After of error responses for the
+// request's context.
+type headerCapturingClient struct {
+	client *http.Client
+}
+
+func (c headerCapturingClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err == nil && resp.StatusCode >= 400 {
+		if target, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*target = parseRetryAfter(resp.Header)
+		}
+	}
+	return resp, err
+}
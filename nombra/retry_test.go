@@ -0,0 +1,183 @@
+package nombra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyProvider fails with the queued errors before succeeding.
+type flakyProvider struct {
+	errs  []error
+	calls int
+}
+
+func (f *flakyProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return Completion{}, err
+	}
+	return Completion{Content: "ok", Usage: Usage{TotalTokens: 10}}, nil
+}
+
+func (f *flakyProvider) DescribeImage(ctx context.Context, req ImageRequest) (Completion, error) {
+	return f.Complete(ctx, CompletionRequest{})
+}
+
+func testRetryingProvider(next Provider) *retryingProvider {
+	return &retryingProvider{
+		next:       next,
+		limiter:    newRateLimiter(0, 0),
+		maxRetries: 3,
+		baseDelay:  time.Millisecond,
+		maxDelay:   5 * time.Millisecond,
+	}
+}
+
+func TestRetryingProviderRetriesTransientErrors(t *testing.T) {
+	flaky := &flakyProvider{errs: []error{
+		&apiError{status: http.StatusTooManyRequests, err: errors.New("rate limited")},
+		&apiError{status: http.StatusBadGateway, err: errors.New("bad gateway")},
+		context.DeadlineExceeded,
+	}}
+	got, err := testRetryingProvider(flaky).Complete(context.Background(), CompletionRequest{})
+	if err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	if got.Content != "ok" || flaky.calls != 4 {
+		t.Errorf("complete() = %+v after %d calls; want ok after 4", got, flaky.calls)
+	}
+}
+
+func TestRetryingProviderStopsOnPermanentErrors(t *testing.T) {
+	for _, err := range []error{
+		&apiError{status: http.StatusBadRequest, err: errors.New("bad request")},
+		&apiError{status: http.StatusTooManyRequests, code: "insufficient_quota", err: errors.New("quota")},
+		errors.New("invalid JSON"),
+	} {
+		flaky := &flakyProvider{errs: []error{err}}
+		if _, got := testRetryingProvider(flaky).Complete(context.Background(), CompletionRequest{}); got == nil {
+			t.Errorf("expected %v to be returned", err)
+		}
+		if flaky.calls != 1 {
+			t.Errorf("%v was retried %d times", err, flaky.calls-1)
+		}
+	}
+}
+
+func TestRetryingProviderGivesUp(t *testing.T) {
+	transient := &apiError{status: http.StatusServiceUnavailable, err: errors.New("unavailable")}
+	flaky := &flakyProvider{errs: []error{transient, transient, transient, transient, transient}}
+	if _, err := testRetryingProvider(flaky).Complete(context.Background(), CompletionRequest{}); err == nil {
+		t.Fatalf("expected error after exhausting retries")
+	}
+	if flaky.calls != 4 {
+		t.Errorf("calls = %d; want 1 attempt plus 3 retries", flaky.calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second},
+		{http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"3"}}, 250 * time.Millisecond},
+		{http.Header{"Retry-After": {"soon"}}, 0},
+		{http.Header{}, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header); got != tt.want {
+			t.Errorf("parseRetryAfter(%v) = %v; want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffHonoursRetryAfter(t *testing.T) {
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay := backoff(attempt, time.Second, time.Minute, 0)
+		if delay <= 0 || delay > time.Minute {
+			t.Errorf("backoff(%d) = %v; want within (0, 1m]", attempt, delay)
+		}
+	}
+	if got := backoff(1, time.Second, time.Minute, 30*time.Second); got != 30*time.Second {
+		t.Errorf("backoff with Retry-After = %v; want 30s", got)
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	start := time.Now()
+	bucket := newTokenBucket(60)
+
+	for i := 0; i < 60; i++ {
+		if wait := bucket.reserve(start, 1); wait != 0 {
+			t.Fatalf("request %d waited %v within the burst", i, wait)
+		}
+	}
+	if wait := bucket.reserve(start, 1); wait != time.Second {
+		t.Errorf("61st request waits %v; want 1s", wait)
+	}
+	if wait := bucket.reserve(start.Add(10*time.Second), 1); wait != 0 {
+		t.Errorf("request after refill waits %v; want 0", wait)
+	}
+	if wait := (*tokenBucket)(nil).reserve(start, 1000); wait != 0 {
+		t.Errorf("unlimited bucket waits %v", wait)
+	}
+}
+
+func TestAnthropicRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"done"}],"usage":{"input_tokens":3,"output_tokens":2}}`))
+	}))
+	defer server.Close()
+
+	llm := testRetryingProvider(newAnthropicProvider("key", server.URL))
+	got, err := llm.Complete(context.Background(), CompletionRequest{Model: DefaultAnthropicModel, User: "text"})
+	if err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	if got.Content != "done" || calls.Load() != 2 {
+		t.Errorf("complete() = %q after %d calls", got.Content, calls.Load())
+	}
+}
+
+func TestOpenAIRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"done"}}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+	}))
+	defer server.Close()
+
+	base, err := newBaseProvider(ProviderOpenAICompatible, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := testRetryingProvider(base).Complete(context.Background(), CompletionRequest{Model: "local", User: "text"})
+	if err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	if got.Content != "done" || calls.Load() != 2 {
+		t.Errorf("complete() = %q after %d calls", got.Content, calls.Load())
+	}
+}
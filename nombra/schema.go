@@ -0,0 +1,171 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Values of Options.StructuredOutput.
+const (
+	// StructuredOutputAuto requests a strict JSON schema from OpenAI models
+	// known to support structured outputs and parses other replies leniently.
+	StructuredOutputAuto = "auto"
+	StructuredOutputOn   = "on"
+	StructuredOutputOff  = "off"
+)
+
+var validStructuredOutputs = []string{StructuredOutputAuto, StructuredOutputOn, StructuredOutputOff}
+
+// builtinFieldDescriptions describe the Metadata keys in the response schema.
+var builtinFieldDescriptions = map[string]string{
+	"date":          "Most relevant document date as YYYY.MM.DD; empty if unknown",
+	"language":      "Main language of the document",
+	"title":         "Explicit document title or heading; empty if none",
+	"document_type": "Kind of document, e.g. invoice, contract or letter",
+	"organization":  "Issuing or main organization",
+	"author":        "Person who wrote or signed the document",
+	"recipient":     "Person or organization the document is addressed to",
+	"topic":         "Main subject in a few words",
+}
+
+// ResponseSchema describes the JSON object a reply must consist of: every
+// property is a string and must be present, and no other keys are allowed.
+// Providers that support structured outputs send it as a strict JSON schema.
+type ResponseSchema struct {
+	Name       string
+	Properties []SchemaProperty
+}
+
+// SchemaProperty is one string property of a ResponseSchema.
+type SchemaProperty struct {
+	Name        string
+	Description string
+}
+
+// SchemaError reports a reply that does not follow the requested
+// ResponseSchema. Requests failing with it are retried like transient errors.
+type SchemaError struct {
+	Reason string
+}
+
+func (e *SchemaError) Error() string {
+	return "reply violates the response schema: " + e.Reason
+}
+
+// MarshalJSON returns the schema in JSON Schema notation.
+func (s *ResponseSchema) MarshalJSON() ([]byte, error) {
+	properties := map[string]any{}
+	required := make([]string, 0, len(s.Properties))
+	for _, p := range s.Properties {
+		properties[p.Name] = map[string]string{"type": "string", "description": p.Description}
+		required = append(required, p.Name)
+	}
+	return json.Marshal(map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	})
+}
+
+// Validate checks that content is exactly one JSON object following s.
+func (s *ResponseSchema) Validate(content string) error {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var object map[string]json.RawMessage
+	if err := dec.Decode(&object); err != nil {
+		return &SchemaError{Reason: fmt.Sprintf("not a JSON object: %v", err)}
+	}
+	if dec.More() {
+		return &SchemaError{Reason: "text after the JSON object"}
+	}
+	if object == nil {
+		return &SchemaError{Reason: "not a JSON object: null"}
+	}
+
+	var problems []string
+	for _, p := range s.Properties {
+		raw, ok := object[p.Name]
+		if !ok {
+			problems = append(problems, "missing "+p.Name)
+			continue
+		}
+		if raw = bytes.TrimSpace(raw); len(raw) == 0 || raw[0] != '"' {
+			problems = append(problems, p.Name+" is not a string")
+		}
+	}
+	for key := range object {
+		if !slices.ContainsFunc(s.Properties, func(p SchemaProperty) bool { return p.Name == key }) {
+			problems = append(problems, "unexpected "+key)
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return &SchemaError{Reason: strings.Join(problems, ", ")}
+	}
+	return nil
+}
+
+// metadataSchema is the response schema for Metadata with the custom fields.
+func metadataSchema(fields []Field) *ResponseSchema {
+	schema := &ResponseSchema{Name: "document_metadata"}
+	for _, name := range builtinFieldNames {
+		schema.Properties = append(schema.Properties, SchemaProperty{Name: name, Description: builtinFieldDescriptions[name]})
+	}
+	for _, field := range fields {
+		schema.Properties = append(schema.Properties, SchemaProperty{Name: field.Name, Description: strings.TrimSpace(field.Description)})
+	}
+	return schema
+}
+
+// useStructuredOutput decides whether metadata requests carry a response
+// schema. In auto mode only the built-in OpenAI client is trusted with it.
+func useStructuredOutput(opts Options) (bool, error) {
+	if opts.Offline {
+		return false, nil
+	}
+	switch opts.StructuredOutput {
+	case StructuredOutputOff:
+		return false, nil
+	case StructuredOutputOn:
+		if opts.Provider == ProviderAnthropic && opts.Client == nil {
+			return false, fmt.Errorf("structured outputs are not supported with provider %s", ProviderAnthropic)
+		}
+		return true, nil
+	case "", StructuredOutputAuto:
+		return opts.Client == nil && opts.Provider == ProviderOpenAI && supportsStructuredOutput(opts.Model), nil
+	default:
+		return false, fmt.Errorf("invalid structured output %q. valid values: %s", opts.StructuredOutput, strings.Join(validStructuredOutputs, ", "))
+	}
+}
+
+// supportsStructuredOutput reports whether an OpenAI model accepts a strict
+// json_schema response format. Older GPT-4 and GPT-3.5 models do not.
+func supportsStructuredOutput(model string) bool {
+	m := strings.ToLower(strings.TrimSpace(model))
+	switch {
+	case isGPT5Model(m), strings.HasPrefix(m, "gpt-4.1"), strings.HasPrefix(m, "o3"), strings.HasPrefix(m, "o4"):
+		return true
+	case strings.HasPrefix(m, "gpt-4o"):
+		return m != "gpt-4o-2024-05-13"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+package nombra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const completeMetadata = `{"date":"2024.03.01","language":"English","title":"Invoice","document_type":"Invoice","organization":"ACME","author":"","recipient":"","topic":""}`
+
+func TestResponseSchemaValidate(t *testing.T) {
+	schema := metadataSchema([]Field{{Name: "invoice_number", Description: "Invoice number"}})
+	valid := strings.TrimSuffix(completeMetadata, "}") + `,"invoice_number":"AB-1"}`
+	if err := schema.Validate(valid); err != nil {
+		t.Errorf("Validate(valid) returned error: %v", err)
+	}
+
+	for _, tc := range []struct{ content, reason string }{
+		{"```json\n" + valid + "\n```", "not a JSON object"},
+		{valid + " done", "text after"},
+		{completeMetadata, "missing invoice_number"},
+		{strings.Replace(valid, `"title":"Invoice"`, `"title":3`, 1), "title is not a string"},
+		{strings.Replace(valid, `"topic":""`, `"topic":"","notes":""`, 1), "unexpected notes"},
+		{"null", "null"},
+	} {
+		err := schema.Validate(tc.content)
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) || !strings.Contains(schemaErr.Reason, tc.reason) {
+			t.Errorf("Validate(%q) = %v; want schema error about %q", tc.content, err, tc.reason)
+		}
+	}
+}
+
+func TestUseStructuredOutput(t *testing.T) {
+	for _, tc := range []struct {
+		opts Options
+		want bool
+	}{
+		{Options{Provider: ProviderOpenAI, Model: "gpt-5.4"}, true},
+		{Options{Provider: ProviderOpenAI, Model: "gpt-4o-mini"}, true},
+		{Options{Provider: ProviderOpenAI, Model: "gpt-4-turbo"}, false},
+		{Options{Provider: ProviderOpenAICompatible, Model: "llama3"}, false},
+		{Options{Provider: ProviderAnthropic}, false},
+		{Options{Provider: ProviderOpenAI, Model: "gpt-5.4", StructuredOutput: StructuredOutputOff}, false},
+		{Options{Provider: ProviderOpenAICompatible, Model: "llama3", StructuredOutput: StructuredOutputOn}, true},
+	} {
+		if got, err := useStructuredOutput(tc.opts); got != tc.want || err != nil {
+			t.Errorf("useStructuredOutput(%+v) = %v, %v; want %v", tc.opts, got, err, tc.want)
+		}
+	}
+	if _, err := useStructuredOutput(Options{Provider: ProviderAnthropic, StructuredOutput: StructuredOutputOn}); err == nil {
+		t.Error("structured outputs with Anthropic succeeded; want error")
+	}
+	if _, err := useStructuredOutput(Options{StructuredOutput: "strict"}); err == nil {
+		t.Error("invalid mode succeeded; want error")
+	}
+}
+
+func TestStructuredOutputRetriesSchemaViolations(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{"Sure! " + completeMetadata, completeMetadata}}
+	n := newTestNamer(t, Options{Client: provider, StructuredOutput: StructuredOutputOn, MaxRetries: 1})
+
+	metadata, usage, err := n.ExtractMetadata(context.Background(), "Invoice from ACME")
+	if err != nil {
+		t.Fatalf("ExtractMetadata returned error: %v", err)
+	}
+	if metadata.Organization != "ACME" || usage.TotalTokens != 20 || len(provider.requests) != 2 {
+		t.Errorf("metadata = %+v, usage %+v after %d requests", metadata, usage, len(provider.requests))
+	}
+	if provider.requests[0].Schema == nil {
+		t.Error("request carries no schema")
+	}
+
+	// Without retries left the violation is reported as such.
+	provider = &scriptedProvider{replies: []string{`{"title":"Invoice"}`}}
+	n = newTestNamer(t, Options{Client: provider, StructuredOutput: StructuredOutputOn})
+	_, _, err = n.ExtractMetadata(context.Background(), "Invoice from ACME")
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Errorf("ExtractMetadata error = %v; want a schema error", err)
+	}
+}
+
+func TestOpenAIProviderSendsResponseFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResponseFormat struct {
+				Type       string `json:"type"`
+				JSONSchema struct {
+					Name   string `json:"name"`
+					Strict bool   `json:"strict"`
+					Schema struct {
+						Required             []string `json:"required"`
+						AdditionalProperties bool     `json:"additionalProperties"`
+					} `json:"schema"`
+				} `json:"json_schema"`
+			} `json:"response_format"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		format := req.ResponseFormat
+		if format.Type != "json_schema" || !format.JSONSchema.Strict || format.JSONSchema.Name != "document_metadata" ||
+			len(format.JSONSchema.Schema.Required) != len(builtinFieldNames) || format.JSONSchema.Schema.AdditionalProperties {
+			t.Errorf("unexpected response format: %+v", format)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": completeMetadata}}},
+			"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		})
+	}))
+	defer server.Close()
+
+	llm, err := newBaseProvider(ProviderOpenAICompatible, "test-key", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := llm.Complete(context.Background(), CompletionRequest{Model: "gpt-5.4", System: "s", User: "u", Schema: metadataSchema(nil)})
+	if err != nil || got.Content != completeMetadata || got.Usage.TotalTokens != 15 {
+		t.Errorf("Complete() = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the Go time layout of Metadata.Date.
+const DateLayout = "2006.01.02"
+
+// titleTemplate is a parsed Options.Template value. A template is literal
+// text with placeholders of the form {field|fallback...:option}. Literal text
+// between two placeholders acts as a separator and is only emitted when fields
+// on both sides of it rendered something.
+type titleTemplate struct {
+	source   string
+	segments []templateSegment
+}
+
+type templateSegment struct {
+	literal string
+	fields  []string
+	// format is the Go time layout used for the date field.
+	format string
+	// limit caps the rendered length of textual fields, 0 means no limit.
+	limit int
+}
+
+var templateFields = map[string]func(Metadata) string{
+	"date":          func(m Metadata) string { return m.Date },
+	"language":      func(m Metadata) string { return m.Language },
+	"title":         func(m Metadata) string { return m.Title },
+	"document_type": func(m Metadata) string { return m.DocumentType },
+	"organization":  func(m Metadata) string { return m.Organization },
+	"author":        func(m Metadata) string { return m.Author },
+	"recipient":     func(m Metadata) string { return m.Recipient },
+	"topic":         func(m Metadata) string { return m.Topic },
+	"primary":       selectPrimaryDescriptor,
+}
+
+var templatePlaceholderRegex = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// parseTitleTemplate validates a template and splits it into literal
+// and placeholder segments. extra names custom fields that may be used
+// besides the built-in ones.
+func parseTitleTemplate(source string, extra []string) (*titleTemplate, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("template is empty")
+	}
+
+	tmpl := &titleTemplate{source: source}
+	last := 0
+	for _, loc := range templatePlaceholderRegex.FindAllStringSubmatchIndex(source, -1) {
+		if literal := source[last:loc[0]]; literal != "" {
+			if strings.ContainsAny(literal, "{}") {
+				return nil, fmt.Errorf("template %q has unbalanced braces", source)
+			}
+			tmpl.segments = append(tmpl.segments, templateSegment{literal: literal})
+		}
+
+		segment, err := parseTemplatePlaceholder(source[loc[2]:loc[3]], extra)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", source, err)
+		}
+		tmpl.segments = append(tmpl.segments, segment)
+		last = loc[1]
+	}
+	if literal := source[last:]; literal != "" {
+		if strings.ContainsAny(literal, "{}") {
+			return nil, fmt.Errorf("template %q has unbalanced braces", source)
+		}
+		tmpl.segments = append(tmpl.segments, templateSegment{literal: literal})
+	}
+
+	if !tmpl.hasPlaceholders() {
+		return nil, fmt.Errorf("template %q contains no placeholders", source)
+	}
+	return tmpl, nil
+}
+
+func parseTemplatePlaceholder(body string, extra []string) (templateSegment, error) {
+	names, option, hasOption := strings.Cut(body, ":")
+
+	segment := templateSegment{}
+	for _, name := range strings.Split(names, "|") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := templateFields[name]; !ok && !slices.Contains(extra, name) {
+			return templateSegment{}, fmt.Errorf("unknown field %q. valid fields: %s", name, strings.Join(append(templateFieldNames(), extra...), ", "))
+		}
+		segment.fields = append(segment.fields, name)
+	}
+
+	if !hasOption {
+		return segment, nil
+	}
+	if option == "" {
+		return templateSegment{}, fmt.Errorf("empty option for {%s}", body)
+	}
+
+	// Date-only placeholders take a time layout, everything else a length limit.
+	if len(segment.fields) == 1 && segment.fields[0] == "date" {
+		segment.format = option
+		return segment, nil
+	}
+	limit, err := strconv.Atoi(option)
+	if err != nil || limit < 1 {
+		return templateSegment{}, fmt.Errorf("invalid length limit %q for {%s}", option, body)
+	}
+	segment.limit = limit
+	return segment, nil
+}
+
+func templateFieldNames() []string {
+	return []string{"date", "language", "title", "document_type", "organization", "author", "recipient", "topic", "primary"}
+}
+
+func (t *titleTemplate) hasPlaceholders() bool {
+	for _, segment := range t.segments {
+		if len(segment.fields) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// render fills the template from metadata. It reports false when no
+// descriptive (non-date) field could be filled, mirroring the rejection rules
+// of buildTitleFromMetadata so that the retry prompt still kicks in.
+func (t *titleTemplate) render(metadata Metadata) (string, bool) {
+	title, descriptive := t.fill(metadata)
+	if len(title) > maxFilenameLength {
+		title = strings.TrimSpace(title[:maxFilenameLength])
+	}
+	if !descriptive || !isLikelyFilename(title) {
+		return "", false
+	}
+	return title, true
+}
+
+// fill renders the template without validating the result and reports whether
+// a descriptive (non-date) field contributed to it.
+func (t *titleTemplate) fill(metadata Metadata) (string, bool) {
+	metadata = normalizeMetadata(metadata)
+
+	var out strings.Builder
+	pending := ""
+	seenPlaceholder := false
+	emitted := false
+	descriptive := false
+
+	for _, segment := range t.segments {
+		if len(segment.fields) == 0 {
+			pending += segment.literal
+			continue
+		}
+
+		value, field := segment.value(metadata)
+		// A literal is a prefix when no placeholder came before it, otherwise it
+		// separates two placeholders and is dropped if either side is empty.
+		if value != "" && (emitted || !seenPlaceholder) {
+			out.WriteString(pending)
+		}
+		if value != "" {
+			out.WriteString(value)
+			emitted = true
+			if field != "date" {
+				descriptive = true
+			}
+		}
+		pending = ""
+		seenPlaceholder = true
+	}
+	if emitted {
+		out.WriteString(pending)
+	}
+
+	text := regexp.MustCompile(`\s+`).ReplaceAllString(out.String(), " ")
+	return strings.TrimSpace(text), descriptive
+}
+
+// value returns the first non-empty field of the placeholder together with
+// the name of the field that supplied it.
+func (s templateSegment) value(metadata Metadata) (string, string) {
+	for _, field := range s.fields {
+		raw := metadata.Extra[field]
+		if get, ok := templateFields[field]; ok {
+			raw = get(metadata)
+		}
+		raw = strings.TrimSpace(raw)
+		if field == "date" {
+			if date := formatTemplateDate(raw, s.format); date != "" {
+				return date, field
+			}
+			continue
+		}
+		if !hasMeaningfulDescriptor(raw) {
+			continue
+		}
+		if s.limit > 0 {
+			raw = shortenDescriptor(raw, s.limit)
+		}
+		return raw, field
+	}
+	return "", ""
+}
+
+func formatTemplateDate(date, layout string) string {
+	if !looksLikeDate(date) {
+		return ""
+	}
+	if layout == "" {
+		return date
+	}
+	parsed, err := time.Parse(DateLayout, date)
+	if err != nil {
+		return ""
+	}
+	return parsed.Format(layout)
+}
@@ -0,0 +1,97 @@
+package nombra
+
+import (
+	"testing"
+)
+
+func TestParseTitleTemplateErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"no placeholders",
+		"{date}_{unknown}",
+		"{date}_{organization",
+		"{organization:abc}",
+		"{organization:0}",
+		"{title:}",
+	}
+
+	for _, in := range cases {
+		if _, err := parseTitleTemplate(in, nil); err == nil {
+			t.Errorf("parseTitleTemplate(%q) expected error", in)
+		}
+	}
+}
+
+func TestTitleTemplateRender(t *testing.T) {
+	metadata := Metadata{
+		Date:         "2024.01.15",
+		DocumentType: "Invoice",
+		Organization: "ACME Corporation International",
+		Topic:        "Office Supplies",
+	}
+
+	cases := []struct {
+		name     string
+		template string
+		metadata Metadata
+		want     string
+		ok       bool
+	}{
+		{
+			name:     "date layout and fallback",
+			template: "{date:2006-01-02}_{organization}_{title|document_type}",
+			metadata: metadata,
+			want:     "2024-01-15_ACME Corporation International_Invoice",
+			ok:       true,
+		},
+		{
+			name:     "length limit",
+			template: "{organization:12} - {topic}",
+			metadata: metadata,
+			want:     "ACME - Office Supplies",
+			ok:       true,
+		},
+		{
+			name:     "separator dropped around empty field",
+			template: "{date:2006}_{recipient}_{document_type}",
+			metadata: metadata,
+			want:     "2024_Invoice",
+			ok:       true,
+		},
+		{
+			name:     "prefix and suffix kept",
+			template: "Scan [{document_type}]",
+			metadata: metadata,
+			want:     "Scan [Invoice]",
+			ok:       true,
+		},
+		{
+			name:     "primary descriptor",
+			template: "{date} {primary}",
+			metadata: metadata,
+			want:     "2024.01.15 Invoice",
+			ok:       true,
+		},
+		{
+			name:     "date alone is not enough",
+			template: "{date}_{title}",
+			metadata: Metadata{Date: "2024.01.15"},
+			ok:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		tmpl, err := parseTitleTemplate(tc.template, nil)
+		if err != nil {
+			t.Fatalf("%s: parseTitleTemplate(%q) returned error: %v", tc.name, tc.template, err)
+		}
+		got, ok := tmpl.render(tc.metadata)
+		if ok != tc.ok {
+			t.Errorf("%s: render() ok = %v; want %v", tc.name, ok, tc.ok)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: render() = %q; want %q", tc.name, got, tc.want)
+		}
+	}
+}
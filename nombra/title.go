@@ -0,0 +1,424 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	maxFilenameLength = 120
+	sanitizeRegex     = `[<>:"\/\\|?*]`
+)
+
+// BuildTitle renders the filename, without extension, for metadata using
+// Options.Template when one is configured and the default layout otherwise.
+// It reports false when the metadata is too weak to name a file.
+func (n *Namer) BuildTitle(metadata Metadata) (string, bool) {
+	if n.template != nil {
+		return n.template.render(metadata)
+	}
+	return buildTitleFromMetadata(metadata)
+}
+
+// buildTitleFromMetadata is the default layout:
+// "date - primary - organization - recipient - topic".
+func buildTitleFromMetadata(metadata Metadata) (string, bool) {
+	metadata = normalizeMetadata(metadata)
+	parts := []string{}
+
+	date := metadata.Date
+	if looksLikeDate(date) {
+		parts = append(parts, date)
+	}
+
+	primary := selectPrimaryDescriptor(metadata)
+	if !hasMeaningfulDescriptor(primary) {
+		return "", false
+	}
+	parts = append(parts, shortenDescriptor(primary, 54))
+
+	for _, extra := range selectSecondaryDescriptors(metadata, primary) {
+		if !hasMeaningfulDescriptor(extra) {
+			continue
+		}
+		if containsFold(parts, extra) {
+			continue
+		}
+		if descriptorOverlaps(primary, extra) {
+			continue
+		}
+		parts = append(parts, shortenDescriptor(extra, descriptorLimit(extra, metadata)))
+		if len(parts) >= 4 {
+			break
+		}
+	}
+
+	title := compactTitle(strings.Join(parts, " - "))
+	if !isLikelyFilename(title) {
+		return "", false
+	}
+	return title, true
+}
+
+func selectPrimaryDescriptor(metadata Metadata) string {
+	switch {
+	case hasMeaningfulDescriptor(metadata.Title) && !isVerboseTitle(metadata.Title, metadata.DocumentType, metadata.Topic):
+		return metadata.Title
+	case hasMeaningfulDescriptor(metadata.DocumentType):
+		return metadata.DocumentType
+	case hasMeaningfulDescriptor(metadata.Title):
+		return metadata.Title
+	case hasMeaningfulDescriptor(metadata.Topic):
+		return metadata.Topic
+	default:
+		return ""
+	}
+}
+
+func selectSecondaryDescriptors(metadata Metadata, primary string) []string {
+	extras := []string{}
+
+	if hasMeaningfulDescriptor(metadata.Organization) && !descriptorOverlaps(primary, metadata.Organization) {
+		extras = append(extras, metadata.Organization)
+	}
+
+	if metadata.Organization == "" &&
+		hasMeaningfulDescriptor(metadata.Author) &&
+		!descriptorOverlaps(primary, metadata.Author) &&
+		!containsFold(extras, metadata.Author) {
+		extras = append(extras, metadata.Author)
+	}
+
+	if hasMeaningfulDescriptor(metadata.Recipient) && !descriptorOverlaps(primary, metadata.Recipient) {
+		extras = append(extras, metadata.Recipient)
+	}
+
+	if hasMeaningfulDescriptor(metadata.Topic) &&
+		!descriptorOverlaps(primary, metadata.Topic) &&
+		!descriptorOverlaps(metadata.DocumentType, metadata.Topic) &&
+		isConciseDescriptor(metadata.Topic) {
+		extras = append(extras, metadata.Topic)
+	}
+
+	return extras
+}
+
+func descriptorLimit(value string, metadata Metadata) int {
+	switch {
+	case strings.EqualFold(value, metadata.Organization):
+		return 42
+	case strings.EqualFold(value, metadata.Recipient):
+		return 30
+	case strings.EqualFold(value, metadata.Author):
+		return 28
+	default:
+		return 34
+	}
+}
+
+func compactTitle(title string) string {
+	title = cleanTitle(title)
+	title = removeOverlappingParts(title)
+	if len(title) <= maxFilenameLength {
+		return title
+	}
+
+	parts := strings.Split(title, " - ")
+	for len(parts) > 2 {
+		removed := false
+		for i := len(parts) - 1; i >= 2; i-- {
+			candidate := cleanTitle(strings.Join(append(append([]string{}, parts[:i]...), parts[i+1:]...), " - "))
+			if len(candidate) < len(title) {
+				title = candidate
+				parts = strings.Split(title, " - ")
+				removed = true
+				if len(title) <= maxFilenameLength {
+					return title
+				}
+				break
+			}
+		}
+		if !removed {
+			break
+		}
+	}
+
+	if len(title) > maxFilenameLength {
+		title = title[:maxFilenameLength]
+		title = strings.TrimSpace(strings.TrimSuffix(title, "-"))
+	}
+	return cleanTitle(title)
+}
+
+func removeOverlappingParts(title string) string {
+	parts := strings.Split(title, " - ")
+	filtered := make([]string, 0, len(parts))
+	for _, part := range parts {
+		skip := false
+		for _, existing := range filtered {
+			if descriptorOverlaps(existing, part) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			filtered = append(filtered, part)
+		}
+	}
+	return cleanTitle(strings.Join(filtered, " - "))
+}
+
+func descriptorOverlaps(a, b string) bool {
+	a = strings.ToLower(strings.TrimSpace(a))
+	b = strings.ToLower(strings.TrimSpace(b))
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
+
+func isVerboseTitle(title, documentType, topic string) bool {
+	if !hasMeaningfulDescriptor(title) {
+		return false
+	}
+	if len(title) > 55 && hasMeaningfulDescriptor(documentType) {
+		return true
+	}
+	return descriptorOverlaps(title, topic) && len(title) > 45 && hasMeaningfulDescriptor(documentType)
+}
+
+func isConciseDescriptor(value string) bool {
+	return len(strings.TrimSpace(value)) <= 40
+}
+
+func stripTrailingTranslation(value string) string {
+	value = strings.TrimSpace(value)
+	matches := regexp.MustCompile(`^(.*?)\s+\(([^()]*)\)$`).FindStringSubmatch(value)
+	if len(matches) != 3 {
+		return value
+	}
+
+	base := strings.TrimSpace(matches[1])
+	translated := strings.TrimSpace(matches[2])
+	if base == "" || translated == "" {
+		return value
+	}
+
+	if descriptorOverlaps(base, translated) || likelyTranslatedDuplicate(base, translated) {
+		return base
+	}
+
+	return value
+}
+
+func likelyTranslatedDuplicate(base, translated string) bool {
+	return len(translated) > 12 && (containsNonASCII(base) || containsAcronym(base) || len(strings.Fields(base)) >= 3)
+}
+
+func containsNonASCII(value string) bool {
+	for _, r := range value {
+		if r > 127 {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAcronym(value string) bool {
+	return regexp.MustCompile(`\b[A-Z]{2,}\b`).MatchString(value)
+}
+
+func shortenDescriptor(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	if limit <= 0 || len(value) <= limit {
+		return value
+	}
+
+	words := strings.Fields(value)
+	if len(words) == 0 {
+		return value[:limit]
+	}
+
+	var parts []string
+	current := 0
+	for _, word := range words {
+		added := len(word)
+		if len(parts) > 0 {
+			added++
+		}
+		if current+added > limit {
+			break
+		}
+		parts = append(parts, word)
+		current += added
+	}
+	if len(parts) == 0 {
+		return strings.TrimSpace(value[:limit])
+	}
+	return strings.Join(parts, " ")
+}
+
+func hasMeaningfulDescriptor(value string) bool {
+	value = strings.TrimSpace(value)
+	return value != "" && !isGenericMetadataValue(value)
+}
+
+func isGenericMetadataValue(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "untitled", "document", "file", "pdf", "scan", "scanned document", "image", "unknown", "misc", "miscellaneous", "n a", "na", "none":
+		return true
+	default:
+		return false
+	}
+}
+
+func containsFold(values []string, candidate string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func looksLikeDate(value string) bool {
+	return regexp.MustCompile(`^\d{4}\.\d{2}\.\d{2}$`).MatchString(strings.TrimSpace(value))
+}
+
+// cleanTitle cleans and formats the generated title by removing extraneous quotes and whitespace,
+// normalizing spacing around dashes, and ensuring proper text formatting.
+func cleanTitle(title string) string {
+	// Remove extraneous quotes and surrounding whitespace
+	title = strings.Trim(title, "\"' \t\n")
+
+	// Replace newlines with a single space
+	title = strings.ReplaceAll(title, "\n", " ")
+
+	// Insert spaces between a lowercase letter followed immediately by an uppercase letter
+	title = regexp.MustCompile(`([a-z])([A-Z])`).ReplaceAllString(title, "$1 $2")
+
+	// Treat missing-space separators like "Name-Title" as section separators.
+	title = regexp.MustCompile(`([[:lower:]])-([[:upper:]][[:lower:]])`).ReplaceAllString(title, "$1 - $2")
+
+	// Collapse runs of whitespace
+	title = regexp.MustCompile(`\s+`).ReplaceAllString(title, " ")
+
+	// Ensure explicit separator dashes have a single space on each side without
+	// touching hyphens inside words like "COVID-19" or "COVID-Zertifikat".
+	title = regexp.MustCompile(`\s+-\s+`).ReplaceAllString(title, " - ")
+	title = regexp.MustCompile(`\s-\s*`).ReplaceAllString(title, " - ")
+	title = regexp.MustCompile(`\s*-\s`).ReplaceAllString(title, " - ")
+
+	title = regexp.MustCompile(`(?i)\.pdf$`).ReplaceAllString(title, "")
+
+	title = moveTrailingDateToFront(strings.TrimSpace(title))
+
+	// Trim any trailing or leading whitespace introduced by replacements
+	return strings.TrimSpace(title)
+}
+
+func isLikelyFilename(title string) bool {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return false
+	}
+
+	disallowedPhrases := []string{
+		"no clear",
+		"mentioned in the text",
+		"descriptive filename could be",
+		"filename should be",
+		"filename could be",
+		"document type",
+		"do not",
+		"respond only",
+	}
+	disallowedTitles := map[string]struct{}{
+		"untitled":         {},
+		"document":         {},
+		"file":             {},
+		"pdf":              {},
+		"scan":             {},
+		"scanned document": {},
+		"image":            {},
+		"unknown":          {},
+		"misc":             {},
+		"miscellaneous":    {},
+	}
+	lowerTitle := strings.ToLower(title)
+	if _, found := disallowedTitles[lowerTitle]; found {
+		return false
+	}
+	for _, phrase := range disallowedPhrases {
+		if strings.Contains(lowerTitle, phrase) {
+			return false
+		}
+	}
+
+	if strings.ContainsAny(title, "\n\r") {
+		return false
+	}
+
+	return !strings.Contains(title, ":")
+}
+
+func moveTrailingDateToFront(title string) string {
+	datePattern := `\d{4}(?:\s*[./-]\s*)\d{2}(?:\s*[./-]\s*)\d{2}`
+	leadingDate := regexp.MustCompile(`^` + datePattern + `(?:\s+-\s+|$)`)
+	if leadingDate.MatchString(title) {
+		return title
+	}
+
+	trailingDate := regexp.MustCompile(`^(.*?)(?:\s+-\s+)(` + datePattern + `)$`)
+	matches := trailingDate.FindStringSubmatch(title)
+	if len(matches) != 3 {
+		return title
+	}
+
+	body := strings.TrimSpace(matches[1])
+	date := normalizeDateSeparators(matches[2])
+	if body == "" {
+		return date
+	}
+	return date + " - " + body
+}
+
+func normalizeDateSeparators(date string) string {
+	date = regexp.MustCompile(`\s*([./-])\s*`).ReplaceAllString(date, "$1")
+	return strings.NewReplacer("/", ".", "-", ".").Replace(date)
+}
+
+// sanitizeFilename removes any invalid characters from the title and trims whitespace.
+// It ensures that the resulting string is safe to use as a filename.
+func sanitizeFilename(title string) string {
+	// Remove invalid characters
+	reg := regexp.MustCompile(sanitizeRegex)
+	clean := reg.ReplaceAllString(title, "")
+
+	// Trim whitespace and truncate
+	clean = strings.TrimSpace(clean)
+	if len(clean) > maxFilenameLength {
+		clean = clean[:maxFilenameLength]
+	}
+
+	// Handle cases where title becomes empty
+	if clean == "" {
+		return "untitled-document"
+	}
+
+	return clean
+}
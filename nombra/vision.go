@@ -0,0 +1,296 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nombra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // decodes rendered pages and PNG scans
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Detail levels of Options.VisionDetail. Low detail costs a fixed, small
+// number of tokens per image but may miss small print.
+const (
+	VisionDetailLow  = "low"
+	VisionDetailHigh = "high"
+	VisionDetailAuto = "auto"
+)
+
+var validVisionDetails = []string{VisionDetailLow, VisionDetailHigh, VisionDetailAuto}
+
+// DefaultVisionMaxSize is used when Options.VisionMaxSize is 0. Larger
+// images are scaled down by the vision APIs anyway.
+const DefaultVisionMaxSize = 2048
+
+const visionPrompt = "You read scanned document pages from images. Read the visible text, including letterheads, stamps, handwriting and signature blocks, and extract the metadata of the document from it. The pages may be a selection of a longer document."
+
+// Image is a document image sent to a vision model.
+type Image struct {
+	Data     []byte
+	MimeType string
+}
+
+// ParseVisionPages parses a page selection such as "1,2,-1" or
+// "first,last" for Options.VisionPages.
+func ParseVisionPages(selection string) ([]int, error) {
+	var pages []int
+	for _, part := range strings.Split(selection, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		var page int
+		switch part {
+		case "first":
+			page = 1
+		case "last":
+			page = -1
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid vision page %q: use page numbers from 1, negative numbers from the end, first or last", part)
+			}
+			page = n
+		}
+		if !slices.Contains(pages, page) {
+			pages = append(pages, page)
+		}
+	}
+	return pages, nil
+}
+
+// resolveVisionPages turns a selection into page numbers of a document with
+// count pages, in document order. Pages beyond the document are dropped.
+func resolveVisionPages(selection []int, count int) []int {
+	var pages []int
+	for _, page := range selection {
+		if page < 0 {
+			page += count + 1
+		}
+		if page >= 1 && page <= count && !slices.Contains(pages, page) {
+			pages = append(pages, page)
+		}
+	}
+	slices.Sort(pages)
+	return pages
+}
+
+func validateVisionOptions(opts Options) error {
+	if !slices.Contains(validVisionDetails, opts.VisionDetail) {
+		return fmt.Errorf("invalid vision detail %q. valid values: %s", opts.VisionDetail, strings.Join(validVisionDetails, ", "))
+	}
+	if opts.VisionMaxSize < 0 {
+		return fmt.Errorf("vision image size cannot be negative")
+	}
+	if slices.Contains(opts.VisionPages, 0) {
+		return fmt.Errorf("vision pages count from 1, or from -1 for the last page")
+	}
+	return nil
+}
+
+// pdfPageImages renders the pages of Options.VisionPages and describes them
+// for the vision model.
+func (n *Namer) pdfPageImages(ctx context.Context, pdfPath string) ([]Image, string, error) {
+	selection := n.opts.VisionPages
+	count, err := pdfPageCount(pdfPath)
+	var pages []int
+	switch {
+	case err == nil:
+		pages = resolveVisionPages(selection, count)
+	case slices.ContainsFunc(selection, func(page int) bool { return page < 0 }):
+		return nil, "", fmt.Errorf("cannot count pages to select them from the end: %w", err)
+	default:
+		// pdftoppm may still render a file the PDF library cannot read.
+		pages = resolveVisionPages(selection, slices.Max(selection))
+	}
+	if len(pages) == 0 {
+		return nil, "", fmt.Errorf("none of the vision pages exists in the %d pages of the document", count)
+	}
+
+	tempDir, err := os.MkdirTemp("", "nombra-vision")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create temp directory for vision fallback: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	images := make([]Image, 0, len(pages))
+	for _, page := range pages {
+		imagePrefix := filepath.Join(tempDir, fmt.Sprintf("page-%d", page))
+		cmd := exec.CommandContext(ctx, "pdftoppm", "-f", strconv.Itoa(page), "-l", strconv.Itoa(page), "-singlefile", "-png", pdfPath, imagePrefix)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, "", fmt.Errorf("pdftoppm failed for vision fallback on page %d: %w", page, err)
+		}
+		data, err := os.ReadFile(imagePrefix + ".png")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read rendered page image: %w", err)
+		}
+		images = append(images, Image{Data: data, MimeType: "image/png"})
+	}
+	return images, describePages(pages, count), nil
+}
+
+// describePages tells the vision model which pages it sees.
+func describePages(pages []int, count int) string {
+	numbers := make([]string, len(pages))
+	for i, page := range pages {
+		numbers[i] = strconv.Itoa(page)
+	}
+	text := "Page " + numbers[0]
+	if len(pages) > 1 {
+		text = "Pages " + strings.Join(numbers[:len(numbers)-1], ", ") + " and " + numbers[len(numbers)-1]
+	}
+	if count > 0 {
+		text += fmt.Sprintf(" of %d", count)
+	}
+	return text + " of a scanned PDF, in order."
+}
+
+func pdfPageCount(path string) (int, error) {
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+	return reader.NumPage(), nil
+}
+
+// visionMetadata asks the vision model for the metadata of a document shown
+// in images, which are scaled down to Options.VisionMaxSize first. The
+// content carries the metadata and a plain-text rendering of it.
+func (n *Namer) visionMetadata(ctx context.Context, images []Image, prompt string) (Content, error) {
+	content := Content{Method: MethodVision}
+	for i, img := range images {
+		scaled, err := downscaleImage(img, n.opts.VisionMaxSize)
+		if err != nil {
+			return content, err
+		}
+		images[i] = scaled
+	}
+
+	reply, err := n.llm.DescribeImage(ctx, ImageRequest{
+		Model:  n.visionModel(),
+		System: visionPrompt + "\n\n" + n.systemPrompt(false),
+		Prompt: prompt,
+		Images: images,
+		Detail: n.opts.VisionDetail,
+		Schema: n.visionSchema,
+	})
+	content.Usage = reply.Usage
+	if err != nil {
+		return content, err
+	}
+	metadata, err := parseMetadataResponse(reply.Content, n.opts.Fields)
+	if err != nil {
+		return content, fmt.Errorf("vision model returned invalid metadata: %w", err)
+	}
+	metadata = normalizeMetadata(metadata)
+	if metadata.IsZero() {
+		return content, fmt.Errorf("vision model could not read the document")
+	}
+	content.Text = visionText(metadata)
+	content.Metadata = &metadata
+	return content, nil
+}
+
+// visionText renders metadata read by the vision model as text, which
+// ExtractMetadata can work from when the metadata is too weak for a title.
+func visionText(metadata Metadata) string {
+	var b strings.Builder
+	for _, name := range builtinFieldNames {
+		if value := templateFields[name](metadata); value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	names := make([]string, 0, len(metadata.Extra))
+	for name := range metadata.Extra {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\n", name, metadata.Extra[name])
+	}
+	return b.String()
+}
+
+// downscaleImage scales an image down so that its longer side has at most
+// maxSize pixels and re-encodes it as JPEG. Smaller images and formats Go
+// cannot decode are returned unchanged.
+func downscaleImage(img Image, maxSize int) (Image, error) {
+	if maxSize <= 0 {
+		return img, nil
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil || max(config.Width, config.Height) <= maxSize {
+		return img, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to decode image for scaling: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scale := float64(maxSize) / float64(max(width, height))
+	dst := boxResize(src, max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5)))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return Image{}, fmt.Errorf("failed to encode scaled image: %w", err)
+	}
+	return Image{Data: buf.Bytes(), MimeType: "image/jpeg"}, nil
+}
+
+// boxResize shrinks src to width x height, averaging the source pixels under
+// each target pixel so that thin strokes of text survive. Transparent areas
+// become white.
+func boxResize(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, src, bounds.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := range width {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, count int
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[flat.PixOffset(x0, sy):]
+				for i := 0; i < (x1-x0)*4; i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					b += int(row[i+2])
+					count++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / count), uint8(g / count), uint8(b / count), 255})
+		}
+	}
+	return dst
+}
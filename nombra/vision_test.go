@@ -0,0 +1,114 @@
+package nombra
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestParseVisionPages(t *testing.T) {
+	tests := []struct {
+		selection string
+		want      []int
+	}{
+		{"1", []int{1}},
+		{"1,2,-1", []int{1, 2, -1}},
+		{"first, LAST", []int{1, -1}},
+		{"last,-1,3", []int{-1, 3}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVisionPages(tt.selection)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseVisionPages(%q) = %v, %v; want %v", tt.selection, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "0", "middle", "1,,2"} {
+		if _, err := ParseVisionPages(bad); err == nil {
+			t.Errorf("ParseVisionPages(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestResolveVisionPages(t *testing.T) {
+	if got := resolveVisionPages([]int{-1, 1, 2, 9}, 5); !reflect.DeepEqual(got, []int{1, 2, 5}) {
+		t.Errorf("pages of 5 = %v", got)
+	}
+	if got := resolveVisionPages([]int{1, -1}, 1); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("pages of 1 = %v", got)
+	}
+	if got := describePages([]int{1, 2, 5}, 5); got != "Pages 1, 2 and 5 of 5 of a scanned PDF, in order." {
+		t.Errorf("describePages = %q", got)
+	}
+	if got := describePages([]int{2}, 0); got != "Page 2 of a scanned PDF, in order." {
+		t.Errorf("describePages without count = %q", got)
+	}
+}
+
+func TestDownscaleImage(t *testing.T) {
+	// A white 400x100 page with a black left half.
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for y := range 100 {
+		for x := range 400 {
+			c := color.RGBA{255, 255, 255, 255}
+			if x < 200 {
+				c = color.RGBA{0, 0, 0, 255}
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	page := Image{Data: buf.Bytes(), MimeType: "image/png"}
+
+	scaled, err := downscaleImage(page, 200)
+	if err != nil {
+		t.Fatalf("downscaleImage returned error: %v", err)
+	}
+	if scaled.MimeType != "image/jpeg" {
+		t.Fatalf("MIME type = %s", scaled.MimeType)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(scaled.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := decoded.Bounds().Size(); size != (image.Point{200, 50}) {
+		t.Errorf("size = %v, want 200x50", size)
+	}
+	if r, _, _, _ := decoded.At(20, 25).RGBA(); r > 0x2000 {
+		t.Errorf("black half became %#x", r)
+	}
+	if r, _, _, _ := decoded.At(180, 25).RGBA(); r < 0xe000 {
+		t.Errorf("white half became %#x", r)
+	}
+
+	for _, unchanged := range []Image{page, {Data: []byte("not an image"), MimeType: "image/png"}} {
+		if got, err := downscaleImage(unchanged, 400); err != nil || !bytes.Equal(got.Data, unchanged.Data) {
+			t.Errorf("downscaleImage changed an image within bounds or in an unknown format: %v", err)
+		}
+	}
+}
+
+func TestNewVisionOptions(t *testing.T) {
+	n := newTestNamer(t, Options{})
+	if opts := n.Options(); opts.VisionModel != visionModel || opts.VisionDetail != VisionDetailHigh || opts.VisionMaxSize != DefaultVisionMaxSize || !reflect.DeepEqual(opts.VisionPages, []int{1}) {
+		t.Errorf("defaults = %+v", opts)
+	}
+	anthropic := newTestNamer(t, Options{Provider: ProviderAnthropic, APIKey: "test"})
+	if got := anthropic.Options().VisionModel; got != DefaultAnthropicModel {
+		t.Errorf("Anthropic vision model = %s", got)
+	}
+	for _, opts := range []Options{
+		{Client: &flakyProvider{}, VisionDetail: "ultra"},
+		{Client: &flakyProvider{}, VisionPages: []int{1, 0}},
+		{Client: &flakyProvider{}, VisionMaxSize: -1},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("New(%+v) succeeded; want error", opts)
+		}
+	}
+}
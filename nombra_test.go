@@ -1,190 +1,59 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
-)
-
-func TestCleanTitle(t *testing.T) {
-	cases := map[string]string{
-		" \"2024.03.31 -John Doe-Title\" \n": "2024.03.31 - John Doe - Title",
-		"FooBar":                             "Foo Bar",
-		"  Something-Else  ":                 "Something - Else",
-		"Taucher Medizincheck - Kandidaten - Fragebogen - 2020.10.31": "2020.10.31 - Taucher Medizincheck - Kandidaten - Fragebogen",
-		"Invoice - ACME Corp - 2024-01-15":                            "2024.01.15 - Invoice - ACME Corp",
-		"Residence Permit Renew.pdf":                                  "Residence Permit Renew",
-	}
-
-	for in, want := range cases {
-		got := cleanTitle(in)
-		if got != want {
-			t.Errorf("cleanTitle(%q) = %q; want %q", in, got, want)
-		}
-	}
-}
 
-func TestIsLikelyFilename(t *testing.T) {
-	cases := map[string]bool{
-		"2024.01.15 - Invoice - ACME Corp": true,
-		"Residence Permit Renew":           true,
-		"Untitled":                         false,
-		"Document":                         false,
-		"No clear document type or parties are mentioned in the text. A descriptive filename could be 'Residence Permit Renew": false,
-		"The filename should be: Residence Permit Renewal":                                                                     false,
-		"Filename: Residence Permit Renewal":                                                                                   false,
-	}
+	"github.com/rtyx/nombra/nombra"
+	"github.com/rtyx/nombra/nombra/nombratest"
+)
 
-	for in, want := range cases {
-		got := isLikelyFilename(in)
-		if got != want {
-			t.Errorf("isLikelyFilename(%q) = %v; want %v", in, got, want)
+// TestProcessFilesRecordAndReplay runs the whole command flow against the
+// fake OpenAI server and then again from the recorded replies.
+func TestProcessFilesRecordAndReplay(t *testing.T) {
+	server := nombratest.NewServer(func(req nombratest.Request) nombratest.Response {
+		kind := strings.Fields(req.User)[0]
+		return nombratest.Response{Content: fmt.Sprintf(`{"date":"2025.01.15","language":"English","title":"","document_type":%q,"organization":"ACME","author":"","recipient":"","topic":""}`, kind)}
+	})
+	defer server.Close()
+	previousDryRun := dryRun
+	t.Cleanup(func() { dryRun = previousDryRun })
+	dryRun = true
+
+	dir := t.TempDir()
+	var files []string
+	for name, text := range map[string]string{"a.txt": "Invoice for the consulting services of January", "b.txt": "Contract between ACME and Rafa about the lease"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(text), 0o644)
+		files = append(files, path)
+	}
+
+	recordings := t.TempDir()
+	useTestNamer(t, nombra.Options{APIKey: "test", BaseURL: server.URL, Record: recordings, MinContentLength: 10})
+	recorded := processFiles(files, 2)
+	if n := len(server.Requests()); n != 2 {
+		t.Fatalf("server received %d requests, want 2", n)
+	}
+	entries, _ := os.ReadDir(recordings)
+	if len(entries) != 2 {
+		t.Errorf("%d recordings, want 2", len(entries))
+	}
+	server.Close()
+
+	useTestNamer(t, nombra.Options{Replay: recordings, MinContentLength: 10})
+	replayed := processFiles(files, 2)
+	for i := range files {
+		if recorded[i].err != nil || replayed[i].err != nil {
+			t.Fatalf("%s: recorded error %v, replayed error %v", filepath.Base(files[i]), recorded[i].err, replayed[i].err)
 		}
-	}
-}
-
-func TestBuildTitleFromMetadata(t *testing.T) {
-	cases := []struct {
-		name     string
-		metadata extractedMetadata
-		want     string
-		ok       bool
-	}{
-		{
-			name: "date and title",
-			metadata: extractedMetadata{
-				Date:  "2024.01.15",
-				Title: "Residence Permit Renewal",
-			},
-			want: "2024.01.15 - Residence Permit Renewal",
-			ok:   true,
-		},
-		{
-			name: "document type before names",
-			metadata: extractedMetadata{
-				Date:         "2007.07.03",
-				DocumentType: "Authorization Letter",
-				Author:       "John Doe",
-				Recipient:    "Jane Doe",
-			},
-			want: "2007.07.03 - Authorization Letter - John Doe - Jane Doe",
-			ok:   true,
-		},
-		{
-			name: "topic fallback",
-			metadata: extractedMetadata{
-				Date:  "2020.10.31",
-				Topic: "Diving Fitness Questionnaire",
-			},
-			want: "2020.10.31 - Diving Fitness Questionnaire",
-			ok:   true,
-		},
-		{
-			name: "prefer organization over signer and avoid verbose overlap",
-			metadata: extractedMetadata{
-				Date:         "2022.02.23",
-				Title:        "Termination of Employment",
-				DocumentType: "Termination Letter",
-				Organization: "Acme Corp",
-				Author:       "John Doe",
-				Recipient:    "Jane Doe",
-				Topic:        "Notice of termination of employment and related procedures",
-			},
-			want: "2022.02.23 - Termination of Employment - Acme Corp - Jane Doe",
-			ok:   true,
-		},
-		{
-			name: "strip bilingual organization and keep main language",
-			metadata: extractedMetadata{
-				Date:         "2021.12.22",
-				Language:     "de",
-				DocumentType: "COVID-Zertifikat",
-				Organization: "Acme AG (Acme Corporation)",
-				Topic:        "COVID-19 Impfung",
-			},
-			want: "2021.12.22 - COVID-Zertifikat - Acme AG - COVID-19 Impfung",
-			ok:   true,
-		},
-		{
-			name: "reject names only",
-			metadata: extractedMetadata{
-				Date:      "2007.07.03",
-				Author:    "John Doe",
-				Recipient: "Jane Doe",
-			},
-			ok: false,
-		},
-	}
-
-	for _, tc := range cases {
-		got, ok := buildTitleFromMetadata(tc.metadata)
-		if ok != tc.ok {
-			t.Errorf("%s: buildTitleFromMetadata() ok = %v; want %v", tc.name, ok, tc.ok)
-			continue
+		if recorded[i].title != replayed[i].title || !strings.HasPrefix(recorded[i].title, "2025.01.15 - ") {
+			t.Errorf("%s: recorded %q, replayed %q", filepath.Base(files[i]), recorded[i].title, replayed[i].title)
 		}
-		if got != tc.want {
-			t.Errorf("%s: buildTitleFromMetadata() = %q; want %q", tc.name, got, tc.want)
+		if recorded[i].usage != replayed[i].usage || recorded[i].usage.TotalTokens == 0 {
+			t.Errorf("%s: recorded usage %+v, replayed %+v", filepath.Base(files[i]), recorded[i].usage, replayed[i].usage)
 		}
 	}
 }
-
-func TestCompactTitle(t *testing.T) {
-	in := "2022.02.23 - Termination of Employment - Notice of termination of employment and related procedures - Johannes Senn"
-	got := compactTitle(in)
-	if len(got) > maxFilenameLength {
-		t.Fatalf("compactTitle produced overlong title: %d chars", len(got))
-	}
-	if strings.Contains(got, "Notice of termination of employment and related procedures") {
-		t.Fatalf("compactTitle did not remove verbose overlapping part: %q", got)
-	}
-}
-
-func TestStripTrailingTranslation(t *testing.T) {
-	in := "Acme AG (Acme Corporation)"
-	got := stripTrailingTranslation(in)
-	want := "Acme AG"
-	if got != want {
-		t.Fatalf("stripTrailingTranslation(%q) = %q; want %q", in, got, want)
-	}
-}
-
-func TestParseMetadataResponse(t *testing.T) {
-	raw := "```json\n{\"date\":\"2024.01.15\",\"language\":\"de\",\"title\":\"Residence Permit Renewal\",\"document_type\":\"\",\"organization\":\"Office for Migration\",\"author\":\"\",\"recipient\":\"\",\"topic\":\"Residence Permit\"}\n```"
-	got, err := parseMetadataResponse(raw)
-	if err != nil {
-		t.Fatalf("parseMetadataResponse returned error: %v", err)
-	}
-	if got.Date != "2024.01.15" || got.Language != "de" || got.Title != "Residence Permit Renewal" || got.Topic != "Residence Permit" || got.Organization != "Office for Migration" {
-		t.Fatalf("unexpected metadata parsed: %+v", got)
-	}
-}
-
-func TestValidateModel(t *testing.T) {
-	if err := validateModel("gpt-5.4"); err != nil {
-		t.Errorf("validateModel returned error for valid model: %v", err)
-	}
-
-	err := validateModel("invalid-model")
-	if err == nil {
-		t.Fatalf("expected error for invalid model")
-	}
-
-	// ensure the error message lists valid models
-	for _, m := range validModels {
-		if !strings.Contains(err.Error(), m) {
-			t.Fatalf("error message does not contain %q", m)
-		}
-	}
-}
-
-func TestValidateReasoningEffort(t *testing.T) {
-	valid := []string{"none", "low", "medium", "high", "xhigh", "None", "HIGH"}
-	for _, effort := range valid {
-		if err := validateReasoningEffort(effort); err != nil {
-			t.Fatalf("validateReasoningEffort(%q) returned error: %v", effort, err)
-		}
-	}
-
-	if err := validateReasoningEffort("turbo"); err == nil {
-		t.Fatalf("expected error for invalid reasoning effort")
-	}
-}
@@ -0,0 +1,376 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputCSV   = "csv"
+)
+
+var validOutputFormats = []string{outputText, outputJSON, outputJSONL, outputCSV}
+
+// Result statuses reported by the machine-readable formats.
+const (
+	statusRenamed = "renamed"
+	statusCopied  = "copied"
+	statusDryRun  = "dry-run"
+	statusPrinted = "printed"
+	statusSkipped = "skipped"
+	statusFailed  = "failed"
+	statusDeleted = "deleted"
+	statusLinked  = "linked"
+	statusReview  = "review"
+)
+
+// resultWriter reports file results as they complete and a summary at the end.
+type resultWriter interface {
+	writeResult(result fileResult) error
+	finish(summary runSummary) error
+}
+
+// runSummary totals the results of a run.
+type runSummary struct {
+	total     int
+	succeeded int
+	skipped   int
+	failed    int
+	review    int
+	usage     nombra.Usage
+	duration  time.Duration
+	runID     string
+	// reviewList is the file listing the files held back by --review list.
+	reviewList string
+}
+
+func (s *runSummary) add(result fileResult) {
+	s.total++
+	s.usage = s.usage.Add(result.usage)
+	switch {
+	case result.err != nil:
+		s.failed++
+	case result.skipped:
+		s.skipped++
+	case result.review:
+		s.review++
+	default:
+		s.succeeded++
+	}
+}
+
+type fileRecord struct {
+	Type         string           `json:"type,omitempty"`
+	OriginalPath string           `json:"original_path"`
+	NewPath      string           `json:"new_path,omitempty"`
+	Title        string           `json:"title,omitempty"`
+	Status       string           `json:"status"`
+	Method       string           `json:"method,omitempty"`
+	Metadata     *nombra.Metadata `json:"metadata,omitempty"`
+	Usage        nombra.Usage     `json:"usage"`
+	DurationMS   int64            `json:"duration_ms"`
+	Error        string           `json:"error,omitempty"`
+	SkipReason   string           `json:"skip_reason,omitempty"`
+	DuplicateOf  string           `json:"duplicate_of,omitempty"`
+	Similarity   float64          `json:"similarity,omitempty"`
+	// Confidence is omitted when no title was built.
+	Confidence        *float64 `json:"confidence,omitempty"`
+	ConfidenceReasons []string `json:"confidence_reasons,omitempty"`
+}
+
+type summaryRecord struct {
+	Type       string       `json:"type,omitempty"`
+	Total      int          `json:"total"`
+	Succeeded  int          `json:"succeeded"`
+	Skipped    int          `json:"skipped"`
+	Failed     int          `json:"failed"`
+	Review     int          `json:"review"`
+	Usage      nombra.Usage `json:"usage"`
+	DurationMS int64        `json:"duration_ms"`
+	RunID      string       `json:"run_id,omitempty"`
+}
+
+func validateOutputFormat(format string) error {
+	for _, v := range validOutputFormats {
+		if format == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format %q. valid formats: %s", format, strings.Join(validOutputFormats, ", "))
+}
+
+func newResultWriter(format string, w io.Writer) resultWriter {
+	switch format {
+	case outputJSON:
+		return &jsonResultWriter{w: w}
+	case outputJSONL:
+		return &jsonlResultWriter{enc: json.NewEncoder(w)}
+	case outputCSV:
+		return &csvResultWriter{w: csv.NewWriter(w), fields: customFieldNames()}
+	default:
+		return textResultWriter{w: w}
+	}
+}
+
+func resultStatus(result fileResult) string {
+	switch {
+	case result.err != nil:
+		return statusFailed
+	case result.skipped:
+		return statusSkipped
+	case result.review:
+		return statusReview
+	case printOnly:
+		return statusPrinted
+	case dryRun:
+		return statusDryRun
+	case result.duplicate != nil && result.duplicate.action == duplicateDelete:
+		return statusDeleted
+	case result.duplicate != nil && result.duplicate.action == duplicateLink:
+		return statusLinked
+	case destMode == nombra.DestModeCopy:
+		return statusCopied
+	default:
+		return statusRenamed
+	}
+}
+
+func newFileRecord(result fileResult) fileRecord {
+	record := fileRecord{
+		OriginalPath: result.path,
+		NewPath:      result.newPath,
+		Title:        result.title,
+		Status:       resultStatus(result),
+		Method:       result.method,
+		Usage:        result.usage,
+		DurationMS:   result.duration.Milliseconds(),
+		SkipReason:   result.skipReason,
+	}
+	if !result.metadata.IsZero() {
+		metadata := result.metadata
+		record.Metadata = &metadata
+	}
+	if result.err != nil {
+		record.Error = result.err.Error()
+	}
+	if result.duplicate != nil {
+		record.DuplicateOf = result.duplicate.path
+		record.Similarity = result.duplicate.similarity
+	}
+	if result.title != "" {
+		score := result.confidence.Score
+		record.Confidence = &score
+		record.ConfidenceReasons = result.confidence.Reasons
+	}
+	return record
+}
+
+func newSummaryRecord(summary runSummary) summaryRecord {
+	return summaryRecord{
+		Total:      summary.total,
+		Succeeded:  summary.succeeded,
+		Skipped:    summary.skipped,
+		Failed:     summary.failed,
+		Review:     summary.review,
+		Usage:      summary.usage,
+		DurationMS: summary.duration.Milliseconds(),
+		RunID:      summary.runID,
+	}
+}
+
+// textResultWriter keeps the human readable output.
+type textResultWriter struct {
+	w io.Writer
+}
+
+func (t textResultWriter) writeResult(result fileResult) error {
+	printResult(t.w, result)
+	return nil
+}
+
+func (t textResultWriter) finish(summary runSummary) error {
+	if summary.total > 1 {
+		review := ""
+		if summary.review > 0 {
+			review = fmt.Sprintf(", %d to review", summary.review)
+		}
+		fmt.Fprintf(t.w, "Summary: %d succeeded, %d skipped, %d failed%s (total: %d)\n", summary.succeeded, summary.skipped, summary.failed, review, summary.total)
+		if summary.usage.TotalTokens > 0 {
+			fmt.Fprintf(t.w, "Usage: %s\n", formatUsage(summary.usage))
+		}
+	}
+	if summary.reviewList != "" {
+		fmt.Fprintf(t.w, "Review list: %s\n", summary.reviewList)
+	}
+	if summary.runID != "" {
+		fmt.Fprintf(t.w, "Run ID: %s (revert with: nombra undo %s)\n", summary.runID, summary.runID)
+	}
+	return nil
+}
+
+// jsonResultWriter collects every record and writes a single document.
+type jsonResultWriter struct {
+	w     io.Writer
+	files []fileRecord
+}
+
+func (j *jsonResultWriter) writeResult(result fileResult) error {
+	j.files = append(j.files, newFileRecord(result))
+	return nil
+}
+
+func (j *jsonResultWriter) finish(summary runSummary) error {
+	files := j.files
+	if files == nil {
+		files = []fileRecord{}
+	}
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Files   []fileRecord  `json:"files"`
+		Summary summaryRecord `json:"summary"`
+	}{files, newSummaryRecord(summary)})
+}
+
+// jsonlResultWriter writes one JSON object per line as results arrive.
+type jsonlResultWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlResultWriter) writeResult(result fileResult) error {
+	record := newFileRecord(result)
+	record.Type = "file"
+	return j.enc.Encode(record)
+}
+
+func (j *jsonlResultWriter) finish(summary runSummary) error {
+	record := newSummaryRecord(summary)
+	record.Type = "summary"
+	return j.enc.Encode(record)
+}
+
+var csvHeader = []string{
+	"type", "original_path", "new_path", "title", "status", "method",
+	"date", "language", "metadata_title", "document_type", "organization", "author", "recipient", "topic",
+	"prompt_tokens", "completion_tokens", "reasoning_tokens", "total_tokens", "cost_usd", "duration_ms", "error",
+	"duplicate_of", "similarity", "confidence",
+	"total", "succeeded", "skipped", "failed", "review", "run_id",
+}
+
+// customFieldNames returns the names of the configured custom fields, which
+// become extra CSV columns.
+func customFieldNames() []string {
+	if namer == nil {
+		return nil
+	}
+	var names []string
+	for _, field := range namer.Options().Fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+// csvResultWriter writes a header, one row per file and a final summary row.
+// Custom fields are appended as extra columns.
+type csvResultWriter struct {
+	w             *csv.Writer
+	fields        []string
+	headerWritten bool
+}
+
+func (c *csvResultWriter) write(row []string, extra map[string]string) error {
+	if !c.headerWritten {
+		if err := c.w.Write(append(slices.Clone(csvHeader), c.fields...)); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+	for _, field := range c.fields {
+		row = append(row, extra[field])
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvResultWriter) writeResult(result fileResult) error {
+	r := newFileRecord(result)
+	m := result.metadata
+	return c.write([]string{
+		"file", r.OriginalPath, r.NewPath, r.Title, r.Status, r.Method,
+		m.Date, m.Language, m.Title, m.DocumentType, m.Organization, m.Author, m.Recipient, m.Topic,
+		strconv.Itoa(r.Usage.PromptTokens), strconv.Itoa(r.Usage.CompletionTokens), strconv.Itoa(r.Usage.ReasoningTokens),
+		strconv.Itoa(r.Usage.TotalTokens), formatCost(r.Usage.Cost),
+		strconv.FormatInt(r.DurationMS, 10), r.Error,
+		r.DuplicateOf, formatSimilarity(r.Similarity), formatScore(r.Confidence),
+		"", "", "", "", "", "",
+	}, m.Extra)
+}
+
+func (c *csvResultWriter) finish(summary runSummary) error {
+	s := newSummaryRecord(summary)
+	return c.write([]string{
+		"summary", "", "", "", "", "",
+		"", "", "", "", "", "", "", "",
+		strconv.Itoa(s.Usage.PromptTokens), strconv.Itoa(s.Usage.CompletionTokens), strconv.Itoa(s.Usage.ReasoningTokens),
+		strconv.Itoa(s.Usage.TotalTokens), formatCost(s.Usage.Cost),
+		strconv.FormatInt(s.DurationMS, 10), "",
+		"", "", "",
+		strconv.Itoa(s.Total), strconv.Itoa(s.Succeeded), strconv.Itoa(s.Skipped), strconv.Itoa(s.Failed), strconv.Itoa(s.Review), s.RunID,
+	}, nil)
+}
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 6, 64)
+}
+
+func formatSimilarity(similarity float64) string {
+	if similarity == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(similarity, 'f', 2, 64)
+}
+
+func formatScore(score *float64) string {
+	if score == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*score, 'f', 2, 64)
+}
+
+// displayPaths returns how a rename is shown: base names when the file stayed
+// in its directory, full paths when it moved to another one.
+func displayPaths(from, to string) (string, string) {
+	if filepath.Dir(from) == filepath.Dir(to) {
+		return filepath.Base(from), filepath.Base(to)
+	}
+	return from, to
+}
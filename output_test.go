@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+func sampleResults() []fileResult {
+	return []fileResult{
+		{
+			path:     "/docs/scan.pdf",
+			newPath:  "/docs/2024.03.01 Invoice.pdf",
+			title:    "2024.03.01 Invoice",
+			metadata: nombra.Metadata{Date: "2024.03.01", DocumentType: "Invoice", Organization: "ACME"},
+			method:   nombra.MethodOCR,
+			usage:    nombra.Usage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+			duration: 1500 * time.Millisecond,
+		},
+		{
+			path:  "/docs/broken.pdf",
+			usage: nombra.Usage{PromptTokens: 5, TotalTokens: 5},
+			err:   errors.New("PDF processing error: no text"),
+		},
+	}
+}
+
+func writeSample(t *testing.T, format string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newResultWriter(format, &buf)
+	var summary runSummary
+	for _, result := range sampleResults() {
+		summary.add(result)
+		if err := w.writeResult(result); err != nil {
+			t.Fatalf("writeResult: %v", err)
+		}
+	}
+	summary.runID = "20240301-120000-abcd"
+	if err := w.finish(summary); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	return buf.String()
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range validOutputFormats {
+		if err := validateOutputFormat(format); err != nil {
+			t.Errorf("validateOutputFormat(%q) returned error: %v", format, err)
+		}
+	}
+	if err := validateOutputFormat("xml"); err == nil {
+		t.Fatalf("expected error for invalid format")
+	}
+}
+
+func TestJSONLOutput(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(writeSample(t, outputJSONL)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines; want 3:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+
+	var first fileRecord
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("invalid file record: %v", err)
+	}
+	if first.Type != "file" || first.Status != statusRenamed || first.Method != nombra.MethodOCR || first.DurationMS != 1500 {
+		t.Errorf("unexpected file record: %+v", first)
+	}
+	if first.Metadata == nil || first.Metadata.Organization != "ACME" || first.Usage.TotalTokens != 120 {
+		t.Errorf("metadata or usage missing: %+v", first)
+	}
+
+	var failed fileRecord
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil {
+		t.Fatalf("invalid file record: %v", err)
+	}
+	if failed.Status != statusFailed || failed.Error == "" || failed.Metadata != nil {
+		t.Errorf("unexpected failed record: %+v", failed)
+	}
+
+	var summary summaryRecord
+	if err := json.Unmarshal([]byte(lines[2]), &summary); err != nil {
+		t.Fatalf("invalid summary record: %v", err)
+	}
+	if summary.Type != "summary" || summary.Total != 2 || summary.Succeeded != 1 || summary.Failed != 1 || summary.Usage.TotalTokens != 125 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
+
+func TestTextOutput(t *testing.T) {
+	out := writeSample(t, outputText)
+	for _, want := range []string{
+		"Successfully renamed:\n  scan.pdf\n  -> 2024.03.01 Invoice.pdf",
+		"[FAIL] broken.pdf: PDF processing error: no text",
+		"Summary: 1 succeeded, 0 skipped, 1 failed (total: 2)",
+		"Run ID: 20240301-120000-abcd",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("text output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	var doc struct {
+		Files   []fileRecord  `json:"files"`
+		Summary summaryRecord `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(writeSample(t, outputJSON)), &doc); err != nil {
+		t.Fatalf("invalid JSON document: %v", err)
+	}
+	if len(doc.Files) != 2 || doc.Files[0].Type != "" || doc.Summary.RunID != "20240301-120000-abcd" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(writeSample(t, outputCSV))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows; want header, two files and summary", len(rows))
+	}
+	column := map[string]int{}
+	for i, name := range rows[0] {
+		column[name] = i
+	}
+	if got := rows[1][column["organization"]]; got != "ACME" {
+		t.Errorf("organization = %q; want ACME", got)
+	}
+	if got := rows[2][column["status"]]; got != statusFailed {
+		t.Errorf("status = %q; want failed", got)
+	}
+	if got := rows[3][column["type"]]; got != "summary" {
+		t.Errorf("last row type = %q; want summary", got)
+	}
+	if got := rows[3][column["total_tokens"]]; got != "125" {
+		t.Errorf("summary total_tokens = %q; want 125", got)
+	}
+}
@@ -0,0 +1,746 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/rtyx/nombra/nombra"
+)
+
+// xmpNamespace holds the fields Dublin Core has no property for.
+const xmpNamespace = "https://github.com/rtyx/nombra/ns/1.0/"
+
+// pdfRef is an indirect object reference.
+type pdfRef struct {
+	num, gen int
+}
+
+func (r pdfRef) String() string {
+	return fmt.Sprintf("%d %d R", r.num, r.gen)
+}
+
+// pdfDict is a parsed dictionary whose values are kept as raw PDF syntax, so
+// references and nested objects are written back unchanged.
+type pdfDict struct {
+	keys   []string
+	values map[string]string
+}
+
+func (d *pdfDict) get(key string) (string, bool) {
+	v, ok := d.values[key]
+	return v, ok
+}
+
+func (d *pdfDict) set(key, value string) {
+	if d.values == nil {
+		d.values = map[string]string{}
+	}
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+func (d *pdfDict) bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString("<<")
+	for _, key := range d.keys {
+		fmt.Fprintf(&b, " /%s %s", key, d.values[key])
+	}
+	b.WriteString(" >>")
+	return b.Bytes()
+}
+
+// pdfObject is an object written by an incremental update.
+type pdfObject struct {
+	ref  pdfRef
+	body []byte
+}
+
+// writePDFMetadata appends an incremental update to the PDF at path that sets
+// the document Info dictionary and an XMP metadata stream from metadata. The
+// original bytes are left untouched; if the result cannot be read back the
+// update is truncated away again.
+func writePDFMetadata(path string, metadata nombra.Metadata, title string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	update, err := buildMetadataUpdate(data, metadata, title)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(update); err != nil {
+		file.Close()
+		os.Truncate(path, int64(len(data)))
+		return fmt.Errorf("failed to append metadata: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Truncate(path, int64(len(data)))
+		return fmt.Errorf("failed to append metadata: %w", err)
+	}
+
+	if err := checkPDFReadable(path); err != nil {
+		os.Truncate(path, int64(len(data)))
+		return fmt.Errorf("metadata update produced an unreadable PDF and was reverted: %w", err)
+	}
+	return nil
+}
+
+func checkPDFReadable(path string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if r.Trailer().Key("Root").Key("Type").Name() != "Catalog" {
+		return fmt.Errorf("document catalog not found")
+	}
+	return nil
+}
+
+// buildMetadataUpdate returns the bytes to append to data: the new Info
+// dictionary, the XMP stream, the catalog pointing at it and a cross-reference
+// section of the same kind as the previous one.
+func buildMetadataUpdate(data []byte, metadata nombra.Metadata, title string) ([]byte, error) {
+	prevXref, err := findStartXref(data)
+	if err != nil {
+		return nil, err
+	}
+	trailer, xrefStream, err := readTrailer(data, prevXref)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := trailer.get("Encrypt"); ok {
+		return nil, fmt.Errorf("encrypted PDFs are not supported")
+	}
+
+	size := 0
+	if raw, ok := trailer.get("Size"); ok {
+		size, _ = strconv.Atoi(raw)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("trailer has no valid /Size")
+	}
+	nextNum := size
+	newRef := func() pdfRef {
+		ref := pdfRef{num: nextNum}
+		nextNum++
+		return ref
+	}
+
+	rootRaw, _ := trailer.get("Root")
+	rootRef, ok := parseRef(rootRaw)
+	if !ok {
+		return nil, fmt.Errorf("trailer has no /Root reference")
+	}
+	catalog, err := findObjectDict(data, rootRef)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read document catalog: %w", err)
+	}
+
+	var info pdfDict
+	infoRaw, _ := trailer.get("Info")
+	infoRef, ok := parseRef(infoRaw)
+	if ok {
+		if existing, err := findObjectDict(data, infoRef); err == nil {
+			info = existing
+		}
+	} else {
+		if strings.HasPrefix(infoRaw, "<<") {
+			if existing, _, err := parsePDFDict([]byte(infoRaw), 0); err == nil {
+				info = existing
+			}
+		}
+		infoRef = newRef()
+	}
+	setInfoFields(&info, metadata, title)
+
+	metadataRaw, _ := catalog.get("Metadata")
+	metadataRef, ok := parseRef(metadataRaw)
+	if !ok {
+		metadataRef = newRef()
+	}
+	catalog.set("Metadata", metadataRef.String())
+
+	xmp := buildXMP(metadata, title)
+	var stream bytes.Buffer
+	fmt.Fprintf(&stream, "<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n", len(xmp))
+	stream.Write(xmp)
+	stream.WriteString("\nendstream")
+
+	objects := []pdfObject{
+		{ref: infoRef, body: info.bytes()},
+		{ref: metadataRef, body: stream.Bytes()},
+		{ref: rootRef, body: catalog.bytes()},
+	}
+
+	var out bytes.Buffer
+	if len(data) > 0 && data[len(data)-1] != '\n' && data[len(data)-1] != '\r' {
+		out.WriteByte('\n')
+	}
+	offsets := map[int]int{}
+	for _, obj := range objects {
+		offsets[obj.ref.num] = len(data) + out.Len()
+		fmt.Fprintf(&out, "%d %d obj\n", obj.ref.num, obj.ref.gen)
+		out.Write(obj.body)
+		out.WriteString("\nendobj\n")
+	}
+
+	next := pdfDict{}
+	next.set("Root", rootRef.String())
+	next.set("Info", infoRef.String())
+	next.set("Prev", strconv.Itoa(prevXref))
+	if id, ok := trailer.get("ID"); ok {
+		next.set("ID", id)
+	}
+
+	if xrefStream {
+		writeXrefStream(&out, len(data), objects, offsets, newRef(), &next, max(size, nextNum))
+	} else {
+		writeXrefTable(&out, len(data), objects, offsets, &next, max(size, nextNum))
+	}
+	return out.Bytes(), nil
+}
+
+func setInfoFields(info *pdfDict, metadata nombra.Metadata, title string) {
+	if metadata.Title != "" {
+		title = metadata.Title
+	}
+	fields := []struct{ key, value string }{
+		{"Title", title},
+		{"Author", firstNonEmpty(metadata.Author, metadata.Organization)},
+		{"Subject", metadata.Topic},
+		{"Organization", metadata.Organization},
+		{"Recipient", metadata.Recipient},
+		{"DocumentType", metadata.DocumentType},
+		{"Language", metadata.Language},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			info.set(field.key, pdfTextString(field.value))
+		}
+	}
+	if date, ok := parseMetadataDate(metadata.Date); ok {
+		info.set("DocumentDate", pdfTextString("D:"+date.Format("20060102")))
+	}
+	info.set("ModDate", pdfTextString("D:"+time.Now().UTC().Format("20060102150405")+"Z"))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func parseMetadataDate(value string) (time.Time, bool) {
+	date, err := time.Parse(nombra.DateLayout, value)
+	return date, err == nil
+}
+
+// pdfTextString encodes s as a literal string, or as UTF-16BE when it
+// contains characters outside printable ASCII.
+func pdfTextString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+		return "(" + r.Replace(s) + ")"
+	}
+
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// languageCodes maps the language names the model tends to return to the
+// RFC 3066 codes expected by dc:language.
+var languageCodes = map[string]string{
+	"english": "en", "german": "de", "deutsch": "de", "spanish": "es", "español": "es",
+	"castellano": "es", "french": "fr", "français": "fr", "italian": "it", "italiano": "it",
+	"portuguese": "pt", "português": "pt", "dutch": "nl", "nederlands": "nl", "catalan": "ca",
+	"català": "ca", "polish": "pl", "polski": "pl", "swedish": "sv", "danish": "da",
+	"norwegian": "no", "finnish": "fi", "czech": "cs", "japanese": "ja", "chinese": "zh",
+}
+
+func languageCode(language string) string {
+	lower := strings.ToLower(strings.TrimSpace(language))
+	if code, ok := languageCodes[lower]; ok {
+		return code
+	}
+	return language
+}
+
+func buildXMP(metadata nombra.Metadata, title string) []byte {
+	if metadata.Title != "" {
+		title = metadata.Title
+	}
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	b.WriteString("    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n")
+	fmt.Fprintf(&b, "    xmlns:nombra=\"%s\">\n", xmpNamespace)
+	if title != "" {
+		fmt.Fprintf(&b, "   <dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", esc(title))
+	}
+	if creator := firstNonEmpty(metadata.Author, metadata.Organization); creator != "" {
+		fmt.Fprintf(&b, "   <dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", esc(creator))
+	}
+	if date, ok := parseMetadataDate(metadata.Date); ok {
+		fmt.Fprintf(&b, "   <dc:date><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:date>\n", date.Format("2006-01-02"))
+	}
+	if metadata.Language != "" {
+		fmt.Fprintf(&b, "   <dc:language><rdf:Bag><rdf:li>%s</rdf:li></rdf:Bag></dc:language>\n", esc(languageCode(metadata.Language)))
+	}
+	if metadata.Topic != "" {
+		fmt.Fprintf(&b, "   <dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", esc(metadata.Topic))
+	}
+	if metadata.DocumentType != "" {
+		fmt.Fprintf(&b, "   <dc:type><rdf:Bag><rdf:li>%s</rdf:li></rdf:Bag></dc:type>\n", esc(metadata.DocumentType))
+	}
+	if metadata.Organization != "" {
+		fmt.Fprintf(&b, "   <nombra:organization>%s</nombra:organization>\n", esc(metadata.Organization))
+	}
+	if metadata.Recipient != "" {
+		fmt.Fprintf(&b, "   <nombra:recipient>%s</nombra:recipient>\n", esc(metadata.Recipient))
+	}
+	b.WriteString("  </rdf:Description>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+// xrefSubsections groups the sorted object numbers into runs of consecutive numbers.
+func xrefSubsections(nums []int) [][]int {
+	sort.Ints(nums)
+	var sections [][]int
+	for _, n := range nums {
+		if last := len(sections) - 1; last >= 0 && sections[last][len(sections[last])-1] == n-1 {
+			sections[last] = append(sections[last], n)
+			continue
+		}
+		sections = append(sections, []int{n})
+	}
+	return sections
+}
+
+func writeXrefTable(out *bytes.Buffer, base int, objects []pdfObject, offsets map[int]int, trailer *pdfDict, size int) {
+	gens := map[int]int{}
+	nums := make([]int, 0, len(objects))
+	for _, obj := range objects {
+		gens[obj.ref.num] = obj.ref.gen
+		nums = append(nums, obj.ref.num)
+	}
+
+	xrefOffset := base + out.Len()
+	out.WriteString("xref\n")
+	for _, section := range xrefSubsections(nums) {
+		fmt.Fprintf(out, "%d %d\n", section[0], len(section))
+		for _, n := range section {
+			fmt.Fprintf(out, "%010d %05d n\r\n", offsets[n], gens[n])
+		}
+	}
+	trailer.set("Size", strconv.Itoa(size))
+	out.WriteString("trailer\n")
+	out.Write(trailer.bytes())
+	fmt.Fprintf(out, "\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+}
+
+func writeXrefStream(out *bytes.Buffer, base int, objects []pdfObject, offsets map[int]int, self pdfRef, trailer *pdfDict, size int) {
+	xrefOffset := base + out.Len()
+	offsets[self.num] = xrefOffset
+	gens := map[int]int{self.num: 0}
+	nums := []int{self.num}
+	for _, obj := range objects {
+		gens[obj.ref.num] = obj.ref.gen
+		nums = append(nums, obj.ref.num)
+	}
+
+	var index []string
+	var entries bytes.Buffer
+	for _, section := range xrefSubsections(nums) {
+		index = append(index, strconv.Itoa(section[0]), strconv.Itoa(len(section)))
+		for _, n := range section {
+			entries.WriteByte(1)
+			binary.Write(&entries, binary.BigEndian, uint32(offsets[n]))
+			binary.Write(&entries, binary.BigEndian, uint16(gens[n]))
+		}
+	}
+
+	dict := pdfDict{}
+	dict.set("Type", "/XRef")
+	dict.set("Size", strconv.Itoa(max(size, self.num+1)))
+	dict.set("W", "[1 4 2]")
+	dict.set("Index", "["+strings.Join(index, " ")+"]")
+	for _, key := range trailer.keys {
+		dict.set(key, trailer.values[key])
+	}
+	dict.set("Length", strconv.Itoa(entries.Len()))
+
+	fmt.Fprintf(out, "%d 0 obj\n", self.num)
+	out.Write(dict.bytes())
+	out.WriteString("\nstream\n")
+	out.Write(entries.Bytes())
+	out.WriteString("\nendstream\nendobj\n")
+	fmt.Fprintf(out, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+}
+
+func findStartXref(data []byte) (int, error) {
+	idx := bytes.LastIndex(data, []byte("startxref"))
+	if idx < 0 {
+		return 0, fmt.Errorf("not a PDF file: startxref not found")
+	}
+	pos := skipPDFSpace(data, idx+len("startxref"))
+	end := pos
+	for end < len(data) && data[end] >= '0' && data[end] <= '9' {
+		end++
+	}
+	offset, err := strconv.Atoi(string(data[pos:end]))
+	if err != nil || offset >= len(data) {
+		return 0, fmt.Errorf("invalid startxref offset")
+	}
+	return offset, nil
+}
+
+// readTrailer parses the trailer of the cross-reference section at offset.
+// For cross-reference streams the stream dictionary is the trailer.
+func readTrailer(data []byte, offset int) (pdfDict, bool, error) {
+	pos := skipPDFSpace(data, offset)
+	if bytes.HasPrefix(data[pos:], []byte("xref")) {
+		idx := bytes.Index(data[pos:], []byte("trailer"))
+		if idx < 0 {
+			return pdfDict{}, false, fmt.Errorf("trailer not found")
+		}
+		dict, _, err := parsePDFDict(data, pos+idx+len("trailer"))
+		return dict, false, err
+	}
+
+	loc := objectHeader.FindSubmatchIndex(data[pos:])
+	if loc == nil || loc[0] != 0 {
+		return pdfDict{}, false, fmt.Errorf("cross-reference section not found at offset %d", offset)
+	}
+	dict, _, err := parsePDFDict(data, pos+loc[1])
+	if err != nil {
+		return pdfDict{}, false, err
+	}
+	if v, _ := dict.get("Type"); v != "/XRef" {
+		return pdfDict{}, false, fmt.Errorf("cross-reference section not found at offset %d", offset)
+	}
+	return dict, true, nil
+}
+
+var objectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// findObjectDict returns the dictionary of the latest definition of ref,
+// looking inside object streams when the object is not stored directly.
+func findObjectDict(data []byte, ref pdfRef) (pdfDict, error) {
+	pattern := regexp.MustCompile(fmt.Sprintf(`(?:^|[^0-9])%d\s+%d\s+obj\b`, ref.num, ref.gen))
+	matches := pattern.FindAllIndex(data, -1)
+	if len(matches) > 0 {
+		dict, _, err := parsePDFDict(data, matches[len(matches)-1][1])
+		return dict, err
+	}
+
+	var found *pdfDict
+	for _, loc := range objectHeader.FindAllIndex(data, -1) {
+		dict, end, err := parsePDFDict(data, loc[1])
+		if err != nil {
+			continue
+		}
+		if v, _ := dict.get("Type"); v != "/ObjStm" {
+			continue
+		}
+		if d, ok := objectFromStream(data, dict, end, ref.num); ok {
+			found = &d
+		}
+	}
+	if found == nil {
+		return pdfDict{}, fmt.Errorf("object %d %d not found", ref.num, ref.gen)
+	}
+	return *found, nil
+}
+
+func objectFromStream(data []byte, dict pdfDict, pos, num int) (pdfDict, bool) {
+	content, err := streamContent(data, dict, pos)
+	if err != nil {
+		return pdfDict{}, false
+	}
+	count, _ := strconv.Atoi(dict.values["N"])
+	first, _ := strconv.Atoi(dict.values["First"])
+	if first <= 0 || first > len(content) {
+		return pdfDict{}, false
+	}
+
+	header := strings.Fields(string(content[:first]))
+	for i := 0; i+1 < len(header) && i/2 < count; i += 2 {
+		n, _ := strconv.Atoi(header[i])
+		if n != num {
+			continue
+		}
+		offset, err := strconv.Atoi(header[i+1])
+		if err != nil || first+offset >= len(content) {
+			return pdfDict{}, false
+		}
+		d, _, err := parsePDFDict(content, first+offset)
+		return d, err == nil
+	}
+	return pdfDict{}, false
+}
+
+// streamContent returns the decoded data of the stream whose dictionary ends
+// at pos. Only unfiltered and FlateDecode streams without predictors are needed
+// for object streams.
+func streamContent(data []byte, dict pdfDict, pos int) ([]byte, error) {
+	pos = skipPDFSpace(data, pos)
+	if !bytes.HasPrefix(data[pos:], []byte("stream")) {
+		return nil, fmt.Errorf("stream keyword not found")
+	}
+	pos += len("stream")
+	if pos < len(data) && data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(data) && data[pos] == '\n' {
+		pos++
+	}
+
+	end := -1
+	if length, err := strconv.Atoi(dict.values["Length"]); err == nil && pos+length <= len(data) {
+		end = pos + length
+	} else if idx := bytes.Index(data[pos:], []byte("endstream")); idx >= 0 {
+		end = pos + idx
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("endstream not found")
+	}
+	raw := data[pos:end]
+
+	switch filter := dict.values["Filter"]; filter {
+	case "":
+		return raw, nil
+	case "/FlateDecode", "[/FlateDecode]", "[ /FlateDecode ]":
+		if _, ok := dict.get("DecodeParms"); ok {
+			return nil, fmt.Errorf("unsupported stream predictor")
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported stream filter %s", filter)
+	}
+}
+
+func parseRef(raw string) (pdfRef, bool) {
+	fields := strings.Fields(raw)
+	if len(fields) != 3 || fields[2] != "R" {
+		return pdfRef{}, false
+	}
+	num, err1 := strconv.Atoi(fields[0])
+	gen, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil {
+		return pdfRef{}, false
+	}
+	return pdfRef{num: num, gen: gen}, true
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipPDFSpace skips whitespace and comments.
+func skipPDFSpace(data []byte, pos int) int {
+	for pos < len(data) {
+		switch {
+		case isPDFSpace(data[pos]):
+			pos++
+		case data[pos] == '%':
+			for pos < len(data) && data[pos] != '\n' && data[pos] != '\r' {
+				pos++
+			}
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+func parsePDFDict(data []byte, pos int) (pdfDict, int, error) {
+	pos = skipPDFSpace(data, pos)
+	if !bytes.HasPrefix(data[pos:], []byte("<<")) {
+		return pdfDict{}, pos, fmt.Errorf("dictionary expected at offset %d", pos)
+	}
+	pos += 2
+
+	dict := pdfDict{values: map[string]string{}}
+	for {
+		pos = skipPDFSpace(data, pos)
+		if pos >= len(data) {
+			return pdfDict{}, pos, fmt.Errorf("unterminated dictionary")
+		}
+		if bytes.HasPrefix(data[pos:], []byte(">>")) {
+			return dict, pos + 2, nil
+		}
+		if data[pos] != '/' {
+			return pdfDict{}, pos, fmt.Errorf("name expected at offset %d", pos)
+		}
+		keyEnd := skipPDFToken(data, pos+1)
+		key := string(data[pos+1 : keyEnd])
+
+		start := skipPDFSpace(data, keyEnd)
+		end, err := skipPDFValue(data, start)
+		if err != nil {
+			return pdfDict{}, end, err
+		}
+		dict.set(key, string(data[start:end]))
+		pos = end
+	}
+}
+
+func skipPDFToken(data []byte, pos int) int {
+	for pos < len(data) && !isPDFSpace(data[pos]) && !isPDFDelimiter(data[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// skipPDFValue returns the offset just past the object starting at pos. An
+// integer followed by a generation and R is consumed as one reference.
+func skipPDFValue(data []byte, pos int) (int, error) {
+	if pos >= len(data) {
+		return pos, fmt.Errorf("unexpected end of data")
+	}
+	switch data[pos] {
+	case '/':
+		return skipPDFToken(data, pos+1), nil
+	case '(':
+		depth := 0
+		for i := pos; i < len(data); i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return i + 1, nil
+				}
+			}
+		}
+		return len(data), fmt.Errorf("unterminated string")
+	case '<':
+		if bytes.HasPrefix(data[pos:], []byte("<<")) {
+			_, end, err := parsePDFDict(data, pos)
+			return end, err
+		}
+		end := bytes.IndexByte(data[pos:], '>')
+		if end < 0 {
+			return len(data), fmt.Errorf("unterminated hex string")
+		}
+		return pos + end + 1, nil
+	case '[':
+		pos++
+		for {
+			pos = skipPDFSpace(data, pos)
+			if pos >= len(data) {
+				return pos, fmt.Errorf("unterminated array")
+			}
+			if data[pos] == ']' {
+				return pos + 1, nil
+			}
+			end, err := skipPDFValue(data, pos)
+			if err != nil {
+				return end, err
+			}
+			pos = end
+		}
+	}
+
+	end := skipPDFToken(data, pos)
+	if end == pos {
+		return pos, fmt.Errorf("unexpected %q at offset %d", data[pos], pos)
+	}
+	if _, err := strconv.Atoi(string(data[pos:end])); err == nil {
+		genStart := skipPDFSpace(data, end)
+		genEnd := skipPDFToken(data, genStart)
+		if _, err := strconv.Atoi(string(data[genStart:genEnd])); err == nil && genEnd > genStart {
+			r := skipPDFSpace(data, genEnd)
+			if r < len(data) && data[r] == 'R' && (r+1 == len(data) || isPDFSpace(data[r+1]) || isPDFDelimiter(data[r+1])) {
+				return r + 1, nil
+			}
+		}
+	}
+	return end, nil
+}
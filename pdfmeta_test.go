@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/rtyx/nombra/nombra"
+)
+
+var testPDFObjects = []string{
+	"<< /Type /Catalog /Pages 2 0 R >>",
+	"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+	"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	"<< /Producer (Scanner \\(v2\\)) /Title (scan0001) >>",
+}
+
+// buildTestPDF writes a minimal one-page PDF with a classic cross-reference
+// table, or with a cross-reference stream when xrefStream is set.
+func buildTestPDF(t *testing.T, xrefStream bool) string {
+	t.Helper()
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	offsets := make([]int, len(testPDFObjects)+1)
+	for i, body := range testPDFObjects {
+		offsets[i+1] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+
+	size := len(testPDFObjects) + 1
+	xrefOffset := b.Len()
+	if xrefStream {
+		offsets = append(offsets, xrefOffset)
+		size++
+		var entries bytes.Buffer
+		entries.Write([]byte{0, 0, 0, 0xff})
+		for _, offset := range offsets[1:] {
+			entries.WriteByte(1)
+			binary.Write(&entries, binary.BigEndian, uint16(offset))
+			entries.WriteByte(0)
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 2 1] /Root 1 0 R /Info 4 0 R /Length %d >>\nstream\n", size-1, size, entries.Len())
+		b.Write(entries.Bytes())
+		b.WriteString("\nendstream\nendobj\n")
+	} else {
+		fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f\r\n", size)
+		for _, offset := range offsets[1:] {
+			fmt.Fprintf(&b, "%010d 00000 n\r\n", offset)
+		}
+		fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R /ID [<0102> <0102>] >>\n", size)
+	}
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	path := filepath.Join(t.TempDir(), "scan.pdf")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write test PDF: %v", err)
+	}
+	return path
+}
+
+func TestWritePDFMetadata(t *testing.T) {
+	metadata := nombra.Metadata{
+		Date:         "2024.03.01",
+		Language:     "German",
+		DocumentType: "Rechnung",
+		Organization: "Stadtwerke München",
+		Recipient:    "Max Mustermann",
+		Topic:        "Strom & Gas",
+	}
+
+	for _, xrefStream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("xrefStream=%v", xrefStream), func(t *testing.T) {
+			path := buildTestPDF(t, xrefStream)
+			original, _ := os.ReadFile(path)
+
+			if err := writePDFMetadata(path, metadata, "2024.03.01 Stadtwerke München Rechnung"); err != nil {
+				t.Fatalf("writePDFMetadata returned error: %v", err)
+			}
+
+			updated, _ := os.ReadFile(path)
+			if !bytes.HasPrefix(updated, original) {
+				t.Fatalf("original bytes were modified; expected an incremental update")
+			}
+
+			f, r, err := pdf.Open(path)
+			if err != nil {
+				t.Fatalf("updated PDF cannot be opened: %v", err)
+			}
+			defer f.Close()
+
+			info := r.Trailer().Key("Info")
+			if got := info.Key("Title").Text(); got != "2024.03.01 Stadtwerke München Rechnung" {
+				t.Errorf("Info Title = %q", got)
+			}
+			if got := info.Key("Author").Text(); got != "Stadtwerke München" {
+				t.Errorf("Info Author = %q", got)
+			}
+			if got := info.Key("Producer").Text(); got != "Scanner (v2)" {
+				t.Errorf("existing Info entry lost: Producer = %q", got)
+			}
+			if r.NumPage() != 1 {
+				t.Errorf("NumPage() = %d; want 1", r.NumPage())
+			}
+
+			stream := r.Trailer().Key("Root").Key("Metadata")
+			if stream.Key("Subtype").Name() != "XML" {
+				t.Fatalf("catalog has no XMP metadata stream")
+			}
+			xmp, _ := io.ReadAll(stream.Reader())
+			for _, want := range []string{
+				"<dc:date><rdf:Seq><rdf:li>2024-03-01</rdf:li>",
+				"<rdf:li>de</rdf:li>",
+				"<nombra:organization>Stadtwerke München</nombra:organization>",
+				"<nombra:recipient>Max Mustermann</nombra:recipient>",
+				"Strom &amp; Gas",
+			} {
+				if !strings.Contains(string(xmp), want) {
+					t.Errorf("XMP missing %q:\n%s", want, xmp)
+				}
+			}
+		})
+	}
+}
+
+func TestWritePDFMetadataTwice(t *testing.T) {
+	path := buildTestPDF(t, false)
+	for _, title := range []string{"First", "Second"} {
+		if err := writePDFMetadata(path, nombra.Metadata{Title: title}, title); err != nil {
+			t.Fatalf("writePDFMetadata(%q) returned error: %v", title, err)
+		}
+	}
+
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		t.Fatalf("updated PDF cannot be opened: %v", err)
+	}
+	defer f.Close()
+	if got := r.Trailer().Key("Info").Key("Title").Text(); got != "Second" {
+		t.Errorf("Info Title = %q; want Second", got)
+	}
+}
+
+func TestWritePDFMetadataRejectsInvalidFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4\nnot really a pdf\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePDFMetadata(path, nombra.Metadata{Title: "x"}, "x"); err == nil {
+		t.Fatalf("expected error for a PDF without cross-reference data")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "%PDF-1.4\nnot really a pdf\n" {
+		t.Fatalf("invalid file was modified")
+	}
+}
+
+func TestPDFTextString(t *testing.T) {
+	tests := map[string]string{
+		"Invoice (2024)": `(Invoice \(2024\))`,
+		`a\b`:            `(a\\b)`,
+		"München":        "<FEFF004D00FC006E006300680065006E>",
+	}
+	for in, want := range tests {
+		if got := pdfTextString(in); got != want {
+			t.Errorf("pdfTextString(%q) = %s; want %s", in, got, want)
+		}
+	}
+}
+
+func TestParsePDFDictKeepsReferences(t *testing.T) {
+	dict, _, err := parsePDFDict([]byte("<< /Type /Catalog /Pages 2 0 R /Names << /Dests 7 0 R >> /Kids [1 0 R 3 0 R] /Lang (en) >>"), 0)
+	if err != nil {
+		t.Fatalf("parsePDFDict returned error: %v", err)
+	}
+	if got := dict.values["Pages"]; got != "2 0 R" {
+		t.Errorf("Pages = %q", got)
+	}
+	if got := dict.values["Kids"]; got != "[1 0 R 3 0 R]" {
+		t.Errorf("Kids = %q", got)
+	}
+	if got := dict.values["Names"]; got != "<< /Dests 7 0 R >>" {
+		t.Errorf("Names = %q", got)
+	}
+	if strings.Join(dict.keys, ",") != "Type,Pages,Names,Kids,Lang" {
+		t.Errorf("key order = %v", dict.keys)
+	}
+}
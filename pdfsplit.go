@@ -0,0 +1,504 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// inheritedPageKeys are the page attributes that may be set on an ancestor in
+// the page tree (ISO 32000-1, 7.7.3.4).
+var inheritedPageKeys = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// pdfDocument indexes the objects of a PDF held in memory, so that pages can be
+// copied into new files.
+type pdfDocument struct {
+	data    []byte
+	offsets map[int]int
+	packed  map[int]packedObject
+	streams map[int][]byte
+	root    pdfRef
+}
+
+// packedObject locates an object inside a decoded object stream.
+type packedObject struct {
+	stream int
+	offset int
+}
+
+// pdfPage is a leaf of the page tree with its inherited attributes resolved.
+type pdfPage struct {
+	ref  pdfRef
+	dict pdfDict
+}
+
+// parsePDFDocument indexes every object definition in data. Later
+// definitions win, which is what incremental updates rely on.
+func parsePDFDocument(data []byte) (*pdfDocument, error) {
+	startXref, err := findStartXref(data)
+	if err != nil {
+		return nil, err
+	}
+	trailer, _, err := readTrailer(data, startXref)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := trailer.get("Encrypt"); ok {
+		return nil, fmt.Errorf("encrypted PDFs are not supported")
+	}
+	rootRaw, _ := trailer.get("Root")
+	root, ok := parseRef(rootRaw)
+	if !ok {
+		return nil, fmt.Errorf("trailer has no /Root reference")
+	}
+
+	doc := &pdfDocument{
+		data:    data,
+		offsets: map[int]int{},
+		packed:  map[int]packedObject{},
+		streams: map[int][]byte{},
+		root:    root,
+	}
+
+	for pos := 0; pos < len(data); {
+		loc := objectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		start := skipPDFSpace(data, pos+loc[1])
+		end, err := skipPDFValue(data, start)
+		if err != nil {
+			pos += loc[1]
+			continue
+		}
+		doc.offsets[num] = start
+		delete(doc.packed, num)
+		pos = end
+
+		if !bytes.HasPrefix(data[start:], []byte("<<")) {
+			continue
+		}
+		dict, _, err := parsePDFDict(data, start)
+		if err != nil {
+			continue
+		}
+		if _, streamEnd, ok := doc.rawStream(dict, end); ok {
+			pos = streamEnd
+			if v, _ := dict.get("Type"); v == "/ObjStm" {
+				doc.indexObjectStream(num, dict, end)
+			}
+		}
+	}
+
+	if _, err := doc.dict(root.num); err != nil {
+		return nil, fmt.Errorf("cannot read document catalog: %w", err)
+	}
+	return doc, nil
+}
+
+// indexObjectStream records the objects packed into object stream num.
+func (d *pdfDocument) indexObjectStream(num int, dict pdfDict, pos int) {
+	content, err := streamContent(d.data, dict, pos)
+	if err != nil {
+		return
+	}
+	count, _ := strconv.Atoi(dict.values["N"])
+	first, _ := strconv.Atoi(dict.values["First"])
+	if first <= 0 || first > len(content) {
+		return
+	}
+	d.streams[num] = content
+
+	header := strings.Fields(string(content[:first]))
+	for i := 0; i+1 < len(header) && i/2 < count; i += 2 {
+		n, err1 := strconv.Atoi(header[i])
+		offset, err2 := strconv.Atoi(header[i+1])
+		if err1 != nil || err2 != nil || first+offset >= len(content) {
+			continue
+		}
+		d.packed[n] = packedObject{stream: num, offset: first + offset}
+		delete(d.offsets, n)
+	}
+}
+
+// rawStream returns the undecoded data of the stream whose dictionary ends at
+// pos and the offset just past it.
+func (d *pdfDocument) rawStream(dict pdfDict, pos int) ([]byte, int, bool) {
+	pos = skipPDFSpace(d.data, pos)
+	if !bytes.HasPrefix(d.data[pos:], []byte("stream")) {
+		return nil, pos, false
+	}
+	pos += len("stream")
+	if pos < len(d.data) && d.data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(d.data) && d.data[pos] == '\n' {
+		pos++
+	}
+
+	lengthRaw, _ := dict.get("Length")
+	length, err := strconv.Atoi(lengthRaw)
+	if ref, ok := parseRef(lengthRaw); ok {
+		// The length object may not be indexed yet while scanning.
+		if raw, _, rerr := d.value(ref.num); rerr == nil {
+			length, err = strconv.Atoi(strings.TrimSpace(string(raw)))
+		}
+	}
+	end := pos + length
+	if err != nil || length < 0 || end > len(d.data) || !bytes.Contains(d.data[end:min(end+20, len(d.data))], []byte("endstream")) {
+		idx := bytes.Index(d.data[pos:], []byte("endstream"))
+		if idx < 0 {
+			return nil, pos, false
+		}
+		end = pos + idx
+		// The end-of-line marker before endstream is not part of the data.
+		if end > pos && d.data[end-1] == '\n' {
+			end--
+		}
+		if end > pos && d.data[end-1] == '\r' {
+			end--
+		}
+	}
+	after := bytes.Index(d.data[end:], []byte("endstream"))
+	return d.data[pos:end], end + after + len("endstream"), true
+}
+
+// value returns the raw syntax of object num and, for streams, the undecoded
+// stream data.
+func (d *pdfDocument) value(num int) ([]byte, []byte, error) {
+	if packed, ok := d.packed[num]; ok {
+		content := d.streams[packed.stream]
+		end, err := skipPDFValue(content, skipPDFSpace(content, packed.offset))
+		if err != nil {
+			return nil, nil, err
+		}
+		return content[skipPDFSpace(content, packed.offset):end], nil, nil
+	}
+	start, ok := d.offsets[num]
+	if !ok {
+		return nil, nil, fmt.Errorf("object %d not found", num)
+	}
+	end, err := skipPDFValue(d.data, start)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw := d.data[start:end]
+	if !bytes.HasPrefix(raw, []byte("<<")) {
+		return raw, nil, nil
+	}
+	dict, _, err := parsePDFDict(d.data, start)
+	if err != nil {
+		return nil, nil, err
+	}
+	stream, _, _ := d.rawStream(dict, end)
+	return raw, stream, nil
+}
+
+func (d *pdfDocument) dict(num int) (pdfDict, error) {
+	raw, _, err := d.value(num)
+	if err != nil {
+		return pdfDict{}, err
+	}
+	dict, _, err := parsePDFDict(raw, 0)
+	return dict, err
+}
+
+// resolve follows raw when it is a reference to a direct value.
+func (d *pdfDocument) resolve(raw string) string {
+	if ref, ok := parseRef(raw); ok {
+		if value, _, err := d.value(ref.num); err == nil {
+			return string(value)
+		}
+	}
+	return raw
+}
+
+// pages returns the pages in document order.
+func (d *pdfDocument) pages() ([]pdfPage, error) {
+	catalog, err := d.dict(d.root.num)
+	if err != nil {
+		return nil, err
+	}
+	rootRaw, _ := catalog.get("Pages")
+	treeRoot, ok := parseRef(rootRaw)
+	if !ok {
+		return nil, fmt.Errorf("catalog has no /Pages reference")
+	}
+
+	var pages []pdfPage
+	visited := map[int]bool{}
+	var walk func(ref pdfRef, inherited map[string]string) error
+	walk = func(ref pdfRef, inherited map[string]string) error {
+		if visited[ref.num] {
+			return fmt.Errorf("page tree contains a cycle")
+		}
+		visited[ref.num] = true
+		node, err := d.dict(ref.num)
+		if err != nil {
+			return err
+		}
+
+		if kind, _ := node.get("Type"); kind == "/Page" {
+			page := pdfDict{}
+			for _, key := range node.keys {
+				page.set(key, node.values[key])
+			}
+			for _, key := range inheritedPageKeys {
+				if _, ok := page.get(key); !ok && inherited[key] != "" {
+					page.set(key, inherited[key])
+				}
+			}
+			pages = append(pages, pdfPage{ref: ref, dict: page})
+			return nil
+		}
+
+		next := map[string]string{}
+		for key, value := range inherited {
+			next[key] = value
+		}
+		for _, key := range inheritedPageKeys {
+			if value, ok := node.get(key); ok {
+				next[key] = value
+			}
+		}
+		kids, _ := node.get("Kids")
+		for _, kid := range parseRefArray(d.resolve(kids)) {
+			if err := walk(kid, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(treeRoot, map[string]string{}); err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("PDF has no pages")
+	}
+	return pages, nil
+}
+
+// pageTreeNodes returns the object numbers of every node of the page tree.
+func (d *pdfDocument) pageTreeNodes() map[int]bool {
+	nodes := map[int]bool{}
+	catalog, err := d.dict(d.root.num)
+	if err != nil {
+		return nodes
+	}
+	rootRaw, _ := catalog.get("Pages")
+	var walk func(raw string)
+	walk = func(raw string) {
+		ref, ok := parseRef(raw)
+		if !ok || nodes[ref.num] {
+			return
+		}
+		nodes[ref.num] = true
+		node, err := d.dict(ref.num)
+		if err != nil {
+			return
+		}
+		kids, _ := node.get("Kids")
+		for _, kid := range parseRefArray(d.resolve(kids)) {
+			walk(kid.String())
+		}
+	}
+	walk(rootRaw)
+	return nodes
+}
+
+func parseRefArray(raw string) []pdfRef {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]")
+	fields := strings.Fields(raw)
+	var refs []pdfRef
+	for i := 0; i+2 < len(fields); {
+		if ref, ok := parseRef(strings.Join(fields[i:i+3], " ")); ok {
+			refs = append(refs, ref)
+			i += 3
+			continue
+		}
+		i++
+	}
+	return refs
+}
+
+// extractPages writes a new PDF with the given pages, copying every object
+// they use. References to pages left out become null.
+func (d *pdfDocument) extractPages(all []pdfPage, keep []int) ([]byte, error) {
+	c := &pdfCopier{
+		doc:     d,
+		skip:    d.pageTreeNodes(),
+		numbers: map[int]int{},
+		pages:   map[int]pdfDict{},
+		next:    3,
+	}
+	for _, page := range all {
+		c.skip[page.ref.num] = true
+	}
+	var kids []string
+	for _, i := range keep {
+		if i < 0 || i >= len(all) {
+			return nil, fmt.Errorf("page %d out of range", i+1)
+		}
+		page := all[i]
+		delete(c.skip, page.ref.num)
+		c.pages[page.ref.num] = page.dict
+		kids = append(kids, fmt.Sprintf("%d 0 R", c.ref(page.ref.num)))
+	}
+
+	bodies := map[int][]byte{
+		1: []byte("<< /Type /Catalog /Pages 2 0 R >>"),
+		2: []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))),
+	}
+	for len(c.queue) > 0 {
+		num := c.queue[0]
+		c.queue = c.queue[1:]
+		body, err := c.copyObject(num)
+		if err != nil {
+			return nil, err
+		}
+		bodies[c.numbers[num]] = body
+	}
+
+	var out bytes.Buffer
+	version := "%PDF-1.7"
+	if bytes.HasPrefix(d.data, []byte("%PDF-")) && len(d.data) >= 8 {
+		version = string(d.data[:8])
+	}
+	out.WriteString(version + "\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, c.next)
+	for num := 1; num < c.next; num++ {
+		offsets[num] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", num)
+		out.Write(bodies[num])
+		out.WriteString("\nendobj\n")
+	}
+
+	xrefOffset := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f\r\n", c.next)
+	for num := 1; num < c.next; num++ {
+		fmt.Fprintf(&out, "%010d 00000 n\r\n", offsets[num])
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", c.next, xrefOffset)
+	return out.Bytes(), nil
+}
+
+// pdfCopier renumbers objects reachable from the copied pages.
+type pdfCopier struct {
+	doc     *pdfDocument
+	skip    map[int]bool
+	numbers map[int]int
+	pages   map[int]pdfDict
+	queue   []int
+	next    int
+}
+
+func (c *pdfCopier) ref(num int) int {
+	if n, ok := c.numbers[num]; ok {
+		return n
+	}
+	n := c.next
+	c.next++
+	c.numbers[num] = n
+	c.queue = append(c.queue, num)
+	return n
+}
+
+func (c *pdfCopier) copyObject(num int) ([]byte, error) {
+	if page, ok := c.pages[num]; ok {
+		out := pdfDict{}
+		for _, key := range page.keys {
+			if key == "Parent" {
+				out.set(key, "2 0 R")
+				continue
+			}
+			out.set(key, string(c.rewrite([]byte(page.values[key]))))
+		}
+		return out.bytes(), nil
+	}
+
+	raw, stream, err := c.doc.value(num)
+	if err != nil {
+		// A dangling reference is read as null (ISO 32000-1, 7.3.10).
+		return []byte("null"), nil
+	}
+	if stream == nil {
+		return c.rewrite(raw), nil
+	}
+
+	dict, _, err := parsePDFDict(raw, 0)
+	if err != nil {
+		return nil, err
+	}
+	out := pdfDict{}
+	for _, key := range dict.keys {
+		if key == "Length" {
+			out.set(key, strconv.Itoa(len(stream)))
+			continue
+		}
+		out.set(key, string(c.rewrite([]byte(dict.values[key]))))
+	}
+	var b bytes.Buffer
+	b.Write(out.bytes())
+	b.WriteString("\nstream\n")
+	b.Write(stream)
+	b.WriteString("\nendstream")
+	return b.Bytes(), nil
+}
+
+// rewrite renumbers the references in raw PDF syntax, leaving strings and
+// names untouched.
+func (c *pdfCopier) rewrite(raw []byte) []byte {
+	var out bytes.Buffer
+	for pos := 0; pos < len(raw); {
+		ch := raw[pos]
+		switch {
+		case ch == '(' || (ch == '<' && !bytes.HasPrefix(raw[pos:], []byte("<<"))):
+			end, err := skipPDFValue(raw, pos)
+			if err != nil {
+				end = len(raw)
+			}
+			out.Write(raw[pos:end])
+			pos = end
+		case ch == '/':
+			end := skipPDFToken(raw, pos+1)
+			out.Write(raw[pos:end])
+			pos = end
+		case ch >= '0' && ch <= '9':
+			end, err := skipPDFValue(raw, pos)
+			if err != nil || end == pos {
+				end = pos + 1
+			}
+			if ref, ok := parseRef(string(raw[pos:end])); ok {
+				if c.skip[ref.num] {
+					out.WriteString("null")
+				} else {
+					fmt.Fprintf(&out, "%d 0 R", c.ref(ref.num))
+				}
+			} else {
+				out.Write(raw[pos:end])
+			}
+			pos = end
+		default:
+			out.WriteByte(ch)
+			pos++
+		}
+	}
+	return out.Bytes()
+}
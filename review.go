@@ -0,0 +1,122 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+// How files below --min-confidence are held back.
+const (
+	reviewList   = "list"
+	reviewFolder = "folder"
+)
+
+var validReviewModes = []string{reviewList, reviewFolder}
+
+// reviewDirName is the folder next to a file that --review folder moves it
+// into.
+const reviewDirName = "_review"
+
+var (
+	minConfidence float64
+	reviewMode    string
+	selfRate      bool
+)
+
+func validateReview() error {
+	if minConfidence < 0 || minConfidence > 1 {
+		return fmt.Errorf("--min-confidence must be between 0 and 1")
+	}
+	for _, mode := range validReviewModes {
+		if reviewMode == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid review mode %q. valid modes: %s", reviewMode, strings.Join(validReviewModes, ", "))
+}
+
+// needsReview reports whether a named file falls below --min-confidence.
+func needsReview(result fileResult) bool {
+	return minConfidence > 0 && result.title != "" && result.confidence.Score < minConfidence
+}
+
+// reviewFile holds back a file whose name is too uncertain instead of
+// renaming it. It stays where it is and is added to the run's review list, or
+// with --review folder moves into the _review folder next to it under its
+// original name, which undo reverts.
+func reviewFile(result fileResult, filePath, hash string, claimed *duplicateEntry) fileResult {
+	result.review = true
+	if reviewMode != reviewFolder || filepath.Base(filepath.Dir(filePath)) == reviewDirName {
+		if journal != nil {
+			proposed := namer.ProposedPath(filePath, result.title, result.metadata)
+			if err := journal.listForReview(filePath, result.confidence.Score, filepath.Base(proposed)); err != nil {
+				log.Printf("Warning: could not add %s to the review list: %v", filepath.Base(filePath), err)
+			}
+		}
+		return result
+	}
+	result.newPath = reviewPath(filePath)
+	if dryRun {
+		return result
+	}
+
+	if err := os.MkdirAll(filepath.Dir(result.newPath), 0o755); err != nil {
+		result.err = fmt.Errorf("could not create review folder: %w", err)
+		return result
+	}
+	if err := nombra.MoveFile(filePath, result.newPath); err != nil {
+		result.err = fmt.Errorf("moving to review folder failed: %w", err)
+		return result
+	}
+	duplicates.moved(claimed, result.newPath)
+	result.hash = hash
+	if journal != nil {
+		if err := journal.recordRename(filePath, result.newPath, hash, result.metadata); err != nil {
+			log.Printf("Warning: moved %s but could not write undo journal: %v", filepath.Base(filePath), err)
+		}
+	}
+	return result
+}
+
+// reviewPath is where --review folder moves a file, with a counter added to
+// its name when the review folder already holds one by that name.
+func reviewPath(filePath string) string {
+	dir := filepath.Join(filepath.Dir(filePath), reviewDirName)
+	base := filepath.Base(filePath)
+	path := filepath.Join(dir, base)
+	ext := filepath.Ext(base)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), i, ext))
+	}
+}
+
+// formatConfidence shows a confidence score as a percentage.
+func formatConfidence(confidence nombra.Confidence) string {
+	text := fmt.Sprintf("%.0f%%", 100*confidence.Score)
+	if len(confidence.Reasons) > 0 {
+		text += " (" + strings.Join(confidence.Reasons, "; ") + ")"
+	}
+	return text
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+func useReview(t *testing.T, threshold float64, mode string) {
+	t.Helper()
+	previousThreshold, previousMode := minConfidence, reviewMode
+	t.Cleanup(func() { minConfidence, reviewMode = previousThreshold, previousMode })
+	minConfidence, reviewMode = threshold, mode
+}
+
+func TestReviewList(t *testing.T) {
+	useTestNamer(t, nombra.Options{MinContentLength: 10})
+	// Date, document type and organization without a topic score 0.9.
+	useReview(t, 0.95, reviewList)
+	j := useTestJournal(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan.txt")
+	os.WriteFile(path, []byte("Invoice for consulting services"), 0o644)
+
+	results := processFiles([]string{path}, 1)
+	result := results[0]
+	if result.err != nil || !result.review || result.newPath != "" || result.confidence.Score != 0.9 {
+		t.Fatalf("result = %+v", result)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file held back for review was moved: %v", err)
+	}
+	list, err := os.ReadFile(j.reviewListPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.TrimSuffix(string(list), "\n"), "\t")
+	if len(fields) != 3 || fields[0] != path || fields[1] != "0.90" || !strings.HasSuffix(fields[2], "ACME.txt") {
+		t.Errorf("review list = %q", list)
+	}
+	record := newFileRecord(result)
+	if record.Status != statusReview || record.Confidence == nil || *record.Confidence != 0.9 {
+		t.Errorf("record = %+v", record)
+	}
+
+	var summary runSummary
+	summary.add(result)
+	summary.add(fileResult{title: "Contract"})
+	var buf bytes.Buffer
+	textResultWriter{w: &buf}.finish(summary)
+	if !strings.Contains(buf.String(), "1 succeeded, 0 skipped, 0 failed, 1 to review (total: 2)") {
+		t.Errorf("summary = %q", buf.String())
+	}
+
+	minConfidence = 0.9
+	if results := processFiles([]string{path}, 1); results[0].review || results[0].err != nil {
+		t.Errorf("file at the threshold was held back: %+v", results[0])
+	}
+}
+
+func TestReviewFolder(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	useTestNamer(t, nombra.Options{MinContentLength: 10})
+	useReview(t, 0.95, reviewFolder)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan.txt")
+	os.WriteFile(path, []byte("Invoice for consulting services"), 0o644)
+	os.Mkdir(filepath.Join(dir, reviewDirName), 0o755)
+	os.WriteFile(filepath.Join(dir, reviewDirName, "scan.txt"), []byte("an earlier scan"), 0o644)
+
+	previousJournal := journal
+	t.Cleanup(func() { journal = previousJournal })
+	var err error
+	if journal, err = newRenameJournal("20250115-120000-facade"); err != nil {
+		t.Fatal(err)
+	}
+	results := processFiles([]string{path}, 1)
+	journal.close()
+	want := filepath.Join(dir, reviewDirName, "scan-1.txt")
+	if results[0].err != nil || !results[0].review || results[0].newPath != want {
+		t.Fatalf("result = %+v", results[0])
+	}
+	if data, err := os.ReadFile(want); err != nil || string(data) != "Invoice for consulting services" {
+		t.Errorf("review copy = %q, %v", data, err)
+	}
+
+	if _, err := undoRun(journal.runID); err != nil {
+		t.Fatalf("undoRun returned error: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("undo did not restore the file: %v", err)
+	}
+}
+
+func TestValidateReview(t *testing.T) {
+	useReview(t, 1.5, reviewList)
+	if err := validateReview(); err == nil {
+		t.Error("validateReview accepted --min-confidence 1.5")
+	}
+	useReview(t, 0.5, "inbox")
+	if err := validateReview(); err == nil {
+		t.Error("validateReview accepted --review inbox")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+// scanOptions controls how --dir is searched for input files.
+type scanOptions struct {
+	recursive      bool
+	include        []string
+	exclude        []string
+	maxDepth       int
+	followSymlinks bool
+}
+
+// validateGlobs reports the first malformed pattern.
+func validateGlobs(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("empty glob pattern")
+		}
+		if _, err := globRegexp(pattern); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// scanDirectory lists the supported files in root. Subdirectories are only entered
+// with opts.recursive, and symlinked directories only with opts.followSymlinks.
+// Patterns without a slash match the base name, others the slash-separated
+// path relative to root, where ** matches any number of directories.
+func scanDirectory(root string, opts scanOptions) ([]string, error) {
+	var files []string
+	visited := map[string]struct{}{}
+
+	var walk func(dir, rel string, depth int) error
+	walk = func(dir, rel string, depth int) error {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			if _, seen := visited[real]; seen {
+				return nil
+			}
+			visited[real] = struct{}{}
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			fullPath := filepath.Join(dir, name)
+			relPath := path.Join(rel, name)
+
+			isDir := entry.IsDir()
+			if entry.Type()&os.ModeSymlink != 0 {
+				info, err := os.Stat(fullPath)
+				if err != nil {
+					if verbose {
+						log.Printf("Skipping broken symlink %s", fullPath)
+					}
+					continue
+				}
+				if info.IsDir() && !opts.followSymlinks {
+					continue
+				}
+				isDir = info.IsDir()
+			}
+
+			if matchesAnyGlob(opts.exclude, relPath) {
+				continue
+			}
+
+			if isDir {
+				if !opts.recursive || (opts.maxDepth > 0 && depth+1 > opts.maxDepth) {
+					continue
+				}
+				if err := walk(fullPath, relPath, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if len(opts.include) > 0 && !matchesAnyGlob(opts.include, relPath) {
+				continue
+			}
+			if nombra.IsSupported(name) {
+				files = append(files, fullPath)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, "", 0); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func matchesAnyGlob(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		target := relPath
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(relPath)
+		}
+		re, err := globRegexp(pattern)
+		if err == nil && re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp translates a glob into an anchored regular expression. It
+// supports *, ?, [...] character classes and ** for any number of directories.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			// Quote the whole literal run so multi-byte characters stay intact.
+			end := strings.IndexAny(pattern[i:], "*?[")
+			if end == -1 {
+				end = len(pattern) - i
+			}
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+end]))
+			i += end - 1
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestScanDirectory(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"top.pdf",
+		"budget.xlsx",
+		"a/one.pdf",
+		"a/b/two.PDF",
+		"a/b/c/three.pdf",
+		"archive/old.pdf",
+		"drafts/draft-1.pdf",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("%PDF"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "linked.pdf"), []byte("%PDF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		opts scanOptions
+		want []string
+	}{
+		{
+			name: "top level only",
+			want: []string{"top.pdf"},
+		},
+		{
+			name: "recursive",
+			opts: scanOptions{recursive: true},
+			want: []string{"a/b/c/three.pdf", "a/b/two.PDF", "a/one.pdf", "archive/old.pdf", "drafts/draft-1.pdf", "top.pdf"},
+		},
+		{
+			name: "max depth",
+			opts: scanOptions{recursive: true, maxDepth: 1},
+			want: []string{"a/one.pdf", "archive/old.pdf", "drafts/draft-1.pdf", "top.pdf"},
+		},
+		{
+			name: "exclude directory and base name",
+			opts: scanOptions{recursive: true, exclude: []string{"archive", "draft-*"}},
+			want: []string{"a/b/c/three.pdf", "a/b/two.PDF", "a/one.pdf", "top.pdf"},
+		},
+		{
+			name: "include with double star",
+			opts: scanOptions{recursive: true, include: []string{"a/**/t*"}},
+			want: []string{"a/b/c/three.pdf", "a/b/two.PDF"},
+		},
+		{
+			name: "follow symlinks",
+			opts: scanOptions{recursive: true, followSymlinks: true, include: []string{"link/*.pdf"}},
+			want: []string{"link/linked.pdf"},
+		},
+	}
+
+	for _, tc := range cases {
+		files, err := scanDirectory(root, tc.opts)
+		if err != nil {
+			t.Fatalf("%s: scanDirectory returned error: %v", tc.name, err)
+		}
+		got := make([]string, 0, len(files))
+		for _, file := range files {
+			rel, _ := filepath.Rel(root, file)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: scanDirectory() = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidateGlobs(t *testing.T) {
+	if err := validateGlobs([]string{"*.pdf", "**/invoices/*", "scan-[0-9]*"}); err != nil {
+		t.Fatalf("validateGlobs returned error: %v", err)
+	}
+	if err := validateGlobs([]string{"scan-[0-9"}); err == nil {
+		t.Fatalf("expected error for unterminated character class")
+	}
+}
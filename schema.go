@@ -0,0 +1,103 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+var (
+	promptFile  string
+	schemaPath  string
+	offline     bool
+	sendersPath string
+)
+
+// fieldSchema is the file read by --schema.
+type fieldSchema struct {
+	Fields []nombra.Field `json:"fields"`
+}
+
+// loadPromptFile reads the extraction prompt given with --prompt-file.
+func loadPromptFile(path string) (string, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return "", fmt.Errorf("cannot read prompt: %w", err)
+	}
+	prompt := strings.TrimSpace(string(data))
+	if prompt == "" {
+		return "", fmt.Errorf("prompt file %s is empty", path)
+	}
+	return prompt, nil
+}
+
+// loadSchema reads the custom fields given with --schema. Unknown keys are
+// rejected so that typos such as "requried" do not go unnoticed.
+func loadSchema(path string) ([]nombra.Field, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read schema: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var schema fieldSchema
+	if err := dec.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("schema %s defines no fields", path)
+	}
+	return schema.Fields, nil
+}
+
+// loadKnownSenders reads the organizations given with --known-senders, one
+// per line. Blank lines and lines starting with # are skipped.
+func loadKnownSenders(path string) ([]string, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read known senders: %w", err)
+	}
+	var senders []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			senders = append(senders, line)
+		}
+	}
+	if len(senders) == 0 {
+		return nil, fmt.Errorf("known senders file %s is empty", path)
+	}
+	return senders, nil
+}
+
+// expandHome replaces a leading ~ so that paths in the config file can be
+// written like on the command line.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~")
+	if !ok || (rest != "" && rest[0] != '/' && rest[0] != filepath.Separator) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+func TestLoadSchema(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "schema.json")
+	os.WriteFile(path, []byte(`{"fields": [{"name": "case_number", "description": "Court case number", "required": true}]}`), 0o644)
+	fields, err := loadSchema(path)
+	if err != nil {
+		t.Fatalf("loadSchema returned error: %v", err)
+	}
+	if len(fields) != 1 || fields[0].Name != "case_number" || !fields[0].Required {
+		t.Errorf("fields = %+v", fields)
+	}
+
+	for _, bad := range []string{`{"fields": []}`, `{"fields": [{"name": "x", "requried": true}]}`, `fields:`} {
+		os.WriteFile(path, []byte(bad), 0o644)
+		if _, err := loadSchema(path); err == nil {
+			t.Errorf("loadSchema(%s) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestCSVOutputCustomFields(t *testing.T) {
+	useTestNamer(t, nombra.Options{Fields: []nombra.Field{{Name: "invoice_number", Description: "Invoice number"}}})
+	var buf bytes.Buffer
+	w := newResultWriter(outputCSV, &buf)
+	result := fileResult{path: "/docs/scan.pdf", metadata: nombra.Metadata{Title: "Invoice", Extra: map[string]string{"invoice_number": "AB-1234"}}}
+	if err := w.writeResult(result); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	last := len(rows[0]) - 1
+	if rows[0][last] != "invoice_number" || rows[1][last] != "AB-1234" {
+		t.Errorf("last column = %q: %q", rows[0][last], rows[1][last])
+	}
+}
+
+func TestLoadKnownSenders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "senders.txt")
+	os.WriteFile(path, []byte("# utilities\nStadtwerke München\n\n  Vodafone  \n"), 0o644)
+	senders, err := loadKnownSenders(path)
+	if err != nil {
+		t.Fatalf("loadKnownSenders returned error: %v", err)
+	}
+	if len(senders) != 2 || senders[0] != "Stadtwerke München" || senders[1] != "Vodafone" {
+		t.Errorf("senders = %q", senders)
+	}
+
+	os.WriteFile(path, []byte("# nothing\n"), 0o644)
+	if _, err := loadKnownSenders(path); err == nil {
+		t.Error("loadKnownSenders succeeded on an empty list; want error")
+	}
+}
+
+func TestOfflineRun(t *testing.T) {
+	useTestNamer(t, nombra.Options{Offline: true, KnownSenders: []string{"Vodafone"}})
+	previousDryRun := dryRun
+	t.Cleanup(func() { dryRun = previousDryRun })
+	dryRun = true
+
+	path := filepath.Join(t.TempDir(), "scan.txt")
+	os.WriteFile(path, []byte("INVOICE\nInvoice date: 4 June 2024\nThank you for choosing Vodafone. The amount will be collected from your account.\n"), 0o644)
+	results := processFiles([]string{path}, 1)
+	if results[0].err != nil {
+		t.Fatalf("processFiles returned error: %v", results[0].err)
+	}
+	if want := "2024.06.04 - Invoice - Vodafone"; results[0].title != want {
+		t.Errorf("title = %q, want %q", results[0].title, want)
+	}
+}
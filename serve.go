@@ -0,0 +1,535 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultServeAddr     = "127.0.0.1:8080"
+	defaultMaxUploadMB   = 50
+	defaultServeQueue    = 32
+	defaultJobTTL        = time.Hour
+	serveShutdownTimeout = 30 * time.Second
+)
+
+// Job states reported by the HTTP API.
+const (
+	jobPending = "pending"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+type serveOptions struct {
+	addr        string
+	storageRoot string
+	maxUploadMB int64
+	queueSize   int
+	jobTTL      time.Duration
+}
+
+// namingServer answers the HTTP API of nombra serve. Uploads are written to a
+// temporary directory and handed to the worker pool, so they are named exactly
+// like files given on the command line. Without a storage root the run is a
+// dry run and uploads are deleted once named.
+type namingServer struct {
+	storageRoot   string
+	maxUploadSize int64
+	jobTTL        time.Duration
+	queue         chan<- fileJob
+
+	mu      sync.Mutex
+	closed  bool
+	next    int
+	byID    map[string]*serveJob
+	byIndex map[int]*serveJob
+
+	started time.Time
+	metrics serveMetrics
+}
+
+// serveJob is one uploaded document. done is closed once result is set.
+type serveJob struct {
+	id       string
+	name     string // the uploaded filename
+	dir      string // temporary directory holding the upload
+	done     chan struct{}
+	result   fileResult
+	finished time.Time
+}
+
+type serveMetrics struct {
+	uploads          atomic.Int64
+	rejected         atomic.Int64
+	named            atomic.Int64
+	failed           atomic.Int64
+	promptTokens     atomic.Int64
+	completionTokens atomic.Int64
+	reasoningTokens  atomic.Int64
+	costMicroUSD     atomic.Int64
+	processingMS     atomic.Int64
+}
+
+// jobRecord is the JSON body returned for a job.
+type jobRecord struct {
+	ID           string           `json:"id"`
+	Status       string           `json:"status"`
+	OriginalName string           `json:"original_name"`
+	Filename     string           `json:"filename,omitempty"`
+	Path         string           `json:"path,omitempty"`
+	Title        string           `json:"title,omitempty"`
+	Method       string           `json:"method,omitempty"`
+	Metadata     *nombra.Metadata `json:"metadata,omitempty"`
+	Usage        *nombra.Usage    `json:"usage,omitempty"`
+	DurationMS   int64            `json:"duration_ms,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+func newServeCmd() *cobra.Command {
+	opts := serveOptions{
+		addr:        defaultServeAddr,
+		maxUploadMB: defaultMaxUploadMB,
+		queueSize:   defaultServeQueue,
+		jobTTL:      defaultJobTTL,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Name uploaded documents over HTTP",
+		Long: "Serves a REST API that names uploaded documents and returns the suggested filename and metadata as JSON. " +
+			"Nothing is renamed or kept on the server unless --storage-root is set; then uploads are filed below it.",
+		Example: "nombra serve\n  nombra serve --addr :8080 --workers 4\n  nombra serve --storage-root /srv/archive --dest '{organization}/{date:2006}'",
+		Args:    cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			// The storage root and --dest may come from the config file.
+			if err := applyConfig(cmd); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if opts.storageRoot == "" {
+				if destSource != "" {
+					fmt.Println("Error: --dest requires --storage-root with serve")
+					os.Exit(1)
+				}
+				dryRun = true
+			} else {
+				root, err := filepath.Abs(opts.storageRoot)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				if info, err := os.Stat(root); err != nil || !info.IsDir() {
+					fmt.Printf("Error: %s is not a directory\n", opts.storageRoot)
+					os.Exit(1)
+				}
+				if destSource != "" && !filepath.IsLocal(destSource) {
+					fmt.Println("Error: --dest must be a relative path below --storage-root")
+					os.Exit(1)
+				}
+				opts.storageRoot = root
+				destSource = filepath.Join(root, destSource)
+			}
+			if onDuplicate != "" {
+				fmt.Println("Error: --on-duplicate is not supported by serve")
+				os.Exit(1)
+			}
+			prepareRun(cmd)
+			if opts.maxUploadMB < 1 || opts.queueSize < 1 || opts.jobTTL <= 0 {
+				fmt.Println("Error: --max-upload-size, --queue-size and --job-ttl must be positive")
+				os.Exit(1)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runServe(opts); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.addr, "addr", opts.addr, "Address to listen on")
+	cmd.Flags().StringVar(&opts.storageRoot, "storage-root", "", "Keep uploads and file them below this directory (default: only suggest names)")
+	cmd.Flags().Int64Var(&opts.maxUploadMB, "max-upload-size", opts.maxUploadMB, "Largest accepted upload in MB")
+	cmd.Flags().IntVar(&opts.queueSize, "queue-size", opts.queueSize, "Uploads waiting for a worker before new ones are refused")
+	cmd.Flags().DurationVar(&opts.jobTTL, "job-ttl", opts.jobTTL, "How long finished async jobs can be fetched")
+	return cmd
+}
+
+func runServe(opts serveOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := make(chan fileJob, opts.queueSize)
+	results := make(chan fileResult)
+	workerGroup := startWorkers(jobs, results, workers)
+	server := newNamingServer(opts, jobs)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for result := range results {
+			server.finish(result)
+		}
+	}()
+
+	httpServer := &http.Server{
+		Addr:              opts.addr,
+		Handler:           server.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- httpServer.ListenAndServe() }()
+
+	mode := "suggesting names only"
+	if opts.storageRoot != "" {
+		mode = "filing uploads into " + opts.storageRoot
+	}
+	log.Printf("Serving on http://%s with %d workers, %s", opts.addr, workers, mode)
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		log.Printf("Shutting down, finishing queued uploads")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		err = httpServer.Shutdown(shutdownCtx)
+		cancel()
+	}
+
+	server.close()
+	workerGroup.Wait()
+	close(results)
+	<-done
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func newNamingServer(opts serveOptions, queue chan<- fileJob) *namingServer {
+	return &namingServer{
+		storageRoot:   opts.storageRoot,
+		maxUploadSize: opts.maxUploadMB << 20,
+		jobTTL:        opts.jobTTL,
+		queue:         queue,
+		byID:          map[string]*serveJob{},
+		byIndex:       map[int]*serveJob{},
+		started:       time.Now(),
+	}
+}
+
+func (s *namingServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/name", s.handleName)
+	mux.HandleFunc("POST /v1/jobs", s.handleSubmitJob)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux
+}
+
+// handleName names an upload and answers once it is done.
+func (s *namingServer) handleName(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.accept(w, r)
+	if !ok {
+		return
+	}
+	select {
+	case <-job.done:
+		s.forget(job.id)
+		status := http.StatusOK
+		if job.result.err != nil {
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSON(w, status, s.record(job))
+	case <-r.Context().Done():
+		// The client left; the finished job expires after --job-ttl.
+	}
+}
+
+// handleSubmitJob queues an upload and answers right away with its job ID.
+func (s *namingServer) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.accept(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", "/v1/jobs/"+job.id)
+	writeJSON(w, http.StatusAccepted, s.record(job))
+}
+
+func (s *namingServer) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.byID[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown job"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.record(job))
+}
+
+func (s *namingServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": version})
+}
+
+// handleMetrics reports counters in the Prometheus text format.
+func (s *namingServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := &s.metrics
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, kind, help string, values ...string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for i := 0; i+1 < len(values); i += 2 {
+			fmt.Fprintf(w, "%s%s %s\n", name, values[i], values[i+1])
+		}
+	}
+	count := func(v int64) string { return fmt.Sprint(v) }
+
+	metric("nombra_uploads_total", "counter", "Uploads accepted for naming.", "", count(m.uploads.Load()))
+	metric("nombra_uploads_rejected_total", "counter", "Uploads refused because the queue was full.", "", count(m.rejected.Load()))
+	metric("nombra_documents_total", "counter", "Documents processed, by outcome.",
+		`{status="named"}`, count(m.named.Load()),
+		`{status="failed"}`, count(m.failed.Load()))
+	metric("nombra_tokens_total", "counter", "Model tokens used, by kind.",
+		`{kind="prompt"}`, count(m.promptTokens.Load()),
+		`{kind="completion"}`, count(m.completionTokens.Load()),
+		`{kind="reasoning"}`, count(m.reasoningTokens.Load()))
+	metric("nombra_cost_usd_total", "counter", "Model cost in USD, from the price table.", "", fmt.Sprintf("%.6f", float64(m.costMicroUSD.Load())/1e6))
+	metric("nombra_processing_seconds_total", "counter", "Time spent naming documents.", "", fmt.Sprintf("%.3f", float64(m.processingMS.Load())/1000))
+	metric("nombra_queue_depth", "gauge", "Uploads waiting for a worker.", "", count(int64(len(s.queue))))
+	metric("nombra_workers", "gauge", "Size of the worker pool.", "", count(int64(workers)))
+	metric("nombra_uptime_seconds", "gauge", "Seconds since the server started.", "", fmt.Sprintf("%.0f", time.Since(s.started).Seconds()))
+}
+
+// accept stores the uploaded file and queues it. On failure it writes the
+// error response itself.
+func (s *namingServer) accept(w http.ResponseWriter, r *http.Request) (*serveJob, bool) {
+	job, status, err := s.receiveUpload(w, r)
+	if err != nil {
+		writeError(w, status, err)
+		return nil, false
+	}
+	if err := s.enqueue(job); err != nil {
+		os.RemoveAll(job.dir)
+		s.metrics.rejected.Add(1)
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, err)
+		return nil, false
+	}
+	s.metrics.uploads.Add(1)
+	return job, true
+}
+
+// receiveUpload copies the "file" field of a multipart request into a new
+// temporary directory, keeping the uploaded filename.
+func (s *namingServer) receiveUpload(w http.ResponseWriter, r *http.Request) (*serveJob, int, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("expected a multipart/form-data upload with a file field")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, http.StatusBadRequest, fmt.Errorf("upload has no file field")
+		}
+		if err != nil {
+			return nil, uploadErrorStatus(err), fmt.Errorf("could not read upload: %w", err)
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		name := filepath.Base(part.FileName())
+		if name == "." || name == string(filepath.Separator) {
+			return nil, http.StatusBadRequest, fmt.Errorf("upload has no filename")
+		}
+		if !nombra.IsSupported(name) {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported file type %q", filepath.Ext(name))
+		}
+
+		dir, err := os.MkdirTemp("", "nombra-serve")
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if err := saveUpload(filepath.Join(dir, name), part); err != nil {
+			os.RemoveAll(dir)
+			return nil, uploadErrorStatus(err), fmt.Errorf("could not read upload: %w", err)
+		}
+		return &serveJob{name: name, dir: dir, done: make(chan struct{})}, 0, nil
+	}
+}
+
+func saveUpload(path string, src io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func uploadErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// enqueue registers a job and hands it to the worker pool without waiting.
+func (s *namingServer) enqueue(job *serveJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("server is shutting down")
+	}
+	s.pruneLocked()
+
+	job.id = newRunID()
+	for s.byID[job.id] != nil {
+		job.id = newRunID()
+	}
+	index := s.next
+	select {
+	case s.queue <- fileJob{index: index, path: filepath.Join(job.dir, job.name)}:
+	default:
+		return fmt.Errorf("too many documents queued, retry later")
+	}
+	s.next++
+	s.byID[job.id] = job
+	s.byIndex[index] = job
+	return nil
+}
+
+// finish records the result of a worker and removes the temporary upload.
+// With a storage root the renamed file has already been moved out of it.
+func (s *namingServer) finish(result fileResult) {
+	s.mu.Lock()
+	job := s.byIndex[result.index]
+	delete(s.byIndex, result.index)
+	s.mu.Unlock()
+	if job == nil {
+		return
+	}
+
+	os.RemoveAll(job.dir)
+	job.result = result
+	job.finished = time.Now()
+
+	if result.err != nil {
+		s.metrics.failed.Add(1)
+	} else {
+		s.metrics.named.Add(1)
+	}
+	s.metrics.promptTokens.Add(int64(result.usage.PromptTokens))
+	s.metrics.completionTokens.Add(int64(result.usage.CompletionTokens))
+	s.metrics.reasoningTokens.Add(int64(result.usage.ReasoningTokens))
+	s.metrics.costMicroUSD.Add(int64(math.Round(result.usage.Cost * 1e6)))
+	s.metrics.processingMS.Add(result.duration.Milliseconds())
+	close(job.done)
+}
+
+func (s *namingServer) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byID, id)
+}
+
+// pruneLocked drops finished jobs older than the TTL. s.mu must be held.
+func (s *namingServer) pruneLocked() {
+	for id, job := range s.byID {
+		select {
+		case <-job.done:
+			if time.Since(job.finished) > s.jobTTL {
+				delete(s.byID, id)
+			}
+		default:
+		}
+	}
+}
+
+// close stops accepting uploads. Queued ones are still processed.
+func (s *namingServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+}
+
+func (s *namingServer) record(job *serveJob) jobRecord {
+	record := jobRecord{ID: job.id, Status: jobPending, OriginalName: job.name}
+	select {
+	case <-job.done:
+	default:
+		return record
+	}
+
+	result := job.result
+	record.Status = jobDone
+	record.Title = result.title
+	record.Method = result.method
+	record.DurationMS = result.duration.Milliseconds()
+	if result.usage != (nombra.Usage{}) {
+		record.Usage = &result.usage
+	}
+	if result.err != nil {
+		record.Status = jobFailed
+		record.Error = result.err.Error()
+		return record
+	}
+	record.Metadata = &result.metadata
+	record.Filename = filepath.Base(result.newPath)
+	if s.storageRoot != "" {
+		if rel, err := filepath.Rel(s.storageRoot, result.newPath); err == nil {
+			record.Path = filepath.ToSlash(rel)
+		}
+	}
+	return record
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: could not write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+)
+
+// startTestServer runs the HTTP API with a fake model and two workers.
+func startTestServer(t *testing.T, storageRoot string) *httptest.Server {
+	t.Helper()
+	n, err := nombra.New(nombra.Options{Client: metadataProvider{}, MinContentLength: 10, Dest: storageRoot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := dryRun
+	t.Cleanup(func() { namer, dryRun = nil, previous })
+	namer, dryRun = n, storageRoot == ""
+
+	jobs := make(chan fileJob, 4)
+	results := make(chan fileResult)
+	workerGroup := startWorkers(jobs, results, 2)
+	server := newNamingServer(serveOptions{storageRoot: storageRoot, maxUploadMB: 1, jobTTL: time.Minute}, jobs)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for result := range results {
+			server.finish(result)
+		}
+	}()
+
+	ts := httptest.NewServer(server.handler())
+	t.Cleanup(func() {
+		ts.Close()
+		server.close()
+		workerGroup.Wait()
+		close(results)
+		<-done
+	})
+	return ts
+}
+
+func upload(t *testing.T, url, name, content string) (*http.Response, jobRecord) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	mw.Close()
+
+	resp, err := http.Post(url, mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var record jobRecord
+	json.NewDecoder(resp.Body).Decode(&record)
+	return resp, record
+}
+
+func TestServeNameSuggestsWithoutStoring(t *testing.T) {
+	ts := startTestServer(t, "")
+
+	resp, record := upload(t, ts.URL+"/v1/name", "scan.txt", "Invoice for the consulting services of January")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d; record %+v", resp.StatusCode, record)
+	}
+	if record.Status != jobDone || !strings.Contains(record.Filename, "Invoice") || !strings.HasSuffix(record.Filename, ".txt") {
+		t.Errorf("record = %+v", record)
+	}
+	if record.Metadata == nil || record.Metadata.Organization != "ACME" || record.Path != "" {
+		t.Errorf("metadata = %+v, path = %q", record.Metadata, record.Path)
+	}
+
+	resp, record = upload(t, ts.URL+"/v1/name", "notes.exe", "Invoice for the consulting services of January")
+	if resp.StatusCode != http.StatusUnsupportedMediaType || record.Status != "" {
+		t.Errorf("unsupported upload: status %d", resp.StatusCode)
+	}
+
+	resp, _ = upload(t, ts.URL+"/v1/name", "big.txt", strings.Repeat("Invoice ", 200_000))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload: status %d", resp.StatusCode)
+	}
+}
+
+func TestServeStoresBelowStorageRoot(t *testing.T) {
+	root := t.TempDir()
+	ts := startTestServer(t, root)
+
+	_, record := upload(t, ts.URL+"/v1/name", "scan.txt", "Contract between ACME and the tenant")
+	if record.Status != jobDone || record.Path == "" {
+		t.Fatalf("record = %+v", record)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(record.Path))); err != nil || !strings.HasPrefix(string(data), "Contract") {
+		t.Errorf("stored file: %q, %v", data, err)
+	}
+}
+
+func TestServeStoresSameTitledUploadsInParallel(t *testing.T) {
+	root := t.TempDir()
+	ts := startTestServer(t, root)
+
+	// Every upload is named "2025.01.15 - Invoice - ACME.txt".
+	const uploads = 4
+	records := make([]jobRecord, uploads)
+	var wg sync.WaitGroup
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, records[i] = upload(t, ts.URL+"/v1/name", "scan.txt", fmt.Sprintf("Invoice number %d for consulting", i))
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, record := range records {
+		if record.Status != jobDone || record.Path == "" || seen[record.Path] {
+			t.Fatalf("upload %d: record = %+v", i, record)
+		}
+		seen[record.Path] = true
+		want := fmt.Sprintf("Invoice number %d for consulting", i)
+		if data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(record.Path))); err != nil || string(data) != want {
+			t.Errorf("upload %d stored as %s: %q, %v", i, record.Path, data, err)
+		}
+	}
+}
+
+func TestServeAsyncJob(t *testing.T) {
+	ts := startTestServer(t, "")
+
+	resp, record := upload(t, ts.URL+"/v1/jobs", "scan.txt", "Letter from ACME about the new tariff")
+	if resp.StatusCode != http.StatusAccepted || record.ID == "" || resp.Header.Get("Location") != "/v1/jobs/"+record.ID {
+		t.Fatalf("submit: status %d, location %q, record %+v", resp.StatusCode, resp.Header.Get("Location"), record)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for record.Status == jobPending && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp, err := http.Get(ts.URL + "/v1/jobs/" + record.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&record)
+		resp.Body.Close()
+	}
+	if record.Status != jobDone || !strings.Contains(record.Filename, "Letter") {
+		t.Errorf("job = %+v", record)
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/jobs/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job: status %d", resp.StatusCode)
+	}
+}
+
+func TestServeHealthAndMetrics(t *testing.T) {
+	ts := startTestServer(t, "")
+	upload(t, ts.URL+"/v1/name", "scan.txt", "Invoice for the consulting services of January")
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{"nombra_uploads_total 1", `nombra_documents_total{status="named"} 1`, "nombra_queue_depth 0"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
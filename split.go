@@ -0,0 +1,524 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rtyx/nombra/nombra"
+	"github.com/spf13/cobra"
+)
+
+const (
+	boundaryBlank     = "blank"
+	boundarySeparator = "separator"
+	boundaryModel     = "model"
+
+	// defaultSeparatorPattern matches the caption printed on patch code T and
+	// patch code II sheets and on nombra's own separator sheets.
+	defaultSeparatorPattern = `(?i)\bPATCH[ -]?(T|II|2)\b|\bNOMBRA[ -]?SPLIT\b`
+
+	// blankPageChars is the number of letters and digits below which a page
+	// counts as blank; scanners leave OCR noise on empty sheets.
+	blankPageChars = 10
+
+	// splitPageChars limits the text sent to the model for each page.
+	splitPageChars = 1500
+
+	splitPrompt = "You split a batch of scanned pages into separate documents.\n\n" +
+		"Each page is given with its page number. Decide on which pages a new document begins. " +
+		"Signs of a new document are a new letterhead, address block, salutation, title or date, " +
+		"page numbering restarting at 1, or a different sender or topic. Continuation pages carry on " +
+		"the previous page's subject, numbering, table or signature.\n\n" +
+		"Return exactly one JSON object {\"starts\": [page numbers]} listing every page that begins a document, " +
+		"including the first page. Return JSON only, with no markdown and no explanation."
+)
+
+var validBoundaries = []string{boundaryBlank, boundarySeparator, boundaryModel}
+
+// splitOptions selects how document boundaries are detected.
+type splitOptions struct {
+	boundaries     map[string]bool
+	separator      *regexp.Regexp
+	removeOriginal bool
+}
+
+// splitPage is what boundary detection knows about one page.
+type splitPage struct {
+	text      string
+	separator bool
+}
+
+func (p splitPage) blank() bool {
+	count := 0
+	for _, r := range p.text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			count++
+		}
+	}
+	return count < blankPageChars
+}
+
+func parseBoundaries(values []string) (map[string]bool, error) {
+	boundaries := map[string]bool{}
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !containsFold(validBoundaries, value) {
+			return nil, fmt.Errorf("invalid boundary %q (valid: %s)", value, strings.Join(validBoundaries, ", "))
+		}
+		boundaries[value] = true
+	}
+	if len(boundaries) == 0 {
+		return nil, fmt.Errorf("at least one boundary type is required")
+	}
+	return boundaries, nil
+}
+
+func newSplitCmd() *cobra.Command {
+	// Blank pages are opt-in: duplex scans of one-sided letters have one
+	// after every sheet.
+	boundaries := []string{boundarySeparator, boundaryModel}
+	separator := defaultSeparatorPattern
+	var opts splitOptions
+
+	cmd := &cobra.Command{
+		Use:   "split <file.pdf> [file.pdf ...]",
+		Short: "Split multi-document scans into separately named PDFs",
+		Long: "Finds where one document ends and the next begins in a batch scan, writes each document to its own PDF " +
+			"next to the original and names it like any other file. Boundaries are separator sheets (patch code or QR), " +
+			"changes of sender or topic found by the model and, with --boundaries blank, empty pages.",
+		Example: "nombra split batch.pdf\n  nombra split batch.pdf --boundaries separator\n  nombra split batch.pdf --dry-run --output jsonl",
+		Args:    cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			prepareRun(cmd)
+			for _, path := range args {
+				if !nombra.IsPDF(path) {
+					fmt.Printf("Error: %s is not a PDF file\n", path)
+					os.Exit(1)
+				}
+			}
+			parsed, err := parseBoundaries(boundaries)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts.boundaries = parsed
+			pattern, err := regexp.Compile(separator)
+			if err != nil {
+				fmt.Printf("Error: invalid --separator-pattern: %v\n", err)
+				os.Exit(1)
+			}
+			opts.separator = pattern
+			if dryRun && opts.removeOriginal {
+				fmt.Println("Error: --dry-run cannot be combined with --remove-original")
+				os.Exit(1)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runSplit(args, opts); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&boundaries, "boundaries", boundaries, "Boundary types to detect: blank, separator, model")
+	cmd.Flags().StringVar(&separator, "separator-pattern", defaultSeparatorPattern, "Regular expression matching the text or QR payload of separator sheets")
+	cmd.Flags().BoolVar(&opts.removeOriginal, "remove-original", false, "Remove the batch file once every part was written and named; nombra undo restores it")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the parts and their names without writing files")
+	return cmd
+}
+
+func runSplit(paths []string, opts splitOptions) error {
+	if !dryRun {
+		var err error
+		journal, err = newRenameJournal(newRunID())
+		if err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	out := newResultWriter(outputFormat, os.Stdout)
+	var summary runSummary
+	index := 0
+	for _, path := range paths {
+		results := splitFile(path, opts)
+		for _, result := range results {
+			result.index = index
+			index++
+			summary.add(result)
+			if err := out.writeResult(result); err != nil {
+				log.Printf("Warning: could not write result: %v", err)
+			}
+		}
+	}
+
+	if journal != nil {
+		if err := journal.close(); err != nil {
+			log.Printf("Warning: could not close undo journal: %v", err)
+		}
+	}
+	summary.duration = time.Since(start)
+	if journal != nil && journal.renames > 0 {
+		summary.runID = journal.runID
+	}
+	if err := out.finish(summary); err != nil {
+		log.Printf("Warning: could not write summary: %v", err)
+	}
+	if summary.failed > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// splitFile splits one batch scan and names its parts. A batch that holds a
+// single document is reported and left alone.
+func splitFile(path string, opts splitOptions) []fileResult {
+	fail := func(err error) []fileResult {
+		return []fileResult{{path: path, err: fmt.Errorf("split failed: %w", err)}}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fail(err)
+	}
+	doc, err := parsePDFDocument(data)
+	if err != nil {
+		return fail(err)
+	}
+	pdfPages, err := doc.pages()
+	if err != nil {
+		return fail(err)
+	}
+
+	pages, err := splitPages(path, len(pdfPages), opts)
+	if err != nil {
+		return fail(err)
+	}
+	var starts map[int]bool
+	var usage nombra.Usage
+	if opts.boundaries[boundaryModel] {
+		starts, usage, err = modelDocumentStarts(pages)
+		if err != nil {
+			log.Printf("Warning: %s: %v; using blank pages and separator sheets only", filepath.Base(path), err)
+		}
+	}
+
+	segments := detectSegments(pages, opts.boundaries, starts)
+	if len(segments) < 2 {
+		if outputFormat == outputText {
+			fmt.Printf("%s: no document boundaries found\n", filepath.Base(path))
+		} else {
+			log.Printf("%s: no document boundaries found", filepath.Base(path))
+		}
+		return nil
+	}
+	if verbose {
+		log.Printf("%s: found %d documents", filepath.Base(path), len(segments))
+	}
+
+	// A dry run writes the parts to a temporary directory so they can be
+	// named, and reports them as if they had been written next to the batch.
+	dir := filepath.Dir(path)
+	if dryRun {
+		dir, err = os.MkdirTemp("", "nombra-split")
+		if err != nil {
+			return fail(err)
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var parts []string
+	for _, segment := range segments {
+		content, err := doc.extractPages(pdfPages, segment)
+		if err != nil {
+			return fail(err)
+		}
+		part, err := writeSplitPart(dir, base+"-p"+pageRange(segment), content)
+		if err != nil {
+			for _, written := range parts {
+				os.Remove(written)
+			}
+			return fail(err)
+		}
+		parts = append(parts, part)
+		if journal != nil {
+			if err := recordSplitPart(path, part); err != nil {
+				log.Printf("Warning: wrote %s but could not write undo journal: %v", filepath.Base(part), err)
+			}
+		}
+	}
+
+	results := processFiles(parts, max(1, min(workers, len(parts))))
+	results[0].usage = results[0].usage.Add(usage)
+	failed := false
+	for i := range results {
+		if dryRun {
+			results[i].path = filepath.Join(filepath.Dir(path), filepath.Base(results[i].path))
+			if results[i].err == nil {
+				results[i].newPath = namer.ProposedPath(results[i].path, results[i].title, results[i].metadata)
+			}
+		}
+		failed = failed || results[i].err != nil
+	}
+
+	// The batch is put away rather than deleted, so that undo can restore it.
+	if opts.removeOriginal && !failed && journal != nil {
+		hash, err := fileSHA256(path)
+		if err == nil {
+			err = journal.remove(path, hash)
+		}
+		if err != nil {
+			log.Printf("Warning: could not remove %s: %v", filepath.Base(path), err)
+		}
+	}
+	return results
+}
+
+func recordSplitPart(batchPath, partPath string) error {
+	hash, err := fileSHA256(partPath)
+	if err != nil {
+		return err
+	}
+	return journal.recordSplit(batchPath, partPath, hash)
+}
+
+// writeSplitPart writes a part without overwriting an existing file.
+func writeSplitPart(dir, name string, content []byte) (string, error) {
+	path := filepath.Join(dir, name+".pdf")
+	for counter := 1; ; counter++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if os.IsExist(err) {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d.pdf", name, counter))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := file.Write(content); err != nil {
+			file.Close()
+			os.Remove(path)
+			return "", err
+		}
+		if err := file.Close(); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// pageRange formats 0-based page indexes as a 1-based range like "4-6".
+func pageRange(segment []int) string {
+	first, last := segment[0]+1, segment[len(segment)-1]+1
+	if first == last {
+		return strconv.Itoa(first)
+	}
+	return fmt.Sprintf("%d-%d", first, last)
+}
+
+// splitPages collects the text of each page, from the text layer or, for
+// pages without one, OCR, and marks separator sheets. Pages that have no text
+// either way count as blank.
+func splitPages(path string, count int, opts splitOptions) ([]splitPage, error) {
+	pages := make([]splitPage, count)
+	texts, err := nombra.PDFPageTexts(path)
+	if err == nil && len(texts) == count {
+		for i, text := range texts {
+			pages[i].text = text
+		}
+	}
+
+	missing := false
+	for _, page := range pages {
+		if strings.TrimSpace(page.text) == "" {
+			missing = true
+			break
+		}
+	}
+	if ocr || missing {
+		if verbose {
+			log.Printf("Running OCR to find document boundaries...")
+		}
+		ocrTexts, err := nombra.OCRPageTexts(context.Background(), path)
+		switch {
+		case err == nil && len(ocrTexts) == count:
+			for i, text := range ocrTexts {
+				if ocr || strings.TrimSpace(pages[i].text) == "" {
+					pages[i].text = text
+				}
+			}
+		case err == nil:
+			log.Printf("Warning: OCR returned %d pages for %d; using the text layer only", len(ocrTexts), count)
+		case verbose:
+			log.Printf("OCR unavailable (%v); using the text layer only", err)
+		}
+	}
+
+	hasText := false
+	for _, page := range pages {
+		hasText = hasText || strings.TrimSpace(page.text) != ""
+	}
+	if !hasText {
+		return nil, fmt.Errorf("no text found on any page (is tesseract installed?)")
+	}
+
+	if opts.boundaries[boundarySeparator] {
+		for i := range pages {
+			pages[i].separator = opts.separator.MatchString(pages[i].text)
+		}
+		qr, err := qrSeparatorPages(path, count, opts.separator)
+		if err != nil && verbose {
+			log.Printf("QR separator detection skipped: %v", err)
+		}
+		for i := range qr {
+			pages[i].separator = true
+		}
+	}
+	return pages, nil
+}
+
+// qrSeparatorPages returns the pages carrying a QR code (or other barcode
+// zbarimg reads) whose payload matches pattern.
+func qrSeparatorPages(path string, count int, pattern *regexp.Regexp) (map[int]bool, error) {
+	if _, err := exec.LookPath("zbarimg"); err != nil {
+		return nil, fmt.Errorf("zbarimg not installed")
+	}
+	tempDir, err := os.MkdirTemp("", "nombra-split")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	images, err := nombra.RenderPDFPages(context.Background(), path, tempDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) != count {
+		return nil, fmt.Errorf("rendered %d pages for %d", len(images), count)
+	}
+
+	found := map[int]bool{}
+	for i, image := range images {
+		var out bytes.Buffer
+		cmd := exec.Command("zbarimg", "--quiet", "--raw", image)
+		cmd.Stdout = &out
+		// zbarimg exits with status 4 when the image holds no barcode.
+		_ = cmd.Run()
+		for _, line := range strings.Split(out.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" && pattern.MatchString(line) {
+				found[i] = true
+			}
+		}
+	}
+	return found, nil
+}
+
+// detectSegments groups page indexes into documents. Separator sheets and,
+// when enabled, blank pages end a document and are dropped; starts holds the
+// pages the model saw beginning a new document.
+func detectSegments(pages []splitPage, boundaries map[string]bool, starts map[int]bool) [][]int {
+	var segments [][]int
+	var current []int
+	flush := func() {
+		if len(current) > 0 {
+			segments = append(segments, current)
+			current = nil
+		}
+	}
+	for i, page := range pages {
+		if page.separator || (boundaries[boundaryBlank] && page.blank()) {
+			flush()
+			continue
+		}
+		if starts[i] {
+			flush()
+		}
+		current = append(current, i)
+	}
+	flush()
+	return segments
+}
+
+// modelDocumentStarts asks the model on which pages new documents begin.
+func modelDocumentStarts(pages []splitPage) (map[int]bool, nombra.Usage, error) {
+	var request strings.Builder
+	candidates := 0
+	for i, page := range pages {
+		if page.separator {
+			continue
+		}
+		candidates++
+		text := strings.TrimSpace(page.text)
+		if runes := []rune(text); len(runes) > splitPageChars {
+			text = string(runes[:splitPageChars]) + nombra.TruncationSuffix
+		}
+		if text == "" {
+			text = "(no text)"
+		}
+		fmt.Fprintf(&request, "Page %d:\n%s\n\n", i+1, text)
+	}
+	if candidates < 2 {
+		return nil, nombra.Usage{}, nil
+	}
+
+	reply, err := namer.Provider().Complete(context.Background(), nombra.CompletionRequest{
+		Model:  namer.Options().Model,
+		System: splitPrompt,
+		User:   request.String(),
+	})
+	if err != nil {
+		return nil, reply.Usage, fmt.Errorf("boundary detection failed: %w", err)
+	}
+	starts, err := parseSplitResponse(reply.Content, len(pages))
+	return starts, reply.Usage, err
+}
+
+// parseSplitResponse reads {"starts": [...]} and returns 0-based page indexes.
+func parseSplitResponse(raw string, pageCount int) (map[int]bool, error) {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("boundary response did not contain JSON object")
+	}
+	var response struct {
+		Starts []int `json:"starts"`
+	}
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &response); err != nil {
+		return nil, fmt.Errorf("invalid boundary JSON: %w", err)
+	}
+
+	starts := map[int]bool{}
+	for _, page := range response.Starts {
+		if page >= 1 && page <= pageCount {
+			starts[page-1] = true
+		}
+	}
+	return starts, nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/rtyx/nombra/nombra"
+)
+
+// buildBatchPDF writes a PDF with one page per text. Resources and MediaBox
+// are inherited from the page tree and content lengths are indirect, as
+// scanner software often writes them.
+func buildBatchPDF(t *testing.T, texts []string) string {
+	t.Helper()
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // page tree, filled in below
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+	var kids []string
+	for _, text := range texts {
+		page := len(objects) + 1
+		content := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Contents %d 0 R >>", page+1),
+			fmt.Sprintf("<< /Length %d 0 R >>\nstream\n%s\nendstream", page+2, content),
+			fmt.Sprint(len(content)),
+		)
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> >>",
+		strings.Join(kids, " "), len(texts))
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects)+1)
+	for i, body := range objects {
+		offsets[i+1] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xrefOffset := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&b, "%010d 00000 n\r\n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	path := filepath.Join(t.TempDir(), "batch.pdf")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readPDFText(t *testing.T, path string) []string {
+	t.Helper()
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		t.Fatalf("cannot open %s: %v", filepath.Base(path), err)
+	}
+	defer f.Close()
+	var pages []string
+	for i := 1; i <= r.NumPage(); i++ {
+		text, err := r.Page(i).GetPlainText(nil)
+		if err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		pages = append(pages, strings.TrimSpace(text))
+	}
+	return pages
+}
+
+func TestExtractPages(t *testing.T) {
+	path := buildBatchPDF(t, []string{"Invoice ACME page one", "Invoice ACME page two", "Letter from the city council"})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parsePDFDocument(data)
+	if err != nil {
+		t.Fatalf("parsePDFDocument returned error: %v", err)
+	}
+	pages, err := doc.pages()
+	if err != nil || len(pages) != 3 {
+		t.Fatalf("pages() = %d pages, %v; want 3", len(pages), err)
+	}
+
+	part, err := doc.extractPages(pages, []int{1, 2})
+	if err != nil {
+		t.Fatalf("extractPages returned error: %v", err)
+	}
+	if bytes.Contains(part, []byte("page one")) {
+		t.Error("part contains the content of a page that was left out")
+	}
+	partPath := filepath.Join(t.TempDir(), "part.pdf")
+	if err := os.WriteFile(partPath, part, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := readPDFText(t, partPath)
+	want := []string{"Invoice ACME page two", "Letter from the city council"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("part pages = %q; want %q", got, want)
+	}
+}
+
+func TestSplitPagesAndSegments(t *testing.T) {
+	path := buildBatchPDF(t, []string{
+		"Invoice ACME 2025 page one",
+		"Invoice ACME 2025 page two",
+		"PATCH T",
+		"Letter from the city council",
+		"",
+		"Insurance policy renewal",
+	})
+	opts := splitOptions{
+		boundaries: map[string]bool{boundaryBlank: true, boundarySeparator: true},
+		separator:  regexp.MustCompile(defaultSeparatorPattern),
+	}
+	pages, err := splitPages(path, 6, opts)
+	if err != nil {
+		t.Fatalf("splitPages returned error: %v", err)
+	}
+	if !pages[2].separator || pages[3].separator || !pages[4].blank() || pages[3].blank() {
+		t.Errorf("unexpected page classification: %+v", pages)
+	}
+
+	got := detectSegments(pages, opts.boundaries, nil)
+	want := [][]int{{0, 1}, {3}, {5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectSegments() = %v; want %v", got, want)
+	}
+
+	// Without blank detection the empty page stays with the letter, and the
+	// model's answer splits the invoice off at page 2.
+	got = detectSegments(pages, map[string]bool{boundarySeparator: true}, map[int]bool{0: true, 1: true, 3: true})
+	want = [][]int{{0}, {1}, {3, 4, 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectSegments() with model starts = %v; want %v", got, want)
+	}
+}
+
+func TestParseSplitResponse(t *testing.T) {
+	got, err := parseSplitResponse("```json\n{\"starts\": [1, 3, 9, 0]}\n```", 5)
+	if err != nil {
+		t.Fatalf("parseSplitResponse returned error: %v", err)
+	}
+	if want := map[int]bool{0: true, 2: true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSplitResponse() = %v; want %v", got, want)
+	}
+	if _, err := parseSplitResponse("no idea", 5); err == nil {
+		t.Error("expected error for a reply without JSON")
+	}
+}
+
+func TestParseBoundaries(t *testing.T) {
+	got, err := parseBoundaries([]string{"Blank", " model "})
+	if err != nil || !got[boundaryBlank] || !got[boundaryModel] || got[boundarySeparator] {
+		t.Errorf("parseBoundaries() = %v, %v", got, err)
+	}
+	if _, err := parseBoundaries([]string{"topic"}); err == nil {
+		t.Error("expected error for unknown boundary")
+	}
+}
+
+func TestPageRange(t *testing.T) {
+	if got := pageRange([]int{3, 4, 5}); got != "4-6" {
+		t.Errorf("pageRange() = %q; want 4-6", got)
+	}
+	if got := pageRange([]int{0}); got != "1" {
+		t.Errorf("pageRange() = %q; want 1", got)
+	}
+}
+
+// metadataProvider answers every metadata request with a document type taken
+// from the first word of the text.
+type metadataProvider struct{}
+
+func (metadataProvider) Complete(ctx context.Context, req nombra.CompletionRequest) (nombra.Completion, error) {
+	kind := strings.Fields(req.User)[0]
+	return nombra.Completion{Content: fmt.Sprintf(`{"date":"2025.01.15","document_type":%q,"organization":"ACME"}`, kind)}, nil
+}
+
+func (metadataProvider) DescribeImage(ctx context.Context, req nombra.ImageRequest) (nombra.Completion, error) {
+	return nombra.Completion{}, fmt.Errorf("no vision")
+}
+
+func TestSplitFile(t *testing.T) {
+	path := buildBatchPDF(t, []string{"Invoice ACME 2025 page one", "Invoice ACME 2025 page two", "PATCH T", "Contract between ACME and Rafa"})
+	opts := splitOptions{
+		boundaries: map[string]bool{boundarySeparator: true},
+		separator:  regexp.MustCompile(defaultSeparatorPattern),
+	}
+
+	n, err := nombra.New(nombra.Options{Client: metadataProvider{}, MinContentLength: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	namer = n
+	t.Cleanup(func() { namer = nil })
+
+	results := splitFile(path, opts)
+	if len(results) != 2 {
+		t.Fatalf("splitFile() returned %d results; want 2: %+v", len(results), results)
+	}
+	for i, want := range []string{"batch-p1-2.pdf", "batch-p4.pdf"} {
+		if results[i].err != nil {
+			t.Fatalf("part %d failed: %v", i+1, results[i].err)
+		}
+		if filepath.Base(results[i].path) != want {
+			t.Errorf("part %d path = %s; want %s", i+1, filepath.Base(results[i].path), want)
+		}
+	}
+	if got := filepath.Base(results[1].newPath); !strings.Contains(got, "Contract") {
+		t.Errorf("second part named %q", got)
+	}
+	if got := readPDFText(t, results[0].newPath); len(got) != 2 {
+		t.Errorf("first part has %d pages; want 2", len(got))
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("original was removed: %v", err)
+	}
+}
+
+func TestSplitFileRemoveOriginalUndo(t *testing.T) {
+	pages := []string{"Invoice ACME 2025 page one", "PATCH T", "Contract between ACME and Rafa"}
+	opts := splitOptions{
+		boundaries:     map[string]bool{boundarySeparator: true},
+		separator:      regexp.MustCompile(defaultSeparatorPattern),
+		removeOriginal: true,
+	}
+	n, err := nombra.New(nombra.Options{Client: metadataProvider{}, MinContentLength: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	namer = n
+	t.Cleanup(func() { namer = nil })
+
+	// Writing metadata changes the parts after they were journaled.
+	for _, metadata := range []bool{false, true} {
+		t.Run(fmt.Sprintf("writeMetadata=%v", metadata), func(t *testing.T) {
+			j := useTestJournal(t)
+			previous := writeMetadata
+			t.Cleanup(func() { writeMetadata = previous })
+			writeMetadata = metadata
+			path := buildBatchPDF(t, pages)
+
+			results := splitFile(path, opts)
+			if len(results) != 2 || results[0].err != nil || results[1].err != nil {
+				t.Fatalf("splitFile() = %+v", results)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("original was kept: %v", err)
+			}
+			if metadata {
+				data, _ := os.ReadFile(results[0].newPath)
+				if !bytes.Contains(data, []byte("/Title")) {
+					t.Fatalf("no metadata was written to %s", filepath.Base(results[0].newPath))
+				}
+			}
+			j.close()
+
+			undone, err := undoRun(j.runID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, result := range undone {
+				if result.err != nil {
+					t.Errorf("undo %s of %s: %v", result.entry.Action, filepath.Base(result.entry.NewPath), result.err)
+				}
+			}
+			if got := readPDFText(t, path); !reflect.DeepEqual(got, pages) {
+				t.Errorf("restored batch pages = %q", got)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(path))
+			if len(entries) != 1 {
+				t.Errorf("undo left %d files next to the batch; want only the batch", len(entries))
+			}
+		})
+	}
+}
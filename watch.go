@@ -0,0 +1,405 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rtyx/nombra/nombra"
+	"github.com/spf13/cobra"
+)
+
+const defaultSettleDelay = 2 * time.Second
+
+// processedRecord is one line of the watch log for a directory.
+type processedRecord struct {
+	SHA256       string    `json:"sha256"`
+	OriginalPath string    `json:"original_path"`
+	NewPath      string    `json:"new_path"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// processedLog remembers, by content hash, which files a watch has already
+// renamed. Hashes survive the rename, so the renamed file is not picked up
+// again and restarts do not rename files a second time.
+type processedLog struct {
+	mu     sync.Mutex
+	path   string
+	hashes map[string]struct{}
+}
+
+// inboxWatcher turns filesystem events into jobs for the worker pool.
+type inboxWatcher struct {
+	settle    time.Duration
+	processed *processedLog
+	jobs      chan<- fileJob
+
+	mu       sync.Mutex
+	pending  map[string]struct{}
+	inflight map[string]string
+	next     int
+	wg       sync.WaitGroup
+}
+
+func processedLogPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	base, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(base, "watch", hex.EncodeToString(sum[:8])+".jsonl"), nil
+}
+
+func openProcessedLog(dir string) (*processedLog, error) {
+	path, err := processedLogPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &processedLog{path: path, hashes: map[string]struct{}{}}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watch log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record processedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.SHA256 == "" {
+			continue
+		}
+		l.hashes[record.SHA256] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read watch log: %w", err)
+	}
+	return l, nil
+}
+
+func (l *processedLog) contains(hash string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.hashes[hash]
+	return ok
+}
+
+func (l *processedLog) add(record processedRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hashes[record.SHA256] = struct{}{}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create watch log directory: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open watch log: %w", err)
+	}
+	defer file.Close()
+
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now().UTC()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func isWatchCandidate(path string) bool {
+	name := filepath.Base(path)
+	return !strings.HasPrefix(name, ".") && nombra.IsSupported(name)
+}
+
+// schedule waits in the background until path is stable and then queues it,
+// unless the same path is already waiting or its content was processed before.
+func (w *inboxWatcher) schedule(ctx context.Context, path string) {
+	if !isWatchCandidate(path) {
+		return
+	}
+
+	w.mu.Lock()
+	if _, ok := w.pending[path]; ok {
+		w.mu.Unlock()
+		return
+	}
+	if _, ok := w.inflight[path]; ok {
+		w.mu.Unlock()
+		return
+	}
+	w.pending[path] = struct{}{}
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() {
+			w.mu.Lock()
+			delete(w.pending, path)
+			w.mu.Unlock()
+		}()
+
+		if err := waitUntilStable(ctx, path, w.settle); err != nil {
+			if verbose && ctx.Err() == nil {
+				log.Printf("Ignoring %s: %v", filepath.Base(path), err)
+			}
+			return
+		}
+
+		hash, err := fileSHA256(path)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			return
+		}
+		if w.claim(path, hash) {
+			if verbose {
+				log.Printf("Skipping %s: already processed", filepath.Base(path))
+			}
+			return
+		}
+
+		w.mu.Lock()
+		index := w.next
+		w.next++
+		w.mu.Unlock()
+
+		select {
+		case w.jobs <- fileJob{index: index, path: path}:
+		case <-ctx.Done():
+			w.release(path)
+		}
+	}()
+}
+
+// claim marks path as in flight and reports whether its content is already
+// processed or queued under another name.
+func (w *inboxWatcher) claim(path, hash string) bool {
+	if w.processed.contains(hash) {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, queued := range w.inflight {
+		if queued == hash {
+			return true
+		}
+	}
+	w.inflight[path] = hash
+	return false
+}
+
+func (w *inboxWatcher) release(path string) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	hash := w.inflight[path]
+	delete(w.inflight, path)
+	return hash
+}
+
+// waitUntilStable returns once the file size and modification time stayed the
+// same for a full settle interval and no other process holds a lock on it.
+func waitUntilStable(ctx context.Context, path string, settle time.Duration) error {
+	previous, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(settle):
+		}
+
+		current, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if current.IsDir() {
+			return fmt.Errorf("is a directory")
+		}
+		if current.Size() > 0 &&
+			current.Size() == previous.Size() &&
+			current.ModTime().Equal(previous.ModTime()) &&
+			!fileLocked(path) {
+			return nil
+		}
+		previous = current
+	}
+}
+
+func newWatchCmd() *cobra.Command {
+	settle := defaultSettleDelay
+
+	cmd := &cobra.Command{
+		Use:   "watch <dir>",
+		Short: "Name documents as they arrive in a directory",
+		Long: "Watches a directory and names every supported document that lands in it once the file is no longer being written. " +
+			"Processed files are remembered by content hash, so restarting the watch does not rename them again.",
+		Example: "nombra watch ~/Scans\n  nombra watch ./inbox --settle 5s --workers 2",
+		Args:    cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			prepareRun(cmd)
+			if outputFormat == outputJSON {
+				fmt.Println("Error: watch streams results; use --output jsonl instead of json")
+				os.Exit(1)
+			}
+			if settle <= 0 {
+				fmt.Println("Error: --settle must be positive")
+				os.Exit(1)
+			}
+			info, err := os.Stat(args[0])
+			if err != nil || !info.IsDir() {
+				fmt.Printf("Error: %s is not a directory\n", args[0])
+				os.Exit(1)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			dir, err := filepath.Abs(args[0])
+			if err != nil {
+				dir = args[0]
+			}
+			if err := runWatch(dir, settle); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().DurationVar(&settle, "settle", defaultSettleDelay, "How long a file must stay unchanged before it is processed")
+	return cmd
+}
+
+func runWatch(dir string, settle time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	processed, err := openProcessedLog(dir)
+	if err != nil {
+		return err
+	}
+	journal, err = newRenameJournal(newRunID())
+	if err != nil {
+		return err
+	}
+	defer journal.close()
+
+	watcher, err := newDirWatcher(dir)
+	if err != nil {
+		return fmt.Errorf("cannot watch %s: %w", dir, err)
+	}
+	defer watcher.close()
+
+	jobs := make(chan fileJob)
+	results := make(chan fileResult)
+	workerGroup := startWorkers(jobs, results, workers)
+
+	inbox := &inboxWatcher{
+		settle:    settle,
+		processed: processed,
+		jobs:      jobs,
+		pending:   map[string]struct{}{},
+		inflight:  map[string]string{},
+	}
+
+	start := time.Now()
+	out := newResultWriter(outputFormat, os.Stdout)
+	var summary runSummary
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for result := range results {
+			summary.add(result)
+			if err := out.writeResult(result); err != nil {
+				log.Printf("Warning: could not write result: %v", err)
+			}
+			hash := inbox.release(result.path)
+			if result.err != nil || result.skipped || hash == "" {
+				continue
+			}
+			if err := processed.add(processedRecord{SHA256: hash, OriginalPath: result.path, NewPath: result.newPath}); err != nil {
+				log.Printf("Warning: could not update watch log: %v", err)
+			}
+			// --write-metadata changes the content, so remember the new hash as well.
+			if result.hash != "" && result.hash != hash {
+				if err := processed.add(processedRecord{SHA256: result.hash, OriginalPath: result.path, NewPath: result.newPath}); err != nil {
+					log.Printf("Warning: could not update watch log: %v", err)
+				}
+			}
+		}
+	}()
+
+	if outputFormat == outputText {
+		fmt.Printf("Watching %s for new documents (Ctrl+C to stop)\n", dir)
+	} else {
+		log.Printf("Watching %s for new documents (Ctrl+C to stop)", dir)
+	}
+
+	existing, err := scanDirectory(dir, scanOptions{})
+	if err != nil {
+		return err
+	}
+	for _, path := range existing {
+		inbox.schedule(ctx, path)
+	}
+
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case path := <-watcher.events:
+			inbox.schedule(ctx, path)
+		case err := <-watcher.errors:
+			log.Printf("Warning: watch error: %v", err)
+		}
+	}
+
+	// Stop scheduling, let files already handed to the pool finish, then drain it.
+	inbox.wg.Wait()
+	close(jobs)
+	workerGroup.Wait()
+	close(results)
+	<-done
+
+	summary.duration = time.Since(start)
+	if journal.renames > 0 {
+		summary.runID = journal.runID
+	}
+	return out.finish(summary)
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// dirWatcher reports files written or moved into a directory using inotify.
+type dirWatcher struct {
+	file   *os.File
+	events chan string
+	errors chan error
+	stop   chan struct{}
+}
+
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO|syscall.IN_CREATE); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("inotify_add_watch: %w", err)
+	}
+
+	// A non-blocking descriptor wrapped in os.File uses the runtime poller,
+	// so closing the file unblocks the pending read.
+	w := &dirWatcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan string),
+		errors: make(chan error),
+		stop:   make(chan struct{}),
+	}
+	go w.readEvents(dir)
+	return w, nil
+}
+
+func (w *dirWatcher) readEvents(dir string) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				select {
+				case w.errors <- err:
+				case <-w.stop:
+				}
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			offset = nameEnd
+
+			if event.Mask&syscall.IN_ISDIR != 0 || event.Len == 0 || nameEnd > n {
+				continue
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			select {
+			case w.events <- filepath.Join(dir, name):
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+func (w *dirWatcher) close() error {
+	close(w.stop)
+	return w.file.Close()
+}
+
+// fileLocked reports whether another process holds a flock on path.
+func fileLocked(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return errors.Is(err, syscall.EWOULDBLOCK)
+	}
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return false
+}
@@ -0,0 +1,105 @@
+// Copyright 2025 Rafael Toledano Illán
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const watchPollInterval = time.Second
+
+// dirWatcher reports new or changed files in a directory by polling it, for
+// platforms without inotify support.
+type dirWatcher struct {
+	events chan string
+	errors chan error
+	stop   chan struct{}
+}
+
+type polledFile struct {
+	size    int64
+	modTime time.Time
+}
+
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	if _, err := os.ReadDir(dir); err != nil {
+		return nil, err
+	}
+	w := &dirWatcher{
+		events: make(chan string),
+		errors: make(chan error),
+		stop:   make(chan struct{}),
+	}
+	go w.poll(dir)
+	return w, nil
+}
+
+func (w *dirWatcher) poll(dir string) {
+	seen := map[string]polledFile{}
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			select {
+			case w.errors <- err:
+			case <-w.stop:
+				return
+			}
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			current := polledFile{size: info.Size(), modTime: info.ModTime()}
+			if previous, ok := seen[path]; ok && previous == current {
+				continue
+			}
+			seen[path] = current
+			select {
+			case w.events <- path:
+			case <-w.stop:
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *dirWatcher) close() error {
+	close(w.stop)
+	return nil
+}
+
+// fileLocked always reports false; only the size and modification time checks
+// apply on this platform.
+func fileLocked(path string) bool {
+	return false
+}
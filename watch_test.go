@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcessedLogPersists(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	first, err := openProcessedLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.contains("abc") {
+		t.Fatalf("new log should be empty")
+	}
+	if err := first.add(processedRecord{SHA256: "abc", OriginalPath: "scan.pdf", NewPath: "Invoice.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := openProcessedLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.contains("abc") {
+		t.Fatalf("reopened log lost processed hash")
+	}
+
+	other, err := openProcessedLog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.contains("abc") {
+		t.Fatalf("logs of different directories should be independent")
+	}
+}
+
+func TestInboxWatcherClaim(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	processed, err := openProcessedLog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := processed.add(processedRecord{SHA256: "done"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &inboxWatcher{processed: processed, pending: map[string]struct{}{}, inflight: map[string]string{}}
+	if !w.claim("a.pdf", "done") {
+		t.Errorf("already processed content should not be claimed")
+	}
+	if w.claim("b.pdf", "new") {
+		t.Errorf("new content should be claimed")
+	}
+	if !w.claim("copy-of-b.pdf", "new") {
+		t.Errorf("content already in flight should not be claimed twice")
+	}
+	if hash := w.release("b.pdf"); hash != "new" {
+		t.Errorf("release() = %q; want new", hash)
+	}
+}
+
+func TestWaitUntilStable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitUntilStable(context.Background(), path, 10*time.Millisecond); err != nil {
+		t.Fatalf("waitUntilStable returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitUntilStable(ctx, path, time.Second); err == nil {
+		t.Fatalf("expected error for cancelled context")
+	}
+}
+
+func TestDirWatcherReportsNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	watcher, err := newDirWatcher(dir)
+	if err != nil {
+		t.Fatalf("newDirWatcher returned error: %v", err)
+	}
+	defer watcher.close()
+
+	path := filepath.Join(dir, "scan.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-watcher.events:
+			if got == path {
+				return
+			}
+		case err := <-watcher.errors:
+			t.Fatalf("watcher error: %v", err)
+		case <-timeout:
+			t.Fatalf("no event received for %s", path)
+		}
+	}
+}